@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/guohuiyuan/go-music-dl/internal/web"
+	"github.com/spf13/cobra"
+)
+
+var importName string
+var importOnline bool
+
+var importCmd = &cobra.Command{
+	Use:   "import <歌单文件>",
+	Short: "把 M3U / M3U8 / XSPF / PLS 歌单文件导入为本地自建歌单",
+	Long: `读取其他播放器导出的歌单文件，按顺序匹配本地音乐：
+先按文件路径（相对路径以歌单文件所在目录为准），再按歌名 / 歌手匹配本地音乐索引，
+使用 --online 时仍未匹配的歌曲会在线搜索。匹配结果保存为新的自建歌单。`,
+	Example: `  music-dl import ~/Music/通勤.m3u8
+  music-dl import old.xspf -n 老歌 --online`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Println("❌ 读取歌单文件失败:", err)
+			os.Exit(1)
+		}
+		baseDir, _ := filepath.Abs(filepath.Dir(args[0]))
+
+		web.InitDB()
+		result, err := web.ImportPlaylistFile(filepath.Base(args[0]), data, web.PlaylistImportOptions{
+			Name:    importName,
+			BaseDir: baseDir,
+			Online:  importOnline,
+		})
+		if result != nil {
+			for _, entry := range result.Unmatched {
+				label := entry.Title
+				if entry.Artist != "" {
+					label = entry.Artist + " - " + entry.Title
+				}
+				fmt.Printf("⚠ 未匹配 #%d: %s (%s)\n", entry.Index, label, entry.Location)
+			}
+		}
+		if err != nil {
+			fmt.Println("❌ 导入失败:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ 已导入歌单「%s」\n", result.Name)
+		fmt.Printf("共 %d 首：路径匹配 %d，歌名匹配 %d，在线匹配 %d，重复 %d，未匹配 %d\n",
+			result.Total, result.ByPath, result.ByTag, result.Online, result.Duplicate, len(result.Unmatched))
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVarP(&importName, "name", "n", "", "歌单名称 (默认使用歌单文件中的标题或文件名)")
+	importCmd.Flags().BoolVar(&importOnline, "online", false, "本地未找到的歌曲在线搜索匹配")
+	rootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/guohuiyuan/go-music-dl/internal/web"
+	"github.com/spf13/cobra"
+)
+
+var playlistFormats string
+var playlistOutDir string
+
+var playlistCmd = &cobra.Command{
+	Use:   "playlist <歌单ID或名称>",
+	Short: "为本地自建歌单生成 M3U8 / XSPF / PLS 歌单文件",
+	Long: `按歌单顺序把自建歌单里已保存到本地的歌曲写成歌单文件。
+歌曲与本地音乐索引匹配，文件默认写在这些歌曲共同所在的目录，路径为相对路径。`,
+	Example: `  music-dl playlist 通勤
+  music-dl playlist 3 -f m3u8,xspf,pls -o /sdcard/Music`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		web.InitDB()
+		result, err := web.ExportCollectionPlaylist(args[0], playlistFormats, playlistOutDir)
+		if result != nil {
+			for _, missing := range result.Missing {
+				fmt.Println("⚠ 未找到本地文件:", missing)
+			}
+		}
+		if err != nil {
+			fmt.Println("❌ 生成歌单文件失败:", err)
+			os.Exit(1)
+		}
+		for _, file := range result.Files {
+			fmt.Println("✅", file)
+		}
+		fmt.Printf("共 %d 首，缺失 %d 首\n", result.Entries, len(result.Missing))
+	},
+}
+
+func init() {
+	playlistCmd.Flags().StringVarP(&playlistFormats, "formats", "f", "", "歌单文件格式，逗号分隔: m3u8, xspf, pls (默认使用设置)")
+	playlistCmd.Flags().StringVarP(&playlistOutDir, "outdir", "o", "", "歌单文件目录 (默认写在歌曲所在目录)")
+	rootCmd.AddCommand(playlistCmd)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 	"github.com/guohuiyuan/go-music-dl/internal/cli"
 )
 
@@ -19,6 +20,7 @@ var (
 	outDir      string
 	withCover   bool
 	withLyrics  bool
+	lyricFormat string
 )
 
 var rootCmd = &cobra.Command{
@@ -42,7 +44,8 @@ var rootCmd = &cobra.Command{
   - Web 网页版界面 (使用 'music-dl web' 启动)
   - 支持下载高品质音频 (部分源支持无损)
   - 自动下载封面图片 (需开启 --cover)
-  - 自动下载 LRC 歌词 (需开启 --lyrics)`,
+  - 自动下载 LRC 歌词 (需开启 --lyrics)
+  - 歌词另存为 LRC/增强 LRC/SRT/WebVTT/ASS 文件 (使用 --lyric-format)`,
 	Example: `  # 1. 基础搜索 (默认搜索所有源)
   music-dl -k "周杰伦"
 
@@ -52,10 +55,13 @@ var rootCmd = &cobra.Command{
   # 3. 全功能下载 (指定目录 + 封面 + 歌词)
   music-dl -k "陈奕迅" -o "MyMusic" --cover --lyrics
 
-  # 4. 启动 Web 界面
+  # 4. 同时保存 SRT 字幕格式的歌词文件
+  music-dl -k "陈奕迅" --lyric-format srt
+
+  # 5. 启动 Web 界面
   music-dl web
 
-  # 5. 直接进入 TUI 交互模式 (不带参数)
+  # 6. 直接进入 TUI 交互模式 (不带参数)
   music-dl`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if showVersion {
@@ -79,8 +85,18 @@ var rootCmd = &cobra.Command{
 			return
 		}
 
+		var format lyrics.Format
+		if lyricFormat != "" {
+			parsed, err := lyrics.ParseFormat(lyricFormat)
+			if err != nil {
+				fmt.Println("❌ 不支持的歌词格式:", lyricFormat, "(可选 lrc, elrc, srt, vtt, ass)")
+				return
+			}
+			format = parsed
+		}
+
 		// 启动 TUI 界面
-		cli.StartUI(keyword, sources, outDir, withCover, withLyrics)
+		cli.StartUI(keyword, sources, outDir, withCover, withLyrics, format)
 	},
 }
 
@@ -96,4 +112,5 @@ func init() {
 	rootCmd.Flags().StringVarP(&outDir, "outdir", "o", "data/downloads", "指定下载目录")
 	rootCmd.Flags().BoolVar(&withCover, "cover", true, "同时下载封面图片 (默认开启，使用 --cover=false 关闭)")
 	rootCmd.Flags().BoolVarP(&withLyrics, "lyrics", "l", true, "同时下载歌词 (默认开启，使用 --lyrics=false 关闭)")
+	rootCmd.Flags().StringVar(&lyricFormat, "lyric-format", "", "额外保存歌词文件的格式: lrc, elrc, srt, vtt, ass (默认不保存)")
 }
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrAudioIntegrity is matched by errors.Is for every download rejected by the
+// post-fetch verification, so callers can tell broken payloads from transport errors.
+var ErrAudioIntegrity = errors.New("audio integrity check failed")
+
+// AudioIntegrityError carries the human-readable reason a payload was rejected.
+type AudioIntegrityError struct {
+	Reason string
+}
+
+func (e *AudioIntegrityError) Error() string {
+	return ErrAudioIntegrity.Error() + ": " + e.Reason
+}
+
+func (e *AudioIntegrityError) Unwrap() error {
+	return ErrAudioIntegrity
+}
+
+func newAudioIntegrityError(format string, args ...interface{}) error {
+	return &AudioIntegrityError{Reason: fmt.Sprintf(format, args...)}
+}
+
+var errFFprobeUnavailable = errors.New("ffprobe not found")
+
+// probeAudioDuration is replaced in tests so the duration check does not need ffprobe.
+var probeAudioDuration = ffprobeAudioDuration
+
+// VerifyDownloadedAudio checks a fetched payload before it is tagged or saved.
+// expectedSize is the Content-Length or Content-Range total; values <= 0 skip
+// the byte count check.
+func VerifyDownloadedAudio(data []byte, contentType string, expectedSize int64) error {
+	if len(data) == 0 {
+		return newAudioIntegrityError("empty response body")
+	}
+	if expectedSize > 0 && int64(len(data)) != expectedSize {
+		return newAudioIntegrityError("received %d of %d bytes", len(data), expectedSize)
+	}
+
+	if kind := textPayloadKind(data, contentType); kind != "" {
+		return newAudioIntegrityError("upstream returned %s instead of audio", kind)
+	}
+
+	ext := DetectAudioExtBySignature(data)
+	if ext == "" {
+		if DetectAudioExtByContentType(contentType) == "" {
+			return newAudioIntegrityError("unrecognized audio container")
+		}
+		return nil
+	}
+	return validateAudioContainer(ext, data)
+}
+
+// VerifyAudioDuration decodes the payload with ffprobe and compares its length
+// with the duration reported by the source. A missing ffprobe or an unknown
+// expected duration skips the check.
+func VerifyAudioDuration(data []byte, ext string, expectedSeconds int) error {
+	if expectedSeconds <= 0 || len(data) == 0 {
+		return nil
+	}
+	seconds, err := probeAudioDuration(data, ext)
+	if err != nil {
+		if errors.Is(err, errFFprobeUnavailable) {
+			return nil
+		}
+		return newAudioIntegrityError("ffprobe could not decode audio: %v", err)
+	}
+	if seconds <= 0 {
+		return newAudioIntegrityError("ffprobe reported no playable duration")
+	}
+	if !IsDurationClose(expectedSeconds, seconds) {
+		return newAudioIntegrityError("duration %ds differs from expected %ds", seconds, expectedSeconds)
+	}
+	return nil
+}
+
+func textPayloadKind(data []byte, contentType string) string {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	switch {
+	case strings.HasPrefix(contentType, "text/html"):
+		return "an HTML page"
+	case strings.Contains(contentType, "json"):
+		return "a JSON document"
+	}
+
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	head = bytes.TrimLeft(head, "\xef\xbb\xbf \t\r\n")
+	lower := bytes.ToLower(head)
+	switch {
+	case bytes.HasPrefix(lower, []byte("<!doctype html")), bytes.HasPrefix(lower, []byte("<html")):
+		return "an HTML page"
+	case bytes.HasPrefix(lower, []byte("<?xml")):
+		return "an XML document"
+	case bytes.HasPrefix(head, []byte("{")) || bytes.HasPrefix(head, []byte("[")):
+		if DetectAudioExtBySignature(data) == "" && strings.HasPrefix(http.DetectContentType(head), "text/") {
+			return "a JSON document"
+		}
+	}
+	return ""
+}
+
+func validateAudioContainer(ext string, data []byte) error {
+	switch ext {
+	case "flac":
+		// "fLaC" + metadata block header + 34-byte STREAMINFO.
+		if len(data) < 42 {
+			return newAudioIntegrityError("truncated FLAC header")
+		}
+		if data[4]&0x7F != 0 {
+			return newAudioIntegrityError("FLAC stream does not start with STREAMINFO")
+		}
+	case "mp3":
+		if len(data) >= 10 && string(data[:3]) == "ID3" {
+			tagSize, ok := decodeID3SynchsafeSize(data[6:10])
+			if !ok {
+				return newAudioIntegrityError("malformed ID3 tag header")
+			}
+			if 10+tagSize >= len(data) {
+				return newAudioIntegrityError("ID3 tag leaves no audio frames")
+			}
+		}
+	case "m4a":
+		boxSize := binary.BigEndian.Uint32(data[:4])
+		if boxSize < 8 || int64(boxSize) > int64(len(data)) {
+			return newAudioIntegrityError("malformed MP4 ftyp box")
+		}
+	case "ogg":
+		if len(data) < 27 {
+			return newAudioIntegrityError("truncated Ogg page header")
+		}
+	}
+	return nil
+}
+
+func ffprobeAudioDuration(data []byte, ext string) (int, error) {
+	ffprobePath, err := ResolveFFprobePath()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errFFprobeUnavailable, err)
+	}
+
+	ext = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+	if ext == "" {
+		ext = DetectAudioExt(data)
+	}
+	file, err := os.CreateTemp("", "gomusicdl-verify-*."+ext)
+	if err != nil {
+		return 0, err
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return 0, err
+	}
+	file.Close()
+
+	cmd := exec.Command(ffprobePath, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ffprobe output %q", strings.TrimSpace(string(out)))
+	}
+	return int(value + 0.5), nil
+}
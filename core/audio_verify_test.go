@@ -0,0 +1,66 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVerifyDownloadedAudio(t *testing.T) {
+	flac := append([]byte{'f', 'L', 'a', 'C', 0x80, 0x00, 0x00, 0x22}, bytes.Repeat([]byte{0}, 64)...)
+	mp3 := append([]byte{'I', 'D', '3', 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00}, []byte{0xFF, 0xFB, 0x90, 0x00}...)
+
+	tests := []struct {
+		name         string
+		data         []byte
+		contentType  string
+		expectedSize int64
+		wantErr      bool
+	}{
+		{name: "valid flac", data: flac, contentType: "audio/flac", expectedSize: int64(len(flac))},
+		{name: "unknown size", data: mp3, contentType: "audio/mpeg", expectedSize: -1},
+		{name: "empty body", data: nil, contentType: "audio/mpeg", wantErr: true},
+		{name: "truncated", data: flac[:50], contentType: "audio/flac", expectedSize: int64(len(flac)), wantErr: true},
+		{name: "html error page", data: []byte("<!DOCTYPE html><html><body>403</body></html>"), contentType: "text/html", wantErr: true},
+		{name: "json error", data: []byte(`{"code":403,"msg":"forbidden"}`), contentType: "application/octet-stream", wantErr: true},
+		{name: "unknown container", data: []byte("definitely not audio"), contentType: "application/octet-stream", wantErr: true},
+		{name: "id3 without frames", data: mp3[:12], contentType: "audio/mpeg", wantErr: true},
+		{name: "flac missing streaminfo", data: append([]byte{'f', 'L', 'a', 'C', 0x04}, bytes.Repeat([]byte{0}, 64)...), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifyDownloadedAudio(tc.data, tc.contentType, tc.expectedSize)
+			if tc.wantErr {
+				if !errors.Is(err, ErrAudioIntegrity) {
+					t.Fatalf("VerifyDownloadedAudio() error = %v, want ErrAudioIntegrity", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyDownloadedAudio() unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAudioDuration(t *testing.T) {
+	original := probeAudioDuration
+	defer func() { probeAudioDuration = original }()
+
+	probeAudioDuration = func(data []byte, ext string) (int, error) { return 31, nil }
+	if err := VerifyAudioDuration([]byte("x"), "mp3", 240); !errors.Is(err, ErrAudioIntegrity) {
+		t.Fatalf("preview-length audio should fail duration check, got %v", err)
+	}
+	if err := VerifyAudioDuration([]byte("x"), "mp3", 30); err != nil {
+		t.Fatalf("matching duration should pass, got %v", err)
+	}
+	if err := VerifyAudioDuration([]byte("x"), "mp3", 0); err != nil {
+		t.Fatalf("unknown expected duration should skip check, got %v", err)
+	}
+
+	probeAudioDuration = func(data []byte, ext string) (int, error) { return 0, errFFprobeUnavailable }
+	if err := VerifyAudioDuration([]byte("x"), "mp3", 240); err != nil {
+		t.Fatalf("missing ffprobe should skip check, got %v", err)
+	}
+}
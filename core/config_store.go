@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/glebarez/sqlite"
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -23,6 +24,9 @@ const (
 	DefaultWebConcurrency           = 3
 	DefaultUpdateRepoURL            = "https://github.com/guohuiyuan/go-music-dl"
 	DefaultGithubProxyURL           = "https://edgeone.gh-proxy.com"
+	DefaultTrashRetentionDays       = 30
+	maxTrashRetentionDays           = 3650
+	DefaultID3Version               = 3
 	webSettingsKey                  = "web_settings"
 	webAuthSettingsKey              = "web_auth_settings"
 )
@@ -40,24 +44,37 @@ type cookieEntry struct {
 }
 
 type WebSettings struct {
-	EmbedDownload            bool   `json:"embedDownload"`
-	DownloadToLocal          bool   `json:"downloadToLocal"`
-	DownloadDir              string `json:"downloadDir"`
-	DownloadFilenameTemplate string `json:"downloadFilenameTemplate"`
-	DisableFloatingLyrics    bool   `json:"disableFloatingLyrics"`
-	WebPageSize              int    `json:"webPageSize"`
-	CliPageSize              int    `json:"cliPageSize"`
-	DownloadConcurrency      int    `json:"downloadConcurrency"`
-	AutoCheckUpdate          bool   `json:"autoCheckUpdate"`
-	AutoSwitchInvalidSources bool   `json:"autoSwitchInvalidSources"`
-	AutoCacheOnPlay          bool   `json:"autoCacheOnPlay"`
-	UpdateRepoURL            string `json:"updateRepoUrl"`
-	GithubProxyEnabled       bool   `json:"githubProxyEnabled"`
-	GithubProxyURL           string `json:"githubProxyUrl"`
-	VgChangeCover            bool   `json:"vgChangeCover"`
-	VgChangeAudio            bool   `json:"vgChangeAudio"`
-	VgChangeLyric            bool   `json:"vgChangeLyric"`
-	VgExportVideo            bool   `json:"vgExportVideo"`
+	EmbedDownload            bool            `json:"embedDownload"`
+	DownloadToLocal          bool            `json:"downloadToLocal"`
+	DownloadDir              string          `json:"downloadDir"`
+	DownloadFilenameTemplate string          `json:"downloadFilenameTemplate"`
+	DisableFloatingLyrics    bool            `json:"disableFloatingLyrics"`
+	WebPageSize              int             `json:"webPageSize"`
+	CliPageSize              int             `json:"cliPageSize"`
+	DownloadConcurrency      int             `json:"downloadConcurrency"`
+	AutoCheckUpdate          bool            `json:"autoCheckUpdate"`
+	AutoSwitchInvalidSources bool            `json:"autoSwitchInvalidSources"`
+	AutoCacheOnPlay          bool            `json:"autoCacheOnPlay"`
+	UpdateRepoURL            string          `json:"updateRepoUrl"`
+	GithubProxyEnabled       bool            `json:"githubProxyEnabled"`
+	GithubProxyURL           string          `json:"githubProxyUrl"`
+	VgChangeCover            bool            `json:"vgChangeCover"`
+	VgChangeAudio            bool            `json:"vgChangeAudio"`
+	VgChangeLyric            bool            `json:"vgChangeLyric"`
+	VgExportVideo            bool            `json:"vgExportVideo"`
+	VerifyDownloadDuration   bool            `json:"verifyDownloadDuration"`
+	ID3Version               int             `json:"id3Version"`
+	CoverMaxSize             int             `json:"coverMaxSize"`
+	CoverJPEGQuality         int             `json:"coverJpegQuality"`
+	CoverSidecar             string          `json:"coverSidecar"`
+	LyricDownloadFormat      string          `json:"lyricDownloadFormat"`
+	LyricMode                string          `json:"lyricMode"`
+	LyricRomanization        bool            `json:"lyricRomanization"`
+	DownloadRoutes           []DownloadRoute `json:"downloadRoutes"`
+	PlaylistFileFormats      string          `json:"playlistFileFormats"`
+	SchedulerInDesktop       bool            `json:"schedulerInDesktop"`
+	WriteRatingTags          bool            `json:"writeRatingTags"`
+	TrashRetentionDays       int             `json:"trashRetentionDays"`
 }
 
 type WebAuthSettings struct {
@@ -105,7 +122,7 @@ func ensureConfigDB() error {
 			return
 		}
 
-		if err := db.AutoMigrate(&configKV{}, &cookieEntry{}, &DownloadRecord{}); err != nil {
+		if err := db.AutoMigrate(&configKV{}, &cookieEntry{}, &DownloadRecord{}, &SongOverride{}); err != nil {
 			configInitErr = err
 			return
 		}
@@ -190,9 +207,11 @@ func normalizeWebSettings(settings WebSettings) WebSettings {
 		settings.DownloadDir = DefaultWebDownloadDir
 	}
 	settings.DownloadFilenameTemplate = strings.TrimSpace(settings.DownloadFilenameTemplate)
-	if settings.DownloadFilenameTemplate == "" {
+	if _, err := ParseFilenameTemplate(settings.DownloadFilenameTemplate); err != nil || settings.DownloadFilenameTemplate == "" {
 		settings.DownloadFilenameTemplate = DefaultDownloadFilenameTemplate
 	}
+	settings.DownloadRoutes = normalizeDownloadRoutes(settings.DownloadRoutes)
+	settings.PlaylistFileFormats = normalizePlaylistFileFormats(settings.PlaylistFileFormats)
 	if settings.WebPageSize <= 0 {
 		settings.WebPageSize = DefaultWebPageSize
 	}
@@ -216,6 +235,32 @@ func normalizeWebSettings(settings WebSettings) WebSettings {
 	if settings.GithubProxyURL == "" {
 		settings.GithubProxyURL = DefaultGithubProxyURL
 	}
+	if settings.ID3Version != 4 {
+		settings.ID3Version = DefaultID3Version
+	}
+	if settings.CoverMaxSize <= 0 {
+		settings.CoverMaxSize = DefaultCoverMaxSize
+	}
+	settings.CoverMaxSize = min(max(settings.CoverMaxSize, minCoverMaxSize), maxCoverMaxSize)
+	if settings.CoverJPEGQuality <= 0 {
+		settings.CoverJPEGQuality = DefaultCoverJPEGQuality
+	}
+	settings.CoverJPEGQuality = min(max(settings.CoverJPEGQuality, minCoverJPEGQuality), 100)
+	settings.CoverSidecar = normalizeCoverSidecar(settings.CoverSidecar)
+	if settings.TrashRetentionDays <= 0 {
+		settings.TrashRetentionDays = DefaultTrashRetentionDays
+	}
+	settings.TrashRetentionDays = min(settings.TrashRetentionDays, maxTrashRetentionDays)
+	if format, err := lyrics.ParseFormat(settings.LyricDownloadFormat); err == nil {
+		settings.LyricDownloadFormat = string(format)
+	} else {
+		settings.LyricDownloadFormat = string(lyrics.FormatLRC)
+	}
+	if mode, err := lyrics.ParseMode(settings.LyricMode); err == nil {
+		settings.LyricMode = string(mode)
+	} else {
+		settings.LyricMode = string(lyrics.ModeStacked)
+	}
 	settings.DownloadDir = normalizeWebDownloadDir(settings.DownloadDir)
 	return settings
 }
@@ -140,6 +140,36 @@ func TestWebSettingsDefaultAndPersist(t *testing.T) {
 	if defaults.VgExportVideo {
 		t.Fatalf("default VgExportVideo should be false")
 	}
+	if defaults.VerifyDownloadDuration {
+		t.Fatalf("default VerifyDownloadDuration should be false")
+	}
+	if defaults.ID3Version != DefaultID3Version {
+		t.Fatalf("default ID3Version = %d, want %d", defaults.ID3Version, DefaultID3Version)
+	}
+	if defaults.CoverMaxSize != DefaultCoverMaxSize || defaults.CoverJPEGQuality != DefaultCoverJPEGQuality {
+		t.Fatalf("default cover options = %d/%d, want %d/%d", defaults.CoverMaxSize, defaults.CoverJPEGQuality, DefaultCoverMaxSize, DefaultCoverJPEGQuality)
+	}
+	if defaults.TrashRetentionDays != DefaultTrashRetentionDays {
+		t.Fatalf("default TrashRetentionDays = %d, want %d", defaults.TrashRetentionDays, DefaultTrashRetentionDays)
+	}
+	if defaults.CoverSidecar != "" {
+		t.Fatalf("default CoverSidecar should be empty, got %q", defaults.CoverSidecar)
+	}
+	if defaults.LyricDownloadFormat != "lrc" {
+		t.Fatalf("default LyricDownloadFormat = %q, want lrc", defaults.LyricDownloadFormat)
+	}
+	if defaults.LyricMode != "stacked" {
+		t.Fatalf("default LyricMode = %q, want stacked", defaults.LyricMode)
+	}
+	if defaults.LyricRomanization {
+		t.Fatalf("default LyricRomanization should be false")
+	}
+	if defaults.PlaylistFileFormats != DefaultPlaylistFileFormats {
+		t.Fatalf("default PlaylistFileFormats = %q, want %q", defaults.PlaylistFileFormats, DefaultPlaylistFileFormats)
+	}
+	if defaults.SchedulerInDesktop {
+		t.Fatalf("default SchedulerInDesktop should be false")
+	}
 
 	if err := SaveWebSettings(WebSettings{
 		EmbedDownload:            true,
@@ -160,6 +190,21 @@ func TestWebSettingsDefaultAndPersist(t *testing.T) {
 		VgChangeAudio:            true,
 		VgChangeLyric:            true,
 		VgExportVideo:            true,
+		VerifyDownloadDuration:   true,
+		ID3Version:               4,
+		CoverMaxSize:             800,
+		CoverJPEGQuality:         85,
+		CoverSidecar:             "folder.jpg",
+		LyricDownloadFormat:      "srt",
+		LyricMode:                "side_by_side",
+		LyricRomanization:        true,
+		DownloadRoutes: []DownloadRoute{
+			{Name: "无损", Format: " .FLAC, wav ", Dir: "Lossless/../"},
+			{Name: "empty", Dir: "Other"},
+		},
+		PlaylistFileFormats: " XSPF, m3u, xspf ",
+		SchedulerInDesktop:  true,
+		TrashRetentionDays:  7,
 	}); err != nil {
 		t.Fatalf("save web settings: %v", err)
 	}
@@ -184,6 +229,18 @@ func TestWebSettingsDefaultAndPersist(t *testing.T) {
 		VgChangeAudio:            true,
 		VgChangeLyric:            true,
 		VgExportVideo:            true,
+		VerifyDownloadDuration:   true,
+		ID3Version:               4,
+		CoverMaxSize:             800,
+		CoverJPEGQuality:         85,
+		CoverSidecar:             "folder.jpg",
+		LyricDownloadFormat:      "srt",
+		LyricMode:                "side_by_side",
+		LyricRomanization:        true,
+		DownloadRoutes:           []DownloadRoute{{Name: "无损", Format: "flac,wav", Dir: "Lossless"}},
+		PlaylistFileFormats:      "xspf,m3u8",
+		SchedulerInDesktop:       true,
+		TrashRetentionDays:       7,
 	}
 	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("saved settings mismatch\ngot:  %#v\nwant: %#v", got, want)
@@ -191,7 +248,8 @@ func TestWebSettingsDefaultAndPersist(t *testing.T) {
 
 	customDir := filepath.Join("downloads", "custom")
 	if err := SaveWebSettings(WebSettings{
-		DownloadDir: customDir,
+		DownloadDir:              customDir,
+		DownloadFilenameTemplate: "{if album}{album}/{name}",
 	}); err != nil {
 		t.Fatalf("save custom download dir: %v", err)
 	}
@@ -233,6 +291,21 @@ func TestWebSettingsDefaultAndPersist(t *testing.T) {
 	if got.GithubProxyURL != DefaultGithubProxyURL {
 		t.Fatalf("custom save should fallback GithubProxyURL to default: got %q want %q", got.GithubProxyURL, DefaultGithubProxyURL)
 	}
+	if got.ID3Version != DefaultID3Version {
+		t.Fatalf("custom save should fallback ID3Version to default: got %d want %d", got.ID3Version, DefaultID3Version)
+	}
+	if got.LyricDownloadFormat != "lrc" {
+		t.Fatalf("custom save should fallback LyricDownloadFormat to lrc: got %q", got.LyricDownloadFormat)
+	}
+	if got.LyricMode != "stacked" {
+		t.Fatalf("custom save should fallback LyricMode to stacked: got %q", got.LyricMode)
+	}
+	if got.PlaylistFileFormats != DefaultPlaylistFileFormats {
+		t.Fatalf("custom save should fallback PlaylistFileFormats to default: got %q", got.PlaylistFileFormats)
+	}
+	if got.CoverMaxSize != DefaultCoverMaxSize || got.CoverJPEGQuality != DefaultCoverJPEGQuality || got.CoverSidecar != "" {
+		t.Fatalf("custom save should fallback cover options to default: %#v", got)
+	}
 	if got.VgChangeCover || got.VgChangeAudio || got.VgChangeLyric || got.VgExportVideo {
 		t.Fatalf("custom save should fallback video generator settings to default false: %#v", got)
 	}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// 封面处理（高清地址 / 缩放 / 重新编码 / 目录封面）
+// ==========================================
+
+const (
+	DefaultCoverMaxSize     = 1200
+	DefaultCoverJPEGQuality = 90
+	minCoverMaxSize         = 100
+	maxCoverMaxSize         = 4000
+	minCoverJPEGQuality     = 30
+
+	CoverSidecarFolder = "folder.jpg"
+	CoverSidecarCover  = "cover.jpg"
+)
+
+var (
+	qqCoverSizeRe      = regexp.MustCompile(`(T00[12]R)\d+x\d+(M000)`)
+	kugouCoverSizeRe   = regexp.MustCompile(`/stdmusic/\d+/`)
+	sodaCoverSizeRe    = regexp.MustCompile(`~c5_\d+x\d+`)
+	appleCoverSizeRe   = regexp.MustCompile(`/\d+x\d+(bb|cc|sr)?\.(jpg|jpeg|png|webp)$`)
+	kuwoCoverSizeRe    = regexp.MustCompile(`/albumcover/\d+/`)
+	jooxCoverSizeRe    = regexp.MustCompile(`/mid_album_\d+/`)
+	neteaseCoverHostRe = regexp.MustCompile(`(^|\.)music\.126\.net$`)
+)
+
+// CoverOptions controls how cover art is resized and re-encoded.
+type CoverOptions struct {
+	MaxSize int // longest edge in pixels
+	Quality int // JPEG quality, 1-100
+}
+
+func normalizeCoverOptions(opts CoverOptions) CoverOptions {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultCoverMaxSize
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = DefaultCoverJPEGQuality
+	}
+	if opts.Quality > 100 {
+		opts.Quality = 100
+	}
+	return opts
+}
+
+// normalizeCoverSidecar keeps only the supported sidecar file names.
+func normalizeCoverSidecar(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case CoverSidecarFolder:
+		return CoverSidecarFolder
+	case CoverSidecarCover:
+		return CoverSidecarCover
+	default:
+		return ""
+	}
+}
+
+// HighResCoverURL rewrites the size parameter of known cover CDNs so the image
+// is requested at about size pixels. Unknown URLs are returned unchanged.
+func HighResCoverURL(rawURL string, size int) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	if size <= 0 {
+		size = DefaultCoverMaxSize
+	}
+	px := strconv.Itoa(size)
+
+	switch {
+	case qqCoverSizeRe.MatchString(rawURL):
+		qqSize := coverSizeStep(size, 500, 800)
+		return qqCoverSizeRe.ReplaceAllString(rawURL, "${1}"+qqSize+"x"+qqSize+"${2}")
+	case strings.Contains(rawURL, "{size}"):
+		return strings.ReplaceAll(rawURL, "{size}", coverSizeStep(size, kugouCoverSizes...))
+	case kugouCoverSizeRe.MatchString(rawURL):
+		return kugouCoverSizeRe.ReplaceAllString(rawURL, "/stdmusic/"+coverSizeStep(size, kugouCoverSizes...)+"/")
+	case sodaCoverSizeRe.MatchString(rawURL):
+		return sodaCoverSizeRe.ReplaceAllString(rawURL, "~c5_"+px+"x"+px)
+	case strings.Contains(rawURL, "mzstatic.com") && appleCoverSizeRe.MatchString(rawURL):
+		return appleCoverSizeRe.ReplaceAllString(rawURL, "/"+px+"x"+px+"bb.jpg")
+	case kuwoCoverSizeRe.MatchString(rawURL):
+		return kuwoCoverSizeRe.ReplaceAllString(rawURL, "/albumcover/"+coverSizeStep(size, 120, 300, 500)+"/")
+	case jooxCoverSizeRe.MatchString(rawURL):
+		return jooxCoverSizeRe.ReplaceAllString(rawURL, "/mid_album_"+coverSizeStep(size, 300, 500)+"/")
+	}
+
+	if parsed, err := url.Parse(rawURL); err == nil && neteaseCoverHostRe.MatchString(parsed.Hostname()) {
+		query := parsed.Query()
+		query.Set("param", px+"y"+px)
+		parsed.RawQuery = query.Encode()
+		return parsed.String()
+	}
+	return rawURL
+}
+
+// kugouCoverSizes are the edge lengths the Kugou image CDN serves.
+var kugouCoverSizes = []int{150, 240, 400, 480}
+
+// coverSizeStep picks, from the ascending sizes a CDN serves, the smallest one
+// that still covers size, or the largest one when size exceeds them all.
+func coverSizeStep(size int, steps ...int) string {
+	for _, step := range steps {
+		if step >= size {
+			return strconv.Itoa(step)
+		}
+	}
+	return strconv.Itoa(steps[len(steps)-1])
+}
+
+// FetchSongCover downloads the largest cover variant the source offers and
+// falls back to the original URL when the rewritten one does not return an
+// image. The result is processed with ProcessCoverImage.
+func FetchSongCover(coverURL string, source string, opts CoverOptions) ([]byte, string, error) {
+	coverURL = strings.TrimSpace(coverURL)
+	if coverURL == "" {
+		return nil, "", errors.New("empty cover url")
+	}
+	opts = normalizeCoverOptions(opts)
+
+	var data []byte
+	var mime string
+	var err error
+	if highRes := HighResCoverURL(coverURL, opts.MaxSize); highRes != coverURL {
+		data, mime, err = FetchBytesWithMime(highRes, source)
+		if err != nil || !isImageData(data) {
+			data = nil
+		}
+	}
+	if data == nil {
+		data, mime, err = FetchBytesWithMime(coverURL, source)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return ProcessCoverImage(data, mime, opts)
+}
+
+func isImageData(data []byte) bool {
+	return len(data) > 0 && strings.HasPrefix(http.DetectContentType(data), "image/")
+}
+
+// ProcessCoverImage downscales covers larger than opts.MaxSize and re-encodes
+// them as JPEG. JPEG covers that already fit are kept byte for byte; formats
+// the standard library cannot decode (e.g. WebP) are returned unchanged.
+func ProcessCoverImage(data []byte, mime string, opts CoverOptions) ([]byte, string, error) {
+	if len(data) == 0 {
+		return nil, "", errors.New("empty cover data")
+	}
+	opts = normalizeCoverOptions(opts)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, normalizeCoverMime(mime), nil
+	}
+	if format == "jpeg" && cfg.Width <= opts.MaxSize && cfg.Height <= opts.MaxSize {
+		return data, "image/jpeg", nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, normalizeCoverMime(mime), nil
+	}
+	width, height := fitCoverSize(cfg.Width, cfg.Height, opts.MaxSize)
+	resized := resizeCoverImage(src, width, height)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: opts.Quality}); err != nil {
+		return nil, "", fmt.Errorf("encode cover: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+func fitCoverSize(width, height, maxSize int) (int, int) {
+	if width <= maxSize && height <= maxSize {
+		return width, height
+	}
+	if width >= height {
+		return maxSize, max(1, height*maxSize/width)
+	}
+	return max(1, width*maxSize/height), maxSize
+}
+
+// resizeCoverImage flattens transparency onto white and resamples with an area
+// average, which keeps downscaled artwork free of aliasing. Source rows are
+// flattened one at a time and folded into the output row they cover, so only a
+// row of each is held in memory besides the result.
+func resizeCoverImage(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	white := &image.Uniform{C: color.White}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if bounds.Dx() == width && bounds.Dy() == height {
+		draw.Draw(dst, dst.Bounds(), white, image.Point{}, draw.Src)
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+		return dst
+	}
+
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	xWeights := areaWeights(srcW, width)
+	yWeights := areaWeights(srcH, height)
+
+	line := image.NewRGBA(image.Rect(0, 0, srcW, 1))
+	acc := make([]float64, width*3)
+	for y, rows := range yWeights {
+		clear(acc)
+		for _, row := range rows {
+			draw.Draw(line, line.Bounds(), white, image.Point{}, draw.Src)
+			draw.Draw(line, line.Bounds(), src, image.Pt(bounds.Min.X, bounds.Min.Y+row.index), draw.Over)
+			for x, weights := range xWeights {
+				var r, g, b float64
+				for _, w := range weights {
+					p := line.Pix[w.index*4:]
+					r += float64(p[0]) * w.weight
+					g += float64(p[1]) * w.weight
+					b += float64(p[2]) * w.weight
+				}
+				i := x * 3
+				acc[i] += r * row.weight
+				acc[i+1] += g * row.weight
+				acc[i+2] += b * row.weight
+			}
+		}
+		for x := 0; x < width; x++ {
+			i := x * 3
+			p := dst.Pix[y*dst.Stride+x*4:]
+			p[0], p[1], p[2], p[3] = clampColor(acc[i]), clampColor(acc[i+1]), clampColor(acc[i+2]), 0xFF
+		}
+	}
+	return dst
+}
+
+type resampleWeight struct {
+	index  int
+	weight float64
+}
+
+// areaWeights returns, for every destination pixel, the source pixels it covers
+// and the share of each one.
+func areaWeights(srcSize, dstSize int) [][]resampleWeight {
+	scale := float64(srcSize) / float64(dstSize)
+	out := make([][]resampleWeight, dstSize)
+	for i := range out {
+		start := float64(i) * scale
+		end := start + scale
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			overlap := min(end, float64(j+1)) - max(start, float64(j))
+			if overlap > 0 {
+				out[i] = append(out[i], resampleWeight{index: j, weight: overlap / scale})
+			}
+		}
+	}
+	return out
+}
+
+func clampColor(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// writeCoverSidecar stores the album cover next to the audio file once per
+// directory; an existing sidecar is left untouched.
+func writeCoverSidecar(dir string, name string, coverData []byte) error {
+	name = normalizeCoverSidecar(name)
+	if name == "" || len(coverData) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil
+		}
+		return err
+	}
+	if _, err := file.Write(coverData); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
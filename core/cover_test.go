@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHighResCoverURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "qq",
+			url:  "https://y.gtimg.cn/music/photo_new/T002R300x300M000abc.jpg",
+			want: "https://y.gtimg.cn/music/photo_new/T002R800x800M000abc.jpg",
+		},
+		{
+			name: "kugou",
+			url:  "http://imge.kugou.com/stdmusic/240/20200101/abc.jpg",
+			want: "http://imge.kugou.com/stdmusic/480/20200101/abc.jpg",
+		},
+		{
+			name: "kugou size placeholder",
+			url:  "http://imge.kugou.com/stdmusic/{size}/abc.jpg",
+			want: "http://imge.kugou.com/stdmusic/480/abc.jpg",
+		},
+		{
+			name: "soda",
+			url:  "https://p3-luna.douyinpic.com/img/tos-cn-v-2774c002/abc~c5_300x300.jpg",
+			want: "https://p3-luna.douyinpic.com/img/tos-cn-v-2774c002/abc~c5_1200x1200.jpg",
+		},
+		{
+			name: "apple",
+			url:  "https://is1-ssl.mzstatic.com/image/thumb/Music/v4/ab/cd/600x600bb.jpg",
+			want: "https://is1-ssl.mzstatic.com/image/thumb/Music/v4/ab/cd/1200x1200bb.jpg",
+		},
+		{
+			name: "netease",
+			url:  "https://p1.music.126.net/abc==/109951.jpg?param=300y300",
+			want: "https://p1.music.126.net/abc==/109951.jpg?param=1200y1200",
+		},
+		{
+			name: "kuwo",
+			url:  "http://img1.kuwo.cn/star/albumcover/120/12/34/abc.jpg",
+			want: "http://img1.kuwo.cn/star/albumcover/500/12/34/abc.jpg",
+		},
+		{
+			name: "unknown host unchanged",
+			url:  "https://example.com/cover.jpg?size=300",
+			want: "https://example.com/cover.jpg?size=300",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HighResCoverURL(tt.url, 1200); got != tt.want {
+				t.Fatalf("HighResCoverURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func testCoverImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xFF})
+		}
+	}
+	return img
+}
+
+func TestProcessCoverImageDownscalesPNGToJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testCoverImage(400, 200)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, mime, err := ProcessCoverImage(buf.Bytes(), "image/png", CoverOptions{MaxSize: 100, Quality: 80})
+	if err != nil {
+		t.Fatalf("ProcessCoverImage() error = %v", err)
+	}
+	if mime != "image/jpeg" {
+		t.Fatalf("mime = %q, want image/jpeg", mime)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode processed cover: %v", err)
+	}
+	if format != "jpeg" || cfg.Width != 100 || cfg.Height != 50 {
+		t.Fatalf("processed cover = %s %dx%d, want jpeg 100x50", format, cfg.Width, cfg.Height)
+	}
+}
+
+func TestProcessCoverImageKeepsSmallJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testCoverImage(64, 64), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, mime, err := ProcessCoverImage(buf.Bytes(), "", CoverOptions{MaxSize: 100})
+	if err != nil {
+		t.Fatalf("ProcessCoverImage() error = %v", err)
+	}
+	if mime != "image/jpeg" || !bytes.Equal(data, buf.Bytes()) {
+		t.Fatalf("small jpeg should be kept unchanged, mime = %q", mime)
+	}
+}
+
+func TestProcessCoverImagePassesThroughUnknownFormat(t *testing.T) {
+	raw := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+	data, mime, err := ProcessCoverImage(raw, "image/webp", CoverOptions{})
+	if err != nil {
+		t.Fatalf("ProcessCoverImage() error = %v", err)
+	}
+	if mime != "image/webp" || !bytes.Equal(data, raw) {
+		t.Fatalf("unknown format should pass through, mime = %q", mime)
+	}
+}
+
+func TestResizeCoverImageAveragesArea(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.NRGBA{R: 0xFF, A: 0xFF})
+	src.Set(1, 0, color.NRGBA{B: 0xFF, A: 0xFF})
+
+	got := resizeCoverImage(src, 1, 1).RGBAAt(0, 0)
+	want := color.RGBA{R: 0x80, B: 0x80, A: 0xFF}
+	if got != want {
+		t.Fatalf("resized pixel = %#v, want %#v", got, want)
+	}
+}
+
+func TestSaveDownloadedSongToFileWritesCoverSidecarOnce(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"01 a.mp3", "02 b.mp3"} {
+		result := &DownloadedSong{
+			Data:         []byte("audio"),
+			Filename:     filepath.Join("Artist", "Album", name),
+			sidecarCover: []byte{byte(i)},
+			sidecarName:  CoverSidecarFolder,
+		}
+		if _, err := saveDownloadedSongToFile(result, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "Artist", "Album", CoverSidecarFolder))
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	if !bytes.Equal(data, []byte{0}) {
+		t.Fatalf("sidecar = %v, want the first cover only", data)
+	}
+}
+
+func TestHighResCoverURLFollowsMaxSize(t *testing.T) {
+	tests := []struct {
+		url  string
+		size int
+		want string
+	}{
+		{"https://y.gtimg.cn/music/photo_new/T002R300x300M000abc.jpg", 300, "https://y.gtimg.cn/music/photo_new/T002R500x500M000abc.jpg"},
+		{"http://imge.kugou.com/stdmusic/{size}/abc.jpg", 200, "http://imge.kugou.com/stdmusic/240/abc.jpg"},
+		{"http://imge.kugou.com/stdmusic/480/20200101/abc.jpg", 150, "http://imge.kugou.com/stdmusic/150/20200101/abc.jpg"},
+		{"http://img1.kuwo.cn/star/albumcover/500/12/34/abc.jpg", 300, "http://img1.kuwo.cn/star/albumcover/300/12/34/abc.jpg"},
+		{"https://image.joox.com/JOOXcover/0/abc/mid_album_500/def.jpg", 200, "https://image.joox.com/JOOXcover/0/abc/mid_album_300/def.jpg"},
+	}
+
+	for _, tt := range tests {
+		if got := HighResCoverURL(tt.url, tt.size); got != tt.want {
+			t.Fatalf("HighResCoverURL(%q, %d) = %q, want %q", tt.url, tt.size, got, tt.want)
+		}
+	}
+}
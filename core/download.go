@@ -7,11 +7,15 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 	"github.com/guohuiyuan/music-lib/model"
 	"github.com/guohuiyuan/music-lib/soda"
 	"github.com/guohuiyuan/music-lib/utils"
 )
 
+// downloadSettingsProvider lets tests toggle download options without touching settings.db.
+var downloadSettingsProvider = GetWebSettings
+
 type DownloadedSong struct {
 	Data        []byte
 	Ext         string
@@ -19,7 +23,14 @@ type DownloadedSong struct {
 	Filename    string
 	SavedPath   string
 	Warning     string
-	Skipped     bool // 因已存在而跳过下载
+	Lyric       string // 下载时获取到的原始 LRC 歌词
+	Skipped     bool   // 因已存在而跳过下载
+	Route       string // 保存时命中的下载路由名称
+
+	// sidecarCover is written as sidecarName next to the saved file instead of
+	// being embedded; only set for downloads saved to disk.
+	sidecarCover []byte
+	sidecarName  string
 }
 
 func DownloadSongData(song *model.Song, withCover bool, withLyrics bool) (*DownloadedSong, error) {
@@ -27,6 +38,21 @@ func DownloadSongData(song *model.Song, withCover bool, withLyrics bool) (*Downl
 }
 
 func DownloadSongDataWithTemplate(song *model.Song, withCover bool, withLyrics bool, filenameTemplate string) (*DownloadedSong, error) {
+	return downloadSongData(song, withCover, withLyrics, fixedFilenameTemplate(filenameTemplate), false)
+}
+
+// filenameTemplateFunc picks the filename template once the song's overrides
+// are applied and its audio format is known.
+type filenameTemplateFunc func(song *model.Song, ext string) string
+
+func fixedFilenameTemplate(template string) filenameTemplateFunc {
+	return func(*model.Song, string) string { return template }
+}
+
+// downloadSongData fetches and tags the audio. When forSave is set and a cover
+// sidecar is configured, the cover is kept out of the file and returned for
+// saveDownloadedSongToFile to write once per album directory.
+func downloadSongData(song *model.Song, withCover bool, withLyrics bool, templateFor filenameTemplateFunc, forSave bool) (*DownloadedSong, error) {
 	if song == nil {
 		return nil, errors.New("song is nil")
 	}
@@ -35,6 +61,7 @@ func DownloadSongDataWithTemplate(song *model.Song, withCover bool, withLyrics b
 	}
 
 	normalized := *song
+	ApplySongOverride(&normalized)
 	normalized.Name = strings.TrimSpace(normalized.Name)
 	normalized.Artist = strings.TrimSpace(normalized.Artist)
 	normalized.Album = strings.TrimSpace(normalized.Album)
@@ -45,10 +72,13 @@ func DownloadSongDataWithTemplate(song *model.Song, withCover bool, withLyrics b
 		normalized.Artist = "Unknown"
 	}
 
-	audioData, contentType, err := fetchSongAudio(&normalized)
+	audioData, contentType, expectedSize, err := fetchSongAudio(&normalized)
 	if err != nil {
 		return nil, err
 	}
+	if err := VerifyDownloadedAudio(audioData, contentType, expectedSize); err != nil {
+		return nil, err
+	}
 
 	signatureExt := DetectAudioExtBySignature(audioData)
 	ext := signatureExt
@@ -58,24 +88,48 @@ func DownloadSongDataWithTemplate(song *model.Song, withCover bool, withLyrics b
 	if ext == "" {
 		ext = DetectAudioExt(audioData)
 	}
+	settings := downloadSettingsProvider()
+	if settings.VerifyDownloadDuration {
+		if err := VerifyAudioDuration(audioData, ext, normalized.Duration); err != nil {
+			return nil, err
+		}
+	}
 
 	var lyric string
 	if withLyrics {
-		if lyricFn := GetLyricFunc(normalized.Source); lyricFn != nil {
-			lyric, _ = lyricFn(&normalized)
+		if resolved, err := ResolveLyric(&normalized); err == nil {
+			lyric = resolved.Lyric
 		}
 	}
+	embedLyric := embeddedLyricForMode(lyric, settings.LyricMode)
 
 	var coverData []byte
 	var coverMime string
 	if withCover && strings.TrimSpace(normalized.Cover) != "" {
-		coverData, coverMime, _ = FetchBytesWithMime(normalized.Cover, normalized.Source)
+		coverData, coverMime, _ = FetchSongCover(normalized.Cover, normalized.Source, CoverOptions{
+			MaxSize: settings.CoverMaxSize,
+			Quality: settings.CoverJPEGQuality,
+		})
+	}
+
+	filename := BuildDownloadFilename(&normalized, ext, templateFor(&normalized, ext))
+	var sidecarCover []byte
+	sidecarName := ""
+	// A sidecar only makes sense when the template sorts files into their own
+	// directories; otherwise every song would share one folder.jpg.
+	if forSave && settings.CoverSidecar != "" && coverMime == "image/jpeg" && filepath.Dir(filename) != "." {
+		sidecarCover, sidecarName = coverData, settings.CoverSidecar
+		coverData, coverMime = nil, ""
 	}
 
 	finalData := audioData
 	warning := ""
-	if (ext == "mp3" || ext == "flac" || ext == "m4a" || ext == "wma") && (normalized.Album != "" || lyric != "" || len(coverData) > 0) {
-		embeddedData, embedErr := EmbedSongMetadata(audioData, &normalized, lyric, coverData, coverMime)
+	writeRating := settings.WriteRatingTags && SongRating(&normalized) > 0
+	if (ext == "mp3" || ext == "flac" || ext == "m4a" || ext == "wma") && (normalized.Album != "" || embedLyric != "" || len(coverData) > 0 || writeRating || SongAudioMetadata(&normalized).hasExtendedTags()) {
+		embeddedData, embedErr := EmbedSongMetadataWithOptions(audioData, &normalized, embedLyric, coverData, coverMime, MetadataOptions{
+			ID3Version:  settings.ID3Version,
+			WriteRating: settings.WriteRatingTags,
+		})
 		switch {
 		case embedErr == nil:
 			finalData = embeddedData
@@ -88,14 +142,18 @@ func DownloadSongDataWithTemplate(song *model.Song, withCover bool, withLyrics b
 
 	if ext == "" {
 		ext = DetectAudioExt(finalData)
+		filename = BuildDownloadFilename(&normalized, ext, templateFor(&normalized, ext))
 	}
 
 	return &DownloadedSong{
-		Data:        finalData,
-		Ext:         ext,
-		ContentType: AudioMimeByExt(ext),
-		Filename:    BuildDownloadFilename(&normalized, ext, filenameTemplate),
-		Warning:     warning,
+		Data:         finalData,
+		Ext:          ext,
+		ContentType:  AudioMimeByExt(ext),
+		Filename:     filename,
+		Warning:      warning,
+		Lyric:        lyric,
+		sidecarCover: sidecarCover,
+		sidecarName:  sidecarName,
 	}, nil
 }
 
@@ -104,11 +162,27 @@ func SaveSongToFile(song *model.Song, outDir string, withCover bool, withLyrics
 }
 
 func SaveSongToFileWithTemplate(song *model.Song, outDir string, withCover bool, withLyrics bool, filenameTemplate string) (*DownloadedSong, error) {
-	result, err := DownloadSongDataWithTemplate(song, withCover, withLyrics, filenameTemplate)
+	return SaveSongToTarget(song, DownloadTarget{Dir: outDir, Template: filenameTemplate}, withCover, withLyrics)
+}
+
+// SaveSongToTarget downloads the song and saves it in the directory and with
+// the template of the first matching route, or the target defaults. The name
+// of the matching route is reported in Route.
+func SaveSongToTarget(song *model.Song, target DownloadTarget, withCover bool, withLyrics bool) (*DownloadedSong, error) {
+	dir := target.Dir
+	var route *DownloadRoute
+	result, err := downloadSongData(song, withCover, withLyrics, func(normalized *model.Song, ext string) string {
+		var template string
+		dir, template, route = target.Resolve(normalized, ext)
+		return template
+	}, true)
 	if err != nil {
 		return nil, err
 	}
-	return saveDownloadedSongToFile(result, outDir)
+	if route != nil {
+		result.Route = route.Name
+	}
+	return saveDownloadedSongToFile(result, dir)
 }
 
 func saveDownloadedSongToFile(result *DownloadedSong, outDir string) (*DownloadedSong, error) {
@@ -134,56 +208,65 @@ func saveDownloadedSongToFile(result *DownloadedSong, outDir string) (*Downloade
 	if err := os.WriteFile(filePath, result.Data, 0644); err != nil {
 		return nil, err
 	}
+	if err := writeCoverSidecar(filepath.Dir(filePath), result.sidecarName, result.sidecarCover); err != nil && result.Warning == "" {
+		result.Warning = "cover sidecar write failed"
+	}
 
 	result.Filename = fileName
 	result.SavedPath = filePath
 	return result, nil
 }
 
-func BuildDownloadFilename(song *model.Song, ext string, filenameTemplate string) string {
-	template := strings.TrimSpace(filenameTemplate)
-	if template == "" {
-		template = DefaultDownloadFilenameTemplate
+// embeddedLyricForMode applies the lyric display mode to embedded lyrics.
+// Stacked lyrics are embedded as the source delivered them; the MP3 writer
+// still files the translation into its own USLT frame.
+func embeddedLyricForMode(lyric string, mode string) string {
+	parsed, err := lyrics.ParseMode(mode)
+	if lyric == "" || err != nil || parsed == lyrics.ModeStacked {
+		return lyric
+	}
+	return lyrics.FormatMode(lyric, lyrics.Options{Mode: parsed}, true)
+}
+
+// SaveLyricFile writes the lyric fetched with a saved song next to the audio
+// file, converted to format, and returns the lyric file path. It does nothing
+// when the download carried no lyric.
+func SaveLyricFile(result *DownloadedSong, format lyrics.Format) (string, error) {
+	if result == nil || strings.TrimSpace(result.SavedPath) == "" {
+		return "", errors.New("song is not saved to disk")
+	}
+	if strings.TrimSpace(result.Lyric) == "" {
+		return "", nil
+	}
+
+	content := result.Lyric
+	if format != lyrics.FormatLRC {
+		content = lyrics.Convert(content, format)
 	}
+	lyricPath := strings.TrimSuffix(result.SavedPath, filepath.Ext(result.SavedPath)) + "." + format.Ext()
+	if err := os.WriteFile(lyricPath, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return lyricPath, nil
+}
+
+// BuildDownloadFilename renders the filename template (see ParseFilenameTemplate)
+// into a safe relative path. Templates that fail to parse or render empty fall
+// back to the default; the extension is appended when {ext} was not used.
+func BuildDownloadFilename(song *model.Song, ext string, filenameTemplate string) string {
 	ext = strings.TrimSpace(strings.TrimPrefix(ext, "."))
+	tpl, err := ParseFilenameTemplate(strings.TrimSpace(filenameTemplate))
+	if err != nil || strings.TrimSpace(filenameTemplate) == "" {
+		tpl, _ = ParseFilenameTemplate(DefaultDownloadFilenameTemplate)
+	}
 
-	name := "Unknown"
-	artist := "Unknown"
-	album := ""
-	source := ""
-	id := ""
-	if song != nil {
-		if strings.TrimSpace(song.Name) != "" {
-			name = strings.TrimSpace(song.Name)
-		}
-		if strings.TrimSpace(song.Artist) != "" {
-			artist = strings.TrimSpace(song.Artist)
-		}
-		album = strings.TrimSpace(song.Album)
-		source = strings.TrimSpace(song.Source)
-		id = strings.TrimSpace(song.ID)
-	}
-	name = sanitizeDownloadTemplateValue(name, "Unknown")
-	artist = sanitizeDownloadTemplateValue(artist, "Unknown")
-	album = sanitizeDownloadTemplateValue(album, "")
-	source = sanitizeDownloadTemplateValue(source, "")
-	id = sanitizeDownloadTemplateValue(id, "")
-
-	hasExtToken := strings.Contains(template, "{ext}")
-	rendered := strings.NewReplacer(
-		"{name}", name,
-		"{artist}", artist,
-		"{album}", album,
-		"{source}", source,
-		"{id}", id,
-		"{ext}", ext,
-	).Replace(template)
+	rendered, usedExt := tpl.Render(song, ext)
 	rendered = strings.TrimSpace(rendered)
 	if rendered == "" {
-		rendered = strings.TrimSpace(DefaultDownloadFilenameTemplate)
-		rendered = strings.NewReplacer("{name}", name, "{artist}", artist, "{album}", album, "{source}", source, "{id}", id, "{ext}", ext).Replace(rendered)
+		tpl, _ = ParseFilenameTemplate(DefaultDownloadFilenameTemplate)
+		rendered, usedExt = tpl.Render(song, ext)
 	}
-	if !hasExtToken && ext != "" {
+	if !usedExt && ext != "" {
 		rendered += "." + ext
 	}
 
@@ -194,8 +277,8 @@ func sanitizeDownloadRelativePath(name string) string {
 	name = strings.ReplaceAll(strings.TrimSpace(name), "\\", "/")
 	parts := strings.Split(name, "/")
 	safeParts := make([]string, 0, len(parts))
-	for _, part := range parts {
-		part = sanitizeDownloadPathSegment(part)
+	for i, part := range parts {
+		part = sanitizeDownloadPathSegment(truncateSegmentBytes(strings.TrimSpace(part), maxDownloadSegmentBytes, i == len(parts)-1))
 		if part == "" || part == "." || part == ".." {
 			continue
 		}
@@ -244,27 +327,29 @@ func FetchDecryptedSodaAudio(song *model.Song) ([]byte, error) {
 	return soda.DecryptAudio(encryptedData, info.PlayAuth)
 }
 
-func fetchSongAudio(song *model.Song) ([]byte, string, error) {
+// fetchSongAudio returns the audio bytes, content type and the size announced
+// by the server (-1 when unknown).
+func fetchSongAudio(song *model.Song) ([]byte, string, int64, error) {
 	if song.Source == "soda" {
 		finalData, err := FetchDecryptedSodaAudio(song)
 		if err != nil {
-			return nil, "", err
+			return nil, "", -1, err
 		}
-		return finalData, "", nil
+		return finalData, "", -1, nil
 	}
 
 	dlFunc := GetDownloadFunc(song.Source)
 	if dlFunc == nil {
-		return nil, "", fmt.Errorf("unsupported source: %s", song.Source)
+		return nil, "", -1, fmt.Errorf("unsupported source: %s", song.Source)
 	}
 
 	urlStr, err := dlFunc(song)
 	if err != nil {
-		return nil, "", err
+		return nil, "", -1, err
 	}
 	if urlStr == "" {
-		return nil, "", errors.New("empty download url")
+		return nil, "", -1, errors.New("empty download url")
 	}
 
-	return FetchBytesWithMime(urlStr, song.Source)
+	return fetchBytesWithLength(urlStr, song.Source)
 }
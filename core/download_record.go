@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ const (
 	DownloadStatusSuccess = "success"
 	DownloadStatusSkipped = "skipped"
 	DownloadStatusFailed  = "failed"
+	DownloadStatusCorrupt = "corrupt"
 )
 
 // DownloadRecord keeps the user-visible download history in SQLite.
@@ -221,27 +223,35 @@ func CountSkippable(queue []model.Song, dedupSet map[string]struct{}) int {
 }
 
 func DownloadWithDedupCheck(song *model.Song, outDir string, withCover, withLyrics bool, dedupSet map[string]struct{}) (*DownloadedSong, error) {
-	return DownloadWithDedupCheckWithTemplate(song, outDir, withCover, withLyrics, "", dedupSet)
+	// 命令行下载同样遵循设置中的下载路由，相对路由目录以 outDir 为基准。
+	target := DownloadTarget{Dir: outDir, Template: DefaultDownloadFilenameTemplate, Routes: downloadSettingsProvider().DownloadRoutes}
+	return DownloadWithDedupCheckToTarget(song, target, withCover, withLyrics, dedupSet)
 }
 
 func DownloadWithDedupCheckWithTemplate(song *model.Song, outDir string, withCover, withLyrics bool, filenameTemplate string, dedupSet map[string]struct{}) (*DownloadedSong, error) {
+	if filenameTemplate == "" {
+		filenameTemplate = DefaultDownloadFilenameTemplate
+	}
+	return DownloadWithDedupCheckToTarget(song, DownloadTarget{Dir: outDir, Template: filenameTemplate}, withCover, withLyrics, dedupSet)
+}
+
+// DownloadWithDedupCheckToTarget is DownloadWithDedupCheck for a target whose
+// routes pick the directory and filename template per song.
+func DownloadWithDedupCheckToTarget(song *model.Song, target DownloadTarget, withCover, withLyrics bool, dedupSet map[string]struct{}) (*DownloadedSong, error) {
 	key := SongKey(song)
 	if IsSongDownloaded(song, dedupSet) {
 		_ = SaveDownloadRecord(song.Name, song.Artist, song.Source, DownloadStatusSkipped, "")
-		return &DownloadedSong{Skipped: true, Filename: key}, nil
+		// 已存在的文件仍需出现在歌单文件里，尽量找回它的位置。
+		return &DownloadedSong{Skipped: true, Filename: key, SavedPath: LocateSavedSong(song, target)}, nil
 	}
 
-	var (
-		result *DownloadedSong
-		dlErr  error
-	)
-	if filenameTemplate == "" {
-		result, dlErr = SaveSongToFile(song, outDir, withCover, withLyrics)
-	} else {
-		result, dlErr = SaveSongToFileWithTemplate(song, outDir, withCover, withLyrics, filenameTemplate)
-	}
+	result, dlErr := SaveSongToTarget(song, target, withCover, withLyrics)
 	if dlErr != nil {
-		_ = SaveDownloadRecord(song.Name, song.Artist, song.Source, DownloadStatusFailed, dlErr.Error())
+		status := DownloadStatusFailed
+		if errors.Is(dlErr, ErrAudioIntegrity) {
+			status = DownloadStatusCorrupt
+		}
+		_ = SaveDownloadRecord(song.Name, song.Artist, song.Source, status, dlErr.Error())
 		return result, dlErr
 	}
 
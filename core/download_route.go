@@ -0,0 +1,174 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// maxDownloadRoutes bounds how many routing rules the settings keep.
+const maxDownloadRoutes = 50
+
+// DownloadRoute sends matching downloads to their own directory and filename
+// template. Every non-empty match field must match; fields take comma
+// separated alternatives ("qq,netease", "flac,wav"). The first enabled route
+// that matches wins.
+type DownloadRoute struct {
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	Collection string `json:"collection"` // collection or playlist name, or collection ID
+	Format     string `json:"format"`     // audio extension
+	Artist     string `json:"artist"`     // any one of the song's artists
+	Dir        string `json:"dir"`        // relative to the download directory, or absolute
+	Template   string `json:"template"`   // empty keeps the default template
+	Disabled   bool   `json:"disabled"`
+}
+
+func (r *DownloadRoute) hasCriteria() bool {
+	return r.Source != "" || r.Collection != "" || r.Format != "" || r.Artist != ""
+}
+
+// normalizeDownloadRoutes trims the routes and drops those that match nothing
+// or change nothing. Invalid templates are cleared so the default applies.
+func normalizeDownloadRoutes(routes []DownloadRoute) []DownloadRoute {
+	var out []DownloadRoute
+	for _, route := range routes {
+		route.Name = strings.TrimSpace(route.Name)
+		route.Source = normalizeRouteList(route.Source, false)
+		route.Collection = normalizeRouteList(route.Collection, false)
+		route.Format = normalizeRouteList(route.Format, true)
+		route.Artist = normalizeRouteList(route.Artist, false)
+		route.Dir = normalizeRouteDir(route.Dir)
+		route.Template = strings.TrimSpace(route.Template)
+		if _, err := ParseFilenameTemplate(route.Template); err != nil {
+			route.Template = ""
+		}
+		if !route.hasCriteria() || (route.Dir == "" && route.Template == "") {
+			continue
+		}
+		out = append(out, route)
+		if len(out) == maxDownloadRoutes {
+			break
+		}
+	}
+	return out
+}
+
+func normalizeRouteList(value string, extension bool) string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '，' }) {
+		item = strings.TrimSpace(item)
+		if extension {
+			item = strings.ToLower(strings.TrimPrefix(item, "."))
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// normalizeRouteDir keeps absolute directories as they are and passes relative
+// ones through the same sanitizing as filename templates, so a route can never
+// climb out of the download directory with "..".
+func normalizeRouteDir(dir string) string {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return ""
+	}
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	// Only "." and ".." segments: the route stays in the download directory.
+	if strings.Trim(strings.ReplaceAll(dir, "..", ""), "./\\ ") == "" {
+		return ""
+	}
+	return sanitizeDownloadRelativePath(dir)
+}
+
+func routeListMatches(list string, values ...string) bool {
+	for _, want := range strings.Split(list, ",") {
+		for _, value := range values {
+			if value != "" && strings.EqualFold(strings.TrimSpace(value), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Matches reports whether the route applies to the song saved with ext.
+func (r *DownloadRoute) Matches(song *model.Song, ext string) bool {
+	if r.Disabled || !r.hasCriteria() || song == nil {
+		return false
+	}
+	if r.Source != "" && !routeListMatches(r.Source, song.Source) {
+		return false
+	}
+	if r.Format != "" && !routeListMatches(r.Format, strings.TrimPrefix(ext, ".")) {
+		return false
+	}
+	if r.Collection != "" && !routeListMatches(r.Collection, songExtraValue(song, "collection_id"), songExtraValue(song, "playlist", "playlist_name")) {
+		return false
+	}
+	if r.Artist != "" && !routeListMatches(r.Artist, SplitArtists(song.Artist)...) {
+		return false
+	}
+	return true
+}
+
+// DownloadTarget is where downloads are saved: a base directory and filename
+// template, and routes that can replace either for matching songs.
+type DownloadTarget struct {
+	Dir      string
+	Template string
+	Routes   []DownloadRoute
+}
+
+// WebDownloadTarget is the target configured in the web settings.
+func WebDownloadTarget(settings WebSettings) DownloadTarget {
+	return DownloadTarget{Dir: settings.DownloadDir, Template: settings.DownloadFilenameTemplate, Routes: settings.DownloadRoutes}
+}
+
+// Resolve returns the directory and template for the song saved with ext, and
+// the route that chose them (nil when none matched).
+func (t DownloadTarget) Resolve(song *model.Song, ext string) (string, string, *DownloadRoute) {
+	dir, template := strings.TrimSpace(t.Dir), t.Template
+	if dir == "" {
+		dir = DefaultWebDownloadDir
+	}
+	for i := range t.Routes {
+		route := &t.Routes[i]
+		if !route.Matches(song, ext) {
+			continue
+		}
+		if route.Dir != "" {
+			if filepath.IsAbs(route.Dir) {
+				dir = route.Dir
+			} else {
+				dir = filepath.Join(dir, route.Dir)
+			}
+		}
+		if route.Template != "" {
+			template = route.Template
+		}
+		return dir, template, route
+	}
+	return dir, template, nil
+}
+
+// DownloadRouteRoots returns the absolute route directories, which lie outside
+// the download directory and need indexing on their own.
+func DownloadRouteRoots(routes []DownloadRoute) []string {
+	var roots []string
+	seen := map[string]bool{}
+	for _, route := range routes {
+		if route.Disabled || !filepath.IsAbs(route.Dir) || seen[route.Dir] {
+			continue
+		}
+		seen[route.Dir] = true
+		roots = append(roots, route.Dir)
+	}
+	return roots
+}
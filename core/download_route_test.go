@@ -0,0 +1,73 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func TestDownloadTargetResolve(t *testing.T) {
+	absolute := filepath.Join(t.TempDir(), "Workout")
+	target := DownloadTarget{
+		Dir:      "downloads",
+		Template: "{artist} - {name}",
+		Routes: normalizeDownloadRoutes([]DownloadRoute{
+			{Name: "off", Source: "qq", Dir: "Disabled", Disabled: true},
+			{Name: "workout", Collection: "Workout,12", Dir: absolute},
+			{Name: "bilibili", Source: "bilibili", Dir: "Bilibili", Template: "{artist}/{name}"},
+			{Name: "lossless", Format: "flac", Dir: "Lossless"},
+			{Name: "jay", Artist: "周杰伦", Source: "qq", Template: "Jay/{album}/{name}"},
+		}),
+	}
+
+	tests := []struct {
+		name         string
+		song         model.Song
+		ext          string
+		wantDir      string
+		wantTemplate string
+		wantRoute    string
+	}{
+		{name: "no route", song: model.Song{Source: "netease"}, ext: "mp3", wantDir: "downloads", wantTemplate: "{artist} - {name}"},
+		{name: "disabled route skipped", song: model.Song{Source: "qq", Artist: "A"}, ext: "mp3", wantDir: "downloads", wantTemplate: "{artist} - {name}"},
+		{name: "collection id goes to absolute dir", song: model.Song{Source: "qq", Extra: map[string]string{"collection_id": "12"}}, ext: "flac", wantDir: absolute, wantTemplate: "{artist} - {name}", wantRoute: "workout"},
+		{name: "playlist name is case-insensitive", song: model.Song{Source: "qq", Extra: map[string]string{"playlist": "workout"}}, ext: "mp3", wantDir: absolute, wantTemplate: "{artist} - {name}", wantRoute: "workout"},
+		{name: "source sets dir and template", song: model.Song{Source: "bilibili"}, ext: "flac", wantDir: filepath.Join("downloads", "Bilibili"), wantTemplate: "{artist}/{name}", wantRoute: "bilibili"},
+		{name: "format", song: model.Song{Source: "netease"}, ext: ".FLAC", wantDir: filepath.Join("downloads", "Lossless"), wantTemplate: "{artist} - {name}", wantRoute: "lossless"},
+		{name: "all criteria must match", song: model.Song{Source: "qq", Artist: "周杰伦、费玉清"}, ext: "mp3", wantDir: "downloads", wantTemplate: "Jay/{album}/{name}", wantRoute: "jay"},
+		{name: "artist alone is not enough", song: model.Song{Source: "kugou", Artist: "周杰伦"}, ext: "mp3", wantDir: "downloads", wantTemplate: "{artist} - {name}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, template, route := target.Resolve(&tt.song, tt.ext)
+			routeName := ""
+			if route != nil {
+				routeName = route.Name
+			}
+			if dir != tt.wantDir || template != tt.wantTemplate || routeName != tt.wantRoute {
+				t.Fatalf("Resolve() = %q, %q, %q; want %q, %q, %q", dir, template, routeName, tt.wantDir, tt.wantTemplate, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestNormalizeDownloadRoutes(t *testing.T) {
+	got := normalizeDownloadRoutes([]DownloadRoute{
+		{Name: "escape", Source: "qq", Dir: "../../etc"},
+		{Name: "no criteria", Dir: "Anywhere"},
+		{Name: "no effect", Source: "qq"},
+		{Name: "bad template", Source: "qq", Template: "{if album}"},
+		{Name: "dot dir", Source: "kugou", Dir: "./..", Template: "{name}"},
+	})
+	if len(got) != 2 {
+		t.Fatalf("normalizeDownloadRoutes() = %+v, want 2 routes", got)
+	}
+	if got[0].Dir != "etc" {
+		t.Fatalf("relative route dir = %q, want traversal segments dropped", got[0].Dir)
+	}
+	if got[1].Dir != "" || got[1].Template != "{name}" {
+		t.Fatalf("dot route = %+v, want empty dir", got[1])
+	}
+}
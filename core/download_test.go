@@ -3,8 +3,10 @@ package core
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 	"github.com/guohuiyuan/music-lib/model"
 )
 
@@ -15,6 +17,12 @@ func TestBuildDownloadFilenameUsesTemplate(t *testing.T) {
 		Name:   "没地址的信",
 		Artist: "阮俊霖",
 		Album:  "专辑/测试",
+		Extra: map[string]string{
+			"track":        "3",
+			"disc":         "1",
+			"release_date": "2020-05-01",
+			"album_artist": "群星",
+		},
 	}
 
 	tests := []struct {
@@ -53,6 +61,12 @@ func TestBuildDownloadFilenameUsesTemplate(t *testing.T) {
 			ext:      "m4a",
 			want:     "netease-12345-没地址的信.m4a",
 		},
+		{
+			name:     "extended tag tokens",
+			template: "{album_artist}/{year} - {album}/{disc}-{track} {name}",
+			ext:      "flac",
+			want:     filepath.Join("群星", "2020 - 专辑_测试", "1-03 没地址的信.flac"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -88,3 +102,46 @@ func TestSaveDownloadedSongToFileCreatesTemplateSubdirectories(t *testing.T) {
 		t.Fatalf("saved data = %q, want audio", string(data))
 	}
 }
+
+func TestSaveLyricFileConvertsNextToAudio(t *testing.T) {
+	dir := t.TempDir()
+	result := &DownloadedSong{
+		SavedPath: filepath.Join(dir, "Artist - Song.mp3"),
+		Lyric:     "[00:01.00]first\n[00:03.00]second",
+	}
+
+	path, err := SaveLyricFile(result, lyrics.FormatVTT)
+	if err != nil {
+		t.Fatalf("SaveLyricFile() error = %v", err)
+	}
+	if want := filepath.Join(dir, "Artist - Song.vtt"); path != want {
+		t.Fatalf("lyric path = %q, want %q", path, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nfirst\n") {
+		t.Fatalf("vtt content = %q", string(data))
+	}
+
+	result.Lyric = ""
+	if path, err := SaveLyricFile(result, lyrics.FormatSRT); err != nil || path != "" {
+		t.Fatalf("SaveLyricFile() without lyric = %q, %v; want no file", path, err)
+	}
+}
+
+func TestEmbeddedLyricForMode(t *testing.T) {
+	raw := "[00:01.00]你好\n[00:01.00]hello"
+	tests := map[string]string{
+		"stacked":      raw,
+		"":             raw,
+		"original":     "[00:01.00]你好",
+		"side_by_side": "[00:01.00]你好 / hello",
+	}
+	for mode, want := range tests {
+		if got := embeddedLyricForMode(raw, mode); got != want {
+			t.Fatalf("embeddedLyricForMode(%q) = %q, want %q", mode, got, want)
+		}
+	}
+}
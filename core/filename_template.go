@@ -0,0 +1,385 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
+	"github.com/guohuiyuan/music-lib/model"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Filename templates render download paths from song fields:
+//
+//	{artist}/{if album}{album}/{end}{track:02} {name|max:60}.{ext}
+//
+// {field} inserts a value, {field:03} zero-pads numbers, and "|" chains
+// filters: upper, lower, title, ascii (pinyin / romaji for CJK, accents
+// dropped), max:N (truncate to N characters) and default:text. {if field},
+// {if !field}, {else} and {end} keep a part only when the field is (or is not)
+// empty. Values never contain "/" so only the template itself creates folders.
+// Unknown {words} are kept as literal text.
+
+// maxDownloadSegmentBytes keeps each path segment under the 255 byte limit
+// common to filesystems, leaving room for temp suffixes.
+const maxDownloadSegmentBytes = 240
+
+var filenameTemplateFields = map[string]bool{
+	"name": true, "artist": true, "first_artist": true, "album": true, "album_artist": true,
+	"source": true, "id": true, "ext": true, "track": true, "disc": true, "year": true,
+	"genre": true, "composer": true, "isrc": true, "playlist": true, "index": true, "bitrate": true,
+}
+
+type filenameTemplateNode struct {
+	text    string // literal text when field is empty
+	field   string
+	width   int
+	filters []filenameTemplateFilter
+
+	// Conditional blocks.
+	cond    string
+	negate  bool
+	then    []filenameTemplateNode
+	orElse  []filenameTemplateNode
+	isBlock bool
+}
+
+type filenameTemplateFilter struct {
+	name string
+	arg  string
+}
+
+// FilenameTemplate is a parsed download filename template.
+type FilenameTemplate struct {
+	nodes []filenameTemplateNode
+}
+
+// ParseFilenameTemplate parses a template, reporting unbalanced {if}/{end}
+// blocks and unknown filters.
+func ParseFilenameTemplate(template string) (*FilenameTemplate, error) {
+	nodes, rest, closer, err := parseFilenameTemplateNodes(template)
+	if err != nil {
+		return nil, err
+	}
+	if closer != "" || rest != "" {
+		return nil, fmt.Errorf("unexpected {%s}", closer)
+	}
+	return &FilenameTemplate{nodes: nodes}, nil
+}
+
+// parseFilenameTemplateNodes parses until the end of input or an {else}/{end}
+// tag, which it returns as closer with the remaining input.
+func parseFilenameTemplateNodes(input string) ([]filenameTemplateNode, string, string, error) {
+	var nodes []filenameTemplateNode
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			nodes = append(nodes, filenameTemplateNode{text: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for input != "" {
+		open := strings.IndexByte(input, '{')
+		if open < 0 {
+			literal.WriteString(input)
+			break
+		}
+		literal.WriteString(input[:open])
+		input = input[open:]
+		end := strings.IndexByte(input, '}')
+		if end < 0 {
+			literal.WriteString(input)
+			break
+		}
+		tag := strings.TrimSpace(input[1:end])
+		raw := input[:end+1]
+		input = input[end+1:]
+
+		switch {
+		case tag == "else" || tag == "end":
+			flush()
+			return nodes, input, tag, nil
+		case strings.HasPrefix(tag, "if "):
+			flush()
+			cond := strings.TrimSpace(strings.TrimPrefix(tag, "if "))
+			node := filenameTemplateNode{isBlock: true}
+			if strings.HasPrefix(cond, "!") {
+				node.negate = true
+				cond = strings.TrimSpace(cond[1:])
+			}
+			if !filenameTemplateFields[cond] {
+				return nil, "", "", fmt.Errorf("unknown field %q in {%s}", cond, tag)
+			}
+			node.cond = cond
+
+			then, rest, closer, err := parseFilenameTemplateNodes(input)
+			if err != nil {
+				return nil, "", "", err
+			}
+			node.then = then
+			if closer == "else" {
+				node.orElse, rest, closer, err = parseFilenameTemplateNodes(rest)
+				if err != nil {
+					return nil, "", "", err
+				}
+			}
+			if closer != "end" {
+				return nil, "", "", fmt.Errorf("{%s} is missing {end}", tag)
+			}
+			nodes = append(nodes, node)
+			input = rest
+		default:
+			node, ok, err := parseFilenameTemplateField(tag)
+			if err != nil {
+				return nil, "", "", err
+			}
+			if !ok {
+				literal.WriteString(raw)
+				continue
+			}
+			flush()
+			nodes = append(nodes, node)
+		}
+	}
+	flush()
+	return nodes, "", "", nil
+}
+
+func parseFilenameTemplateField(tag string) (filenameTemplateNode, bool, error) {
+	parts := strings.Split(tag, "|")
+	field, width, _ := strings.Cut(strings.TrimSpace(parts[0]), ":")
+	if !filenameTemplateFields[field] {
+		return filenameTemplateNode{}, false, nil
+	}
+	node := filenameTemplateNode{field: field}
+	if width != "" {
+		n, err := strconv.Atoi(width)
+		if err != nil || n < 0 || n > 10 {
+			return node, false, fmt.Errorf("invalid width in {%s}", tag)
+		}
+		node.width = n
+	}
+	for _, part := range parts[1:] {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), ":")
+		switch name {
+		case "upper", "lower", "title", "ascii", "default":
+		case "max":
+			if n, err := strconv.Atoi(arg); err != nil || n <= 0 {
+				return node, false, fmt.Errorf("invalid max in {%s}", tag)
+			}
+		default:
+			return node, false, fmt.Errorf("unknown filter %q in {%s}", name, tag)
+		}
+		node.filters = append(node.filters, filenameTemplateFilter{name: name, arg: arg})
+	}
+	return node, true, nil
+}
+
+// filenameTemplateValues returns the raw field values of a song, before
+// sanitizing, padding and filters.
+func filenameTemplateValues(song *model.Song, ext string) map[string]string {
+	values := map[string]string{"name": "Unknown", "artist": "Unknown", "ext": ext}
+	if song == nil {
+		values["first_artist"] = "Unknown"
+		return values
+	}
+	if name := strings.TrimSpace(song.Name); name != "" {
+		values["name"] = name
+	}
+	if artist := strings.TrimSpace(song.Artist); artist != "" {
+		values["artist"] = artist
+	}
+	values["first_artist"] = values["artist"]
+	if artists := SplitArtists(song.Artist); len(artists) > 0 {
+		values["first_artist"] = artists[0]
+	}
+	values["album"] = strings.TrimSpace(song.Album)
+	values["source"] = strings.TrimSpace(song.Source)
+	values["id"] = strings.TrimSpace(song.ID)
+
+	meta := SongAudioMetadata(song)
+	if meta.TrackNumber > 0 {
+		values["track"] = strconv.Itoa(meta.TrackNumber)
+	}
+	if meta.DiscNumber > 0 {
+		values["disc"] = strconv.Itoa(meta.DiscNumber)
+	}
+	values["year"] = meta.Year()
+	values["genre"] = meta.Genre
+	values["album_artist"] = meta.AlbumArtist
+	values["composer"] = meta.Composer
+	values["isrc"] = meta.ISRC
+	values["playlist"] = songExtraValue(song, "playlist", "playlist_name")
+	if index, err := strconv.Atoi(songExtraValue(song, "playlist_index", "index")); err == nil && index > 0 {
+		values["index"] = strconv.Itoa(index)
+	}
+	bitrate := song.Bitrate
+	if bitrate <= 0 {
+		bitrate, _ = strconv.Atoi(strings.TrimSuffix(strings.ToLower(songExtraValue(song, "bitrate")), "kbps"))
+	}
+	if bitrate > 0 {
+		values["bitrate"] = strconv.Itoa(bitrate)
+	}
+	return values
+}
+
+// Render fills the template. usedExt reports whether {ext} was written, so the
+// caller knows whether to append the extension itself.
+func (t *FilenameTemplate) Render(song *model.Song, ext string) (rendered string, usedExt bool) {
+	values := filenameTemplateValues(song, ext)
+	var b strings.Builder
+	renderFilenameTemplateNodes(&b, t.nodes, values, &usedExt)
+	return b.String(), usedExt
+}
+
+func renderFilenameTemplateNodes(b *strings.Builder, nodes []filenameTemplateNode, values map[string]string, usedExt *bool) {
+	for _, node := range nodes {
+		switch {
+		case node.isBlock:
+			present := strings.TrimSpace(values[node.cond]) != ""
+			if present != node.negate {
+				renderFilenameTemplateNodes(b, node.then, values, usedExt)
+			} else {
+				renderFilenameTemplateNodes(b, node.orElse, values, usedExt)
+			}
+		case node.field != "":
+			if node.field == "ext" {
+				*usedExt = true
+			}
+			b.WriteString(node.value(values[node.field]))
+		default:
+			b.WriteString(node.text)
+		}
+	}
+}
+
+func (n filenameTemplateNode) value(value string) string {
+	if n.field == "ext" {
+		return value
+	}
+	if n.width == 0 && n.field == "track" {
+		// Track numbers have always been written with two digits.
+		n.width = 2
+	}
+	if n.width > 0 {
+		if number, err := strconv.Atoi(value); err == nil {
+			value = fmt.Sprintf("%0*d", n.width, number)
+		}
+	}
+	for _, filter := range n.filters {
+		switch filter.name {
+		case "upper":
+			value = strings.ToUpper(value)
+		case "lower":
+			value = strings.ToLower(value)
+		case "title":
+			value = titleCase(value)
+		case "ascii":
+			value = asciiFold(value)
+		case "max":
+			limit, _ := strconv.Atoi(filter.arg)
+			value = truncateRunes(value, limit)
+		case "default":
+			if strings.TrimSpace(value) == "" {
+				value = filter.arg
+			}
+		}
+	}
+	return sanitizeDownloadTemplateValue(value, "")
+}
+
+func titleCase(value string) string {
+	runes := []rune(value)
+	start := true
+	for i, r := range runes {
+		if unicode.IsLetter(r) {
+			if start {
+				runes[i] = unicode.ToUpper(r)
+			} else {
+				runes[i] = unicode.ToLower(r)
+			}
+			start = false
+		} else {
+			start = unicode.IsSpace(r) || r == '-' || r == '_'
+		}
+	}
+	return string(runes)
+}
+
+// asciiFold transliterates CJK text (pinyin without tones, romaji, Korean
+// romanization) and strips accents, dropping whatever is still not ASCII.
+func asciiFold(value string) string {
+	var b strings.Builder
+	var cjk []rune
+	flushCJK := func() {
+		if len(cjk) == 0 {
+			return
+		}
+		if roman := lyrics.Romanize(string(cjk)); roman != "" {
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), " ") {
+				b.WriteByte(' ')
+			}
+			b.WriteString(stripMarks(roman))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range value {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー' {
+			cjk = append(cjk, r)
+			continue
+		}
+		flushCJK()
+		b.WriteString(stripMarks(string(r)))
+	}
+	flushCJK()
+
+	var out strings.Builder
+	for _, r := range b.String() {
+		if r < utf8.RuneSelf {
+			out.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(out.String()), " ")
+}
+
+func stripMarks(value string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(value) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func truncateRunes(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return strings.TrimSpace(string(runes[:limit]))
+}
+
+// truncateSegmentBytes shortens a path segment to limit bytes on a rune
+// boundary, keeping the extension of a file name.
+func truncateSegmentBytes(segment string, limit int, keepExt bool) string {
+	if len(segment) <= limit {
+		return segment
+	}
+	ext := ""
+	if keepExt {
+		if dot := strings.LastIndexByte(segment, '.'); dot > 0 && len(segment)-dot <= 10 {
+			ext = segment[dot:]
+			segment = segment[:dot]
+		}
+	}
+	limit -= len(ext)
+	for limit > 0 && !utf8.RuneStart(segment[limit]) {
+		limit--
+	}
+	return strings.TrimRight(segment[:limit], " .") + ext
+}
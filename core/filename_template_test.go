@@ -0,0 +1,66 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func TestBuildDownloadFilenameExpressions(t *testing.T) {
+	song := &model.Song{
+		ID:      "186001",
+		Source:  "netease",
+		Name:    "晴天",
+		Artist:  "周杰伦、杨瑞代",
+		Bitrate: 320,
+		Extra: map[string]string{
+			"track":          "3",
+			"playlist":       "我喜欢的音乐",
+			"playlist_index": "7",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "padded index and playlist folder", template: "{playlist}/{index:03} {name}", want: filepath.Join("我喜欢的音乐", "007 晴天.mp3")},
+		{name: "first artist and bitrate", template: "{first_artist} - {name} [{bitrate}k]", want: "周杰伦 - 晴天 [320k].mp3"},
+		{name: "album folder only when album is set", template: "{artist}/{if album}{album}/{end}{name}", want: filepath.Join("周杰伦、杨瑞代", "晴天.mp3")},
+		{name: "else branch", template: "{if album}{album}{else}Singles{end}/{track} {name}", want: filepath.Join("Singles", "03 晴天.mp3")},
+		{name: "negated condition", template: "{if !album}loose/{end}{name}", want: filepath.Join("loose", "晴天.mp3")},
+		{name: "ascii and case filters", template: "{first_artist|ascii|title} - {name|ascii|upper}", want: "Zhou Jie Lun - QING TIAN.mp3"},
+		{name: "max truncates a value", template: "{artist|max:3}", want: "周杰伦.mp3"},
+		{name: "default filter", template: "{genre|default:Unknown Genre}/{name}", want: filepath.Join("Unknown Genre", "晴天.mp3")},
+		{name: "unknown token stays literal", template: "{name} {mood}", want: "晴天 {mood}.mp3"},
+		{name: "invalid template falls back to default", template: "{if album}{name}", want: "周杰伦、杨瑞代 - 晴天.mp3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildDownloadFilename(song, "mp3", tt.template); got != tt.want {
+				t.Fatalf("BuildDownloadFilename(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilenameTemplateErrors(t *testing.T) {
+	for _, template := range []string{"{if album}x", "x{end}", "{if mood}x{end}", "{name|shout}", "{name|max:0}"} {
+		if _, err := ParseFilenameTemplate(template); err == nil {
+			t.Fatalf("ParseFilenameTemplate(%q) should fail", template)
+		}
+	}
+}
+
+func TestBuildDownloadFilenameTruncatesLongSegments(t *testing.T) {
+	song := &model.Song{Name: strings.Repeat("长", 200), Artist: "A"}
+	got := BuildDownloadFilename(song, "flac", "{artist}/{name}")
+	base := filepath.Base(got)
+	if len(base) > maxDownloadSegmentBytes || !strings.HasSuffix(base, ".flac") {
+		t.Fatalf("segment = %d bytes %q, want <= %d ending in .flac", len(base), base, maxDownloadSegmentBytes)
+	}
+}
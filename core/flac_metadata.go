@@ -0,0 +1,293 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// FLAC 元数据内嵌（VORBIS_COMMENT / PICTURE）
+// ==========================================
+
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockPadding       = 1
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+
+	flacPictureFrontCover = 3
+	flacDefaultPadding    = 8192
+	flacMaxBlockSize      = 1<<24 - 1
+	flacVendorString      = "go-music-dl"
+)
+
+type flacMetadataBlock struct {
+	Type int
+	Data []byte
+}
+
+// parseFLACMetadataBlocks splits a FLAC stream into its metadata blocks and the
+// offset at which audio frames start.
+func parseFLACMetadataBlocks(audioData []byte) ([]flacMetadataBlock, int, error) {
+	if len(audioData) < 4 || string(audioData[:4]) != "fLaC" {
+		return nil, 0, errors.New("not a flac stream")
+	}
+
+	var blocks []flacMetadataBlock
+	pos := 4
+	for {
+		if pos+4 > len(audioData) {
+			return nil, 0, errors.New("truncated flac metadata block header")
+		}
+		header := audioData[pos]
+		size := int(audioData[pos+1])<<16 | int(audioData[pos+2])<<8 | int(audioData[pos+3])
+		pos += 4
+		if pos+size > len(audioData) {
+			return nil, 0, errors.New("truncated flac metadata block")
+		}
+		blocks = append(blocks, flacMetadataBlock{Type: int(header & 0x7F), Data: audioData[pos : pos+size]})
+		pos += size
+		if header&0x80 != 0 {
+			break
+		}
+	}
+	if len(blocks) == 0 || blocks[0].Type != flacBlockStreamInfo {
+		return nil, 0, errors.New("flac stream does not start with STREAMINFO")
+	}
+	return blocks, pos, nil
+}
+
+func parseFLACVorbisComment(data []byte) (string, []string) {
+	if len(data) < 4 {
+		return "", nil
+	}
+	vendorLen := int(binary.LittleEndian.Uint32(data[:4]))
+	if 4+vendorLen+4 > len(data) {
+		return "", nil
+	}
+	vendor := string(data[4 : 4+vendorLen])
+	pos := 4 + vendorLen
+	count := int(binary.LittleEndian.Uint32(data[pos:]))
+	pos += 4
+
+	comments := make([]string, 0, count)
+	for i := 0; i < count && pos+4 <= len(data); i++ {
+		length := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if pos+length > len(data) {
+			break
+		}
+		comments = append(comments, string(data[pos:pos+length]))
+		pos += length
+	}
+	return vendor, comments
+}
+
+func buildFLACVorbisComment(vendor string, comments []string) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(vendor)))
+	buf.WriteString(vendor)
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(comment)))
+		buf.WriteString(comment)
+	}
+	return buf.Bytes()
+}
+
+// flacVorbisFields lists the comments written for the tag set, in output order.
+func flacVorbisFields(meta AudioMetadata) [][2]string {
+	fields := [][2]string{
+		{"TITLE", meta.Title},
+		{"ARTIST", meta.Artist},
+		{"ALBUM", meta.Album},
+		{"ALBUMARTIST", meta.AlbumArtist},
+		{"COMPOSER", meta.Composer},
+		{"GENRE", meta.Genre},
+		{"DATE", meta.Date},
+		{"ISRC", meta.ISRC},
+		{"COMMENT", meta.Comment},
+		{"LYRICS", meta.Lyric},
+		{"RATING", vorbisRatingValue(meta.Rating)},
+	}
+	if meta.TrackNumber > 0 {
+		fields = append(fields, [2]string{"TRACKNUMBER", strconv.Itoa(meta.TrackNumber)})
+		if meta.TrackTotal > 0 {
+			fields = append(fields, [2]string{"TRACKTOTAL", strconv.Itoa(meta.TrackTotal)})
+		}
+	}
+	if meta.DiscNumber > 0 {
+		fields = append(fields, [2]string{"DISCNUMBER", strconv.Itoa(meta.DiscNumber)})
+		if meta.DiscTotal > 0 {
+			fields = append(fields, [2]string{"DISCTOTAL", strconv.Itoa(meta.DiscTotal)})
+		}
+	}
+	fields = append(fields, meta.CustomTags()...)
+	return fields
+}
+
+func flacPictureBlock(coverData []byte, coverMime string) []byte {
+	mimeType := normalizeCoverMime(coverMime)
+	width, height, depth := 0, 0, 0
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(coverData)); err == nil {
+		width, height = cfg.Width, cfg.Height
+		depth = 24
+		if format == "png" || format == "gif" {
+			depth = 32
+		}
+	}
+
+	var buf bytes.Buffer
+	fields := []uint32{flacPictureFrontCover, uint32(len(mimeType))}
+	for _, v := range fields {
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	}
+	buf.WriteString(mimeType)
+	for _, v := range []uint32{0, uint32(width), uint32(height), uint32(depth), 0, uint32(len(coverData))} {
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	}
+	buf.Write(coverData)
+	return buf.Bytes()
+}
+
+func flacPictureType(data []byte) int {
+	if len(data) < 4 {
+		return -1
+	}
+	return int(binary.BigEndian.Uint32(data[:4]))
+}
+
+// flacPaddingBlocks fills size bytes, block headers included, with PADDING
+// blocks. A single block cannot hold more than flacMaxBlockSize bytes, so a
+// larger area is split; size must be at least 4.
+func flacPaddingBlocks(size int) []flacMetadataBlock {
+	var blocks []flacMetadataBlock
+	for size >= 4 {
+		n := min(size-4, flacMaxBlockSize)
+		if rest := size - 4 - n; rest > 0 && rest < 4 {
+			// Leave room for the header of the next block.
+			n -= 4
+		}
+		blocks = append(blocks, flacMetadataBlock{Type: flacBlockPadding, Data: make([]byte, n)})
+		size -= 4 + n
+	}
+	return blocks
+}
+
+// embedFLACMetadata rewrites VORBIS_COMMENT and the front cover PICTURE block.
+// Other metadata blocks and the audio frames are kept as they are; when the new
+// metadata fits into the old metadata area plus PADDING the total size of the
+// header stays unchanged, so audio frames keep their offsets. A leading ID3v2
+// tag, which some encoders put in front of "fLaC", is dropped.
+func embedFLACMetadata(audioData []byte, meta AudioMetadata, coverData []byte, coverMime string) ([]byte, error) {
+	audioData = stripID3v2Prefix(audioData)
+	blocks, audioOffset, err := parseFLACMetadataBlocks(audioData)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := flacVorbisFields(meta)
+	replace := map[string]bool{}
+	for _, field := range fields {
+		if field[1] != "" {
+			replace[field[0]] = true
+		}
+	}
+	if meta.TrackNumber > 0 {
+		replace["TRACKTOTAL"] = true
+	}
+	if meta.DiscNumber > 0 {
+		replace["DISCTOTAL"] = true
+	}
+	if meta.ClearRating {
+		replace["RATING"] = true
+	}
+
+	vendor := flacVendorString
+	var comments []string
+	for _, block := range blocks {
+		if block.Type != flacBlockVorbisComment {
+			continue
+		}
+		existingVendor, existing := parseFLACVorbisComment(block.Data)
+		if existingVendor != "" {
+			vendor = existingVendor
+		}
+		for _, comment := range existing {
+			name, _, _ := strings.Cut(comment, "=")
+			if !replace[strings.ToUpper(name)] {
+				comments = append(comments, comment)
+			}
+		}
+	}
+	for _, field := range fields {
+		if field[1] != "" {
+			comments = append(comments, field[0]+"="+field[1])
+		}
+	}
+
+	commentBlock := flacMetadataBlock{Type: flacBlockVorbisComment, Data: buildFLACVorbisComment(vendor, comments)}
+	out := make([]flacMetadataBlock, 0, len(blocks)+2)
+	commentWritten := false
+	for _, block := range blocks {
+		switch {
+		case block.Type == flacBlockPadding:
+			continue
+		case block.Type == flacBlockVorbisComment:
+			if !commentWritten {
+				out = append(out, commentBlock)
+				commentWritten = true
+			}
+			continue
+		case block.Type == flacBlockPicture && len(coverData) > 0 && flacPictureType(block.Data) == flacPictureFrontCover:
+			continue
+		}
+		out = append(out, block)
+		if block.Type == flacBlockStreamInfo && !commentWritten {
+			out = append(out, commentBlock)
+			commentWritten = true
+		}
+	}
+	if len(coverData) > 0 {
+		out = append(out, flacMetadataBlock{Type: flacBlockPicture, Data: flacPictureBlock(coverData, coverMime)})
+	}
+
+	used := 0
+	for _, block := range out {
+		if len(block.Data) > flacMaxBlockSize {
+			return nil, fmt.Errorf("flac metadata block too large: %d bytes", len(block.Data))
+		}
+		used += 4 + len(block.Data)
+	}
+	available := audioOffset - 4
+	switch {
+	case used == available:
+	case used+4 <= available:
+		out = append(out, flacPaddingBlocks(available-used)...)
+	default:
+		out = append(out, flacMetadataBlock{Type: flacBlockPadding, Data: make([]byte, flacDefaultPadding)})
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(audioData) + used + flacDefaultPadding)
+	buf.WriteString("fLaC")
+	for i, block := range out {
+		header := byte(block.Type & 0x7F)
+		if i == len(out)-1 {
+			header |= 0x80
+		}
+		size := len(block.Data)
+		buf.Write([]byte{header, byte(size >> 16), byte(size >> 8), byte(size)})
+		buf.Write(block.Data)
+	}
+	buf.Write(audioData[audioOffset:])
+	return buf.Bytes(), nil
+}
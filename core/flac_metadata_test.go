@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dhowden/tag"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func buildTestFLAC(blocks []flacMetadataBlock, frames []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	for i, block := range blocks {
+		header := byte(block.Type)
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		size := len(block.Data)
+		buf.Write([]byte{header, byte(size >> 16), byte(size >> 8), byte(size)})
+		buf.Write(block.Data)
+	}
+	buf.Write(frames)
+	return buf.Bytes()
+}
+
+func TestEmbedFLACMetadataUsesPaddingAndPreservesBlocks(t *testing.T) {
+	frames := []byte{0xFF, 0xF8, 0x69, 0x08, 0x00, 0x01, 0x02, 0x03}
+	application := flacMetadataBlock{Type: 2, Data: []byte("testAPPL")}
+	source := buildTestFLAC([]flacMetadataBlock{
+		{Type: flacBlockStreamInfo, Data: make([]byte, 34)},
+		{Type: flacBlockVorbisComment, Data: buildFLACVorbisComment("ref", []string{"TITLE=Old", "GENRE=Jazz", "REPLAYGAIN_TRACK_GAIN=-6.5 dB"})},
+		application,
+		{Type: flacBlockPadding, Data: make([]byte, 4096)},
+	}, frames)
+
+	cover := []byte{0xff, 0xd8, 0xff, 0xd9}
+	embedded, err := EmbedSongMetadata(source, &model.Song{
+		Name:   "New Title",
+		Artist: "New Artist",
+		Album:  "New Album",
+		Ext:    "flac",
+		Extra:  map[string]string{"track": "4/9"},
+	}, "[00:01.00]lyric", cover, "image/jpeg")
+	if err != nil {
+		t.Fatalf("EmbedSongMetadata() error = %v", err)
+	}
+	if len(embedded) != len(source) {
+		t.Fatalf("embedded size = %d, want %d (metadata should fit in padding)", len(embedded), len(source))
+	}
+	if !bytes.HasSuffix(embedded, frames) {
+		t.Fatal("audio frames should be preserved")
+	}
+
+	blocks, _, err := parseFLACMetadataBlocks(embedded)
+	if err != nil {
+		t.Fatalf("parseFLACMetadataBlocks(embedded): %v", err)
+	}
+	hasApplication := false
+	for _, block := range blocks {
+		if block.Type == 2 && bytes.Equal(block.Data, application.Data) {
+			hasApplication = true
+		}
+	}
+	if !hasApplication {
+		t.Fatal("APPLICATION block should be preserved")
+	}
+
+	metadata, err := tag.ReadFrom(bytes.NewReader(embedded))
+	if err != nil {
+		t.Fatalf("ReadFrom(embedded): %v", err)
+	}
+	if metadata.Title() != "New Title" || metadata.Artist() != "New Artist" || metadata.Album() != "New Album" {
+		t.Fatalf("title/artist/album = %q/%q/%q", metadata.Title(), metadata.Artist(), metadata.Album())
+	}
+	if metadata.Genre() != "Jazz" || metadata.Lyrics() != "[00:01.00]lyric" {
+		t.Fatalf("genre/lyrics = %q/%q, want preserved Jazz and new lyric", metadata.Genre(), metadata.Lyrics())
+	}
+	if track, total := metadata.Track(); track != 4 || total != 9 {
+		t.Fatalf("track = %d/%d, want 4/9", track, total)
+	}
+	if metadata.Raw()["replaygain_track_gain"] != "-6.5 dB" {
+		t.Fatalf("unrelated comments should be preserved: %#v", metadata.Raw())
+	}
+	if picture := metadata.Picture(); picture == nil || !bytes.Equal(picture.Data, cover) {
+		t.Fatalf("picture = %#v, want embedded cover", picture)
+	}
+}
+
+func TestEmbedFLACMetadataGrowsWithoutPadding(t *testing.T) {
+	frames := []byte{0xFF, 0xF8, 0x00, 0x01}
+	source := buildTestFLAC([]flacMetadataBlock{{Type: flacBlockStreamInfo, Data: make([]byte, 34)}}, frames)
+
+	embedded, err := embedFLACMetadata(source, AudioMetadata{Title: "Song"}, nil, "")
+	if err != nil {
+		t.Fatalf("embedFLACMetadata() error = %v", err)
+	}
+	blocks, offset, err := parseFLACMetadataBlocks(embedded)
+	if err != nil {
+		t.Fatalf("parseFLACMetadataBlocks(embedded): %v", err)
+	}
+	if blocks[len(blocks)-1].Type != flacBlockPadding || len(blocks[len(blocks)-1].Data) != flacDefaultPadding {
+		t.Fatalf("last block = type %d len %d, want default padding", blocks[len(blocks)-1].Type, len(blocks[len(blocks)-1].Data))
+	}
+	if !bytes.Equal(embedded[offset:], frames) {
+		t.Fatal("audio frames should follow the rewritten metadata")
+	}
+}
+
+func TestEmbedFLACMetadataSkipsLeadingID3Tag(t *testing.T) {
+	frames := []byte{0xFF, 0xF8, 0x00, 0x01}
+	flac := buildTestFLAC([]flacMetadataBlock{
+		{Type: flacBlockStreamInfo, Data: make([]byte, 34)},
+		{Type: flacBlockPadding, Data: make([]byte, 1024)},
+	}, frames)
+	id3 := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}, make([]byte, 20)...)
+	source := append(id3, flac...)
+
+	embedded, err := embedFLACMetadata(source, AudioMetadata{Title: "Song"}, nil, "")
+	if err != nil {
+		t.Fatalf("embedFLACMetadata() error = %v", err)
+	}
+	if len(embedded) != len(flac) {
+		t.Fatalf("embedded size = %d, want %d", len(embedded), len(flac))
+	}
+	if _, _, err := parseFLACMetadataBlocks(embedded); err != nil {
+		t.Fatalf("parseFLACMetadataBlocks(embedded): %v", err)
+	}
+	if !bytes.HasSuffix(embedded, frames) {
+		t.Fatal("audio frames should be preserved")
+	}
+}
+
+func TestEmbedFLACMetadataSplitsOversizedPadding(t *testing.T) {
+	frames := []byte{0xFF, 0xF8, 0x00, 0x01}
+	source := buildTestFLAC([]flacMetadataBlock{
+		{Type: flacBlockStreamInfo, Data: make([]byte, 34)},
+		{Type: flacBlockPadding, Data: make([]byte, flacMaxBlockSize)},
+		{Type: flacBlockPadding, Data: make([]byte, 4096)},
+	}, frames)
+
+	embedded, err := embedFLACMetadata(source, AudioMetadata{}, nil, "")
+	if err != nil {
+		t.Fatalf("embedFLACMetadata() error = %v", err)
+	}
+	if len(embedded) != len(source) {
+		t.Fatalf("embedded size = %d, want %d", len(embedded), len(source))
+	}
+	blocks, offset, err := parseFLACMetadataBlocks(embedded)
+	if err != nil {
+		t.Fatalf("parseFLACMetadataBlocks(embedded): %v", err)
+	}
+	if offset != len(source)-len(frames) {
+		t.Fatalf("audio offset = %d, want %d", offset, len(source)-len(frames))
+	}
+	padding := 0
+	for _, block := range blocks {
+		if block.Type == flacBlockPadding {
+			padding++
+		}
+	}
+	if padding < 2 {
+		t.Fatalf("padding blocks = %d, want the padding split across several blocks", padding)
+	}
+}
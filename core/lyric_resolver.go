@@ -0,0 +1,391 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// ResolvedLyric is a lyric together with the song that supplied it. Fallback is
+// set when it came from another source than the one the song was played from,
+// Overridden when a SongOverride replaced or shifted it.
+type ResolvedLyric struct {
+	Lyric      string
+	Source     string
+	SongID     string
+	Fallback   bool
+	Overridden bool
+}
+
+type lyricCandidate struct {
+	song    model.Song
+	score   float64
+	durDiff int
+}
+
+type lyricCandidateResult struct {
+	candidate lyricCandidate
+	lyric     string
+	quality   int
+}
+
+type lyricCacheEntry struct {
+	result  *ResolvedLyric
+	expires time.Time
+}
+
+// Lyric quality, higher is better.
+const (
+	lyricQualityNone = iota
+	lyricQualityPlain
+	lyricQualityTimed
+	lyricQualityTranslated
+)
+
+var (
+	lyricResolverLyricFunc  = GetLyricFunc
+	lyricResolverSearchFunc = func(source string) SearchFunc {
+		return GetSearchFunc(source)
+	}
+	lyricResolverSourceNames = GetDefaultSourceNames
+)
+
+const (
+	lyricFallbackMinScore       = 0.85
+	lyricFallbackHighScore      = 0.98
+	lyricFallbackCandidates     = 5
+	lyricFallbackTriesPerSource = 2
+	lyricFallbackCallsPerSource = 4
+	lyricCacheHitTTL            = 6 * time.Hour
+	lyricCacheMissTTL           = 10 * time.Minute
+	lyricCacheMaxEntries        = 512
+)
+
+var lyricFallbackTimeout = 6 * time.Second
+
+// Provider calls take no context, so a call that outlives lyricFallbackTimeout
+// keeps its goroutine until the source answers. The slots cap how many of them
+// one slow source can hold at a time.
+var (
+	lyricSourceSlotsMu sync.Mutex
+	lyricSourceSlots   = map[string]chan struct{}{}
+)
+
+var (
+	lyricCacheMu sync.Mutex
+	lyricCache   = map[string]lyricCacheEntry{}
+)
+
+// ResolveLyric fetches the song's lyric from its own source and, when that
+// fails or only has plain text, looks the song up on the other lyric-capable
+// sources. Fallback matches must pass CalcSongSimilarity and the duration check;
+// timed lyrics beat plain text and translated ones beat untranslated. The lyric
+// chosen from another source is cached per SongKey. A SongOverride for the song
+// takes precedence over all of it.
+func ResolveLyric(song *model.Song) (*ResolvedLyric, error) {
+	if song == nil {
+		return nil, fmt.Errorf("missing song")
+	}
+	override, _ := GetSongOverride(song.Source, song.ID)
+	if override == nil {
+		return resolveLyric(song)
+	}
+	if override.Lyric != "" {
+		return &ResolvedLyric{Lyric: override.ApplyLyric(""), Source: song.Source, SongID: song.ID, Overridden: true}, nil
+	}
+
+	corrected := *song
+	override.applyTo(&corrected)
+	resolved, err := resolveLyric(&corrected)
+	if err != nil {
+		return nil, err
+	}
+	if override.LyricOffsetMs != 0 {
+		resolved.Lyric = override.ApplyLyric(resolved.Lyric)
+		resolved.Overridden = true
+	}
+	return resolved, nil
+}
+
+func resolveLyric(song *model.Song) (*ResolvedLyric, error) {
+	key := SongKey(song)
+	cached, searched := lookupLyricCache(key)
+	if cached != nil {
+		return cached, nil
+	}
+
+	var primary *ResolvedLyric
+	if fn := lyricResolverLyricFunc(song.Source); fn != nil {
+		if raw, err := fn(song); err == nil && strings.TrimSpace(raw) != "" {
+			primary = &ResolvedLyric{Lyric: raw, Source: song.Source, SongID: song.ID}
+			if lyricQuality(raw) >= lyricQualityTimed {
+				return primary, nil
+			}
+		}
+	}
+
+	if !searched {
+		found := findFallbackLyric(song)
+		storeLyricCache(key, found)
+		if found != nil {
+			return found, nil
+		}
+	}
+	if primary != nil {
+		return primary, nil
+	}
+	return nil, fmt.Errorf("lyric not found")
+}
+
+// lookupLyricCache returns a cached fallback lyric, and whether a search for
+// the key already ran recently.
+func lookupLyricCache(key string) (*ResolvedLyric, bool) {
+	lyricCacheMu.Lock()
+	defer lyricCacheMu.Unlock()
+	entry, ok := lyricCache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(lyricCache, key)
+		return nil, false
+	}
+	if entry.result == nil {
+		return nil, true
+	}
+	result := *entry.result
+	return &result, true
+}
+
+func storeLyricCache(key string, result *ResolvedLyric) {
+	lyricCacheMu.Lock()
+	defer lyricCacheMu.Unlock()
+	if len(lyricCache) >= lyricCacheMaxEntries {
+		now := time.Now()
+		for k, entry := range lyricCache {
+			if now.After(entry.expires) {
+				delete(lyricCache, k)
+			}
+		}
+		for k := range lyricCache {
+			if len(lyricCache) < lyricCacheMaxEntries {
+				break
+			}
+			delete(lyricCache, k)
+		}
+	}
+	ttl := lyricCacheMissTTL
+	if result != nil {
+		ttl = lyricCacheHitTTL
+		copied := *result
+		result = &copied
+	}
+	lyricCache[key] = lyricCacheEntry{result: result, expires: time.Now().Add(ttl)}
+}
+
+// ClearLyricCache forgets every resolved fallback lyric.
+func ClearLyricCache() {
+	lyricCacheMu.Lock()
+	defer lyricCacheMu.Unlock()
+	lyricCache = map[string]lyricCacheEntry{}
+}
+
+func lyricQuality(raw string) int {
+	if strings.TrimSpace(raw) == "" {
+		return lyricQualityNone
+	}
+	parsed := lyrics.Parse(raw)
+	switch {
+	case len(parsed.Lines) == 0:
+		return lyricQualityPlain
+	case parsed.HasTranslation():
+		return lyricQualityTranslated
+	default:
+		return lyricQualityTimed
+	}
+}
+
+func lyricFallbackSources(current string) []string {
+	var sources []string
+	for _, source := range lyricResolverSourceNames() {
+		if source == current || source == "local" {
+			continue
+		}
+		if lyricResolverSearchFunc(source) == nil || lyricResolverLyricFunc(source) == nil {
+			continue
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+func findFallbackLyric(song *model.Song) *ResolvedLyric {
+	name := strings.TrimSpace(song.Name)
+	artist := strings.TrimSpace(song.Artist)
+	if name == "" {
+		return nil
+	}
+	sources := lyricFallbackSources(song.Source)
+	if len(sources) == 0 {
+		return nil
+	}
+
+	results := make(chan *lyricCandidateResult, len(sources))
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source string) {
+			defer wg.Done()
+			results <- searchSourceLyric(source, name, artist, song.Duration)
+		}(source)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var best *lyricCandidateResult
+	for result := range results {
+		if result == nil {
+			continue
+		}
+		if best == nil || betterLyricCandidate(result, best) {
+			best = result
+		}
+		if best.quality == lyricQualityTranslated && best.candidate.score >= lyricFallbackHighScore {
+			break
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return &ResolvedLyric{
+		Lyric:    best.lyric,
+		Source:   best.candidate.song.Source,
+		SongID:   best.candidate.song.ID,
+		Fallback: true,
+	}
+}
+
+func betterLyricCandidate(a, b *lyricCandidateResult) bool {
+	if a.quality != b.quality {
+		return a.quality > b.quality
+	}
+	if a.candidate.score != b.candidate.score {
+		return a.candidate.score > b.candidate.score
+	}
+	return a.candidate.durDiff < b.candidate.durDiff
+}
+
+// searchSourceLyric returns the best timed lyric one source has for the song,
+// trying its closest matches in order.
+func searchSourceLyric(source, name, artist string, duration int) *lyricCandidateResult {
+	search := lyricResolverSearchFunc(source)
+	fetch := lyricResolverLyricFunc(source)
+	keyword := name
+	if artist != "" {
+		keyword = name + " " + artist
+	}
+
+	songs, err := lyricCallWithTimeout(source, func() ([]model.Song, error) { return search(keyword) })
+	if (err != nil || len(songs) == 0) && artist != "" {
+		songs, _ = lyricCallWithTimeout(source, func() ([]model.Song, error) { return search(name) })
+	}
+	if len(songs) > lyricFallbackCandidates {
+		songs = songs[:lyricFallbackCandidates]
+	}
+
+	var candidates []lyricCandidate
+	for _, cand := range songs {
+		cand.Source = source
+		score := CalcSongSimilarity(name, artist, cand.Name, cand.Artist)
+		if score < lyricFallbackMinScore {
+			continue
+		}
+		durDiff := 0
+		if duration > 0 && cand.Duration > 0 {
+			if !IsDurationClose(duration, cand.Duration) {
+				continue
+			}
+			durDiff = IntAbs(duration - cand.Duration)
+		}
+		candidates = append(candidates, lyricCandidate{song: cand, score: score, durDiff: durDiff})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score == candidates[j].score {
+			return candidates[i].durDiff < candidates[j].durDiff
+		}
+		return candidates[i].score > candidates[j].score
+	})
+
+	var best *lyricCandidateResult
+	for i, cand := range candidates {
+		if i >= lyricFallbackTriesPerSource {
+			break
+		}
+		song := cand.song
+		raw, err := lyricCallWithTimeout(source, func() (string, error) { return fetch(&song) })
+		if err != nil {
+			continue
+		}
+		quality := lyricQuality(raw)
+		if quality < lyricQualityTimed {
+			continue
+		}
+		result := &lyricCandidateResult{candidate: cand, lyric: raw, quality: quality}
+		if best == nil || betterLyricCandidate(result, best) {
+			best = result
+		}
+		if quality == lyricQualityTranslated {
+			break
+		}
+	}
+	return best
+}
+
+func lyricSourceSlot(source string) chan struct{} {
+	lyricSourceSlotsMu.Lock()
+	defer lyricSourceSlotsMu.Unlock()
+	slots, ok := lyricSourceSlots[source]
+	if !ok {
+		slots = make(chan struct{}, lyricFallbackCallsPerSource)
+		lyricSourceSlots[source] = slots
+	}
+	return slots
+}
+
+// lyricCallWithTimeout runs a provider call of source and gives up after
+// lyricFallbackTimeout, counting the time spent waiting for a free slot.
+func lyricCallWithTimeout[T any](source string, fn func() (T, error)) (T, error) {
+	type response struct {
+		value T
+		err   error
+	}
+	var zero T
+	timeout := time.NewTimer(lyricFallbackTimeout)
+	defer timeout.Stop()
+
+	slots := lyricSourceSlot(source)
+	select {
+	case slots <- struct{}{}:
+	case <-timeout.C:
+		return zero, fmt.Errorf("lyric fallback timeout")
+	}
+	done := make(chan response, 1)
+	go func() {
+		defer func() { <-slots }()
+		value, err := fn()
+		done <- response{value: value, err: err}
+	}()
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-timeout.C:
+		return zero, fmt.Errorf("lyric fallback timeout")
+	}
+}
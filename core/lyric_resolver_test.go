@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func stubLyricResolver(t *testing.T, lyricsBySource map[string]map[string]string, songsBySource map[string][]model.Song) *int32 {
+	t.Helper()
+	useTempConfigDB(t)
+	oldLyric, oldSearch, oldSources := lyricResolverLyricFunc, lyricResolverSearchFunc, lyricResolverSourceNames
+	var searches int32
+	lyricResolverSourceNames = func() []string { return []string{"netease", "qq", "kugou"} }
+	lyricResolverLyricFunc = func(source string) func(*model.Song) (string, error) {
+		byID, ok := lyricsBySource[source]
+		if !ok {
+			return nil
+		}
+		return func(song *model.Song) (string, error) {
+			if raw, ok := byID[song.ID]; ok {
+				return raw, nil
+			}
+			return "", errors.New("not found")
+		}
+	}
+	lyricResolverSearchFunc = func(source string) SearchFunc {
+		songs, ok := songsBySource[source]
+		if !ok {
+			return nil
+		}
+		return func(string) ([]model.Song, error) {
+			atomic.AddInt32(&searches, 1)
+			return songs, nil
+		}
+	}
+	ClearLyricCache()
+	t.Cleanup(func() {
+		lyricResolverLyricFunc, lyricResolverSearchFunc, lyricResolverSourceNames = oldLyric, oldSearch, oldSources
+		ClearLyricCache()
+	})
+	return &searches
+}
+
+func TestResolveLyricKeepsTimedPrimary(t *testing.T) {
+	searches := stubLyricResolver(t,
+		map[string]map[string]string{"netease": {"1": "[00:01.00]晴天"}},
+		map[string][]model.Song{"qq": {{ID: "q1", Name: "晴天", Artist: "周杰伦"}}},
+	)
+
+	got, err := ResolveLyric(&model.Song{ID: "1", Source: "netease", Name: "晴天", Artist: "周杰伦"})
+	if err != nil {
+		t.Fatalf("ResolveLyric returned error: %v", err)
+	}
+	if got.Source != "netease" || got.Fallback || got.Lyric != "[00:01.00]晴天" {
+		t.Fatalf("ResolveLyric = %+v, want primary netease lyric", got)
+	}
+	if *searches != 0 {
+		t.Fatalf("searches = %d, want none for a timed primary lyric", *searches)
+	}
+}
+
+func TestResolveLyricFallsBackToBestMatch(t *testing.T) {
+	searches := stubLyricResolver(t,
+		map[string]map[string]string{
+			"netease": {"1": "纯文本歌词"},
+			"qq":      {"q1": "[00:01.00]晴天", "q2": "[00:01.00]别的歌\n[00:01.00]another"},
+			"kugou":   {"k1": "[00:01.00]晴天\n[00:01.00]A sunny day"},
+		},
+		map[string][]model.Song{
+			"qq":    {{ID: "q2", Name: "别的歌", Artist: "别人", Duration: 269}, {ID: "q1", Name: "晴天", Artist: "周杰伦", Duration: 270}},
+			"kugou": {{ID: "k0", Name: "晴天", Artist: "周杰伦", Duration: 120}, {ID: "k1", Name: "晴天", Artist: "周杰伦", Duration: 268}},
+		},
+	)
+
+	song := &model.Song{ID: "1", Source: "netease", Name: "晴天", Artist: "周杰伦", Duration: 269}
+	got, err := ResolveLyric(song)
+	if err != nil {
+		t.Fatalf("ResolveLyric returned error: %v", err)
+	}
+	if !got.Fallback || got.Source != "kugou" || got.SongID != "k1" {
+		t.Fatalf("ResolveLyric = %+v, want translated kugou lyric k1", got)
+	}
+
+	before := *searches
+	again, err := ResolveLyric(song)
+	if err != nil || again.Source != "kugou" || again.Lyric != got.Lyric {
+		t.Fatalf("cached ResolveLyric = %+v, %v", again, err)
+	}
+	if *searches != before {
+		t.Fatalf("searches = %d after cache hit, want %d", *searches, before)
+	}
+}
+
+func TestResolveLyricKeepsPlainPrimaryWithoutMatch(t *testing.T) {
+	stubLyricResolver(t,
+		map[string]map[string]string{
+			"netease": {"1": "纯文本歌词"},
+			"qq":      {"q1": "[00:01.00]晴天"},
+		},
+		map[string][]model.Song{"qq": {{ID: "q1", Name: "晴天", Artist: "周杰伦", Duration: 100}}},
+	)
+
+	got, err := ResolveLyric(&model.Song{ID: "1", Source: "netease", Name: "晴天", Artist: "周杰伦", Duration: 269})
+	if err != nil {
+		t.Fatalf("ResolveLyric returned error: %v", err)
+	}
+	if got.Fallback || got.Lyric != "纯文本歌词" {
+		t.Fatalf("ResolveLyric = %+v, want plain primary lyric", got)
+	}
+
+	if _, err := ResolveLyric(&model.Song{ID: "2", Source: "netease", Name: "不存在", Artist: "无名"}); err == nil {
+		t.Fatalf("ResolveLyric should fail when no source has the lyric")
+	}
+}
+
+func TestLyricCallWithTimeoutCapsStuckCallsPerSource(t *testing.T) {
+	oldTimeout := lyricFallbackTimeout
+	lyricFallbackTimeout = 20 * time.Millisecond
+	release := make(chan struct{})
+	t.Cleanup(func() {
+		close(release)
+		lyricFallbackTimeout = oldTimeout
+		lyricSourceSlotsMu.Lock()
+		delete(lyricSourceSlots, "stuck-source")
+		lyricSourceSlotsMu.Unlock()
+	})
+
+	var started int32
+	stuck := func() (string, error) {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return "", nil
+	}
+	for i := 0; i < lyricFallbackCallsPerSource+3; i++ {
+		if _, err := lyricCallWithTimeout("stuck-source", stuck); err == nil {
+			t.Fatalf("call %d should time out", i)
+		}
+	}
+	if got := atomic.LoadInt32(&started); got != lyricFallbackCallsPerSource {
+		t.Fatalf("started calls = %d, want %d while the source hangs", got, lyricFallbackCallsPerSource)
+	}
+
+	if _, err := lyricCallWithTimeout("other-source", func() (string, error) { return "ok", nil }); err != nil {
+		t.Fatalf("other source should not be blocked: %v", err)
+	}
+}
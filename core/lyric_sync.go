@@ -0,0 +1,34 @@
+package core
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
+)
+
+func id3LanguageCode(lang string) []byte {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if len(lang) != 3 {
+		lang = "eng"
+	}
+	return []byte(lang)
+}
+
+// id3SYLTPayload encodes lyric lines as a SYLT frame with millisecond
+// timestamps (format 2) and content type "lyrics" (1).
+func id3SYLTPayload(version byte, lang string, lines []lyrics.Line) []byte {
+	encoding, desc, terminator := id3EncodedText(version, "")
+	payload := []byte{encoding}
+	payload = append(payload, id3LanguageCode(lang)...)
+	payload = append(payload, 0x02, 0x01)
+	payload = append(payload, desc...)
+	payload = append(payload, terminator...)
+	for _, line := range lines {
+		_, text, _ := id3EncodedText(version, line.Text)
+		payload = append(payload, text...)
+		payload = append(payload, terminator...)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(line.StartMs))
+	}
+	return payload
+}
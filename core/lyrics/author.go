@@ -0,0 +1,105 @@
+package lyrics
+
+import (
+	"sort"
+	"strings"
+)
+
+// Untimed marks a line without a timestamp in Distribute and Author.
+const Untimed = -1
+
+// PlainLines returns the non-empty lines of a lyric with their timestamps and
+// ID tags removed; it is the starting point for authoring timed lyrics.
+func PlainLines(text string) []string {
+	var lines []string
+	for _, rawLine := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(rawLine)
+		if metaTagRe.MatchString(line) {
+			continue
+		}
+		for {
+			match := leadingTimestampRe.FindString(line)
+			if match == "" {
+				break
+			}
+			line = line[len(match):]
+		}
+		if plain, _ := parseWords(line, 0); plain != "" {
+			lines = append(lines, plain)
+		}
+	}
+	return lines
+}
+
+// Distribute returns stamps with every Untimed entry filled in. Untimed lines
+// between two timed ones are spaced evenly between them, leading ones between
+// 0 and the first timed line, and trailing ones between the last timed line and
+// durationMs (DefaultLastLineMs apart when the duration is unknown).
+func Distribute(stamps []int, durationMs int) []int {
+	out := append([]int(nil), stamps...)
+	prev, prevTime := -1, 0
+	for i := 0; i <= len(out); i++ {
+		if i < len(out) && out[i] < 0 {
+			continue
+		}
+		count := i - prev - 1
+		if count > 0 {
+			switch {
+			case prev < 0:
+				// Leading run: the first line starts at 0.
+				end := 0
+				if i < len(out) {
+					end = out[i]
+				} else if durationMs > 0 {
+					end = durationMs
+				}
+				step := end / count
+				if end <= 0 {
+					step = DefaultLastLineMs
+				}
+				for k := 0; k < count; k++ {
+					out[k] = k * step
+				}
+			case i < len(out):
+				step := (out[i] - prevTime) / (count + 1)
+				for k := 1; k <= count; k++ {
+					out[prev+k] = prevTime + k*step
+				}
+			default:
+				step := DefaultLastLineMs
+				if durationMs > prevTime {
+					step = (durationMs - prevTime) / (count + 1)
+				}
+				for k := 1; k <= count; k++ {
+					out[prev+k] = prevTime + k*step
+				}
+			}
+		}
+		if i < len(out) {
+			prev, prevTime = i, out[i]
+		}
+	}
+	return out
+}
+
+// Author builds a lyric from lines and their tapped stamps (Untimed where no
+// tap was recorded), distributing the untimed lines over the song first.
+func Author(lines []string, stamps []int, durationMs int) *Lyric {
+	padded := make([]int, len(lines))
+	for i := range padded {
+		padded[i] = Untimed
+		if i < len(stamps) && stamps[i] >= 0 {
+			padded[i] = stamps[i]
+		}
+	}
+
+	lyric := &Lyric{}
+	for i, start := range Distribute(padded, durationMs) {
+		lyric.Lines = append(lyric.Lines, Line{StartMs: start, Text: lines[i]})
+	}
+	sort.SliceStable(lyric.Lines, func(i, j int) bool {
+		return lyric.Lines[i].StartMs < lyric.Lines[j].StartMs
+	})
+	lyric.fillEndTimes()
+	return lyric
+}
@@ -0,0 +1,44 @@
+package lyrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlainLines(t *testing.T) {
+	got := PlainLines("[ti:T]\r\n[00:01.00]第一句\n\n  第二句  \n[00:03.00]逐[00:03.50]字[00:04.00]\n")
+	want := []string{"第一句", "第二句", "逐字"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PlainLines = %q, want %q", got, want)
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	tests := []struct {
+		name     string
+		stamps   []int
+		duration int
+		want     []int
+	}{
+		{name: "between taps", stamps: []int{-1, -1, 3000, -1, 7000, -1}, duration: 10000, want: []int{0, 1500, 3000, 5000, 7000, 8500}},
+		{name: "all untimed over duration", stamps: []int{-1, -1, -1}, duration: 9000, want: []int{0, 3000, 6000}},
+		{name: "all untimed without duration", stamps: []int{-1, -1, -1}, want: []int{0, 5000, 10000}},
+		{name: "trailing without duration", stamps: []int{1000, -1}, want: []int{1000, 6000}},
+		{name: "fully timed", stamps: []int{100, 200}, duration: 1000, want: []int{100, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Distribute(tt.stamps, tt.duration); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Distribute = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthor(t *testing.T) {
+	got := Export(Author([]string{"一", "二", "三"}, []int{2000}, 8000), FormatLRC)
+	want := "[00:02.00]一\n[00:04.00]二\n[00:06.00]三"
+	if got != want {
+		t.Fatalf("Author = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,241 @@
+package lyrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format is a lyric or subtitle output format.
+type Format string
+
+const (
+	FormatLRC         Format = "lrc"
+	FormatEnhancedLRC Format = "elrc"
+	FormatSRT         Format = "srt"
+	FormatVTT         Format = "vtt"
+	FormatASS         Format = "ass"
+)
+
+// Formats lists the supported output formats.
+var Formats = []Format{FormatLRC, FormatEnhancedLRC, FormatSRT, FormatVTT, FormatASS}
+
+// ParseFormat accepts a format name or common alias; empty means LRC.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "."))) {
+	case "", "lrc":
+		return FormatLRC, nil
+	case "elrc", "enhanced", "enhanced-lrc", "a2":
+		return FormatEnhancedLRC, nil
+	case "srt":
+		return FormatSRT, nil
+	case "vtt", "webvtt":
+		return FormatVTT, nil
+	case "ass", "ssa":
+		return FormatASS, nil
+	default:
+		return "", fmt.Errorf("unsupported lyric format: %s", name)
+	}
+}
+
+// Ext returns the file extension without the dot.
+func (f Format) Ext() string {
+	if f == FormatEnhancedLRC {
+		return "lrc"
+	}
+	return string(f)
+}
+
+// ContentType returns the MIME type used when serving the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatVTT:
+		return "text/vtt; charset=utf-8"
+	case FormatSRT:
+		return "application/x-subrip; charset=utf-8"
+	case FormatASS:
+		return "text/x-ssa; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Export renders the lyric in the given format.
+func Export(l *Lyric, f Format) string {
+	if l == nil {
+		return ""
+	}
+	switch f {
+	case FormatEnhancedLRC:
+		return exportLRC(l, lrcWordsEnhanced)
+	case FormatSRT:
+		return exportSRT(l)
+	case FormatVTT:
+		return exportVTT(l)
+	case FormatASS:
+		return exportASS(l)
+	default:
+		return exportLRC(l, lrcWordsNone)
+	}
+}
+
+// Convert parses raw LRC and renders it in the given format.
+func Convert(raw string, f Format) string {
+	return Export(Parse(raw), f)
+}
+
+// lrcWordStyle selects how word timestamps are written into LRC output.
+type lrcWordStyle int
+
+const (
+	lrcWordsNone     lrcWordStyle = iota // plain line-synced LRC
+	lrcWordsEnhanced                     // [t]<t>w<t>w<t>
+	lrcWordsInline                       // [t]w[t]w[t], the form sources emit
+)
+
+func exportLRC(l *Lyric, style lrcWordStyle) string {
+	var b strings.Builder
+	for _, tag := range l.Tags {
+		if tag.Key == "offset" {
+			continue
+		}
+		fmt.Fprintf(&b, "[%s:%s]\n", tag.Key, tag.Value)
+	}
+	for _, line := range l.Lines {
+		stamp := FormatTimestamp(line.StartMs)
+		b.WriteString(stamp)
+		switch {
+		case style == lrcWordsEnhanced && len(line.Words) > 0:
+			for _, word := range line.Words {
+				b.WriteString(wordTimestamp(word.StartMs))
+				b.WriteString(word.Text)
+			}
+			b.WriteString(wordTimestamp(line.Words[len(line.Words)-1].EndMs))
+		case style == lrcWordsInline && len(line.Words) > 0:
+			for i, word := range line.Words {
+				switch {
+				case i > 0:
+					b.WriteString(FormatTimestamp(word.StartMs))
+				case word.StartMs != line.StartMs:
+					// A second "[t]" right after the line stamp would read
+					// as another line with the same text.
+					b.WriteString(wordTimestamp(word.StartMs))
+				}
+				b.WriteString(word.Text)
+			}
+			b.WriteString(FormatTimestamp(line.Words[len(line.Words)-1].EndMs))
+		default:
+			b.WriteString(line.Text)
+		}
+		b.WriteByte('\n')
+		for _, layer := range []string{line.Romanization, line.Translation} {
+			for _, text := range strings.Split(layer, "\n") {
+				if text != "" {
+					b.WriteString(stamp + text + "\n")
+				}
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func wordTimestamp(ms int) string {
+	stamp := FormatTimestamp(ms)
+	return "<" + stamp[1:len(stamp)-1] + ">"
+}
+
+func cueText(line Line) string {
+	text := line.Text
+	for _, layer := range []string{line.Romanization, line.Translation} {
+		if layer != "" {
+			text += "\n" + layer
+		}
+	}
+	return text
+}
+
+func exportSRT(l *Lyric) string {
+	var b strings.Builder
+	for i, line := range l.Lines {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, clockTime(line.StartMs, ","), clockTime(line.EndMs, ","), cueText(line))
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+func exportVTT(l *Lyric) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, line := range l.Lines {
+		// "-->" may not appear inside a cue payload.
+		text := strings.ReplaceAll(cueText(line), "-->", "->")
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", clockTime(line.StartMs, "."), clockTime(line.EndMs, "."), text)
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+func clockTime(ms int, sep string) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+func exportASS(l *Lyric) string {
+	title := l.Tag("ti")
+	if title == "" {
+		title = "Lyrics"
+	}
+
+	var b strings.Builder
+	b.WriteString("[Script Info]\n")
+	b.WriteString("Title: " + assText(title) + "\n")
+	b.WriteString("ScriptType: v4.00+\nWrapStyle: 0\nPlayResX: 1920\nPlayResY: 1080\nScaledBorderAndShadow: yes\n\n")
+	b.WriteString("[V4+ Styles]\n")
+	b.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	b.WriteString("Style: Default,Arial,64,&H00FFFFFF,&H0000A5FF,&H00000000,&H64000000,-1,0,0,0,100,100,0,0,1,3,1,2,60,60,120,1\n")
+	b.WriteString("Style: Romanization,Arial,40,&H00C8C8C8,&H00C8C8C8,&H00000000,&H64000000,0,1,0,0,100,100,0,0,1,2,1,8,60,60,60,1\n")
+	b.WriteString("Style: Translation,Arial,44,&H00E0E0E0,&H00E0E0E0,&H00000000,&H64000000,0,0,0,0,100,100,0,0,1,2,1,2,60,60,50,1\n\n")
+	b.WriteString("[Events]\n")
+	b.WriteString("Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	for _, line := range l.Lines {
+		start, end := assTime(line.StartMs), assTime(line.EndMs)
+		fmt.Fprintf(&b, "Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n", start, end, assKaraoke(line))
+		if line.Romanization != "" {
+			fmt.Fprintf(&b, "Dialogue: 0,%s,%s,Romanization,,0,0,0,,%s\n", start, end, assText(line.Romanization))
+		}
+		if line.Translation != "" {
+			fmt.Fprintf(&b, "Dialogue: 0,%s,%s,Translation,,0,0,0,,%s\n", start, end, assText(line.Translation))
+		}
+	}
+	return b.String()
+}
+
+// assKaraoke prefixes every word with a \k tag holding its length in
+// centiseconds; a gap before the first word is emitted as an empty syllable.
+func assKaraoke(line Line) string {
+	if len(line.Words) == 0 {
+		return assText(line.Text)
+	}
+	var b strings.Builder
+	if gap := (line.Words[0].StartMs - line.StartMs) / 10; gap > 0 {
+		b.WriteString(`{\k` + strconv.Itoa(gap) + `}`)
+	}
+	for _, word := range line.Words {
+		b.WriteString(`{\k` + strconv.Itoa(max(0, (word.EndMs-word.StartMs)/10)) + `}`)
+		b.WriteString(assText(word.Text))
+	}
+	return b.String()
+}
+
+var assTextReplacer = strings.NewReplacer("{", "(", "}", ")", "\r\n", `\N`, "\n", `\N`)
+
+func assText(text string) string {
+	return assTextReplacer.Replace(text)
+}
+
+func assTime(ms int) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%d:%02d:%02d.%02d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000/10)
+}
@@ -0,0 +1,89 @@
+package lyrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const karaokeSample = "[ti:Test]\n[00:01.00]你[00:01.50]好[00:02.00]\n[00:01.00]hello[00:02.00]\n[00:03.00]世界"
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{
+		"":       FormatLRC,
+		"LRC":    FormatLRC,
+		"elrc":   FormatEnhancedLRC,
+		".srt":   FormatSRT,
+		"webvtt": FormatVTT,
+		"ssa":    FormatASS,
+	}
+	for name, want := range tests {
+		got, err := ParseFormat(name)
+		if err != nil || got != want {
+			t.Fatalf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("docx"); err == nil {
+		t.Fatalf("ParseFormat(docx) should fail")
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	lyric := Parse(karaokeSample)
+	tests := []struct {
+		format Format
+		want   []string
+	}{
+		{
+			format: FormatLRC,
+			want:   []string{"[ti:Test]", "[00:01.00]你好\n[00:01.00]hello", "[00:03.00]世界"},
+		},
+		{
+			format: FormatEnhancedLRC,
+			want:   []string{"[00:01.00]<00:01.00>你<00:01.50>好<00:02.00>\n[00:01.00]hello"},
+		},
+		{
+			format: FormatSRT,
+			want:   []string{"1\n00:00:01,000 --> 00:00:02,000\n你好\nhello\n", "2\n00:00:03,000 --> 00:00:08,000\n世界\n"},
+		},
+		{
+			format: FormatVTT,
+			want:   []string{"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\n你好\nhello\n"},
+		},
+		{
+			format: FormatASS,
+			want: []string{
+				"Title: Test",
+				`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\k50}你{\k50}好`,
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Translation,,0,0,0,,hello",
+				"Dialogue: 0,0:00:03.00,0:00:08.00,Default,,0,0,0,,世界",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got := Export(lyric, tt.format)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Fatalf("%s export missing %q:\n%s", tt.format, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLRCExportRoundTrips(t *testing.T) {
+	raw := "[ti:Test]\n[00:01.00]<00:01.20>你[00:01.50]好[00:02.00]\n[00:01.00]hello\n[00:03.00]世[00:03.40]界[00:04.00]"
+	lyric := Parse(raw)
+	if got := lyric.Lines[0].Words[0].StartMs; got != 1200 {
+		t.Fatalf("first word starts at %d, want 1200", got)
+	}
+
+	for _, style := range []lrcWordStyle{lrcWordsEnhanced, lrcWordsInline} {
+		exported := exportLRC(lyric, style)
+		if got := Parse(exported); !reflect.DeepEqual(got, lyric) {
+			t.Fatalf("style %d does not round-trip:\n%s\ngot  %#v\nwant %#v", style, exported, got, lyric)
+		}
+	}
+}
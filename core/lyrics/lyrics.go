@@ -0,0 +1,379 @@
+// Package lyrics parses LRC lyrics into a structured model and converts them to
+// subtitle formats used by video editors and players.
+package lyrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultLastLineMs is how long the last line stays on screen when nothing
+// tells where it ends.
+const DefaultLastLineMs = 5000
+
+var (
+	leadingTimestampRe = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	inlineTimestampRe  = regexp.MustCompile(`[\[<](\d+):(\d{1,2})(?:[.:](\d{1,3}))?[\]>]`)
+	metaTagRe          = regexp.MustCompile(`^\[([A-Za-z]+):([^\]]*)\]$`)
+)
+
+// Tag is an LRC ID tag such as [ti:Title] or [offset:+200].
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Word is one karaoke syllable with absolute times in milliseconds.
+type Word struct {
+	StartMs int
+	EndMs   int
+	Text    string
+}
+
+// Line is one timed lyric line. Words is empty for plain line-synced LRC.
+// Further lines sharing the same timestamp are kept as the Translation and
+// Romanization layers of the original Text.
+type Line struct {
+	StartMs      int
+	EndMs        int
+	Text         string
+	Words        []Word
+	Translation  string
+	Romanization string
+}
+
+// Lyric is a parsed LRC document.
+type Lyric struct {
+	Tags  []Tag
+	Lines []Line
+}
+
+// Tag returns the value of the first tag with the given key.
+func (l *Lyric) Tag(key string) string {
+	for _, tag := range l.Tags {
+		if strings.EqualFold(tag.Key, key) {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// HasWords reports whether any line carries word level timestamps.
+func (l *Lyric) HasWords() bool {
+	for _, line := range l.Lines {
+		if len(line.Words) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRomanization reports whether any line carries a romanization.
+func (l *Lyric) HasRomanization() bool {
+	for _, line := range l.Lines {
+		if line.Romanization != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTranslation reports whether any line carries a translation.
+func (l *Lyric) HasTranslation() bool {
+	for _, line := range l.Lines {
+		if line.Translation != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads line timestamps (including repeated "[t1][t2]text" prefixes),
+// word level stamps in both "[t]w[t]w" and enhanced "<t>w<t>w" form, ID tags and
+// the translation and romanization layers that sources emit as extra lines with
+// the same timestamp. Lines are returned in time order with end times filled.
+func Parse(raw string) *Lyric {
+	lyric := &Lyric{}
+	index := map[int]int{}
+	for _, rawLine := range strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(rawLine)
+		if line == "" {
+			continue
+		}
+		if match := metaTagRe.FindStringSubmatch(line); match != nil {
+			lyric.Tags = append(lyric.Tags, Tag{Key: strings.ToLower(match[1]), Value: strings.TrimSpace(match[2])})
+			continue
+		}
+
+		var starts []int
+		for {
+			match := leadingTimestampRe.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			starts = append(starts, timestampMs(match[1], match[2], match[3]))
+			line = line[len(match[0]):]
+		}
+		if len(starts) == 0 {
+			continue
+		}
+		text, words := parseWords(line, starts[0])
+		if text == "" {
+			continue
+		}
+
+		for _, start := range starts {
+			if i, ok := index[start]; ok {
+				lyric.Lines[i].addLayer(text)
+				continue
+			}
+			index[start] = len(lyric.Lines)
+			lyric.Lines = append(lyric.Lines, Line{StartMs: start, Text: text, Words: shiftWords(words, start-starts[0])})
+		}
+	}
+
+	if offset, err := strconv.Atoi(strings.TrimPrefix(lyric.Tag("offset"), "+")); err == nil && offset != 0 {
+		lyric.shift(-offset)
+	}
+	sort.SliceStable(lyric.Lines, func(i, j int) bool {
+		return lyric.Lines[i].StartMs < lyric.Lines[j].StartMs
+	})
+	lyric.fillEndTimes()
+	return lyric
+}
+
+// addLayer files an extra line with the same timestamp. A Latin-script line
+// under a kana or Hangul original, or one with a syllable per Han character
+// (pinyin), is taken as romanization; anything else fills the translation first.
+func (line *Line) addLayer(text string) {
+	if text == line.Text || text == line.Translation || text == line.Romanization {
+		return
+	}
+	switch {
+	case line.Romanization == "" && looksLikeRomanization(line.Text, text):
+		line.Romanization = text
+	case line.Translation == "":
+		line.Translation = text
+	case line.Romanization == "":
+		line.Romanization = text
+	}
+}
+
+func isLatinText(text string) bool {
+	latin := false
+	for _, r := range text {
+		switch {
+		case isCJKRune(r):
+			return false
+		case unicode.IsLetter(r) && r < 0x250:
+			latin = true
+		}
+	}
+	return latin
+}
+
+func looksLikeRomanization(original, text string) bool {
+	if !isLatinText(text) {
+		return false
+	}
+	// Pinyin has one syllable per Han character; Latin words in the original
+	// (as in "Baby 我爱你") carry over unchanged.
+	han, words, inWord := 0, 0, false
+	for _, r := range original {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			return true
+		case unicode.Is(unicode.Han, r):
+			han++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	return han > 0 && len(strings.Fields(text)) == han+words
+}
+
+func isCJKRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// parseWords splits a line body at its inline timestamps. Text before the first
+// stamp starts with the line itself; a trailing stamp only marks the end of the
+// last word.
+func parseWords(body string, lineStart int) (string, []Word) {
+	matches := inlineTimestampRe.FindAllStringSubmatchIndex(body, -1)
+	if len(matches) == 0 {
+		return strings.TrimSpace(body), nil
+	}
+
+	var words []Word
+	var text strings.Builder
+	appendWord := func(start int, segment string) {
+		text.WriteString(segment)
+		if strings.TrimSpace(segment) != "" {
+			words = append(words, Word{StartMs: start, Text: segment})
+		}
+	}
+
+	appendWord(lineStart, body[:matches[0][0]])
+	for i, match := range matches {
+		start := timestampMs(body[match[2]:match[3]], body[match[4]:match[5]], submatch(body, match, 6))
+		if len(words) > 0 && words[len(words)-1].EndMs == 0 {
+			words[len(words)-1].EndMs = start
+		}
+		end := len(body)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		appendWord(start, body[match[1]:end])
+	}
+	return strings.TrimSpace(text.String()), words
+}
+
+func submatch(s string, match []int, group int) string {
+	if match[group] < 0 {
+		return ""
+	}
+	return s[match[group]:match[group+1]]
+}
+
+func shiftWords(words []Word, delta int) []Word {
+	if len(words) == 0 {
+		return nil
+	}
+	out := make([]Word, len(words))
+	for i, word := range words {
+		out[i] = word
+		out[i].StartMs += delta
+		if word.EndMs > 0 {
+			out[i].EndMs += delta
+		}
+	}
+	return out
+}
+
+func (l *Lyric) shift(delta int) {
+	for i := range l.Lines {
+		l.Lines[i].StartMs = max(0, l.Lines[i].StartMs+delta)
+		for j := range l.Lines[i].Words {
+			l.Lines[i].Words[j].StartMs = max(0, l.Lines[i].Words[j].StartMs+delta)
+			if l.Lines[i].Words[j].EndMs > 0 {
+				l.Lines[i].Words[j].EndMs = max(0, l.Lines[i].Words[j].EndMs+delta)
+			}
+		}
+	}
+}
+
+// fillEndTimes ends every line where its last word ends, or else where the next
+// line starts, and closes open words at the end of their line.
+func (l *Lyric) fillEndTimes() {
+	for i := range l.Lines {
+		line := &l.Lines[i]
+		next := -1
+		if i+1 < len(l.Lines) {
+			next = l.Lines[i+1].StartMs
+		}
+
+		wordsEnd := 0
+		if n := len(line.Words); n > 0 {
+			wordsEnd = line.Words[n-1].EndMs
+		}
+		switch {
+		case wordsEnd > line.StartMs && (next < 0 || wordsEnd <= next):
+			line.EndMs = wordsEnd
+		case next > line.StartMs:
+			line.EndMs = next
+		default:
+			line.EndMs = line.StartMs + DefaultLastLineMs
+		}
+
+		for j := range line.Words {
+			if line.Words[j].EndMs > line.Words[j].StartMs {
+				continue
+			}
+			if j+1 < len(line.Words) {
+				line.Words[j].EndMs = line.Words[j+1].StartMs
+			} else {
+				line.Words[j].EndMs = line.EndMs
+			}
+		}
+	}
+}
+
+func timestampMs(minutes, seconds, fraction string) int {
+	min, _ := strconv.Atoi(minutes)
+	sec, _ := strconv.Atoi(seconds)
+	ms := 0
+	if fraction != "" {
+		ms, _ = strconv.Atoi(fraction)
+		switch len(fraction) {
+		case 1:
+			ms *= 100
+		case 2:
+			ms *= 10
+		}
+	}
+	return (min*60+sec)*1000 + ms
+}
+
+// FormatTimestamp renders milliseconds as an LRC "[mm:ss.xx]" stamp.
+func FormatTimestamp(ms int) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("[%02d:%02d.%02d]", ms/60000, ms/1000%60, ms%1000/10)
+}
+
+// SplitTranslation separates translated lines from the original lyric. The raw
+// text is returned unchanged when it carries no translation.
+func SplitTranslation(raw string) (string, string) {
+	lyric := Parse(raw)
+	if !lyric.HasTranslation() {
+		return raw, ""
+	}
+
+	var original, translation strings.Builder
+	for _, line := range lyric.Lines {
+		original.WriteString(FormatTimestamp(line.StartMs) + line.Text + "\n")
+		if line.Translation != "" {
+			translation.WriteString(FormatTimestamp(line.StartMs) + line.Translation + "\n")
+		}
+	}
+	return strings.TrimRight(original.String(), "\n"), strings.TrimRight(translation.String(), "\n")
+}
+
+// DetectLanguage guesses an ISO 639-2 code from the script the text uses.
+func DetectLanguage(text string) string {
+	var han, kana, hangul, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.IsLetter(r) && r < unicode.MaxLatin1:
+			latin++
+		}
+	}
+	switch {
+	case hangul > 0 && hangul >= han:
+		return "kor"
+	case kana > 0:
+		return "jpn"
+	case han > 0 && han*2 >= latin:
+		return "chi"
+	default:
+		return "eng"
+	}
+}
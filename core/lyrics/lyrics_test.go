@@ -0,0 +1,81 @@
+package lyrics
+
+import "testing"
+
+func TestParseTimedLines(t *testing.T) {
+	raw := "[ti:Song]\n[00:05.20]<00:05.20>Hello <00:05.80>world\n[00:01.5][00:10.00]Chorus\n[00:05.20]你好世界"
+	lyric := Parse(raw)
+	lines := lyric.Lines
+	if len(lines) != 3 {
+		t.Fatalf("Parse() returned %d lines, want 3: %#v", len(lines), lines)
+	}
+	if lyric.Tag("ti") != "Song" {
+		t.Fatalf("title tag = %q, want Song", lyric.Tag("ti"))
+	}
+	if lines[0].StartMs != 1500 || lines[0].Text != "Chorus" || lines[0].EndMs != 5200 {
+		t.Fatalf("first line = %#v, want Chorus 1500-5200ms", lines[0])
+	}
+	if lines[1].StartMs != 5200 || lines[1].Text != "Hello world" || lines[1].Translation != "你好世界" {
+		t.Fatalf("second line = %#v, want karaoke text with translation", lines[1])
+	}
+	if lines[2].StartMs != 10000 || lines[2].Text != "Chorus" || lines[2].EndMs != 10000+DefaultLastLineMs {
+		t.Fatalf("third line = %#v, want repeated Chorus at 10000ms", lines[2])
+	}
+}
+
+func TestParseWordTimestamps(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "bracket stamps", raw: "[00:01.00]你[00:01.50]好[00:02.00]\n[00:03.00]next"},
+		{name: "enhanced stamps", raw: "[00:01.00]<00:01.00>你<00:01.50>好<00:02.00>\n[00:03.00]next"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := Parse(tt.raw).Lines[0]
+			want := []Word{{StartMs: 1000, EndMs: 1500, Text: "你"}, {StartMs: 1500, EndMs: 2000, Text: "好"}}
+			if len(line.Words) != len(want) {
+				t.Fatalf("words = %#v, want %#v", line.Words, want)
+			}
+			for i := range want {
+				if line.Words[i] != want[i] {
+					t.Fatalf("word %d = %#v, want %#v", i, line.Words[i], want[i])
+				}
+			}
+			if line.Text != "你好" || line.EndMs != 2000 {
+				t.Fatalf("line = %#v, want text 你好 ending at 2000ms", line)
+			}
+		})
+	}
+}
+
+func TestParseAppliesOffset(t *testing.T) {
+	lines := Parse("[offset:+500]\n[00:01.00]a\n[00:02.00]b").Lines
+	if lines[0].StartMs != 500 || lines[1].StartMs != 1500 {
+		t.Fatalf("offset not applied: %#v", lines)
+	}
+}
+
+func TestSplitTranslationKeepsPlainLyricUnchanged(t *testing.T) {
+	raw := "[00:01.00]一行\n[00:02.00]两行"
+	original, translation := SplitTranslation(raw)
+	if original != raw || translation != "" {
+		t.Fatalf("SplitTranslation() = %q/%q, want unchanged lyric and no translation", original, translation)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"你好世界":        "chi",
+		"こんにちは世界":     "jpn",
+		"안녕하세요":       "kor",
+		"hello world": "eng",
+	}
+	for text, want := range tests {
+		if got := DetectLanguage(text); got != want {
+			t.Fatalf("DetectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
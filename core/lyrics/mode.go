@@ -0,0 +1,105 @@
+package lyrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mode selects which lyric layers are shown and how they are combined.
+type Mode string
+
+const (
+	ModeOriginal    Mode = "original"
+	ModeTranslation Mode = "translation"
+	ModeStacked     Mode = "stacked"
+	ModeSideBySide  Mode = "side_by_side"
+)
+
+// DefaultSeparator joins layers in side-by-side mode.
+const DefaultSeparator = " / "
+
+// ParseMode accepts a mode name or common alias; empty means stacked, which is
+// how sources deliver bilingual lyrics.
+func ParseMode(name string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "stacked", "bilingual":
+		return ModeStacked, nil
+	case "original", "orig":
+		return ModeOriginal, nil
+	case "translation", "trans":
+		return ModeTranslation, nil
+	case "side_by_side", "side-by-side", "sidebyside", "side":
+		return ModeSideBySide, nil
+	default:
+		return "", fmt.Errorf("unsupported lyric mode: %s", name)
+	}
+}
+
+// Options controls Apply.
+type Options struct {
+	Mode         Mode
+	Separator    string // side-by-side only; DefaultSeparator when empty
+	Romanization bool   // keep the romanization layer in original, stacked and side-by-side output
+}
+
+// Apply returns a copy of the lyric with the layers chosen by opts:
+//   - original keeps the original text (and its word timing) only;
+//   - translation shows the translation, falling back to the original line;
+//   - stacked keeps original and translation as separate lines;
+//   - side-by-side joins the layers into one line with the separator.
+func (l *Lyric) Apply(opts Options) *Lyric {
+	separator := opts.Separator
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+
+	out := &Lyric{Tags: append([]Tag(nil), l.Tags...), Lines: make([]Line, len(l.Lines))}
+	for i, line := range l.Lines {
+		if !opts.Romanization {
+			line.Romanization = ""
+		}
+		switch opts.Mode {
+		case ModeOriginal:
+			line.Translation = ""
+		case ModeTranslation:
+			if line.Translation != "" {
+				line.Text, line.Words = line.Translation, nil
+			}
+			line.Translation, line.Romanization = "", ""
+		case ModeSideBySide:
+			parts := []string{line.Text}
+			for _, layer := range []string{line.Romanization, line.Translation} {
+				if layer != "" {
+					parts = append(parts, layer)
+				}
+			}
+			if len(parts) > 1 {
+				line.Text, line.Words = strings.Join(parts, separator), nil
+			}
+			line.Translation, line.Romanization = "", ""
+		}
+		out.Lines[i] = line
+	}
+	return out
+}
+
+// FormatMode re-renders raw LRC with the layers chosen by opts. Word timing is
+// written in the "[t]w[t]w" form sources use when keepWords is set.
+func FormatMode(raw string, opts Options, keepWords bool) string {
+	style := lrcWordsNone
+	if keepWords {
+		style = lrcWordsInline
+	}
+	return exportLRC(Parse(raw).Apply(opts), style)
+}
+
+// Shift moves every line and word by deltaMs, positive values showing them
+// later. Lyrics without timestamps are returned unchanged.
+func Shift(raw string, deltaMs int) string {
+	l := Parse(raw)
+	if deltaMs == 0 || len(l.Lines) == 0 {
+		return raw
+	}
+	l.shift(deltaMs)
+	return exportLRC(l, lrcWordsInline)
+}
@@ -0,0 +1,107 @@
+package lyrics
+
+import (
+	"strings"
+	"testing"
+)
+
+const layeredSample = "[00:01.00]君[00:01.50]の名は[00:02.00]\n[00:01.00]kimi no na wa\n[00:01.00]你的名字\n[00:03.00]星"
+
+func TestParseIdentifiesLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantRoma string
+		wantTran string
+	}{
+		{name: "kana with romaji", raw: layeredSample, wantRoma: "kimi no na wa", wantTran: "你的名字"},
+		{name: "pinyin", raw: "[00:01.00]你好\n[00:01.00]ni hao", wantRoma: "ni hao"},
+		{name: "english translation", raw: "[00:01.00]你好\n[00:01.00]hello", wantTran: "hello"},
+		{name: "chinese translation of english", raw: "[00:01.00]hello\n[00:01.00]你好", wantTran: "你好"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := Parse(tt.raw).Lines[0]
+			if line.Romanization != tt.wantRoma || line.Translation != tt.wantTran {
+				t.Fatalf("layers = roma %q / trans %q, want %q / %q", line.Romanization, line.Translation, tt.wantRoma, tt.wantTran)
+			}
+		})
+	}
+}
+
+func TestFormatMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		keepWords bool
+		want      string
+	}{
+		{
+			name:      "original keeps word timing",
+			opts:      Options{Mode: ModeOriginal},
+			keepWords: true,
+			want:      "[00:01.00]君[00:01.50]の名は[00:02.00]\n[00:03.00]星",
+		},
+		{
+			name: "translation falls back to original",
+			opts: Options{Mode: ModeTranslation},
+			want: "[00:01.00]你的名字\n[00:03.00]星",
+		},
+		{
+			name: "stacked",
+			opts: Options{Mode: ModeStacked},
+			want: "[00:01.00]君の名は\n[00:01.00]你的名字\n[00:03.00]星",
+		},
+		{
+			name: "stacked with romanization",
+			opts: Options{Mode: ModeStacked, Romanization: true},
+			want: "[00:01.00]君の名は\n[00:01.00]kimi no na wa\n[00:01.00]你的名字\n[00:03.00]星",
+		},
+		{
+			name: "side by side",
+			opts: Options{Mode: ModeSideBySide, Separator: " | "},
+			want: "[00:01.00]君の名は | 你的名字\n[00:03.00]星",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatMode(layeredSample, tt.opts, tt.keepWords); got != tt.want {
+				t.Fatalf("FormatMode() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySideBySideSRT(t *testing.T) {
+	got := Export(Parse(layeredSample).Apply(Options{Mode: ModeSideBySide}), FormatSRT)
+	if !strings.Contains(got, "\n君の名は / 你的名字\n") {
+		t.Fatalf("side-by-side srt = %q", got)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for name, want := range map[string]Mode{"": ModeStacked, "side-by-side": ModeSideBySide, "Original": ModeOriginal} {
+		if got, err := ParseMode(name); err != nil || got != want {
+			t.Fatalf("ParseMode(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseMode("karaoke"); err == nil {
+		t.Fatalf("ParseMode(karaoke) should fail")
+	}
+}
+
+func TestShift(t *testing.T) {
+	got := Shift("[ti:T]\n[00:01.00]你[00:01.50]好[00:02.00]\n[00:01.00]hello\n[00:03.00]世界", 500)
+	want := "[ti:T]\n[00:01.50]你[00:02.00]好[00:02.50]\n[00:01.50]hello\n[00:03.50]世界"
+	if got != want {
+		t.Fatalf("Shift = %q, want %q", got, want)
+	}
+	if got := Shift("[00:00.20]开头", -1000); got != "[00:00.00]开头" {
+		t.Fatalf("Shift clamps at zero = %q", got)
+	}
+	if got := Shift("plain text", 500); got != "plain text" {
+		t.Fatalf("Shift changed untimed lyric: %q", got)
+	}
+}
@@ -0,0 +1,300 @@
+package lyrics
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//go:embed pinyin.txt
+var pinyinTable string
+
+var (
+	pinyinOnce  sync.Once
+	pinyinByHan map[rune]string
+)
+
+func pinyinOf(r rune) (string, bool) {
+	pinyinOnce.Do(func() {
+		pinyinByHan = make(map[rune]string, 21000)
+		for _, line := range strings.Split(pinyinTable, "\n") {
+			reading, chars, ok := strings.Cut(strings.TrimSpace(line), " ")
+			if !ok || strings.HasPrefix(line, "#") {
+				continue
+			}
+			for _, c := range chars {
+				pinyinByHan[c] = reading
+			}
+		}
+	})
+	reading, ok := pinyinByHan[r]
+	return reading, ok
+}
+
+// Romanize returns a pronunciation guide for one lyric line: tone-marked pinyin
+// for Chinese, Hepburn romaji for kana and Revised Romanization for Hangul,
+// space separated per Han character and per kana or Hangul word. Kanji in lines
+// that contain kana are left out because their reading depends on the word.
+// Text without any of these scripts yields "".
+func Romanize(text string) string {
+	runes := []rune(text)
+	japanese := false
+	for _, r := range runes {
+		if isKana(r) {
+			japanese = true
+			break
+		}
+	}
+
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	romanized := false
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isKana(r):
+			flush()
+			j := i
+			for j < len(runes) && (isKana(runes[j]) || runes[j] == 'ー') {
+				j++
+			}
+			tokens = append(tokens, kanaToRomaji(runes[i:j]))
+			romanized = true
+			i = j
+			continue
+		case unicode.Is(unicode.Hangul, r):
+			flush()
+			j := i
+			for j < len(runes) && isHangulSyllable(runes[j]) {
+				j++
+			}
+			if j == i {
+				// Lone jamo have no syllable reading.
+				i++
+				continue
+			}
+			tokens = append(tokens, hangulToLatin(runes[i:j]))
+			romanized = true
+			i = j
+			continue
+		case unicode.Is(unicode.Han, r):
+			flush()
+			if reading, ok := pinyinOf(r); ok && !japanese {
+				tokens = append(tokens, reading)
+				romanized = true
+			}
+		case unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r):
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+		i++
+	}
+	flush()
+	if !romanized {
+		return ""
+	}
+	return strings.Join(tokens, " ")
+}
+
+// AddRomanization fills the romanization layer of every line that has none
+// from its original text.
+func (l *Lyric) AddRomanization() {
+	for i := range l.Lines {
+		if l.Lines[i].Romanization == "" {
+			l.Lines[i].Romanization = Romanize(l.Lines[i].Text)
+		}
+	}
+}
+
+// WithRomanization re-renders raw LRC with a generated romanization line under
+// every line that lacks one, keeping word timing in the "[t]w[t]w" form.
+func WithRomanization(raw string) string {
+	lyric := Parse(raw)
+	if len(lyric.Lines) == 0 {
+		return raw
+	}
+	lyric.AddRomanization()
+	return exportLRC(lyric, lrcWordsInline)
+}
+
+func isKana(r rune) bool {
+	return (r >= 0x3041 && r <= 0x3096) || (r >= 0x30A1 && r <= 0x30FA)
+}
+
+// ==========================================
+// 假名 → 罗马字（平文式）
+// ==========================================
+
+var hiraganaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'ゔ': "vu", 'ゕ': "ka", 'ゖ': "ke",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+func toHiragana(r rune) rune {
+	if r >= 0x30A1 && r <= 0x30F6 {
+		return r - 0x60
+	}
+	return r
+}
+
+func isSmallYoon(r rune) bool {
+	return r == 'ゃ' || r == 'ゅ' || r == 'ょ'
+}
+
+func isSmallVowel(r rune) bool {
+	return r == 'ぁ' || r == 'ぃ' || r == 'ぅ' || r == 'ぇ' || r == 'ぉ'
+}
+
+// kanaSyllables splits a kana run into romaji syllables, merging small kana
+// with the syllable before them (きゃ kya, しょ sho, ファ fa, ティ ti).
+func kanaSyllables(run []rune) []string {
+	var out []string
+	for _, raw := range run {
+		r := toHiragana(raw)
+		romaji, ok := hiraganaRomaji[r]
+		switch {
+		case raw == 'ー':
+			// The long vowel mark repeats the previous vowel.
+			if n := len(out); n > 0 && out[n-1] != "" {
+				prev := out[n-1]
+				out[n-1] = prev + prev[len(prev)-1:]
+			}
+			continue
+		case r == 'っ' || r == 'ヷ' || !ok:
+			out = append(out, "")
+			continue
+		}
+
+		n := len(out)
+		if n == 0 || out[n-1] == "" || !(isSmallYoon(r) || isSmallVowel(r)) {
+			out = append(out, romaji)
+			continue
+		}
+		prev := out[n-1]
+		if isSmallYoon(r) {
+			if !strings.HasSuffix(prev, "i") || prev == "i" {
+				out = append(out, romaji)
+				continue
+			}
+			stem := strings.TrimSuffix(prev, "i")
+			if stem == "sh" || stem == "ch" || stem == "j" {
+				out[n-1] = stem + romaji[1:]
+			} else {
+				out[n-1] = stem + romaji
+			}
+			continue
+		}
+		// Small vowels build the loanword sounds: ファ fa, ティ ti, ウィ wi.
+		stem := strings.TrimRight(prev, "aiueo")
+		switch prev {
+		case "u":
+			stem = "w"
+		case "fu", "vu", "tsu":
+			stem = strings.TrimSuffix(prev, "u")
+		}
+		out[n-1] = stem + romaji
+	}
+	return out
+}
+
+func kanaToRomaji(run []rune) string {
+	syllables := kanaSyllables(run)
+	var b strings.Builder
+	for i, syllable := range syllables {
+		if syllable == "" {
+			// っ doubles the next consonant; ch becomes tch.
+			if i+1 < len(syllables) && syllables[i+1] != "" {
+				next := syllables[i+1]
+				switch {
+				case strings.HasPrefix(next, "ch"):
+					b.WriteByte('t')
+				case !strings.ContainsRune("aiueon", rune(next[0])):
+					b.WriteByte(next[0])
+				}
+			}
+			continue
+		}
+		if syllable == "n" && i+1 < len(syllables) && syllables[i+1] != "" && strings.ContainsRune("aiueoy", rune(syllables[i+1][0])) {
+			b.WriteString("n'")
+			continue
+		}
+		b.WriteString(syllable)
+	}
+	return b.String()
+}
+
+// ==========================================
+// 韩文 → 罗马字（国语罗马字，仅处理连音）
+// ==========================================
+
+var (
+	hangulInitials = []string{"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h"}
+	hangulMedials  = []string{"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae", "oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i"}
+	hangulFinals   = []string{"", "k", "k", "k", "n", "n", "n", "t", "l", "k", "m", "l", "l", "l", "p", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t"}
+	// hangulLinkedFinals is how a single final consonant sounds when it moves
+	// onto a following syllable that starts with the silent ㅇ (한국어 hangugeo).
+	hangulLinkedFinals = map[int]string{1: "g", 2: "kk", 4: "n", 7: "d", 8: "r", 16: "m", 17: "b", 19: "s", 20: "ss", 22: "j", 23: "ch", 24: "k", 25: "t", 26: "p", 27: ""}
+)
+
+const (
+	hangulBase      = 0xAC00
+	hangulLast      = 0xD7A3
+	hangulSilentIdx = 11
+)
+
+func isHangulSyllable(r rune) bool {
+	return r >= hangulBase && r <= hangulLast
+}
+
+func hangulToLatin(run []rune) string {
+	var b strings.Builder
+	carry := ""
+	for i, r := range run {
+		index := int(r - hangulBase)
+		initial, medial, final := index/(21*28), index/28%21, index%28
+
+		onset := hangulInitials[initial]
+		if initial == hangulSilentIdx && carry != "" {
+			onset = carry
+		}
+		carry = ""
+		b.WriteString(onset)
+		b.WriteString(hangulMedials[medial])
+
+		if final == 0 {
+			continue
+		}
+		if i+1 < len(run) && int(run[i+1]-hangulBase)/(21*28) == hangulSilentIdx {
+			if linked, ok := hangulLinkedFinals[final]; ok {
+				carry = linked
+				continue
+			}
+		}
+		b.WriteString(hangulFinals[final])
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package lyrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRomanize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "pinyin", text: "晴天 我爱你", want: "qíng tiān wǒ ài nǐ"},
+		{name: "latin kept", text: "Baby 我爱你", want: "Baby wǒ ài nǐ"},
+		{name: "hiragana", text: "さくらさくら", want: "sakurasakura"},
+		{name: "sokuon and yoon", text: "ちょっと", want: "chotto"},
+		{name: "katakana long vowel", text: "コーヒー", want: "koohii"},
+		{name: "loanword small vowel", text: "パーティー", want: "paatii"},
+		{name: "kanji skipped beside kana", text: "君の名は", want: "no ha"},
+		{name: "syllabic n before vowel", text: "きんえん", want: "kin'en"},
+		{name: "hangul", text: "사랑해요", want: "saranghaeyo"},
+		{name: "hangul liaison", text: "한국어", want: "hangugeo"},
+		{name: "no cjk", text: "Hello world", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Romanize(tt.text); got != tt.want {
+				t.Fatalf("Romanize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRomanizationKeepsExistingLayer(t *testing.T) {
+	got := WithRomanization(layeredSample + "\n[00:04.00]Baby 我爱你")
+	for _, want := range []string{"[00:01.00]kimi no na wa", "[00:04.00]Baby wǒ ài nǐ"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("WithRomanization() missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "[00:01.00]no ha") {
+		t.Fatalf("WithRomanization() replaced an existing romanization:\n%s", got)
+	}
+}
+
+func TestGeneratedRomanizationParsesAsRomanization(t *testing.T) {
+	for _, text := range []string{"你好，世界", "Baby 我爱你", "2个人", "사랑해요"} {
+		line := Parse(WithRomanization("[00:01.00]" + text)).Lines[0]
+		if line.Romanization == "" || line.Translation != "" {
+			t.Fatalf("%q layers = roma %q / trans %q", text, line.Romanization, line.Translation)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// Custom tag names used for TXXX frames, Vorbis comments and ASF attributes so a
+// file can be traced back to the source it was downloaded from.
+const (
+	CustomTagSource    = "MUSIC_DL_SOURCE"
+	CustomTagSourceID  = "MUSIC_DL_SONG_ID"
+	CustomTagSourceURL = "MUSIC_DL_SONG_URL"
+)
+
+// MaxSongRating is the highest star rating a song can have.
+const MaxSongRating = 5
+
+// popmRatingEmail is the POPM owner most players (Windows, foobar2000,
+// MusicBee, MediaMonkey) read the star rating from.
+const popmRatingEmail = "Windows Media Player 9 Series"
+
+// AudioMetadata is the tag set written into downloaded files.
+type AudioMetadata struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Composer    string
+	Genre       string
+	Date        string // YYYY, YYYY-MM or YYYY-MM-DD
+	TrackNumber int
+	TrackTotal  int
+	DiscNumber  int
+	DiscTotal   int
+	ISRC        string
+	Comment     string
+	Lyric       string
+	Source      string
+	SourceID    string
+	SourceURL   string
+	Rating      int  // stars, 1-5; 0 keeps the rating already in the file
+	ClearRating bool // with Rating 0, removes the rating already in the file
+}
+
+// Year returns the four digit year of Date, or "" when unknown.
+func (m AudioMetadata) Year() string {
+	if len(m.Date) >= 4 {
+		return m.Date[:4]
+	}
+	return ""
+}
+
+// TrackTag formats the track position as "n" or "n/total".
+func (m AudioMetadata) TrackTag() string {
+	return formatTagPosition(m.TrackNumber, m.TrackTotal)
+}
+
+// DiscTag formats the disc position as "n" or "n/total".
+func (m AudioMetadata) DiscTag() string {
+	return formatTagPosition(m.DiscNumber, m.DiscTotal)
+}
+
+// CustomTags returns the source tracing tags in a stable order.
+func (m AudioMetadata) CustomTags() [][2]string {
+	tags := make([][2]string, 0, 3)
+	if m.Source != "" {
+		tags = append(tags, [2]string{CustomTagSource, m.Source})
+	}
+	if m.SourceID != "" {
+		tags = append(tags, [2]string{CustomTagSourceID, m.SourceID})
+	}
+	if m.SourceURL != "" {
+		tags = append(tags, [2]string{CustomTagSourceURL, m.SourceURL})
+	}
+	return tags
+}
+
+// hasExtendedTags reports whether the source supplied anything beyond title,
+// artist and album worth embedding on its own.
+func (m AudioMetadata) hasExtendedTags() bool {
+	return m.AlbumArtist != "" || m.Composer != "" || m.Genre != "" || m.Date != "" ||
+		m.TrackNumber > 0 || m.DiscNumber > 0 || m.ISRC != "" || m.Comment != ""
+}
+
+func (m AudioMetadata) isEmpty() bool {
+	return m.Title == "" && m.Artist == "" && m.Album == "" && m.AlbumArtist == "" &&
+		m.Composer == "" && m.Genre == "" && m.Date == "" && m.TrackNumber == 0 &&
+		m.DiscNumber == 0 && m.ISRC == "" && m.Comment == "" && m.Lyric == "" &&
+		m.Source == "" && m.SourceID == "" && m.SourceURL == "" && m.Rating == 0
+}
+
+// SongRating reads the star rating kept in song.Extra["rating"], or 0.
+func SongRating(song *model.Song) int {
+	if song == nil {
+		return 0
+	}
+	rating, err := strconv.Atoi(songExtraValue(song, "rating"))
+	if err != nil || rating < 0 {
+		return 0
+	}
+	return min(rating, MaxSongRating)
+}
+
+// popmRatingByte maps stars onto the POPM byte scale used by Windows.
+func popmRatingByte(stars int) byte {
+	return [...]byte{0, 1, 64, 128, 196, 255}[min(max(stars, 0), MaxSongRating)]
+}
+
+// vorbisRatingValue writes stars on the 0-100 RATING scale shared by
+// MusicBee, MediaMonkey and foobar2000's 100-point mode.
+func vorbisRatingValue(stars int) string {
+	if stars <= 0 {
+		return ""
+	}
+	return strconv.Itoa(min(stars, MaxSongRating) * 100 / MaxSongRating)
+}
+
+// SongAudioMetadata collects tag values from the song and the source specific
+// fields sources leave in song.Extra (track, disc, release_date, genre, isrc...).
+func SongAudioMetadata(song *model.Song) AudioMetadata {
+	if song == nil {
+		return AudioMetadata{}
+	}
+
+	meta := AudioMetadata{
+		Title:       strings.TrimSpace(song.Name),
+		Artist:      strings.TrimSpace(song.Artist),
+		Album:       strings.TrimSpace(song.Album),
+		AlbumArtist: songExtraValue(song, "album_artist", "albumartist"),
+		Composer:    songExtraValue(song, "composer"),
+		Genre:       songExtraValue(song, "genre"),
+		Date:        normalizeReleaseDate(songExtraValue(song, "release_date", "publish_date", "publish_time", "date", "year")),
+		ISRC:        strings.ToUpper(songExtraValue(song, "isrc")),
+		Comment:     songExtraValue(song, "comment"),
+		Source:      strings.TrimSpace(song.Source),
+		SourceID:    strings.TrimSpace(song.ID),
+		SourceURL:   strings.TrimSpace(song.Link),
+	}
+	meta.TrackNumber, meta.TrackTotal = parseTagPosition(songExtraValue(song, "track", "track_number", "tracknumber"))
+	if total, err := strconv.Atoi(songExtraValue(song, "track_total", "tracktotal")); err == nil && total > 0 {
+		meta.TrackTotal = total
+	}
+	meta.DiscNumber, meta.DiscTotal = parseTagPosition(songExtraValue(song, "disc", "disc_number", "discnumber", "cd"))
+	if total, err := strconv.Atoi(songExtraValue(song, "disc_total", "disctotal")); err == nil && total > 0 {
+		meta.DiscTotal = total
+	}
+	if meta.SourceURL == "" && meta.Source != "" && meta.SourceID != "" && !strings.HasPrefix(meta.Source, "local") {
+		meta.SourceURL = GetOriginalLink(meta.Source, meta.SourceID, "song")
+	}
+	return meta
+}
+
+// ApplyAlbumTrackMetadata fills track positions and the album artist for songs
+// listed from an album detail page. Values already provided by the source win.
+func ApplyAlbumTrackMetadata(songs []model.Song) []model.Song {
+	albumArtist := ""
+	for i, song := range songs {
+		artist := strings.TrimSpace(song.Artist)
+		if i == 0 {
+			albumArtist = artist
+		} else if artist != albumArtist {
+			albumArtist = ""
+			break
+		}
+	}
+
+	total := strconv.Itoa(len(songs))
+	for i := range songs {
+		if songs[i].Extra == nil {
+			songs[i].Extra = map[string]string{}
+		}
+		if strings.TrimSpace(songs[i].Extra["track"]) == "" {
+			songs[i].Extra["track"] = strconv.Itoa(i + 1)
+		}
+		if strings.TrimSpace(songs[i].Extra["track_total"]) == "" {
+			songs[i].Extra["track_total"] = total
+		}
+		if albumArtist != "" && strings.TrimSpace(songs[i].Extra["album_artist"]) == "" {
+			songs[i].Extra["album_artist"] = albumArtist
+		}
+	}
+	return songs
+}
+
+func songExtraValue(song *model.Song, keys ...string) string {
+	if song == nil || song.Extra == nil {
+		return ""
+	}
+	for _, key := range keys {
+		if value := strings.TrimSpace(song.Extra[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func parseTagPosition(value string) (int, int) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, 0
+	}
+	numberPart, totalPart, _ := strings.Cut(value, "/")
+	number, err := strconv.Atoi(strings.TrimSpace(numberPart))
+	if err != nil || number <= 0 {
+		return 0, 0
+	}
+	total, err := strconv.Atoi(strings.TrimSpace(totalPart))
+	if err != nil || total < number {
+		total = 0
+	}
+	return number, total
+}
+
+func formatTagPosition(number, total int) string {
+	if number <= 0 {
+		return ""
+	}
+	if total >= number {
+		return strconv.Itoa(number) + "/" + strconv.Itoa(total)
+	}
+	return strconv.Itoa(number)
+}
+
+// normalizeReleaseDate accepts unix timestamps (seconds or milliseconds),
+// compact YYYYMMDD dates and common date layouts and returns YYYY, YYYY-MM or
+// YYYY-MM-DD.
+func normalizeReleaseDate(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		switch {
+		case len(value) == 4 && n >= 1000:
+			return value
+		case len(value) == 8:
+			if t, err := time.Parse("20060102", value); err == nil {
+				return t.Format("2006-01-02")
+			}
+			return ""
+		case len(value) >= 12:
+			return time.UnixMilli(n).UTC().Format("2006-01-02")
+		case len(value) >= 9:
+			return time.Unix(n, 0).UTC().Format("2006-01-02")
+		default:
+			return ""
+		}
+	}
+
+	value = strings.NewReplacer("/", "-", ".", "-").Replace(value)
+	if len(value) > 10 {
+		value = value[:10]
+	}
+	for _, layout := range []string{"2006-01-02", "2006-1-2", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			switch layout {
+			case "2006-01":
+				return t.Format("2006-01")
+			case "2006":
+				return t.Format("2006")
+			default:
+				return t.Format("2006-01-02")
+			}
+		}
+	}
+	if len(value) >= 4 {
+		if _, err := strconv.Atoi(value[:4]); err == nil {
+			return value[:4]
+		}
+	}
+	return ""
+}
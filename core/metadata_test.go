@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func TestSongAudioMetadataReadsSourceExtra(t *testing.T) {
+	song := &model.Song{
+		ID:     "42",
+		Source: "netease",
+		Name:   "Song",
+		Artist: "Artist",
+		Album:  "Album",
+		Extra: map[string]string{
+			"track":        "3",
+			"track_total":  "12",
+			"disc":         "1/2",
+			"release_date": "1577836800000",
+			"genre":        "Pop",
+			"album_artist": "Various",
+			"isrc":         "usrc17607839",
+		},
+	}
+
+	meta := SongAudioMetadata(song)
+	if meta.TrackTag() != "3/12" || meta.DiscTag() != "1/2" {
+		t.Fatalf("track/disc = %q/%q, want 3/12 and 1/2", meta.TrackTag(), meta.DiscTag())
+	}
+	if meta.Date != "2020-01-01" || meta.Year() != "2020" {
+		t.Fatalf("date/year = %q/%q, want 2020-01-01/2020", meta.Date, meta.Year())
+	}
+	if meta.Genre != "Pop" || meta.AlbumArtist != "Various" || meta.ISRC != "USRC17607839" {
+		t.Fatalf("genre/album artist/isrc = %q/%q/%q", meta.Genre, meta.AlbumArtist, meta.ISRC)
+	}
+	if meta.SourceURL != "https://music.163.com/#/song?id=42" {
+		t.Fatalf("source url = %q, want netease song link", meta.SourceURL)
+	}
+}
+
+func TestNormalizeReleaseDate(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"2019":                 "2019",
+		"2019-5-7":             "2019-05-07",
+		"2019.05.07":           "2019-05-07",
+		"2019-05":              "2019-05",
+		"1577836800":           "2020-01-01",
+		"20200101":             "2020-01-01",
+		"20201399":             "",
+		"2021-03-04T00:00:00Z": "2021-03-04",
+		"unknown":              "",
+	}
+	for input, want := range tests {
+		if got := normalizeReleaseDate(input); got != want {
+			t.Fatalf("normalizeReleaseDate(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestApplyAlbumTrackMetadataKeepsSourceValues(t *testing.T) {
+	songs := ApplyAlbumTrackMetadata([]model.Song{
+		{Name: "A", Artist: "Band"},
+		{Name: "B", Artist: "Band", Extra: map[string]string{"track": "7"}},
+	})
+	if songs[0].Extra["track"] != "1" || songs[1].Extra["track"] != "7" {
+		t.Fatalf("tracks = %q/%q, want 1/7", songs[0].Extra["track"], songs[1].Extra["track"])
+	}
+	if songs[0].Extra["track_total"] != "2" || songs[0].Extra["album_artist"] != "Band" {
+		t.Fatalf("extra = %#v, want track_total 2 and album_artist Band", songs[0].Extra)
+	}
+}
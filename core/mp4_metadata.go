@@ -0,0 +1,362 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ==========================================
+// MP4 / M4A 元数据内嵌（moov/udta/meta/ilst）
+// ==========================================
+
+const (
+	mp4DataTypeImplicit = 0
+	mp4DataTypeUTF8     = 1
+	mp4DataTypeJPEG     = 13
+	mp4DataTypePNG      = 14
+
+	mp4FreeformMean = "com.apple.iTunes"
+)
+
+type mp4Box struct {
+	Type   string
+	Start  int // offset of the box header
+	Header int // header length (8, or 16 for 64-bit sizes)
+	End    int
+}
+
+func (b mp4Box) payload(data []byte) []byte {
+	return data[b.Start+b.Header : b.End]
+}
+
+func readMP4Boxes(data []byte, start, end int) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for pos := start; pos < end; {
+		if pos+8 > end {
+			return nil, errors.New("truncated mp4 box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		header := 8
+		switch size {
+		case 0:
+			size = uint64(end - pos)
+		case 1:
+			if pos+16 > end {
+				return nil, errors.New("truncated mp4 largesize header")
+			}
+			size = binary.BigEndian.Uint64(data[pos+8 : pos+16])
+			header = 16
+		}
+		if size < uint64(header) || size > uint64(end-pos) {
+			return nil, fmt.Errorf("invalid mp4 box size %d for %q", size, string(data[pos+4:pos+8]))
+		}
+		boxes = append(boxes, mp4Box{Type: string(data[pos+4 : pos+8]), Start: pos, Header: header, End: pos + int(size)})
+		pos += int(size)
+	}
+	return boxes, nil
+}
+
+func findMP4Box(boxes []mp4Box, boxType string) (mp4Box, bool) {
+	for _, box := range boxes {
+		if box.Type == boxType {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+func mp4BoxBytes(boxType string, payload ...[]byte) []byte {
+	size := 8
+	for _, part := range payload {
+		size += len(part)
+	}
+	out := make([]byte, 0, size)
+	out = binary.BigEndian.AppendUint32(out, uint32(size))
+	out = append(out, boxType...)
+	for _, part := range payload {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func mp4DataBox(dataType uint32, value []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[:4], dataType)
+	return mp4BoxBytes("data", header, value)
+}
+
+func mp4TextItem(itemType, value string) []byte {
+	return mp4BoxBytes(itemType, mp4DataBox(mp4DataTypeUTF8, []byte(value)))
+}
+
+func mp4PositionItem(itemType string, number, total int, trailing int) []byte {
+	value := make([]byte, 0, 6+trailing)
+	value = append(value, 0, 0)
+	value = binary.BigEndian.AppendUint16(value, uint16(number))
+	value = binary.BigEndian.AppendUint16(value, uint16(total))
+	value = append(value, make([]byte, trailing)...)
+	return mp4BoxBytes(itemType, mp4DataBox(mp4DataTypeImplicit, value))
+}
+
+func mp4FreeformItem(name, value string) []byte {
+	fullBoxHeader := []byte{0, 0, 0, 0}
+	return mp4BoxBytes("----",
+		mp4BoxBytes("mean", fullBoxHeader, []byte(mp4FreeformMean)),
+		mp4BoxBytes("name", fullBoxHeader, []byte(name)),
+		mp4DataBox(mp4DataTypeUTF8, []byte(value)),
+	)
+}
+
+// mp4FreeformName returns the name of a "----" item, which identifies it the
+// way a TXXX description does for ID3.
+func mp4FreeformName(item []byte) string {
+	children, err := readMP4Boxes(item, 8, len(item))
+	if err != nil {
+		return ""
+	}
+	if name, ok := findMP4Box(children, "name"); ok {
+		payload := name.payload(item)
+		if len(payload) >= 4 {
+			return string(payload[4:])
+		}
+	}
+	return ""
+}
+
+func mp4CoverItem(coverData []byte, coverMime string) []byte {
+	dataType := uint32(mp4DataTypeJPEG)
+	if normalizeCoverMime(coverMime) == "image/png" {
+		dataType = mp4DataTypePNG
+	}
+	return mp4BoxBytes("covr", mp4DataBox(dataType, coverData))
+}
+
+// mp4MetaHandler is the hdlr box iTunes style metadata requires inside meta.
+func mp4MetaHandler() []byte {
+	payload := make([]byte, 0, 25)
+	payload = append(payload, 0, 0, 0, 0, 0, 0, 0, 0)
+	payload = append(payload, "mdirappl"...)
+	payload = append(payload, make([]byte, 9)...)
+	return mp4BoxBytes("hdlr", payload)
+}
+
+// mp4ItemsForMetadata builds the ilst items for the tag set. Items are keyed so
+// existing atoms of the same kind can be dropped before the new ones are added.
+func mp4ItemsForMetadata(meta AudioMetadata, coverData []byte, coverMime string) ([]string, [][]byte) {
+	var keys []string
+	var items [][]byte
+	addText := func(itemType, value string) {
+		if value != "" {
+			keys = append(keys, itemType)
+			items = append(items, mp4TextItem(itemType, value))
+		}
+	}
+	addFreeform := func(name, value string) {
+		if value != "" {
+			keys = append(keys, "----:"+name)
+			items = append(items, mp4FreeformItem(name, value))
+		}
+	}
+
+	addText("\xa9nam", meta.Title)
+	addText("\xa9ART", meta.Artist)
+	addText("\xa9alb", meta.Album)
+	addText("aART", meta.AlbumArtist)
+	addText("\xa9wrt", meta.Composer)
+	addText("\xa9gen", meta.Genre)
+	addText("\xa9day", meta.Date)
+	addText("\xa9cmt", meta.Comment)
+	addText("\xa9lyr", meta.Lyric)
+	if meta.TrackNumber > 0 && meta.TrackNumber <= math.MaxUint16 {
+		keys = append(keys, "trkn")
+		items = append(items, mp4PositionItem("trkn", meta.TrackNumber, meta.TrackTotal, 2))
+	}
+	if meta.DiscNumber > 0 && meta.DiscNumber <= math.MaxUint16 {
+		keys = append(keys, "disk")
+		items = append(items, mp4PositionItem("disk", meta.DiscNumber, meta.DiscTotal, 0))
+	}
+	addFreeform("ISRC", meta.ISRC)
+	for _, custom := range meta.CustomTags() {
+		addFreeform(custom[0], custom[1])
+	}
+	if len(coverData) > 0 {
+		keys = append(keys, "covr")
+		items = append(items, mp4CoverItem(coverData, coverMime))
+	}
+	return keys, items
+}
+
+// embedMP4Metadata rewrites the iTunes item list in moov/udta/meta/ilst. Items
+// that are not part of the tag set are kept. When moov sits before mdat, the
+// stco/co64 chunk offsets are shifted by the change in moov size.
+func embedMP4Metadata(audioData []byte, meta AudioMetadata, coverData []byte, coverMime string) ([]byte, error) {
+	top, err := readMP4Boxes(audioData, 0, len(audioData))
+	if err != nil {
+		return nil, err
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return nil, errors.New("mp4 moov box not found")
+	}
+
+	keys, newItems := mp4ItemsForMetadata(meta, coverData, coverMime)
+	replace := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		replace[key] = true
+	}
+
+	moovChildren, err := readMP4Boxes(audioData, moov.Start+moov.Header, moov.End)
+	if err != nil {
+		return nil, err
+	}
+
+	var ilstPayload bytes.Buffer
+	var metaPrefix []byte
+	var metaOthers [][]byte
+	hasHandler := false
+	var udtaOthers [][]byte
+	udta, hasUdta := findMP4Box(moovChildren, "udta")
+	if hasUdta {
+		udtaChildren, err := readMP4Boxes(audioData, udta.Start+udta.Header, udta.End)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range udtaChildren {
+			if child.Type != "meta" {
+				udtaOthers = append(udtaOthers, audioData[child.Start:child.End])
+				continue
+			}
+			payload := child.payload(audioData)
+			if len(payload) < 4 {
+				return nil, errors.New("truncated mp4 meta box")
+			}
+			metaPrefix = payload[:4]
+			metaStart := child.Start + child.Header + 4
+			metaChildren, err := readMP4Boxes(audioData, metaStart, child.End)
+			if err != nil {
+				return nil, err
+			}
+			for _, metaChild := range metaChildren {
+				if metaChild.Type != "ilst" {
+					if metaChild.Type == "hdlr" {
+						hasHandler = true
+					}
+					metaOthers = append(metaOthers, audioData[metaChild.Start:metaChild.End])
+					continue
+				}
+				items, err := readMP4Boxes(audioData, metaChild.Start+metaChild.Header, metaChild.End)
+				if err != nil {
+					return nil, err
+				}
+				for _, item := range items {
+					raw := audioData[item.Start:item.End]
+					key := item.Type
+					if key == "----" {
+						key = "----:" + mp4FreeformName(raw)
+					}
+					if !replace[key] {
+						ilstPayload.Write(raw)
+					}
+				}
+			}
+		}
+	}
+	for _, item := range newItems {
+		ilstPayload.Write(item)
+	}
+
+	if metaPrefix == nil {
+		metaPrefix = []byte{0, 0, 0, 0}
+	}
+	metaParts := [][]byte{metaPrefix}
+	if !hasHandler {
+		metaParts = append(metaParts, mp4MetaHandler())
+	}
+	metaParts = append(metaParts, metaOthers...)
+	metaParts = append(metaParts, mp4BoxBytes("ilst", ilstPayload.Bytes()))
+	newMeta := mp4BoxBytes("meta", metaParts...)
+	newUdta := mp4BoxBytes("udta", append([][]byte{newMeta}, udtaOthers...)...)
+
+	moovParts := make([][]byte, 0, len(moovChildren)+1)
+	for _, child := range moovChildren {
+		if child.Start == udta.Start && hasUdta {
+			moovParts = append(moovParts, newUdta)
+			continue
+		}
+		moovParts = append(moovParts, audioData[child.Start:child.End])
+	}
+	if !hasUdta {
+		moovParts = append(moovParts, newUdta)
+	}
+	newMoov := mp4BoxBytes("moov", moovParts...)
+	if uint64(len(newMoov)) > math.MaxUint32 {
+		return nil, errors.New("mp4 moov box too large")
+	}
+
+	delta := int64(len(newMoov)) - int64(moov.End-moov.Start)
+	if mdat, ok := findMP4Box(top, "mdat"); ok && moov.Start < mdat.Start && delta != 0 {
+		if err := shiftMP4ChunkOffsets(newMoov, 8, len(newMoov), delta); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]byte, 0, len(audioData)+int(delta))
+	out = append(out, audioData[:moov.Start]...)
+	out = append(out, newMoov...)
+	out = append(out, audioData[moov.End:]...)
+	return out, nil
+}
+
+// shiftMP4ChunkOffsets walks moov/trak/mdia/minf/stbl and moves every stco and
+// co64 entry by delta bytes in place.
+func shiftMP4ChunkOffsets(data []byte, start, end int, delta int64) error {
+	boxes, err := readMP4Boxes(data, start, end)
+	if err != nil {
+		return err
+	}
+	for _, box := range boxes {
+		payload := box.payload(data)
+		switch box.Type {
+		case "trak", "mdia", "minf", "stbl":
+			if err := shiftMP4ChunkOffsets(data, box.Start+box.Header, box.End, delta); err != nil {
+				return err
+			}
+		case "stco":
+			if len(payload) < 8 {
+				return errors.New("truncated stco box")
+			}
+			count := int(binary.BigEndian.Uint32(payload[4:8]))
+			if 8+count*4 > len(payload) {
+				return errors.New("truncated stco entries")
+			}
+			for i := 0; i < count; i++ {
+				entry := payload[8+i*4 : 12+i*4]
+				shifted := int64(binary.BigEndian.Uint32(entry)) + delta
+				if shifted < 0 || shifted > math.MaxUint32 {
+					return errors.New("stco chunk offset out of range")
+				}
+				binary.BigEndian.PutUint32(entry, uint32(shifted))
+			}
+		case "co64":
+			if len(payload) < 8 {
+				return errors.New("truncated co64 box")
+			}
+			count := int(binary.BigEndian.Uint32(payload[4:8]))
+			if 8+count*8 > len(payload) {
+				return errors.New("truncated co64 entries")
+			}
+			for i := 0; i < count; i++ {
+				entry := payload[8+i*8 : 16+i*8]
+				shifted := int64(binary.BigEndian.Uint64(entry)) + delta
+				if shifted < 0 {
+					return errors.New("co64 chunk offset out of range")
+				}
+				binary.BigEndian.PutUint64(entry, uint64(shifted))
+			}
+		}
+	}
+	return nil
+}
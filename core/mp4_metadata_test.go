@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dhowden/tag"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func buildTestM4A(moovFirst bool, samples []byte, udta []byte) []byte {
+	ftyp := mp4BoxBytes("ftyp", []byte("M4A \x00\x00\x00\x00M4A isom"))
+	mdat := mp4BoxBytes("mdat", samples)
+
+	stco := func(offset uint32) []byte {
+		payload := []byte{0, 0, 0, 0, 0, 0, 0, 1}
+		payload = binary.BigEndian.AppendUint32(payload, offset)
+		return mp4BoxBytes("stco", payload)
+	}
+	moovWith := func(offset uint32) []byte {
+		trak := mp4BoxBytes("trak", mp4BoxBytes("mdia", mp4BoxBytes("minf", mp4BoxBytes("stbl", stco(offset)))))
+		parts := [][]byte{mp4BoxBytes("mvhd", make([]byte, 100)), trak}
+		if udta != nil {
+			parts = append(parts, udta)
+		}
+		return mp4BoxBytes("moov", parts...)
+	}
+
+	if moovFirst {
+		moovLen := len(moovWith(0))
+		offset := uint32(len(ftyp) + moovLen + 8)
+		return bytes.Join([][]byte{ftyp, moovWith(offset), mdat}, nil)
+	}
+	offset := uint32(len(ftyp) + 8)
+	return bytes.Join([][]byte{ftyp, mdat, moovWith(offset)}, nil)
+}
+
+func testM4AChunkOffset(t *testing.T, data []byte) uint32 {
+	t.Helper()
+	idx := bytes.Index(data, []byte("stco"))
+	if idx < 0 {
+		t.Fatal("stco box not found")
+	}
+	return binary.BigEndian.Uint32(data[idx+12 : idx+16])
+}
+
+func TestEmbedMP4MetadataShiftsChunkOffsetsWhenMoovFirst(t *testing.T) {
+	samples := []byte("AUDIO-SAMPLES")
+	source := buildTestM4A(true, samples, nil)
+	cover := []byte{0x89, 'P', 'N', 'G'}
+
+	embedded, err := EmbedSongMetadata(source, &model.Song{
+		Name:   "标题",
+		Artist: "Artist",
+		Album:  "Album",
+		Ext:    "m4a",
+		Extra:  map[string]string{"track": "5/12", "disc": "2/2", "album_artist": "Band"},
+	}, "[00:01.00]lyric", cover, "image/png")
+	if err != nil {
+		t.Fatalf("EmbedSongMetadata() error = %v", err)
+	}
+
+	offset := testM4AChunkOffset(t, embedded)
+	if got := embedded[offset : offset+uint32(len(samples))]; !bytes.Equal(got, samples) {
+		t.Fatalf("chunk offset %d points at %q, want audio samples", offset, got)
+	}
+
+	wantTrkn := mp4BoxBytes("trkn", mp4BoxBytes("data", []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 12, 0, 0}))
+	if !bytes.Contains(embedded, wantTrkn) {
+		t.Fatal("trkn atom should be encoded as track 5 of 12")
+	}
+	wantCovr := mp4BoxBytes("covr", mp4BoxBytes("data", []byte{0, 0, 0, 14, 0, 0, 0, 0}, cover))
+	if !bytes.Contains(embedded, wantCovr) {
+		t.Fatal("covr atom should carry the PNG cover with data type 14")
+	}
+
+	metadata, err := tag.ReadFrom(bytes.NewReader(embedded))
+	if err != nil {
+		t.Fatalf("ReadFrom(embedded): %v", err)
+	}
+	if metadata.Title() != "标题" || metadata.Artist() != "Artist" || metadata.Album() != "Album" || metadata.AlbumArtist() != "Band" {
+		t.Fatalf("title/artist/album/album artist = %q/%q/%q/%q", metadata.Title(), metadata.Artist(), metadata.Album(), metadata.AlbumArtist())
+	}
+	if metadata.Lyrics() != "[00:01.00]lyric" {
+		t.Fatalf("lyrics = %q", metadata.Lyrics())
+	}
+	if disc, total := metadata.Disc(); disc != 2 || total != 2 {
+		t.Fatalf("disc = %d/%d, want 2/2", disc, total)
+	}
+	if picture := metadata.Picture(); picture == nil || !bytes.Equal(picture.Data, cover) {
+		t.Fatalf("picture = %#v, want embedded cover", picture)
+	}
+}
+
+func TestEmbedMP4MetadataReplacesItemsAndKeepsOthers(t *testing.T) {
+	samples := []byte("AUDIO")
+	ilst := mp4BoxBytes("ilst",
+		mp4TextItem("\xa9nam", "Old"),
+		mp4TextItem("\xa9too", "Encoder"),
+		mp4FreeformItem(CustomTagSourceID, "old-id"),
+	)
+	udta := mp4BoxBytes("udta", mp4BoxBytes("meta", []byte{0, 0, 0, 0}, mp4MetaHandler(), ilst))
+	source := buildTestM4A(false, samples, udta)
+
+	embedded, err := embedMP4Metadata(source, AudioMetadata{Title: "New", SourceID: "new-id"}, nil, "")
+	if err != nil {
+		t.Fatalf("embedMP4Metadata() error = %v", err)
+	}
+	if offset := testM4AChunkOffset(t, embedded); !bytes.Equal(embedded[offset:offset+5], samples) {
+		t.Fatalf("chunk offset should stay unchanged when mdat precedes moov")
+	}
+	if !bytes.Contains(embedded, mp4TextItem("\xa9too", "Encoder")) {
+		t.Fatal("unrelated ilst items should be preserved")
+	}
+	if bytes.Contains(embedded, []byte("Old")) || bytes.Contains(embedded, []byte("old-id")) {
+		t.Fatal("replaced items should be removed")
+	}
+	if !bytes.Contains(embedded, mp4FreeformItem(CustomTagSourceID, "new-id")) {
+		t.Fatal("freeform source id item should be written")
+	}
+	if bytes.Count(embedded, []byte("hdlr")) != 1 {
+		t.Fatal("existing meta handler should be reused")
+	}
+}
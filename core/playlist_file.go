@@ -0,0 +1,326 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// PlaylistFormat is a playlist file format written next to downloaded songs.
+type PlaylistFormat string
+
+const (
+	PlaylistFormatM3U8 PlaylistFormat = "m3u8"
+	PlaylistFormatXSPF PlaylistFormat = "xspf"
+	PlaylistFormatPLS  PlaylistFormat = "pls"
+
+	// PlaylistFormatsNone turns off writing playlist files after downloads.
+	PlaylistFormatsNone = "none"
+	// DefaultPlaylistFileFormats is the playlistFileFormats setting default.
+	DefaultPlaylistFileFormats = "m3u8"
+)
+
+// PlaylistEntry is one saved song in a playlist file.
+type PlaylistEntry struct {
+	Path     string // audio file on disk
+	Title    string
+	Artist   string
+	Album    string
+	Duration int // seconds, 0 when unknown
+}
+
+// ParsePlaylistFormats parses a comma separated format list ("m3u8,xspf"),
+// dropping duplicates. "none" and an empty list yield no formats.
+func ParsePlaylistFormats(value string) ([]PlaylistFormat, error) {
+	var formats []PlaylistFormat
+	seen := map[PlaylistFormat]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(item), "."))
+		switch item {
+		case "", PlaylistFormatsNone:
+			continue
+		case "m3u":
+			item = string(PlaylistFormatM3U8)
+		}
+		format := PlaylistFormat(item)
+		switch format {
+		case PlaylistFormatM3U8, PlaylistFormatXSPF, PlaylistFormatPLS:
+		default:
+			return nil, fmt.Errorf("unsupported playlist format %q", item)
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
+
+// normalizePlaylistFileFormats keeps the setting as a canonical list, "none",
+// or the default when it cannot be parsed.
+func normalizePlaylistFileFormats(value string) string {
+	if strings.EqualFold(strings.TrimSpace(value), PlaylistFormatsNone) {
+		return PlaylistFormatsNone
+	}
+	formats, err := ParsePlaylistFormats(value)
+	if err != nil || len(formats) == 0 {
+		return DefaultPlaylistFileFormats
+	}
+	items := make([]string, len(formats))
+	for i, format := range formats {
+		items[i] = string(format)
+	}
+	return strings.Join(items, ",")
+}
+
+// PlaylistEntryForSong describes a saved song for a playlist file.
+func PlaylistEntryForSong(song *model.Song, path string) PlaylistEntry {
+	entry := PlaylistEntry{Path: path}
+	if song != nil {
+		entry.Title = strings.TrimSpace(song.Name)
+		entry.Artist = strings.TrimSpace(song.Artist)
+		entry.Album = strings.TrimSpace(song.Album)
+		entry.Duration = song.Duration
+	}
+	return entry
+}
+
+// PlaylistDir is the deepest directory containing every entry, where the
+// playlist file goes so its relative paths stay short.
+func PlaylistDir(entries []PlaylistEntry) string {
+	dir := ""
+	for _, entry := range entries {
+		if entry.Path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(entry.Path)
+		if err != nil {
+			continue
+		}
+		parent := filepath.Dir(abs)
+		if dir == "" {
+			dir = parent
+			continue
+		}
+		for !pathWithin(dir, parent) {
+			next := filepath.Dir(dir)
+			if next == dir {
+				break
+			}
+			dir = next
+		}
+	}
+	return dir
+}
+
+func pathWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// playlistLocation is the entry path relative to baseDir with forward
+// slashes, or the absolute path when no relative path exists (another drive).
+func playlistLocation(baseDir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	if baseDir != "" {
+		if rel, err := filepath.Rel(baseDir, abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(abs)
+}
+
+func (e PlaylistEntry) displayTitle() string {
+	title := e.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(e.Path), filepath.Ext(e.Path))
+	}
+	if e.Artist != "" {
+		return e.Artist + " - " + title
+	}
+	return title
+}
+
+// RenderPlaylist renders entries in order as a playlist file whose paths are
+// relative to baseDir. Entries without a path are skipped.
+func RenderPlaylist(format PlaylistFormat, title, baseDir string, entries []PlaylistEntry) ([]byte, error) {
+	switch format {
+	case PlaylistFormatM3U8:
+		return renderM3U8(title, baseDir, entries), nil
+	case PlaylistFormatXSPF:
+		return renderXSPF(title, baseDir, entries)
+	case PlaylistFormatPLS:
+		return renderPLS(baseDir, entries), nil
+	}
+	return nil, fmt.Errorf("unsupported playlist format %q", format)
+}
+
+func renderM3U8(title, baseDir string, entries []PlaylistEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	if title = playlistLineText(title); title != "" {
+		b.WriteString("#PLAYLIST:" + title + "\n")
+	}
+	for _, entry := range entries {
+		if entry.Path == "" {
+			continue
+		}
+		duration := entry.Duration
+		if duration <= 0 {
+			duration = -1
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", duration, playlistLineText(entry.displayTitle()))
+		b.WriteString(playlistLocation(baseDir, entry.Path) + "\n")
+	}
+	return b.Bytes()
+}
+
+func renderPLS(baseDir string, entries []PlaylistEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString("[playlist]\n")
+	n := 0
+	for _, entry := range entries {
+		if entry.Path == "" {
+			continue
+		}
+		n++
+		duration := entry.Duration
+		if duration <= 0 {
+			duration = -1
+		}
+		fmt.Fprintf(&b, "File%d=%s\n", n, playlistLocation(baseDir, entry.Path))
+		fmt.Fprintf(&b, "Title%d=%s\n", n, playlistLineText(entry.displayTitle()))
+		fmt.Fprintf(&b, "Length%d=%d\n", n, duration)
+	}
+	fmt.Fprintf(&b, "NumberOfEntries=%d\nVersion=2\n", n)
+	return b.Bytes()
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Version string      `xml:"version,attr"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int    `xml:"duration,omitempty"` // milliseconds
+}
+
+func renderXSPF(title, baseDir string, entries []PlaylistEntry) ([]byte, error) {
+	doc := xspfPlaylist{Version: "1", XMLNS: "http://xspf.org/ns/0/", Title: strings.TrimSpace(title)}
+	for _, entry := range entries {
+		if entry.Path == "" {
+			continue
+		}
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Location: xspfLocation(playlistLocation(baseDir, entry.Path)),
+			Title:    entry.Title,
+			Creator:  entry.Artist,
+			Album:    entry.Album,
+			Duration: entry.Duration * 1000,
+		})
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// xspfLocation turns a slash path into the URI XSPF expects, with absolute
+// paths as file:// URLs.
+func xspfLocation(location string) string {
+	segments := strings.Split(location, "/")
+	for i, segment := range segments {
+		if i == 0 && strings.HasSuffix(segment, ":") {
+			continue // Windows drive letter
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	escaped := strings.Join(segments, "/")
+	switch {
+	case strings.HasPrefix(location, "/"):
+		return "file://" + escaped
+	case filepath.VolumeName(filepath.FromSlash(location)) != "":
+		return "file:///" + escaped
+	}
+	return escaped
+}
+
+func playlistLineText(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// WritePlaylistFiles writes the entries as one playlist file per format into
+// dir (PlaylistDir(entries) when empty), named after title, and returns the
+// written paths.
+func WritePlaylistFiles(dir, title string, entries []PlaylistEntry, formats []PlaylistFormat) ([]string, error) {
+	if len(formats) == 0 {
+		return nil, nil
+	}
+	if strings.TrimSpace(dir) == "" {
+		dir = PlaylistDir(entries)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("no saved songs for playlist %q", title)
+	}
+	base := sanitizeDownloadPathSegment(title)
+	if base == "" {
+		base = "playlist"
+	}
+	base = truncateSegmentBytes(base, maxDownloadSegmentBytes-5, false)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, format := range formats {
+		data, err := RenderPlaylist(format, title, dir, entries)
+		if err != nil {
+			return written, err
+		}
+		path := filepath.Join(dir, base+"."+string(format))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// LocateSavedSong returns where a song already saved to target lies, trying
+// the song's own extension and then the common audio ones, or "".
+func LocateSavedSong(song *model.Song, target DownloadTarget) string {
+	if song == nil {
+		return ""
+	}
+	normalized := *song
+	ApplySongOverride(&normalized)
+	exts := []string{"mp3", "flac", "m4a", "ogg", "wav", "aac", "wma"}
+	if ext := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(normalized.Ext), ".")); ext != "" {
+		exts = append([]string{ext}, exts...)
+	}
+	for _, ext := range exts {
+		dir, template, _ := target.Resolve(&normalized, ext)
+		path := filepath.Join(dir, sanitizeDownloadRelativePath(BuildDownloadFilename(&normalized, ext, template)))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func TestParsePlaylistFormats(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []PlaylistFormat
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "none", want: nil},
+		{input: "m3u8", want: []PlaylistFormat{PlaylistFormatM3U8}},
+		{input: " .PLS , m3u, xspf, pls", want: []PlaylistFormat{PlaylistFormatPLS, PlaylistFormatM3U8, PlaylistFormatXSPF}},
+		{input: "m3u8,wpl", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePlaylistFormats(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParsePlaylistFormats(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ParsePlaylistFormats(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPlaylistFormats(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "歌单")
+	entries := []PlaylistEntry{
+		{Path: filepath.Join(base, "周杰伦", "晴天.flac"), Title: "晴天", Artist: "周杰伦", Album: "叶惠美", Duration: 269},
+		{Path: ""},
+		{Path: filepath.Join(base, "Track #2.mp3")},
+	}
+
+	tests := []struct {
+		format PlaylistFormat
+		want   []string
+	}{
+		{
+			format: PlaylistFormatM3U8,
+			want: []string{
+				"#EXTM3U\n#PLAYLIST:通勤\n",
+				"#EXTINF:269,周杰伦 - 晴天\n周杰伦/晴天.flac\n",
+				"#EXTINF:-1,Track #2\nTrack #2.mp3\n",
+			},
+		},
+		{
+			format: PlaylistFormatPLS,
+			want: []string{
+				"File1=周杰伦/晴天.flac\nTitle1=周杰伦 - 晴天\nLength1=269\n",
+				"File2=Track #2.mp3\nTitle2=Track #2\nLength2=-1\n",
+				"NumberOfEntries=2\nVersion=2\n",
+			},
+		},
+		{
+			format: PlaylistFormatXSPF,
+			want: []string{
+				`<playlist version="1" xmlns="http://xspf.org/ns/0/">`,
+				"<title>通勤</title>",
+				"<location>%E5%91%A8%E6%9D%B0%E4%BC%A6/%E6%99%B4%E5%A4%A9.flac</location>",
+				"<duration>269000</duration>",
+				"<location>Track%20%232.mp3</location>",
+			},
+		},
+	}
+	for _, tt := range tests {
+		data, err := RenderPlaylist(tt.format, "通勤", base, entries)
+		if err != nil {
+			t.Fatalf("RenderPlaylist(%s) error = %v", tt.format, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(data), want) {
+				t.Fatalf("RenderPlaylist(%s) missing %q in:\n%s", tt.format, want, data)
+			}
+		}
+	}
+}
+
+func TestWritePlaylistFilesUsesCommonDirectory(t *testing.T) {
+	root := t.TempDir()
+	entries := []PlaylistEntry{
+		{Path: filepath.Join(root, "A", "x", "one.mp3"), Title: "one"},
+		{Path: filepath.Join(root, "A", "y", "two.mp3"), Title: "two"},
+	}
+	if got, want := PlaylistDir(entries), filepath.Join(root, "A"); got != want {
+		t.Fatalf("PlaylistDir() = %q, want %q", got, want)
+	}
+
+	written, err := WritePlaylistFiles("", "My/List", entries, []PlaylistFormat{PlaylistFormatM3U8, PlaylistFormatPLS})
+	if err != nil {
+		t.Fatalf("WritePlaylistFiles() error = %v", err)
+	}
+	want := []string{filepath.Join(root, "A", "My_List.m3u8"), filepath.Join(root, "A", "My_List.pls")}
+	if !reflect.DeepEqual(written, want) {
+		t.Fatalf("WritePlaylistFiles() = %v, want %v", written, want)
+	}
+	data, err := os.ReadFile(written[0])
+	if err != nil {
+		t.Fatalf("read m3u8: %v", err)
+	}
+	if !strings.Contains(string(data), "x/one.mp3\n") || strings.Index(string(data), "x/one.mp3") > strings.Index(string(data), "y/two.mp3") {
+		t.Fatalf("m3u8 should list entries in order with relative paths:\n%s", data)
+	}
+
+	if _, err := WritePlaylistFiles("", "empty", []PlaylistEntry{{Title: "missing"}}, []PlaylistFormat{PlaylistFormatM3U8}); err == nil {
+		t.Fatal("WritePlaylistFiles() without saved songs should fail")
+	}
+}
+
+func TestLocateSavedSong(t *testing.T) {
+	dir := t.TempDir()
+	target := DownloadTarget{
+		Dir:      dir,
+		Template: "{artist} - {name}",
+		Routes:   []DownloadRoute{{Format: "flac", Dir: "Lossless"}},
+	}
+	song := &model.Song{ID: "1", Source: "qq", Name: "晴天", Artist: "周杰伦"}
+	if got := LocateSavedSong(song, target); got != "" {
+		t.Fatalf("LocateSavedSong() before saving = %q, want empty", got)
+	}
+
+	saved := filepath.Join(dir, "Lossless", "周杰伦 - 晴天.flac")
+	if err := os.MkdirAll(filepath.Dir(saved), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(saved, []byte("audio"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := LocateSavedSong(song, target); got != saved {
+		t.Fatalf("LocateSavedSong() = %q, want %q", got, saved)
+	}
+}
@@ -0,0 +1,353 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// ParsedPlaylist is a playlist file read back into entries. Entry paths are
+// the locations as written in the file: relative, absolute or URLs.
+type ParsedPlaylist struct {
+	Format  PlaylistFormat
+	Title   string
+	Entries []PlaylistEntry
+}
+
+// ParsePlaylistFile parses an M3U/M3U8, XSPF or PLS file. The format comes
+// from the file name extension, or the content when the extension is unknown.
+func ParsePlaylistFile(name string, data []byte) (*ParsedPlaylist, error) {
+	text := playlistText(data)
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("playlist file is empty")
+	}
+	format := playlistFormatOf(name, text)
+	var (
+		parsed *ParsedPlaylist
+		err    error
+	)
+	switch format {
+	case PlaylistFormatXSPF:
+		parsed, err = parseXSPF(text)
+	case PlaylistFormatPLS:
+		parsed = parsePLS(text)
+	default:
+		parsed = parseM3U(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	parsed.Format = format
+	if parsed.Title == "" {
+		base := filepath.Base(filepath.FromSlash(name))
+		parsed.Title = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if len(parsed.Entries) == 0 {
+		return parsed, errors.New("playlist has no entries")
+	}
+	return parsed, nil
+}
+
+// playlistText decodes the file as UTF-8, falling back to GBK which older
+// Windows players use for .m3u files.
+func playlistText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	if decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(data); err == nil {
+		return string(decoded)
+	}
+	return string(data)
+}
+
+func playlistFormatOf(name, text string) PlaylistFormat {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xspf":
+		return PlaylistFormatXSPF
+	case ".pls":
+		return PlaylistFormatPLS
+	case ".m3u", ".m3u8":
+		return PlaylistFormatM3U8
+	}
+	trimmed := strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(trimmed, "<"):
+		return PlaylistFormatXSPF
+	case strings.HasPrefix(strings.ToLower(trimmed), "[playlist]"):
+		return PlaylistFormatPLS
+	}
+	return PlaylistFormatM3U8
+}
+
+func parseM3U(text string) *ParsedPlaylist {
+	parsed := &ParsedPlaylist{}
+	var pending *PlaylistEntry
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			parsed.Title = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			entry := parseEXTINF(strings.TrimPrefix(line, "#EXTINF:"))
+			pending = &entry
+		case strings.HasPrefix(line, "#EXTALB:"):
+			if pending != nil {
+				pending.Album = strings.TrimSpace(strings.TrimPrefix(line, "#EXTALB:"))
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			entry := PlaylistEntry{}
+			if pending != nil {
+				entry = *pending
+				pending = nil
+			}
+			entry.Path = playlistEntryPath(line)
+			parsed.Entries = append(parsed.Entries, entry)
+		}
+	}
+	return parsed
+}
+
+// parseEXTINF reads "<seconds>[ attrs],<artist> - <title>".
+func parseEXTINF(value string) PlaylistEntry {
+	var entry PlaylistEntry
+	head, display, found := strings.Cut(value, ",")
+	if !found {
+		display = ""
+	}
+	if fields := strings.Fields(head); len(fields) > 0 {
+		if seconds, err := strconv.Atoi(fields[0]); err == nil && seconds > 0 {
+			entry.Duration = seconds
+		}
+	}
+	entry.Artist, entry.Title = splitPlaylistDisplay(display)
+	return entry
+}
+
+// splitPlaylistDisplay splits the "Artist - Title" text players write.
+func splitPlaylistDisplay(display string) (artist, title string) {
+	display = strings.TrimSpace(display)
+	if before, after, found := strings.Cut(display, " - "); found {
+		return strings.TrimSpace(before), strings.TrimSpace(after)
+	}
+	return "", display
+}
+
+func parsePLS(text string) *ParsedPlaylist {
+	entries := map[int]*PlaylistEntry{}
+	entry := func(n int) *PlaylistEntry {
+		if entries[n] == nil {
+			entries[n] = &PlaylistEntry{}
+		}
+		return entries[n]
+	}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		for _, field := range []string{"file", "title", "length"} {
+			n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+			if !strings.HasPrefix(key, field) || err != nil {
+				continue
+			}
+			switch field {
+			case "file":
+				entry(n).Path = playlistEntryPath(value)
+			case "title":
+				e := entry(n)
+				e.Artist, e.Title = splitPlaylistDisplay(value)
+			case "length":
+				if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+					entry(n).Duration = seconds
+				}
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n := range entries {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	parsed := &ParsedPlaylist{}
+	for _, n := range numbers {
+		if entries[n].Path != "" {
+			parsed.Entries = append(parsed.Entries, *entries[n])
+		}
+	}
+	return parsed
+}
+
+func parseXSPF(text string) (*ParsedPlaylist, error) {
+	var doc xspfPlaylist
+	if err := xml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, fmt.Errorf("invalid XSPF: %w", err)
+	}
+	parsed := &ParsedPlaylist{Title: strings.TrimSpace(doc.Title)}
+	for _, track := range doc.Tracks {
+		location := strings.TrimSpace(track.Location)
+		if location == "" && strings.TrimSpace(track.Title) == "" {
+			continue
+		}
+		parsed.Entries = append(parsed.Entries, PlaylistEntry{
+			Path:     playlistEntryPath(location),
+			Title:    strings.TrimSpace(track.Title),
+			Artist:   strings.TrimSpace(track.Creator),
+			Album:    strings.TrimSpace(track.Album),
+			Duration: track.Duration / 1000,
+		})
+	}
+	return parsed, nil
+}
+
+// playlistEntryPath turns file:// URLs and percent-escaped relative URIs into
+// plain paths with forward slashes; other URLs are returned as they are.
+func playlistEntryPath(location string) string {
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return ""
+	}
+	if u, err := url.Parse(location); err == nil {
+		switch {
+		case strings.EqualFold(u.Scheme, "file"):
+			p := u.Path
+			// file:///C:/Music/a.mp3
+			if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+				p = p[1:]
+			}
+			return p
+		case len(u.Scheme) > 1:
+			return location
+		case u.Scheme == "" && strings.Contains(location, "%"):
+			if unescaped, err := url.PathUnescape(location); err == nil {
+				location = unescaped
+			}
+		}
+	}
+	return strings.ReplaceAll(location, "\\", "/")
+}
+
+// PlaylistEntryTitle is the entry title, falling back to the file name, and
+// the artist, splitting an "Artist - Title" file name when no artist is known.
+func PlaylistEntryTitle(entry PlaylistEntry) (title, artist string) {
+	title, artist = strings.TrimSpace(entry.Title), strings.TrimSpace(entry.Artist)
+	if title != "" || entry.Path == "" {
+		return title, artist
+	}
+	base := path.Base(entry.Path)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	if artist != "" {
+		return base, artist
+	}
+	artist, title = splitPlaylistDisplay(base)
+	return title, artist
+}
+
+// trackListColumns maps the header names used by common playlist exporters
+// (Spotify via Exportify, TuneMyMusic, Soundiiz, Chinese services) to fields.
+var trackListColumns = map[string]string{
+	"track": "title", "track name": "title", "title": "title", "name": "title", "song": "title",
+	"song name": "title", "歌名": "title", "歌曲": "title", "歌曲名": "title", "标题": "title",
+	"artist": "artist", "artists": "artist", "artist name": "artist", "artist name(s)": "artist",
+	"artist(s)": "artist", "singer": "artist", "歌手": "artist", "艺术家": "artist", "演唱者": "artist",
+	"album": "album", "album name": "album", "专辑": "album",
+	"duration": "duration", "duration (ms)": "duration_ms", "duration_ms": "duration_ms", "length": "duration",
+	"time": "duration", "时长": "duration",
+}
+
+// ParseTrackListCSV reads a third-party playlist export with track, artist,
+// album and duration columns. Only the track column is required.
+func ParseTrackListCSV(data []byte) ([]PlaylistEntry, error) {
+	reader := csv.NewReader(strings.NewReader(playlistText(data)))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("CSV is empty")
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		field, ok := trackListColumns[strings.ToLower(strings.TrimSpace(name))]
+		if _, seen := columns[field]; ok && !seen {
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV has no track title column")
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var entries []PlaylistEntry
+	for _, row := range rows[1:] {
+		entry := PlaylistEntry{Title: field(row, "title"), Artist: field(row, "artist"), Album: field(row, "album")}
+		if entry.Title == "" {
+			continue
+		}
+		if ms := field(row, "duration_ms"); ms != "" {
+			if n, err := strconv.Atoi(ms); err == nil {
+				entry.Duration = (n + 500) / 1000
+			}
+		} else {
+			entry.Duration = parseTrackListDuration(field(row, "duration"))
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("CSV has no tracks")
+	}
+	return entries, nil
+}
+
+// parseTrackListDuration reads "3:45", "1:02:03", seconds or milliseconds.
+func parseTrackListDuration(value string) int {
+	if value == "" {
+		return 0
+	}
+	if strings.Contains(value, ":") {
+		total := 0
+		for _, part := range strings.Split(value, ":") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return 0
+			}
+			total = total*60 + n
+		}
+		return total
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	// No song lasts ten hours; larger values are milliseconds.
+	if seconds > 36000 {
+		seconds /= 1000
+	}
+	return int(seconds + 0.5)
+}
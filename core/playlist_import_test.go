@@ -0,0 +1,155 @@
+package core
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestParsePlaylistFileRoundTrip(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "歌单")
+	entries := []PlaylistEntry{
+		{Path: filepath.Join(base, "周杰伦", "晴天.flac"), Title: "晴天", Artist: "周杰伦", Duration: 269},
+		{Path: filepath.Join(base, "Track #2.mp3"), Title: "Track #2"},
+	}
+	want := []PlaylistEntry{
+		{Path: "周杰伦/晴天.flac", Title: "晴天", Artist: "周杰伦", Duration: 269},
+		{Path: "Track #2.mp3", Title: "Track #2"},
+	}
+	for _, format := range []PlaylistFormat{PlaylistFormatM3U8, PlaylistFormatXSPF, PlaylistFormatPLS} {
+		data, err := RenderPlaylist(format, "通勤", base, entries)
+		if err != nil {
+			t.Fatalf("RenderPlaylist(%s) error = %v", format, err)
+		}
+		parsed, err := ParsePlaylistFile("list."+string(format), data)
+		if err != nil {
+			t.Fatalf("ParsePlaylistFile(%s) error = %v", format, err)
+		}
+		if parsed.Format != format || !reflect.DeepEqual(parsed.Entries, want) {
+			t.Fatalf("ParsePlaylistFile(%s) = %s %+v", format, parsed.Format, parsed.Entries)
+		}
+		if format != PlaylistFormatPLS && parsed.Title != "通勤" {
+			t.Fatalf("ParsePlaylistFile(%s) title = %q", format, parsed.Title)
+		}
+	}
+}
+
+func TestParsePlaylistFileVariants(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String("#EXTM3U\r\n#EXTINF:200,陈奕迅 - 十年\r\nD:\\音乐\\十年.mp3\r\n")
+	if err != nil {
+		t.Fatalf("encode GBK: %v", err)
+	}
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		title string
+		want  []PlaylistEntry
+	}{
+		{
+			name: "gbk m3u with windows paths", file: "老歌.m3u", data: gbk, title: "老歌",
+			want: []PlaylistEntry{{Path: "D:/音乐/十年.mp3", Title: "十年", Artist: "陈奕迅", Duration: 200}},
+		},
+		{
+			name: "plain m3u with urls", file: "web.m3u",
+			data:  "/music/a.mp3\n# comment\nhttp://example.com/stream.mp3\n",
+			title: "web",
+			want:  []PlaylistEntry{{Path: "/music/a.mp3"}, {Path: "http://example.com/stream.mp3"}},
+		},
+		{
+			name: "pls out of order", file: "list.pls",
+			data:  "[playlist]\nFile2=b.mp3\nTitle2=B\nFile1=a.mp3\nLength1=61\nNumberOfEntries=2\n",
+			title: "list",
+			want:  []PlaylistEntry{{Path: "a.mp3", Duration: 61}, {Path: "b.mp3", Title: "B"}},
+		},
+		{
+			name: "xspf file urls detected by content", file: "upload",
+			data: `<?xml version="1.0"?><playlist version="1" xmlns="http://xspf.org/ns/0/"><trackList>` +
+				`<track><location>file:///C:/Music/%E6%99%B4%E5%A4%A9.flac</location><creator>周杰伦</creator></track>` +
+				`<track><location>file:///home/me/a%20b.mp3</location><title>A B</title></track>` +
+				`</trackList></playlist>`,
+			title: "upload",
+			want: []PlaylistEntry{
+				{Path: "C:/Music/晴天.flac", Artist: "周杰伦"},
+				{Path: "/home/me/a b.mp3", Title: "A B"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		parsed, err := ParsePlaylistFile(tt.file, []byte(tt.data))
+		if err != nil {
+			t.Fatalf("%s: ParsePlaylistFile() error = %v", tt.name, err)
+		}
+		if parsed.Title != tt.title || !reflect.DeepEqual(parsed.Entries, tt.want) {
+			t.Fatalf("%s: ParsePlaylistFile() = %q %+v", tt.name, parsed.Title, parsed.Entries)
+		}
+	}
+
+	if _, err := ParsePlaylistFile("empty.m3u", []byte("#EXTM3U\n")); err == nil {
+		t.Fatal("ParsePlaylistFile() should reject playlists without entries")
+	}
+}
+
+func TestPlaylistEntryTitle(t *testing.T) {
+	tests := []struct {
+		entry         PlaylistEntry
+		title, artist string
+	}{
+		{entry: PlaylistEntry{Path: "x.mp3", Title: "晴天", Artist: "周杰伦"}, title: "晴天", artist: "周杰伦"},
+		{entry: PlaylistEntry{Path: "music/周杰伦 - 晴天.flac"}, title: "晴天", artist: "周杰伦"},
+		{entry: PlaylistEntry{Path: "music/晴天.flac", Artist: "周杰伦"}, title: "晴天", artist: "周杰伦"},
+		{entry: PlaylistEntry{Path: "晴天.flac"}, title: "晴天"},
+	}
+	for _, tt := range tests {
+		if title, artist := PlaylistEntryTitle(tt.entry); title != tt.title || artist != tt.artist {
+			t.Fatalf("PlaylistEntryTitle(%+v) = %q, %q", tt.entry, title, artist)
+		}
+	}
+}
+
+func TestParseTrackListCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []PlaylistEntry
+	}{
+		{
+			name: "exportify",
+			data: "\"Track URI\",\"Track Name\",\"Artist Name(s)\",\"Album Name\",\"Duration (ms)\"\n" +
+				"\"spotify:track:1\",\"晴天\",\"周杰伦\",\"叶惠美\",\"269453\"\n" +
+				"\"spotify:track:2\",\"\",\"Nobody\",\"\",\"1000\"\n" +
+				"\"spotify:track:3\",\"Something, Else\",\"A, B\",\"\",\"\"\n",
+			want: []PlaylistEntry{
+				{Title: "晴天", Artist: "周杰伦", Album: "叶惠美", Duration: 269},
+				{Title: "Something, Else", Artist: "A, B"},
+			},
+		},
+		{
+			name: "chinese headers with m:ss",
+			data: "歌名,歌手,专辑,时长\n十年,陈奕迅,黑白灰,3:25\n",
+			want: []PlaylistEntry{{Title: "十年", Artist: "陈奕迅", Album: "黑白灰", Duration: 205}},
+		},
+		{
+			name: "seconds and milliseconds",
+			data: "Title,Artist,Duration\nA,X,245\nB,Y,245000\n",
+			want: []PlaylistEntry{{Title: "A", Artist: "X", Duration: 245}, {Title: "B", Artist: "Y", Duration: 245}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseTrackListCSV([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("%s: ParseTrackListCSV() error = %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: ParseTrackListCSV() = %+v", tt.name, got)
+		}
+	}
+
+	for _, data := range []string{"", "Artist,Album\nX,Y\n", "Track\n\n"} {
+		if _, err := ParseTrackListCSV([]byte(data)); err == nil {
+			t.Fatalf("ParseTrackListCSV(%q) should fail", data)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Scheduled job types. The web server provides the runner for each type.
+const (
+	JobRefreshCollections  = "refresh_collections"
+	JobValidatePlayability = "validate_playability"
+	JobRescanLocalMusic    = "rescan_local_music"
+	JobCheckUpdate         = "check_update"
+	JobSourceHealth        = "source_health"
+	JobCheckSubscriptions  = "check_subscriptions"
+	JobPurgeTrash          = "purge_trash"
+)
+
+const (
+	JobStatusRunning = "running"
+	JobStatusSuccess = "success"
+	JobStatusFailed  = "failed"
+
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+
+	maxScheduledJobRuns  = 50
+	scheduledJobsSeedKey = "scheduled_jobs_seeded"
+)
+
+// ScheduledJobTypes lists every job type in display order.
+func ScheduledJobTypes() []string {
+	return []string{JobRefreshCollections, JobCheckSubscriptions, JobValidatePlayability, JobRescanLocalMusic, JobCheckUpdate, JobSourceHealth, JobPurgeTrash}
+}
+
+// IsScheduledJobType reports whether jobType is a known job type.
+func IsScheduledJobType(jobType string) bool {
+	for _, known := range ScheduledJobTypes() {
+		if jobType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ScheduledJob is a recurring job stored in settings.db. The Last* fields
+// mirror the most recent run so job lists need no join.
+type ScheduledJob struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `gorm:"size:128;not null" json:"name"`
+	Type           string    `gorm:"size:64;index;not null" json:"type"`
+	Cron           string    `gorm:"size:128;not null" json:"cron"`
+	Enabled        bool      `json:"enabled"`
+	LastRunAt      time.Time `json:"last_run_at"`
+	LastStatus     string    `gorm:"size:16" json:"last_status"`
+	LastMessage    string    `gorm:"type:text" json:"last_message"`
+	LastError      string    `gorm:"type:text" json:"last_error"`
+	LastDurationMs int64     `json:"last_duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ScheduledJobRun is one execution of a job. Detail holds the runner's JSON
+// report, e.g. per-source probe results.
+type ScheduledJobRun struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	JobID      uint      `gorm:"index;not null" json:"job_id"`
+	Trigger    string    `gorm:"size:16" json:"trigger"`
+	Status     string    `gorm:"size:16" json:"status"`
+	Message    string    `gorm:"type:text" json:"message"`
+	Error      string    `gorm:"type:text" json:"error"`
+	Detail     string    `gorm:"type:text" json:"detail,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// defaultScheduledJobs are created the first time jobs are listed. They start
+// disabled, except the subscription check and the recycle bin purge, which
+// keep subscriptions and retention working without any setup.
+func defaultScheduledJobs() []ScheduledJob {
+	return []ScheduledJob{
+		{Name: "刷新导入歌单", Type: JobRefreshCollections, Cron: "0 6 * * *"},
+		{Name: "检查订阅歌单", Type: JobCheckSubscriptions, Cron: "*/10 * * * *", Enabled: true},
+		{Name: "检查歌单可播放性", Type: JobValidatePlayability, Cron: "0 3 * * 0"},
+		{Name: "重新扫描本地音乐", Type: JobRescanLocalMusic, Cron: "30 4 * * *"},
+		{Name: "检查更新", Type: JobCheckUpdate, Cron: "0 9 * * *"},
+		{Name: "音源健康检查", Type: JobSourceHealth, Cron: "0 */6 * * *"},
+		{Name: "清理回收站", Type: JobPurgeTrash, Cron: "0 * * * *", Enabled: true},
+	}
+}
+
+// firstSeededJobTypes are the types seeded under the bare scheduledJobsSeedKey,
+// before each type got its own marker.
+var firstSeededJobTypes = []string{JobRefreshCollections, JobValidatePlayability, JobRescanLocalMusic, JobCheckUpdate, JobSourceHealth}
+
+func initScheduledJobTables() error {
+	if err := ensureConfigDB(); err != nil {
+		return err
+	}
+	if err := configDB.AutoMigrate(&ScheduledJob{}, &ScheduledJobRun{}); err != nil {
+		return err
+	}
+
+	// Seed each type once, so jobs the user deleted are not recreated while
+	// types added later still reach settings seeded before them.
+	if missing, err := unseededScheduledJobs(configDB); err != nil || len(missing) == 0 {
+		return err
+	}
+	return configDB.Transaction(func(tx *gorm.DB) error {
+		missing, err := unseededScheduledJobs(tx)
+		if err != nil {
+			return err
+		}
+		for _, job := range missing {
+			if err := tx.Create(&job).Error; err != nil {
+				return err
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&configKV{Key: scheduledJobsSeedKey + ":" + job.Type, Value: "1"}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// unseededScheduledJobs returns the default jobs whose type was never seeded.
+func unseededScheduledJobs(tx *gorm.DB) ([]ScheduledJob, error) {
+	var markers []configKV
+	if err := tx.Where("key = ? OR key LIKE ?", scheduledJobsSeedKey, scheduledJobsSeedKey+":%").Find(&markers).Error; err != nil {
+		return nil, err
+	}
+	seeded := map[string]bool{}
+	for _, marker := range markers {
+		if marker.Key == scheduledJobsSeedKey {
+			for _, jobType := range firstSeededJobTypes {
+				seeded[jobType] = true
+			}
+			continue
+		}
+		seeded[strings.TrimPrefix(marker.Key, scheduledJobsSeedKey+":")] = true
+	}
+	var missing []ScheduledJob
+	for _, job := range defaultScheduledJobs() {
+		if !seeded[job.Type] {
+			missing = append(missing, job)
+		}
+	}
+	return missing, nil
+}
+
+func (j *ScheduledJob) normalize() error {
+	j.Name = cleanDownloadRecordText(j.Name)
+	j.Type = strings.TrimSpace(j.Type)
+	j.Cron = strings.Join(strings.Fields(j.Cron), " ")
+	if !IsScheduledJobType(j.Type) {
+		return fmt.Errorf("unknown job type %q", j.Type)
+	}
+	if _, err := ParseCronSchedule(j.Cron); err != nil {
+		return err
+	}
+	if j.Name == "" {
+		j.Name = j.Type
+	}
+	return nil
+}
+
+// NextRun returns when the job is next due after its last run or edit,
+// whichever is later, so enabling a job does not fire it for times that passed
+// while it was off. A zero time means the job is disabled or never fires.
+func (j *ScheduledJob) NextRun() time.Time {
+	if !j.Enabled {
+		return time.Time{}
+	}
+	schedule, err := ParseCronSchedule(j.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	base := j.CreatedAt
+	if j.UpdatedAt.After(base) {
+		base = j.UpdatedAt
+	}
+	if j.LastRunAt.After(base) {
+		base = j.LastRunAt
+	}
+	return schedule.Next(base)
+}
+
+// ListScheduledJobs returns every job in creation order.
+func ListScheduledJobs() ([]ScheduledJob, error) {
+	if err := initScheduledJobTables(); err != nil {
+		return nil, err
+	}
+	var jobs []ScheduledJob
+	err := configDB.Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+// GetScheduledJob returns the job with the given ID, or nil.
+func GetScheduledJob(id uint) (*ScheduledJob, error) {
+	if err := initScheduledJobTables(); err != nil {
+		return nil, err
+	}
+	var job ScheduledJob
+	result := configDB.Where("id = ?", id).Limit(1).Find(&job)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &job, nil
+}
+
+// SaveScheduledJob validates the job type and cron expression, then creates
+// or updates the job. Run status fields are left to the runs.
+func SaveScheduledJob(job *ScheduledJob) error {
+	if job == nil {
+		return errors.New("job is nil")
+	}
+	if err := job.normalize(); err != nil {
+		return err
+	}
+	if err := initScheduledJobTables(); err != nil {
+		return err
+	}
+	if job.ID == 0 {
+		return configDB.Create(job).Error
+	}
+	return configDB.Model(job).Select("name", "type", "cron", "enabled").Updates(job).Error
+}
+
+// DeleteScheduledJob removes a job and its run history.
+func DeleteScheduledJob(id uint) error {
+	if err := initScheduledJobTables(); err != nil {
+		return err
+	}
+	return configDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id = ?", id).Delete(&ScheduledJobRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&ScheduledJob{}, id).Error
+	})
+}
+
+// StartScheduledJobRun records that a run began and marks the job as run at
+// that moment, so the scheduler does not start it again while it runs.
+func StartScheduledJobRun(jobID uint, trigger string) (*ScheduledJobRun, error) {
+	if err := initScheduledJobTables(); err != nil {
+		return nil, err
+	}
+	run := &ScheduledJobRun{JobID: jobID, Trigger: trigger, Status: JobStatusRunning, StartedAt: time.Now()}
+	err := configDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ScheduledJob{}).Where("id = ?", jobID).Updates(map[string]any{
+			"last_run_at": run.StartedAt,
+			"last_status": JobStatusRunning,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// FinishScheduledJobRun stores the outcome of a run on the run and its job
+// and trims the job's history.
+func FinishScheduledJobRun(run *ScheduledJobRun, message, detail string, runErr error) error {
+	if run == nil {
+		return errors.New("run is nil")
+	}
+	if err := initScheduledJobTables(); err != nil {
+		return err
+	}
+	run.FinishedAt = time.Now()
+	run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.Message = strings.TrimSpace(message)
+	run.Detail = detail
+	run.Status = JobStatusSuccess
+	run.Error = ""
+	if runErr != nil {
+		run.Status = JobStatusFailed
+		run.Error = runErr.Error()
+	}
+	return configDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(run).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&ScheduledJob{}).Where("id = ?", run.JobID).Updates(map[string]any{
+			"last_status":      run.Status,
+			"last_message":     run.Message,
+			"last_error":       run.Error,
+			"last_duration_ms": run.DurationMs,
+		}).Error; err != nil {
+			return err
+		}
+		var stale []uint
+		if err := tx.Model(&ScheduledJobRun{}).Where("job_id = ?", run.JobID).
+			Order("id DESC").Offset(maxScheduledJobRuns).Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return tx.Where("id IN ?", stale).Delete(&ScheduledJobRun{}).Error
+	})
+}
+
+// ListScheduledJobRuns returns a job's most recent runs, newest first.
+func ListScheduledJobRuns(jobID uint, limit int) ([]ScheduledJobRun, error) {
+	if err := initScheduledJobTables(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxScheduledJobRuns {
+		limit = maxScheduledJobRuns
+	}
+	var runs []ScheduledJobRun
+	err := configDB.Where("job_id = ?", jobID).Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// MarkInterruptedJobRuns fails runs left "running" by a previous process.
+func MarkInterruptedJobRuns() error {
+	if err := initScheduledJobTables(); err != nil {
+		return err
+	}
+	const reason = "interrupted by restart"
+	return configDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ScheduledJobRun{}).Where("status = ?", JobStatusRunning).
+			Updates(map[string]any{"status": JobStatusFailed, "error": reason}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ScheduledJob{}).Where("last_status = ?", JobStatusRunning).
+			Updates(map[string]any{"last_status": JobStatusFailed, "last_error": reason}).Error
+	})
+}
+
+// ==========================================
+// Cron 表达式
+// ==========================================
+
+// CronSchedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week (0 or 7 is Sunday). Fields accept *, lists,
+// ranges and steps; @hourly, @daily, @weekly and @monthly are shorthands.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseCronSchedule parses a cron expression.
+func ParseCronSchedule(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields, got %d", expr, len(fields))
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+	return &CronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if base, stepText, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rangePart, step = base, n
+		}
+		start, end := lo, hi
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("bad range in %q", part)
+				}
+			} else if step > 1 {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	// As in cron, a restricted day of month and day of week match either.
+	if !s.domAny && !s.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// Next returns the first matching minute strictly after t, or the zero time
+// if none falls within five years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2026-03-04 is a Wednesday.
+	from := time.Date(2026, 3, 4, 10, 17, 42, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2026, 3, 4, 10, 18, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC)},
+		{expr: "30 4 * * *", want: time.Date(2026, 3, 5, 4, 30, 0, 0, time.UTC)},
+		{expr: "0 9-17/4 * * *", want: time.Date(2026, 3, 4, 13, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 0", want: time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", want: time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", want: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week both restricted: either matches.
+		{expr: "0 0 20 * 5", want: time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCronSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCronSchedule(%q) error = %v", tt.expr, err)
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Fatalf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCronSchedule(expr); err == nil {
+			t.Fatalf("ParseCronSchedule(%q) should fail", expr)
+		}
+	}
+}
+
+func TestScheduledJobsPersistRunsAndHistory(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Setenv("MUSIC_DL_CONFIG_DB", filepath.Join(baseDir, "data", "settings.db"))
+	t.Setenv("MUSIC_DL_COOKIE_FILE", filepath.Join(baseDir, "data", "cookies.json"))
+	resetConfigStateForTest()
+	t.Cleanup(resetConfigStateForTest)
+
+	jobs, err := ListScheduledJobs()
+	if err != nil {
+		t.Fatalf("ListScheduledJobs() error = %v", err)
+	}
+	if len(jobs) != len(ScheduledJobTypes()) {
+		t.Fatalf("seeded %d jobs, want one per type", len(jobs))
+	}
+	for _, job := range jobs {
+		wantEnabled := job.Type == JobCheckSubscriptions || job.Type == JobPurgeTrash
+		if job.Enabled != wantEnabled || job.NextRun().IsZero() == wantEnabled {
+			t.Fatalf("seeded job %q enabled = %v, want %v", job.Name, job.Enabled, wantEnabled)
+		}
+	}
+
+	// Deleted defaults stay deleted.
+	if err := DeleteScheduledJob(jobs[0].ID); err != nil {
+		t.Fatalf("DeleteScheduledJob() error = %v", err)
+	}
+	if jobs, _ = ListScheduledJobs(); len(jobs) != len(ScheduledJobTypes())-1 {
+		t.Fatalf("jobs after delete = %d", len(jobs))
+	}
+
+	if err := SaveScheduledJob(&ScheduledJob{Type: "unknown", Cron: "* * * * *"}); err == nil {
+		t.Fatal("SaveScheduledJob() should reject unknown types")
+	}
+	if err := SaveScheduledJob(&ScheduledJob{Type: JobCheckUpdate, Cron: "every day"}); err == nil {
+		t.Fatal("SaveScheduledJob() should reject bad cron expressions")
+	}
+	job := &ScheduledJob{Name: " 每小时扫描 ", Type: JobRescanLocalMusic, Cron: " 0  *  * * * ", Enabled: true}
+	if err := SaveScheduledJob(job); err != nil {
+		t.Fatalf("SaveScheduledJob() error = %v", err)
+	}
+	if job.Name != "每小时扫描" || job.Cron != "0 * * * *" {
+		t.Fatalf("saved job = %+v", job)
+	}
+
+	for i := 0; i < maxScheduledJobRuns+2; i++ {
+		run, err := StartScheduledJobRun(job.ID, JobTriggerManual)
+		if err != nil {
+			t.Fatalf("StartScheduledJobRun() error = %v", err)
+		}
+		var runErr error
+		if i == maxScheduledJobRuns+1 {
+			runErr = errors.New("scan failed")
+		}
+		if err := FinishScheduledJobRun(run, "扫描完成", "", runErr); err != nil {
+			t.Fatalf("FinishScheduledJobRun() error = %v", err)
+		}
+	}
+	runs, err := ListScheduledJobRuns(job.ID, 0)
+	if err != nil {
+		t.Fatalf("ListScheduledJobRuns() error = %v", err)
+	}
+	if len(runs) != maxScheduledJobRuns || runs[0].Status != JobStatusFailed || runs[0].Error != "scan failed" {
+		t.Fatalf("runs = %d, newest = %+v", len(runs), runs[0])
+	}
+
+	stored, err := GetScheduledJob(job.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetScheduledJob() = %v, %v", stored, err)
+	}
+	if stored.LastStatus != JobStatusFailed || stored.LastError != "scan failed" || stored.LastRunAt.IsZero() {
+		t.Fatalf("job status = %+v", stored)
+	}
+	if next := stored.NextRun(); !next.After(stored.LastRunAt) || next.Minute() != 0 {
+		t.Fatalf("NextRun() = %v after %v", next, stored.LastRunAt)
+	}
+
+	// A run left running by a crash is failed on the next start.
+	if _, err := StartScheduledJobRun(job.ID, JobTriggerSchedule); err != nil {
+		t.Fatalf("StartScheduledJobRun() error = %v", err)
+	}
+	if err := MarkInterruptedJobRuns(); err != nil {
+		t.Fatalf("MarkInterruptedJobRuns() error = %v", err)
+	}
+	if stored, _ = GetScheduledJob(job.ID); stored.LastStatus != JobStatusFailed {
+		t.Fatalf("interrupted job status = %q", stored.LastStatus)
+	}
+}
+
+func TestScheduledJobsSeedTypesAddedLater(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Setenv("MUSIC_DL_CONFIG_DB", filepath.Join(baseDir, "data", "settings.db"))
+	t.Setenv("MUSIC_DL_COOKIE_FILE", filepath.Join(baseDir, "data", "cookies.json"))
+	resetConfigStateForTest()
+	t.Cleanup(resetConfigStateForTest)
+
+	// Settings seeded before the subscription and purge jobs existed, with
+	// every job deleted since.
+	if err := ensureConfigDB(); err != nil {
+		t.Fatalf("ensureConfigDB() error = %v", err)
+	}
+	if err := configDB.Create(&configKV{Key: scheduledJobsSeedKey, Value: "1"}).Error; err != nil {
+		t.Fatalf("create seed marker: %v", err)
+	}
+
+	jobs, err := ListScheduledJobs()
+	if err != nil {
+		t.Fatalf("ListScheduledJobs() error = %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Type != JobCheckSubscriptions || jobs[1].Type != JobPurgeTrash {
+		t.Fatalf("jobs = %+v, want only the types added later", jobs)
+	}
+	if err := DeleteScheduledJob(jobs[0].ID); err != nil {
+		t.Fatalf("DeleteScheduledJob() error = %v", err)
+	}
+	if jobs, _ = ListScheduledJobs(); len(jobs) != 1 {
+		t.Fatalf("jobs after delete = %d, want deleted defaults to stay deleted", len(jobs))
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"unicode/utf16"
 
 	"github.com/dhowden/tag"
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 	"github.com/guohuiyuan/music-lib/apple"
 	"github.com/guohuiyuan/music-lib/bilibili"
 	"github.com/guohuiyuan/music-lib/fivesing"
@@ -1103,20 +1104,217 @@ func id3UTF16LEText(value string) []byte {
 	return data
 }
 
+// id3EncodedText returns the text encoding byte, the encoded string and its
+// terminator: UTF-16 with BOM for ID3v2.3, UTF-8 for ID3v2.4.
+func id3EncodedText(version byte, value string) (byte, []byte, []byte) {
+	if version == 4 {
+		return 0x03, []byte(value), []byte{0x00}
+	}
+	return 0x01, id3UTF16LEText(value), []byte{0x00, 0x00}
+}
+
 func id3TextFramePayload(value string) []byte {
-	payload := []byte{0x01}
-	payload = append(payload, id3UTF16LEText(value)...)
+	return id3VersionedTextPayload(3, value)
+}
+
+func id3VersionedTextPayload(version byte, value string) []byte {
+	encoding, text, _ := id3EncodedText(version, value)
+	payload := []byte{encoding}
+	payload = append(payload, text...)
 	return payload
 }
 
 func id3USLTPayload(lyric string) []byte {
-	payload := []byte{0x01, 'e', 'n', 'g'}
-	payload = append(payload, id3UTF16LEText("")...)
-	payload = append(payload, 0x00, 0x00)
-	payload = append(payload, id3UTF16LEText(lyric)...)
+	return id3LangTextPayload(3, "eng", "", lyric)
+}
+
+// id3LangTextPayload encodes the shared layout of USLT and COMM frames.
+func id3LangTextPayload(version byte, lang, description, text string) []byte {
+	encoding, desc, terminator := id3EncodedText(version, description)
+	_, body, _ := id3EncodedText(version, text)
+	payload := []byte{encoding}
+	payload = append(payload, id3LanguageCode(lang)...)
+	payload = append(payload, desc...)
+	payload = append(payload, terminator...)
+	payload = append(payload, body...)
 	return payload
 }
 
+func id3COMMPayload(comment string) []byte {
+	return id3USLTPayload(comment)
+}
+
+func id3TXXXPayload(description, value string) []byte {
+	return id3VersionedTXXXPayload(3, description, value)
+}
+
+func id3VersionedTXXXPayload(version byte, description, value string) []byte {
+	encoding, desc, terminator := id3EncodedText(version, description)
+	_, body, _ := id3EncodedText(version, value)
+	payload := []byte{encoding}
+	payload = append(payload, desc...)
+	payload = append(payload, terminator...)
+	payload = append(payload, body...)
+	return payload
+}
+
+// id3TXXXDescription decodes the description of a TXXX frame so user defined
+// frames can be replaced one by one instead of all at once.
+func id3TXXXDescription(payload []byte) string {
+	if len(payload) < 2 {
+		return ""
+	}
+	description, _ := id3SplitText(payload[0], payload[1:])
+	return description
+}
+
+// id3SplitText decodes the first terminated string of data in the given text
+// encoding and returns it with the bytes after its terminator.
+func id3SplitText(encoding byte, data []byte) (string, []byte) {
+	switch encoding {
+	case 0x01, 0x02:
+		end, next := len(data)&^1, len(data)
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				end, next = i, i+2
+				break
+			}
+		}
+		body := data[:end]
+		bigEndian := encoding == 0x02
+		if len(body) >= 2 && body[0] == 0xFE && body[1] == 0xFF {
+			bigEndian = true
+			body = body[2:]
+		} else if len(body) >= 2 && body[0] == 0xFF && body[1] == 0xFE {
+			bigEndian = false
+			body = body[2:]
+		}
+		units := make([]uint16, 0, len(body)/2)
+		for i := 0; i+1 < len(body); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(body[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(body[i:]))
+			}
+		}
+		return string(utf16.Decode(units)), data[next:]
+	default:
+		end, next := len(data), len(data)
+		if idx := bytes.IndexByte(data, 0x00); idx >= 0 {
+			end, next = idx, idx+1
+		}
+		return string(data[:end]), data[next:]
+	}
+}
+
+// id3v24OnlyFrames have no ID3v2.3 counterpart and are left out when a v2.4
+// tag is rewritten as v2.3. TDRC is handled separately.
+var id3v24OnlyFrames = map[string]bool{
+	"ASPI": true, "EQU2": true, "RVA2": true, "SEEK": true, "SIGN": true,
+	"TDEN": true, "TDOR": true, "TDRL": true, "TDTG": true, "TIPL": true,
+	"TMCL": true, "TMOO": true, "TPRO": true, "TSST": true,
+}
+
+// downgradeID3v24Frame re-encodes a frame of an ID3v2.4 tag for ID3v2.3.
+// UTF-8 and UTF-16BE text, which v2.3 cannot carry, becomes UTF-16 with BOM
+// and multiple text values are joined with "/". It reports false for frames
+// v2.3 has no place for.
+func downgradeID3v24Frame(id string, payload []byte) (string, []byte, bool) {
+	if id3v24OnlyFrames[id] {
+		return "", nil, false
+	}
+	if id == "TDRC" {
+		id = "TYER"
+	}
+	if len(payload) == 0 || payload[0] <= 0x01 || payload[0] > 0x03 {
+		if id == "TYER" && len(payload) > 0 {
+			text, _ := id3SplitText(payload[0], payload[1:])
+			return id, id3VersionedTextPayload(3, id3YearPrefix(text)), true
+		}
+		return id, payload, true
+	}
+	encoding, body := payload[0], payload[1:]
+	switch {
+	case id == "TXXX":
+		description, rest := id3SplitText(encoding, body)
+		value := strings.ReplaceAll(strings.TrimRight(id3DecodeAll(encoding, rest), "\x00"), "\x00", "/")
+		return id, id3VersionedTXXXPayload(3, description, value), true
+	case id == "TYER":
+		return id, id3VersionedTextPayload(3, id3YearPrefix(id3DecodeAll(encoding, body))), true
+	case id[0] == 'T':
+		text := strings.ReplaceAll(strings.TrimRight(id3DecodeAll(encoding, body), "\x00"), "\x00", "/")
+		return id, id3VersionedTextPayload(3, text), true
+	case (id == "COMM" || id == "USLT") && len(body) >= 3:
+		description, rest := id3SplitText(encoding, body[3:])
+		return id, id3LangTextPayload(3, string(body[:3]), description, id3DecodeAll(encoding, rest)), true
+	case id == "WXXX":
+		description, url := id3SplitText(encoding, body)
+		_, desc, terminator := id3EncodedText(3, description)
+		out := append([]byte{0x01}, desc...)
+		out = append(out, terminator...)
+		return id, append(out, url...), true
+	case id == "APIC":
+		mime, rest := id3SplitText(0x00, body)
+		if len(rest) == 0 {
+			return "", nil, false
+		}
+		pictureType := rest[0]
+		description, data := id3SplitText(encoding, rest[1:])
+		_, desc, terminator := id3EncodedText(3, description)
+		out := append([]byte{0x01}, mime...)
+		out = append(out, 0x00, pictureType)
+		out = append(out, desc...)
+		out = append(out, terminator...)
+		return id, append(out, data...), true
+	case id == "SYLT" && len(body) >= 5:
+		out := append([]byte{0x01}, body[:5]...)
+		description, rest := id3SplitText(encoding, body[5:])
+		_, desc, terminator := id3EncodedText(3, description)
+		out = append(out, desc...)
+		out = append(out, terminator...)
+		for len(rest) > 0 {
+			var line string
+			line, rest = id3SplitText(encoding, rest)
+			if len(rest) < 4 {
+				break
+			}
+			_, text, terminator := id3EncodedText(3, line)
+			out = append(out, text...)
+			out = append(out, terminator...)
+			out = append(out, rest[:4]...)
+			rest = rest[4:]
+		}
+		return id, out, true
+	default:
+		// Other frames with a text encoding byte (GEOB, USER, OWNE, COMR) are
+		// rare enough that they are dropped rather than re-encoded.
+		switch id {
+		case "GEOB", "USER", "OWNE", "COMR":
+			return "", nil, false
+		}
+		return id, payload, true
+	}
+}
+
+// id3DecodeAll decodes every byte of data in the given text encoding.
+func id3DecodeAll(encoding byte, data []byte) string {
+	var parts []string
+	for len(data) > 0 {
+		var part string
+		part, data = id3SplitText(encoding, data)
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func id3YearPrefix(date string) string {
+	date = strings.TrimSpace(date)
+	if len(date) > 4 {
+		date = date[:4]
+	}
+	return date
+}
+
 func id3APICPayload(coverData []byte, coverMime string) []byte {
 	mimeType := normalizeCoverMime(coverMime)
 	payload := []byte{0x00}
@@ -1127,12 +1325,23 @@ func id3APICPayload(coverData []byte, coverMime string) []byte {
 }
 
 func id3v23Frame(id string, payload []byte) []byte {
+	return id3VersionedFrame(3, id, payload)
+}
+
+// id3VersionedFrame writes a frame header; ID3v2.4 stores frame sizes as
+// synchsafe integers while ID3v2.3 uses plain big endian.
+func id3VersionedFrame(version byte, id string, payload []byte) []byte {
 	if id == "" || len(payload) == 0 {
 		return nil
 	}
 	frame := make([]byte, 0, 10+len(payload))
 	frame = append(frame, []byte(id)...)
-	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	if version == 4 {
+		size := id3SynchsafeSize(len(payload))
+		frame = append(frame, size[:]...)
+	} else {
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	}
 	frame = append(frame, 0x00, 0x00)
 	frame = append(frame, payload...)
 	return frame
@@ -1152,7 +1361,18 @@ func isID3v23FrameID(id []byte) bool {
 }
 
 func preservedID3v23Frames(audioData []byte, replace map[string]bool) []byte {
-	if len(audioData) < 10 || string(audioData[:3]) != "ID3" || audioData[3] != 0x03 {
+	return preservedID3Frames(audioData, replace, 3)
+}
+
+// preservedID3Frames returns the frames of an existing ID3v2.3/v2.4 tag that are
+// not listed in replace, re-encoded for the target version. Frames of a v2.4 tag
+// written as v2.3 go through downgradeID3v24Frame.
+func preservedID3Frames(audioData []byte, replace map[string]bool, version byte) []byte {
+	if len(audioData) < 10 || string(audioData[:3]) != "ID3" {
+		return nil
+	}
+	sourceVersion := audioData[3]
+	if sourceVersion != 0x03 && sourceVersion != 0x04 {
 		return nil
 	}
 	if audioData[5]&0x40 != 0 {
@@ -1178,62 +1398,142 @@ func preservedID3v23Frames(audioData []byte, replace map[string]bool) []byte {
 			break
 		}
 		frameSize := int(binary.BigEndian.Uint32(header[4:8]))
+		if sourceVersion == 0x04 {
+			if frameSize, ok = decodeID3SynchsafeSize(header[4:8]); !ok {
+				break
+			}
+		}
 		if frameSize <= 0 || pos+10+frameSize > len(tagData) {
 			break
 		}
 		frameID := string(header[:4])
+		payload := tagData[pos+10 : pos+10+frameSize]
+		frame := tagData[pos : pos+10+frameSize]
+		pos += 10 + frameSize
+		if sourceVersion == 0x04 && version != 4 {
+			// Compressed, encrypted or unsynchronised v2.4 frames are not
+			// worth decoding just to downgrade them.
+			if header[9] != 0 {
+				continue
+			}
+			var keep bool
+			if frameID, payload, keep = downgradeID3v24Frame(frameID, payload); !keep {
+				continue
+			}
+			frame = id3VersionedFrame(version, frameID, payload)
+		} else if sourceVersion != version {
+			frame = id3VersionedFrame(version, frameID, payload)
+		}
+		if frameID == "TXXX" && replace["TXXX:"+id3TXXXDescription(payload)] {
+			continue
+		}
 		if !replace[frameID] {
-			preserved = append(preserved, tagData[pos:pos+10+frameSize]...)
+			preserved = append(preserved, frame...)
 		}
-		pos += 10 + frameSize
 	}
 	return preserved
 }
 
-func embedMP3ID3v23Metadata(audioData []byte, title, artist, album, lyric string, coverData []byte, coverMime string) ([]byte, error) {
+func embedMP3ID3v23Metadata(audioData []byte, meta AudioMetadata, coverData []byte, coverMime string) ([]byte, error) {
+	return embedMP3ID3Metadata(audioData, meta, coverData, coverMime, 3)
+}
+
+// embedMP3ID3Metadata writes an ID3v2.3 (UTF-16) or ID3v2.4 (UTF-8) tag. Timed
+// lyrics are also written as a SYLT frame, and translated lines found in the
+// LRC go into their own USLT frame.
+func embedMP3ID3Metadata(audioData []byte, meta AudioMetadata, coverData []byte, coverMime string, version byte) ([]byte, error) {
+	if version != 4 {
+		version = 3
+	}
+	dateFrame := [2]string{"TYER", meta.Year()}
+	if version == 4 {
+		dateFrame = [2]string{"TDRC", meta.Date}
+	}
+	textFrames := [][2]string{
+		{"TIT2", meta.Title},
+		{"TPE1", meta.Artist},
+		{"TALB", meta.Album},
+		{"TPE2", meta.AlbumArtist},
+		{"TCOM", meta.Composer},
+		{"TCON", meta.Genre},
+		dateFrame,
+		{"TRCK", meta.TrackTag()},
+		{"TPOS", meta.DiscTag()},
+		{"TSRC", meta.ISRC},
+	}
+
 	var frames bytes.Buffer
 	replaceFrames := map[string]bool{}
-	if title != "" {
-		replaceFrames["TIT2"] = true
+	for _, frame := range textFrames {
+		if frame[1] != "" {
+			replaceFrames[frame[0]] = true
+		}
 	}
-	if artist != "" {
-		replaceFrames["TPE1"] = true
+	if version == 4 && meta.Date != "" {
+		replaceFrames["TYER"] = true
+		replaceFrames["TDAT"] = true
 	}
-	if album != "" {
-		replaceFrames["TALB"] = true
+	if meta.Comment != "" {
+		replaceFrames["COMM"] = true
 	}
-	if lyric != "" {
+	if meta.Lyric != "" {
 		replaceFrames["USLT"] = true
+		replaceFrames["SYLT"] = true
 	}
 	if len(coverData) > 0 {
 		replaceFrames["APIC"] = true
 	}
-	frames.Write(preservedID3v23Frames(audioData, replaceFrames))
+	if meta.Rating > 0 || meta.ClearRating {
+		replaceFrames["POPM"] = true
+	}
+	customTags := meta.CustomTags()
+	for _, custom := range customTags {
+		replaceFrames["TXXX:"+custom[0]] = true
+	}
+	frames.Write(preservedID3Frames(audioData, replaceFrames, version))
 
-	if title != "" {
-		frames.Write(id3v23Frame("TIT2", id3TextFramePayload(title)))
+	for _, frame := range textFrames {
+		if frame[1] != "" {
+			frames.Write(id3VersionedFrame(version, frame[0], id3VersionedTextPayload(version, frame[1])))
+		}
 	}
-	if artist != "" {
-		frames.Write(id3v23Frame("TPE1", id3TextFramePayload(artist)))
+	if meta.Comment != "" {
+		frames.Write(id3VersionedFrame(version, "COMM", id3LangTextPayload(version, "eng", "", meta.Comment)))
 	}
-	if album != "" {
-		frames.Write(id3v23Frame("TALB", id3TextFramePayload(album)))
+	for _, custom := range customTags {
+		frames.Write(id3VersionedFrame(version, "TXXX", id3VersionedTXXXPayload(version, custom[0], custom[1])))
 	}
-	if lyric != "" {
-		frames.Write(id3v23Frame("USLT", id3USLTPayload(lyric)))
+	if meta.Lyric != "" {
+		original, translation := lyrics.SplitTranslation(meta.Lyric)
+		lang := lyrics.DetectLanguage(original)
+		frames.Write(id3VersionedFrame(version, "USLT", id3LangTextPayload(version, lang, "", original)))
+		if translation != "" {
+			frames.Write(id3VersionedFrame(version, "USLT", id3LangTextPayload(version, lyrics.DetectLanguage(translation), "translation", translation)))
+		}
+		if lines := lyrics.Parse(original).Lines; len(lines) > 0 {
+			frames.Write(id3VersionedFrame(version, "SYLT", id3SYLTPayload(version, lang, lines)))
+		}
 	}
 	if len(coverData) > 0 {
-		frames.Write(id3v23Frame("APIC", id3APICPayload(coverData, coverMime)))
+		frames.Write(id3VersionedFrame(version, "APIC", id3APICPayload(coverData, coverMime)))
+	}
+	if meta.Rating > 0 {
+		payload := append([]byte(popmRatingEmail), 0, popmRatingByte(meta.Rating))
+		frames.Write(id3VersionedFrame(version, "POPM", payload))
 	}
 
 	frameData := frames.Bytes()
 	if len(frameData) == 0 {
+		if meta.ClearRating {
+			// The rating was the only frame, so the whole tag goes.
+			return stripID3v2Prefix(audioData), nil
+		}
 		return audioData, nil
 	}
 
 	size := id3SynchsafeSize(len(frameData))
 	out := make([]byte, 0, 10+len(frameData)+len(audioData))
-	out = append(out, 'I', 'D', '3', 0x03, 0x00, 0x00)
+	out = append(out, 'I', 'D', '3', version, 0x00, 0x00)
 	out = append(out, size[:]...)
 	out = append(out, frameData...)
 	out = append(out, stripID3v2Prefix(audioData)...)
@@ -1258,42 +1558,49 @@ func normalizeCoverMime(coverMime string) string {
 }
 
 func FetchBytesWithMime(urlStr string, source string) ([]byte, string, error) {
+	data, contentType, _, err := fetchBytesWithLength(urlStr, source)
+	return data, contentType, err
+}
+
+// fetchBytesWithLength also reports the size announced by the server
+// (Content-Range total or Content-Length), or -1 when it is unknown.
+func fetchBytesWithLength(urlStr string, source string) ([]byte, string, int64, error) {
 	if fetch, handled, err := NewSourceRangeFetch(urlStr, source, ""); handled || err != nil {
 		if err != nil {
-			return nil, "", err
+			return nil, "", -1, err
 		}
 		var buf bytes.Buffer
 		if fetch.ContentLength > 0 && fetch.ContentLength <= int64(1<<(strconv.IntSize-1)-1) {
 			buf.Grow(int(fetch.ContentLength))
 		}
 		if err := fetch.WriteTo(&buf); err != nil {
-			return nil, "", err
+			return nil, "", -1, err
 		}
-		return buf.Bytes(), fetch.ContentType, nil
+		return buf.Bytes(), fetch.ContentType, fetch.Total, nil
 	}
 	return fetchBytesSingle(urlStr, source)
 }
 
-func fetchBytesSingle(urlStr string, source string) ([]byte, string, error) {
+func fetchBytesSingle(urlStr string, source string) ([]byte, string, int64, error) {
 	req, err := BuildSourceRequest("GET", urlStr, source, "")
 	if err != nil {
-		return nil, "", err
+		return nil, "", -1, err
 	}
 
 	client := &http.Client{Timeout: 2 * time.Minute}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, "", err
+		return nil, "", -1, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, "", fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		return nil, "", -1, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, "", err
+		return nil, "", -1, err
 	}
 
 	contentType := strings.TrimSpace(resp.Header.Get("Content-Type"))
@@ -1305,7 +1612,7 @@ func fetchBytesSingle(urlStr string, source string) ([]byte, string, error) {
 		contentType = strings.TrimSpace(contentType[:idx])
 	}
 
-	return data, contentType, nil
+	return data, contentType, resp.ContentLength, nil
 }
 
 type SourceRangeFetch struct {
@@ -1586,7 +1893,17 @@ func resolveRangeHeader(value string, total int64) (int64, int64, bool, bool) {
 	return start, end, true, true
 }
 
+// MetadataOptions tunes how EmbedSongMetadataWithOptions writes tags.
+type MetadataOptions struct {
+	ID3Version  int  // 3 (default, UTF-16) or 4 (UTF-8)
+	WriteRating bool // write Extra["rating"] as POPM (MP3) or RATING (FLAC)
+}
+
 func EmbedSongMetadata(audioData []byte, song *model.Song, lyric string, coverData []byte, coverMime string) ([]byte, error) {
+	return EmbedSongMetadataWithOptions(audioData, song, lyric, coverData, coverMime, MetadataOptions{})
+}
+
+func EmbedSongMetadataWithOptions(audioData []byte, song *model.Song, lyric string, coverData []byte, coverMime string, opts MetadataOptions) ([]byte, error) {
 	if len(audioData) == 0 {
 		return nil, errors.New("empty audio data")
 	}
@@ -1600,31 +1917,16 @@ func EmbedSongMetadata(audioData []byte, song *model.Song, lyric string, coverDa
 		}
 	}
 
-	title := ""
-	artist := ""
-	album := ""
-	if song != nil {
-		title = strings.TrimSpace(song.Name)
-		artist = strings.TrimSpace(song.Artist)
-		album = strings.TrimSpace(song.Album)
+	meta := SongAudioMetadata(song)
+	meta.Lyric = strings.TrimSpace(lyric)
+	if opts.WriteRating {
+		meta.Rating = SongRating(song)
 	}
-	lyric = strings.TrimSpace(lyric)
 	coverMime = normalizeCoverMime(coverMime)
 	incomingCover := len(coverData) > 0
 
 	if existing, err := tag.ReadFrom(bytes.NewReader(audioData)); err == nil {
-		if existingTitle := strings.TrimSpace(existing.Title()); title == "" && existingTitle != "" {
-			title = existingTitle
-		}
-		if existingArtist := strings.TrimSpace(existing.Artist()); artist == "" && existingArtist != "" {
-			artist = existingArtist
-		}
-		if existingAlbum := strings.TrimSpace(existing.Album()); album == "" && existingAlbum != "" {
-			album = existingAlbum
-		}
-		if existingLyric := strings.TrimSpace(existing.Lyrics()); lyric == "" && existingLyric != "" {
-			lyric = existingLyric
-		}
+		mergeExistingAudioMetadata(&meta, existing)
 		if ext == "mp3" && !incomingCover {
 			if picture := existing.Picture(); picture != nil && len(picture.Data) > 0 {
 				coverData = append([]byte(nil), picture.Data...)
@@ -1638,18 +1940,109 @@ func EmbedSongMetadata(audioData []byte, song *model.Song, lyric string, coverDa
 	if ext != "mp3" && ext != "flac" && ext != "m4a" && ext != "wma" {
 		return audioData, nil
 	}
-	if title == "" && artist == "" && album == "" && lyric == "" && len(coverData) == 0 {
+	if meta.isEmpty() && len(coverData) == 0 {
 		return audioData, nil
 	}
 
 	if ext == "mp3" {
-		return embedMP3ID3v23Metadata(audioData, title, artist, album, lyric, coverData, coverMime)
+		if opts.ID3Version == 4 {
+			return embedMP3ID3Metadata(audioData, meta, coverData, coverMime, 4)
+		}
+		return embedMP3ID3v23Metadata(audioData, meta, coverData, coverMime)
+	}
+	if ext == "flac" {
+		return embedFLACMetadata(audioData, meta, coverData, coverMime)
+	}
+	if ext == "m4a" {
+		return embedMP4Metadata(audioData, meta, coverData, coverMime)
 	}
 
-	return embedAudioMetadataByFFmpeg(audioData, ext, title, artist, album, lyric, coverData, coverMime)
+	return embedAudioMetadataByFFmpeg(audioData, ext, meta, coverData, coverMime)
 }
 
-func embedAudioMetadataByFFmpeg(audioData []byte, ext, title, artist, album, lyric string, coverData []byte, coverMime string) ([]byte, error) {
+// ErrRatingUnsupported is returned when a file has no rating tag this package
+// can rewrite without touching its other tags.
+var ErrRatingUnsupported = errors.New("rating tags can only be written to MP3 (ID3v2.3/2.4) and FLAC files")
+
+// WriteAudioRating sets the star rating (1-5) of an MP3 or FLAC file as POPM
+// or RATING and keeps every other tag; 0 stars removes the rating tag. An
+// existing ID3 tag keeps its version; id3Version is used for files without one.
+func WriteAudioRating(audioData []byte, stars int, id3Version int) ([]byte, error) {
+	if stars < 0 || stars > MaxSongRating {
+		return nil, fmt.Errorf("rating must be between 0 and %d", MaxSongRating)
+	}
+	meta := AudioMetadata{Rating: stars, ClearRating: stars == 0}
+	switch DetectAudioExtBySignature(audioData) {
+	case "mp3":
+		if len(audioData) >= 10 && string(audioData[:3]) == "ID3" {
+			// Other versions and extended headers would not be preserved.
+			if (audioData[3] != 3 && audioData[3] != 4) || audioData[5]&0x40 != 0 {
+				return nil, ErrRatingUnsupported
+			}
+			id3Version = int(audioData[3])
+		}
+		return embedMP3ID3Metadata(audioData, meta, nil, "", byte(id3Version))
+	case "flac":
+		return embedFLACMetadata(audioData, meta, nil, "")
+	}
+	return nil, ErrRatingUnsupported
+}
+
+// mergeExistingAudioMetadata keeps tags already present in the file for every
+// field the source did not provide.
+func mergeExistingAudioMetadata(meta *AudioMetadata, existing tag.Metadata) {
+	fill := func(dst *string, value string) {
+		if *dst == "" {
+			*dst = strings.TrimSpace(value)
+		}
+	}
+	fill(&meta.Title, existing.Title())
+	fill(&meta.Artist, existing.Artist())
+	fill(&meta.Album, existing.Album())
+	fill(&meta.AlbumArtist, existing.AlbumArtist())
+	fill(&meta.Composer, existing.Composer())
+	fill(&meta.Genre, existing.Genre())
+	fill(&meta.Comment, existing.Comment())
+	fill(&meta.Lyric, existing.Lyrics())
+	if meta.Date == "" && existing.Year() > 0 {
+		meta.Date = strconv.Itoa(existing.Year())
+	}
+	if meta.TrackNumber == 0 {
+		meta.TrackNumber, meta.TrackTotal = existing.Track()
+	}
+	if meta.DiscNumber == 0 {
+		meta.DiscNumber, meta.DiscTotal = existing.Disc()
+	}
+}
+
+// ffmpegMetadataEntries maps the tag set onto ffmpeg metadata keys.
+func ffmpegMetadataEntries(meta AudioMetadata) [][2]string {
+	entries := [][2]string{
+		{"title", meta.Title},
+		{"artist", meta.Artist},
+		{"album", meta.Album},
+		{"album_artist", meta.AlbumArtist},
+		{"composer", meta.Composer},
+		{"genre", meta.Genre},
+		{"date", meta.Date},
+		{"track", meta.TrackTag()},
+		{"disc", meta.DiscTag()},
+		{"comment", meta.Comment},
+		{"lyrics", meta.Lyric},
+	}
+	entries = append(entries, [2]string{"ISRC", meta.ISRC})
+	entries = append(entries, meta.CustomTags()...)
+
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if entry[1] != "" {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+func embedAudioMetadataByFFmpeg(audioData []byte, ext string, meta AudioMetadata, coverData []byte, coverMime string) ([]byte, error) {
 	ffmpegPath, err := ResolveFFmpegPath()
 	if err != nil {
 		return nil, ErrFFmpegNotFound
@@ -1712,17 +2105,8 @@ func embedAudioMetadataByFFmpeg(audioData []byte, ext, title, artist, album, lyr
 		args = append(args, "-c", "copy")
 	}
 
-	if title != "" {
-		args = append(args, "-metadata", "title="+title)
-	}
-	if artist != "" {
-		args = append(args, "-metadata", "artist="+artist)
-	}
-	if album != "" {
-		args = append(args, "-metadata", "album="+album)
-	}
-	if lyric != "" {
-		args = append(args, "-metadata", "lyrics="+lyric)
+	for _, entry := range ffmpegMetadataEntries(meta) {
+		args = append(args, "-metadata", entry[0]+"="+entry[1])
 	}
 
 	if ext == "mp3" {
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -201,3 +202,261 @@ func TestEmbedSongMetadataPreservesFLACMetadataWhenAddingAlbum(t *testing.T) {
 		t.Fatalf("metadata genre = %q, want preserved Jazz", metadata.Genre())
 	}
 }
+
+func TestEmbedSongMetadataWritesExtendedMP3Frames(t *testing.T) {
+	audioData := []byte{0xff, 0xfb, 0x90, 0x64}
+	song := &model.Song{
+		ID:     "1001",
+		Source: "netease",
+		Name:   "Title",
+		Artist: "Artist",
+		Album:  "Album",
+		Ext:    "mp3",
+		Extra: map[string]string{
+			"track":        "2/10",
+			"disc":         "1",
+			"release_date": "2018-06-01",
+			"genre":        "Rock",
+			"album_artist": "Band",
+			"composer":     "Writer",
+			"isrc":         "USRC17607839",
+		},
+	}
+
+	first, err := EmbedSongMetadata(audioData, song, "", nil, "")
+	if err != nil {
+		t.Fatalf("EmbedSongMetadata() error = %v", err)
+	}
+	song.ID = "1002"
+	embedded, err := EmbedSongMetadata(first, song, "", nil, "")
+	if err != nil {
+		t.Fatalf("second EmbedSongMetadata() error = %v", err)
+	}
+
+	metadata, err := tag.ReadFrom(bytes.NewReader(embedded))
+	if err != nil {
+		t.Fatalf("ReadFrom(embedded): %v", err)
+	}
+	track, total := metadata.Track()
+	disc, _ := metadata.Disc()
+	if track != 2 || total != 10 || disc != 1 {
+		t.Fatalf("track/disc = %d/%d/%d, want 2/10/1", track, total, disc)
+	}
+	if metadata.Year() != 2018 || metadata.Genre() != "Rock" || metadata.AlbumArtist() != "Band" || metadata.Composer() != "Writer" {
+		t.Fatalf("year/genre/album artist/composer = %d/%q/%q/%q", metadata.Year(), metadata.Genre(), metadata.AlbumArtist(), metadata.Composer())
+	}
+
+	raw := metadata.Raw()
+	if count := bytes.Count(embedded, id3UTF16LEText(CustomTagSourceID)); count != 1 {
+		t.Fatalf("TXXX %s frames = %d, want replaced to exactly 1 (raw %#v)", CustomTagSourceID, count, raw)
+	}
+	if !bytes.Contains(embedded, id3UTF16LEText("1002")) || bytes.Contains(embedded, id3UTF16LEText("1001")) {
+		t.Fatal("TXXX source id should be replaced with the new song id")
+	}
+	if !bytes.Contains(embedded, id3UTF16LEText("USRC17607839")) {
+		t.Fatal("TSRC frame should carry the ISRC")
+	}
+}
+
+func TestEmbedSongMetadataWritesID3v24SyncedAndTranslatedLyrics(t *testing.T) {
+	audioData := []byte{0xff, 0xfb, 0x90, 0x64}
+	lyric := "[00:01.00]こんにちは\n[00:01.00]你好\n[00:02.50]さようなら\n[00:02.50]再见"
+
+	var existing bytes.Buffer
+	existing.Write(id3v23Frame("TCON", id3TextFramePayload("J-Pop")))
+	tagSize := id3SynchsafeSize(existing.Len())
+	tagged := append([]byte{'I', 'D', '3', 0x03, 0x00, 0x00}, tagSize[:]...)
+	tagged = append(tagged, existing.Bytes()...)
+	tagged = append(tagged, audioData...)
+
+	embedded, err := EmbedSongMetadataWithOptions(tagged, &model.Song{Name: "歌", Artist: "歌手", Ext: "mp3"}, lyric, nil, "", MetadataOptions{ID3Version: 4})
+	if err != nil {
+		t.Fatalf("EmbedSongMetadataWithOptions() error = %v", err)
+	}
+
+	metadata, err := tag.ReadFrom(bytes.NewReader(embedded))
+	if err != nil {
+		t.Fatalf("ReadFrom(embedded): %v", err)
+	}
+	if metadata.Format() != tag.ID3v2_4 {
+		t.Fatalf("metadata format = %v, want ID3v2.4", metadata.Format())
+	}
+	if metadata.Title() != "歌" || metadata.Genre() != "J-Pop" {
+		t.Fatalf("title/genre = %q/%q, want 歌 and preserved J-Pop", metadata.Title(), metadata.Genre())
+	}
+	if metadata.Lyrics() != "[00:01.00]こんにちは\n[00:02.50]さようなら" {
+		t.Fatalf("original lyrics = %q", metadata.Lyrics())
+	}
+
+	translated, ok := metadata.Raw()["USLT_0"].(*tag.Comm)
+	if !ok || translated.Language != "chi" || translated.Description != "translation" || translated.Text != "[00:01.00]你好\n[00:02.50]再见" {
+		t.Fatalf("translated USLT = %#v", metadata.Raw()["USLT_0"])
+	}
+
+	sylt := bytes.Index(embedded, []byte("SYLT"))
+	if sylt < 0 {
+		t.Fatal("SYLT frame should be written")
+	}
+	wantSYLT := []byte{0x03, 'j', 'p', 'n', 0x02, 0x01, 0x00}
+	wantSYLT = append(wantSYLT, "こんにちは"...)
+	wantSYLT = append(wantSYLT, 0x00, 0x00, 0x00, 0x03, 0xE8)
+	wantSYLT = append(wantSYLT, "さようなら"...)
+	wantSYLT = append(wantSYLT, 0x00, 0x00, 0x00, 0x09, 0xC4)
+	if got := embedded[sylt+10 : sylt+10+len(wantSYLT)]; !bytes.Equal(got, wantSYLT) {
+		t.Fatalf("SYLT payload = %x, want %x", got, wantSYLT)
+	}
+}
+
+func TestEmbedSongMetadataDowngradesExistingID3v24Frames(t *testing.T) {
+	audioData := []byte{0xff, 0xfb, 0x90, 0x64}
+	popm := append([]byte(popmRatingEmail), 0, 255)
+
+	var existing bytes.Buffer
+	existing.Write(id3VersionedFrame(4, "TPE1", id3VersionedTextPayload(4, "旧歌手")))
+	existing.Write(id3VersionedFrame(4, "TEXT", []byte("\x03作词\x00作词二")))
+	existing.Write(id3VersionedFrame(4, "TXXX", id3VersionedTXXXPayload(4, "REPLAYGAIN_TRACK_GAIN", "-6.20 dB")))
+	existing.Write(id3VersionedFrame(4, "USLT", id3LangTextPayload(4, "jpn", "", "歌詞")))
+	existing.Write(id3VersionedFrame(4, "POPM", popm))
+	existing.Write(id3VersionedFrame(4, "TDRC", id3VersionedTextPayload(4, "2019-05-07")))
+	existing.Write(id3VersionedFrame(4, "TMOO", id3VersionedTextPayload(4, "calm")))
+	tagSize := id3SynchsafeSize(existing.Len())
+	tagged := append([]byte{'I', 'D', '3', 0x04, 0x00, 0x00}, tagSize[:]...)
+	tagged = append(tagged, existing.Bytes()...)
+	tagged = append(tagged, audioData...)
+
+	embedded, err := EmbedSongMetadata(tagged, &model.Song{Name: "歌", Artist: "歌手", Ext: "mp3"}, "", nil, "")
+	if err != nil {
+		t.Fatalf("EmbedSongMetadata() error = %v", err)
+	}
+	metadata, err := tag.ReadFrom(bytes.NewReader(embedded))
+	if err != nil {
+		t.Fatalf("ReadFrom(embedded): %v", err)
+	}
+	if metadata.Format() != tag.ID3v2_3 {
+		t.Fatalf("metadata format = %v, want ID3v2.3", metadata.Format())
+	}
+	if metadata.Artist() != "歌手" || metadata.Lyrics() != "歌詞" || metadata.Year() != 2019 {
+		t.Fatalf("artist/lyrics/year = %q/%q/%d", metadata.Artist(), metadata.Lyrics(), metadata.Year())
+	}
+	if !bytes.Contains(embedded, id3UTF16LEText("-6.20 dB")) || !bytes.Contains(embedded, popm) {
+		t.Fatal("ReplayGain TXXX and POPM frames should be kept")
+	}
+	if !bytes.Contains(embedded, id3UTF16LEText("作词/作词二")) {
+		t.Fatal("multiple v2.4 text values should be joined with /")
+	}
+	if bytes.Contains(embedded, []byte("TMOO")) || bytes.Contains(embedded, []byte("TDRC")) || bytes.Contains(embedded, []byte("旧歌手")) {
+		t.Fatal("v2.4-only and replaced frames should not be written")
+	}
+}
+
+func TestEmbedSongMetadataWritesRatingOnlyWhenEnabled(t *testing.T) {
+	audioData := []byte{0xff, 0xfb, 0x90, 0x64}
+	song := &model.Song{Name: "Title", Artist: "Artist", Album: "Album", Ext: "mp3", Extra: map[string]string{"rating": "4"}}
+	popm := append([]byte(popmRatingEmail), 0, 196)
+
+	plain, err := EmbedSongMetadata(audioData, song, "", nil, "")
+	if err != nil {
+		t.Fatalf("EmbedSongMetadata() error = %v", err)
+	}
+	if bytes.Contains(plain, []byte("POPM")) {
+		t.Fatal("rating should not be written unless enabled")
+	}
+	rated, err := EmbedSongMetadataWithOptions(audioData, song, "", nil, "", MetadataOptions{WriteRating: true})
+	if err != nil {
+		t.Fatalf("EmbedSongMetadataWithOptions() error = %v", err)
+	}
+	if !bytes.Contains(rated, popm) {
+		t.Fatal("POPM frame should carry the 4 star rating")
+	}
+}
+
+func TestWriteAudioRatingKeepsOtherTags(t *testing.T) {
+	audioData := []byte{0xff, 0xfb, 0x90, 0x64}
+	var existingFrames bytes.Buffer
+	existingFrames.Write(id3v23Frame("TIT2", id3TextFramePayload("Kept")))
+	existingFrames.Write(id3v23Frame("POPM", append([]byte(popmRatingEmail), 0, 1)))
+	frameData := existingFrames.Bytes()
+	tagSize := id3SynchsafeSize(len(frameData))
+	tagged := append([]byte{'I', 'D', '3', 0x03, 0x00, 0x00}, tagSize[:]...)
+	tagged = append(append(tagged, frameData...), audioData...)
+
+	rated, err := WriteAudioRating(tagged, 5, 4)
+	if err != nil {
+		t.Fatalf("WriteAudioRating(mp3) error = %v", err)
+	}
+	metadata, err := tag.ReadFrom(bytes.NewReader(rated))
+	if err != nil {
+		t.Fatalf("ReadFrom(rated): %v", err)
+	}
+	if metadata.Format() != tag.ID3v2_3 || metadata.Title() != "Kept" {
+		t.Fatalf("format/title = %v/%q, want ID3v2.3 and the kept title", metadata.Format(), metadata.Title())
+	}
+	if bytes.Count(rated, []byte("POPM")) != 1 || !bytes.Contains(rated, append([]byte(popmRatingEmail), 0, 255)) {
+		t.Fatal("the old POPM frame should be replaced by a 5 star one")
+	}
+
+	flac := buildTestFLAC([]flacMetadataBlock{
+		{Type: flacBlockStreamInfo, Data: make([]byte, 34)},
+		{Type: flacBlockVorbisComment, Data: buildFLACVorbisComment("ref", []string{"TITLE=Kept", "RATING=20"})},
+	}, []byte{0xFF, 0xF8, 0x69, 0x08})
+	rated, err = WriteAudioRating(flac, 4, 3)
+	if err != nil {
+		t.Fatalf("WriteAudioRating(flac) error = %v", err)
+	}
+	blocks, _, err := parseFLACMetadataBlocks(rated)
+	if err != nil {
+		t.Fatalf("parseFLACMetadataBlocks() error = %v", err)
+	}
+	_, comments := parseFLACVorbisComment(blocks[1].Data)
+	if len(comments) != 2 || comments[0] != "TITLE=Kept" || comments[1] != "RATING=80" {
+		t.Fatalf("comments = %v, want the title kept and RATING=80", comments)
+	}
+
+	if _, err := WriteAudioRating([]byte("OggS0000"), 3, 3); !errors.Is(err, ErrRatingUnsupported) {
+		t.Fatalf("WriteAudioRating(ogg) error = %v, want ErrRatingUnsupported", err)
+	}
+}
+
+func TestWriteAudioRatingZeroRemovesRating(t *testing.T) {
+	audioData := []byte{0xff, 0xfb, 0x90, 0x64}
+	buildTagged := func(frames ...[]byte) []byte {
+		frameData := bytes.Join(frames, nil)
+		tagSize := id3SynchsafeSize(len(frameData))
+		tagged := append([]byte{'I', 'D', '3', 0x03, 0x00, 0x00}, tagSize[:]...)
+		return append(append(tagged, frameData...), audioData...)
+	}
+	popm := id3v23Frame("POPM", append([]byte(popmRatingEmail), 0, 255))
+
+	cleared, err := WriteAudioRating(buildTagged(id3v23Frame("TIT2", id3TextFramePayload("Kept")), popm), 0, 3)
+	if err != nil {
+		t.Fatalf("WriteAudioRating(mp3, 0) error = %v", err)
+	}
+	metadata, err := tag.ReadFrom(bytes.NewReader(cleared))
+	if err != nil {
+		t.Fatalf("ReadFrom(cleared): %v", err)
+	}
+	if metadata.Title() != "Kept" || bytes.Contains(cleared, []byte("POPM")) {
+		t.Fatalf("title = %q, POPM left = %v; want the title kept and the rating gone", metadata.Title(), bytes.Contains(cleared, []byte("POPM")))
+	}
+
+	cleared, err = WriteAudioRating(buildTagged(popm), 0, 3)
+	if err != nil || !bytes.Equal(cleared, audioData) {
+		t.Fatalf("WriteAudioRating(rating only, 0) = %x, %v; want the tag removed", cleared, err)
+	}
+
+	flac := buildTestFLAC([]flacMetadataBlock{
+		{Type: flacBlockStreamInfo, Data: make([]byte, 34)},
+		{Type: flacBlockVorbisComment, Data: buildFLACVorbisComment("ref", []string{"TITLE=Kept", "RATING=80"})},
+	}, []byte{0xFF, 0xF8, 0x69, 0x08})
+	cleared, err = WriteAudioRating(flac, 0, 3)
+	if err != nil {
+		t.Fatalf("WriteAudioRating(flac, 0) error = %v", err)
+	}
+	blocks, _, err := parseFLACMetadataBlocks(cleared)
+	if err != nil {
+		t.Fatalf("parseFLACMetadataBlocks() error = %v", err)
+	}
+	if _, comments := parseFLACVorbisComment(blocks[1].Data); len(comments) != 1 || comments[0] != "TITLE=Kept" {
+		t.Fatalf("comments = %v, want only the title", comments)
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
+	"github.com/guohuiyuan/music-lib/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SongOverride holds user corrections for one song, keyed by source and ID.
+// Empty fields leave the upstream value alone. LyricOffsetMs moves every lyric
+// line; positive values show the lines later.
+type SongOverride struct {
+	Source        string    `gorm:"primaryKey;size:64" json:"source"`
+	SongID        string    `gorm:"primaryKey;size:512" json:"song_id"`
+	Name          string    `gorm:"size:512" json:"name"`
+	Artist        string    `gorm:"size:512" json:"artist"`
+	Album         string    `gorm:"size:512" json:"album"`
+	Cover         string    `gorm:"size:2048" json:"cover"`
+	Lyric         string    `json:"lyric"`
+	LyricOffsetMs int       `json:"lyric_offset_ms"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (o *SongOverride) normalize() {
+	o.Source = cleanDownloadRecordText(o.Source)
+	o.SongID = strings.TrimSpace(o.SongID)
+	o.Name = cleanDownloadRecordText(o.Name)
+	o.Artist = cleanDownloadRecordText(o.Artist)
+	o.Album = cleanDownloadRecordText(o.Album)
+	o.Cover = strings.TrimSpace(o.Cover)
+	o.Lyric = strings.TrimSpace(strings.ReplaceAll(o.Lyric, "\r\n", "\n"))
+}
+
+// IsEmpty reports whether the override changes nothing.
+func (o *SongOverride) IsEmpty() bool {
+	return o.Name == "" && o.Artist == "" && o.Album == "" && o.Cover == "" && o.Lyric == "" && o.LyricOffsetMs == 0
+}
+
+// GetSongOverride returns the override stored for the song, or nil.
+func GetSongOverride(source, songID string) (*SongOverride, error) {
+	source = strings.TrimSpace(source)
+	songID = strings.TrimSpace(songID)
+	if source == "" || songID == "" {
+		return nil, nil
+	}
+	if err := ensureConfigDB(); err != nil {
+		return nil, err
+	}
+	var override SongOverride
+	err := configDB.Where("source = ? AND song_id = ?", source, songID).First(&override).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// ListSongOverrides returns every override, most recently edited first.
+func ListSongOverrides() ([]SongOverride, error) {
+	if err := ensureConfigDB(); err != nil {
+		return nil, err
+	}
+	var overrides []SongOverride
+	err := configDB.Order("updated_at DESC").Find(&overrides).Error
+	return overrides, err
+}
+
+// SaveSongOverride creates or replaces the override for its source and ID. An
+// override that changes nothing is deleted instead.
+func SaveSongOverride(override *SongOverride) error {
+	if override == nil {
+		return errors.New("override is nil")
+	}
+	override.normalize()
+	if override.Source == "" || override.SongID == "" {
+		return errors.New("missing song id or source")
+	}
+	if override.IsEmpty() {
+		return DeleteSongOverride(override.Source, override.SongID)
+	}
+	if err := ensureConfigDB(); err != nil {
+		return err
+	}
+	return configDB.Clauses(clause.OnConflict{UpdateAll: true}).Create(override).Error
+}
+
+// DeleteSongOverride removes the override for the song, if any.
+func DeleteSongOverride(source, songID string) error {
+	if err := ensureConfigDB(); err != nil {
+		return err
+	}
+	return configDB.Where("source = ? AND song_id = ?", strings.TrimSpace(source), strings.TrimSpace(songID)).Delete(&SongOverride{}).Error
+}
+
+// ApplySongOverride copies the overridden metadata onto the song. It reports
+// whether an override was found; lookup errors leave the song untouched.
+func ApplySongOverride(song *model.Song) bool {
+	if song == nil {
+		return false
+	}
+	override, err := GetSongOverride(song.Source, song.ID)
+	if err != nil || override == nil {
+		return false
+	}
+	override.applyTo(song)
+	return true
+}
+
+// ApplySongOverrides applies overrides to a list of songs with one query per
+// source.
+func ApplySongOverrides(songs []model.Song) {
+	idsBySource := map[string][]string{}
+	for _, song := range songs {
+		if song.Source != "" && song.ID != "" {
+			idsBySource[song.Source] = append(idsBySource[song.Source], song.ID)
+		}
+	}
+	if len(idsBySource) == 0 || ensureConfigDB() != nil {
+		return
+	}
+
+	found := map[string]SongOverride{}
+	for source, ids := range idsBySource {
+		var overrides []SongOverride
+		if err := configDB.Where("source = ? AND song_id IN ?", source, ids).Find(&overrides).Error; err != nil {
+			continue
+		}
+		for _, override := range overrides {
+			found[override.Source+"\x00"+override.SongID] = override
+		}
+	}
+	for i := range songs {
+		if override, ok := found[songs[i].Source+"\x00"+songs[i].ID]; ok {
+			override.applyTo(&songs[i])
+		}
+	}
+}
+
+func (o *SongOverride) applyTo(song *model.Song) {
+	if o.Name != "" {
+		song.Name = o.Name
+	}
+	if o.Artist != "" {
+		song.Artist = o.Artist
+	}
+	if o.Album != "" {
+		song.Album = o.Album
+	}
+	if o.Cover != "" {
+		song.Cover = o.Cover
+	}
+}
+
+// ApplyLyric replaces the lyric with the override text and shifts its timing.
+func (o *SongOverride) ApplyLyric(raw string) string {
+	if o.Lyric != "" {
+		raw = o.Lyric
+	}
+	if o.LyricOffsetMs != 0 {
+		raw = lyrics.Shift(raw, o.LyricOffsetMs)
+	}
+	return raw
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func useTempConfigDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("MUSIC_DL_CONFIG_DB", filepath.Join(t.TempDir(), "settings.db"))
+	resetConfigStateForTest()
+	t.Cleanup(resetConfigStateForTest)
+}
+
+func TestSongOverrideSaveApplyAndDelete(t *testing.T) {
+	useTempConfigDB(t)
+
+	if err := SaveSongOverride(&SongOverride{Source: "qq", SongID: "1", Artist: " 周杰伦 ", Album: "叶惠美"}); err != nil {
+		t.Fatalf("SaveSongOverride: %v", err)
+	}
+	if err := SaveSongOverride(&SongOverride{Source: "qq", SongID: "1", Artist: "周杰伦", Album: "叶惠美", Cover: "https://example.com/c.jpg"}); err != nil {
+		t.Fatalf("SaveSongOverride replace: %v", err)
+	}
+
+	song := &model.Song{ID: "1", Source: "qq", Name: "晴天", Artist: "Jay Chou"}
+	if !ApplySongOverride(song) {
+		t.Fatal("ApplySongOverride found no override")
+	}
+	if song.Name != "晴天" || song.Artist != "周杰伦" || song.Album != "叶惠美" || song.Cover != "https://example.com/c.jpg" {
+		t.Fatalf("song after override = %+v", song)
+	}
+
+	songs := []model.Song{{ID: "1", Source: "qq", Artist: "Jay Chou"}, {ID: "1", Source: "netease", Artist: "Jay Chou"}}
+	ApplySongOverrides(songs)
+	if songs[0].Artist != "周杰伦" || songs[1].Artist != "Jay Chou" {
+		t.Fatalf("ApplySongOverrides = %+v", songs)
+	}
+
+	overrides, err := ListSongOverrides()
+	if err != nil || len(overrides) != 1 {
+		t.Fatalf("ListSongOverrides = %+v, %v", overrides, err)
+	}
+
+	// Saving an override that changes nothing removes it.
+	if err := SaveSongOverride(&SongOverride{Source: "qq", SongID: "1"}); err != nil {
+		t.Fatalf("SaveSongOverride empty: %v", err)
+	}
+	if override, err := GetSongOverride("qq", "1"); err != nil || override != nil {
+		t.Fatalf("GetSongOverride after clear = %+v, %v", override, err)
+	}
+	if err := SaveSongOverride(&SongOverride{Source: "qq", Name: "x"}); err == nil {
+		t.Fatal("SaveSongOverride without song id should fail")
+	}
+}
+
+func TestResolveLyricAppliesOverride(t *testing.T) {
+	stubLyricResolver(t, map[string]map[string]string{"qq": {"1": "[00:01.00]晴天"}}, nil)
+
+	if err := SaveSongOverride(&SongOverride{Source: "qq", SongID: "1", LyricOffsetMs: 500}); err != nil {
+		t.Fatalf("SaveSongOverride: %v", err)
+	}
+	got, err := ResolveLyric(&model.Song{ID: "1", Source: "qq", Name: "晴天"})
+	if err != nil || got.Lyric != "[00:01.50]晴天" || !got.Overridden {
+		t.Fatalf("ResolveLyric with offset = %+v, %v", got, err)
+	}
+
+	if err := SaveSongOverride(&SongOverride{Source: "qq", SongID: "1", Lyric: "[00:02.00]自己的歌词", LyricOffsetMs: -1000}); err != nil {
+		t.Fatalf("SaveSongOverride: %v", err)
+	}
+	got, err = ResolveLyric(&model.Song{ID: "1", Source: "qq", Name: "晴天"})
+	if err != nil || got.Lyric != "[00:01.00]自己的歌词" || got.Source != "qq" {
+		t.Fatalf("ResolveLyric with lyric override = %+v, %v", got, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -19,6 +20,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 	"github.com/guohuiyuan/music-lib/apple"
 	"github.com/guohuiyuan/music-lib/bilibili"
 	"github.com/guohuiyuan/music-lib/fivesing"
@@ -560,10 +562,11 @@ type modelState struct {
 	cursor     int              // 当前光标位置
 
 	// 配置参数
-	sources    []string // 指定搜索源
-	outDir     string
-	withCover  bool
-	withLyrics bool
+	sources     []string // 指定搜索源
+	outDir      string
+	withCover   bool
+	withLyrics  bool
+	lyricFormat lyrics.Format // 非空时额外保存该格式的歌词文件
 
 	// 下载队列管理
 	downloadQueue []model.Song        // 待下载队列
@@ -573,6 +576,10 @@ type modelState struct {
 	failed        int                 // 失败数量
 	allSongsSet   map[string]struct{} // SQLite 去重集合，批量下载时复用
 
+	// 歌单文件：从歌单 / 专辑进入时记录名称，下载结束后按队列顺序写出 M3U8 等文件
+	collectionName string
+	savedEntries   []core.PlaylistEntry
+
 	// 换源队列管理
 	switchQueue []int
 	switchTotal int
@@ -592,7 +599,7 @@ type modelState struct {
 }
 
 // 启动 UI 的入口
-func StartUI(initialKeyword string, sources []string, outDir string, withCover bool, withLyrics bool) {
+func StartUI(initialKeyword string, sources []string, outDir string, withCover bool, withLyrics bool, lyricFormat lyrics.Format) {
 	// 1. 加载 Cookies
 	cm.Load()
 
@@ -622,17 +629,18 @@ func StartUI(initialKeyword string, sources []string, outDir string, withCover b
 	}
 
 	m := modelState{
-		state:      initialState,
-		searchType: searchTypeSong,
-		textInput:  ti,
-		spinner:    sp,
-		progress:   prog,
-		selected:   make(map[int]struct{}),
-		sources:    sources,
-		outDir:     outDir,
-		withCover:  withCover,
-		withLyrics: withLyrics,
-		pageSize:   pageSize,
+		state:       initialState,
+		searchType:  searchTypeSong,
+		textInput:   ti,
+		spinner:     sp,
+		progress:    prog,
+		selected:    make(map[int]struct{}),
+		sources:     sources,
+		outDir:      outDir,
+		withCover:   withCover,
+		withLyrics:  withLyrics,
+		lyricFormat: lyricFormat,
+		pageSize:    pageSize,
 	}
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
@@ -715,6 +723,7 @@ func (m modelState) updateInput(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// 清空旧数据
 				m.songs = nil
 				m.playlists = nil
+				m.collectionName = ""
 				return m, tea.Batch(m.spinner.Tick, searchCmd(val, m.searchType, m.sources))
 			}
 		case tea.KeyEsc:
@@ -815,6 +824,7 @@ func (m modelState) updatePlaylistResult(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "enter":
 			if len(m.playlists) > 0 {
 				target := m.playlists[m.cursor]
+				m.collectionName = target.Name
 				if m.searchType == searchTypePlaylist || m.searchType == searchTypeAlbum {
 					m.state = stateLoading
 					m.statusMsg = fmt.Sprintf("正在获取%s [%s] 详情...", collectionLabel(m.searchType), target.Name)
@@ -899,12 +909,19 @@ func (m modelState) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.selected[m.cursor] = struct{}{}
 			}
 
-			m.downloadQueue = []model.Song{}
+			// 按列表顺序入队，歌单文件才能保持原有曲序
+			indices := make([]int, 0, len(m.selected))
 			for idx := range m.selected {
 				if idx >= 0 && idx < len(m.songs) {
-					m.downloadQueue = append(m.downloadQueue, m.songs[idx])
+					indices = append(indices, idx)
 				}
 			}
+			sort.Ints(indices)
+			m.downloadQueue = []model.Song{}
+			for _, idx := range indices {
+				m.downloadQueue = append(m.downloadQueue, m.songs[idx])
+			}
+			m.savedEntries = nil
 
 			m.totalToDl = len(m.downloadQueue)
 			m.downloaded = 0
@@ -959,7 +976,8 @@ func (m modelState) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 type downloadOneFinishedMsg struct {
 	err     error
 	song    model.Song
-	skipped bool // 因已存在而跳过
+	skipped bool   // 因已存在而跳过
+	path    string // 保存（或已存在）的文件路径，未知时为空
 }
 
 type switchSourceResultMsg struct {
@@ -981,6 +999,9 @@ func (m modelState) updateDownloading(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, cmd
 
 	case downloadOneFinishedMsg:
+		if msg.err == nil && msg.path != "" {
+			m.savedEntries = append(m.savedEntries, core.PlaylistEntryForSong(&msg.song, msg.path))
+		}
 		if msg.skipped {
 			m.skipped++
 			m.statusMsg = fmt.Sprintf("⏭ 已跳过: %s - %s (已存在)", msg.song.Name, msg.song.Artist)
@@ -1003,15 +1024,36 @@ func (m modelState) updateDownloading(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.state = stateList
 			m.selected = make(map[int]struct{})
 			m.statusMsg = fmt.Sprintf("✅ 任务结束  成功: %d | 跳过: %d | 失败: %d", m.downloaded, m.skipped, m.failed)
+			m.statusMsg += m.writePlaylistFiles()
 			return m, nil
 		}
 
-		cmds = append(cmds, downloadNextCmd(m.downloadQueue, m.outDir, m.withCover, m.withLyrics, m.allSongsSet))
+		cmds = append(cmds, downloadNextCmd(m.downloadQueue, m.outDir, m.withCover, m.withLyrics, m.lyricFormat, m.allSongsSet))
 		return m, tea.Batch(cmds...)
 	}
 	return m, nil
 }
 
+// writePlaylistFiles 在歌单 / 专辑下载结束后按设置写出歌单文件，返回追加到状态栏的说明。
+func (m modelState) writePlaylistFiles() string {
+	if m.collectionName == "" || len(m.savedEntries) == 0 {
+		return ""
+	}
+	formats, err := core.ParsePlaylistFormats(core.GetWebSettings().PlaylistFileFormats)
+	if err != nil || len(formats) == 0 {
+		return ""
+	}
+	files, err := core.WritePlaylistFiles("", m.collectionName, m.savedEntries, formats)
+	if err != nil {
+		return fmt.Sprintf(" | 歌单文件写入失败: %v", err)
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = filepath.Base(file)
+	}
+	return " | 歌单文件: " + strings.Join(names, ", ")
+}
+
 // --- 4.3 下载前确认状态逻辑 ---
 func (m modelState) updateConfirmDownload(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
@@ -1022,7 +1064,7 @@ func (m modelState) updateConfirmDownload(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.statusMsg = "正在准备下载..."
 			return m, tea.Batch(
 				m.spinner.Tick,
-				downloadNextCmd(m.downloadQueue, m.outDir, m.withCover, m.withLyrics, m.allSongsSet),
+				downloadNextCmd(m.downloadQueue, m.outDir, m.withCover, m.withLyrics, m.lyricFormat, m.allSongsSet),
 			)
 		case "esc":
 			m.state = stateList
@@ -1364,18 +1406,26 @@ func fetchPlaylistSongsCmd(id, source string) tea.Cmd {
 	return fetchCollectionSongsCmd(id, source, searchTypePlaylist)
 }
 
-func downloadNextCmd(queue []model.Song, outDir string, withCover bool, withLyrics bool, allSongsSet map[string]struct{}) tea.Cmd {
+func downloadNextCmd(queue []model.Song, outDir string, withCover bool, withLyrics bool, lyricFormat lyrics.Format, allSongsSet map[string]struct{}) tea.Cmd {
 	return func() tea.Msg {
 		if len(queue) == 0 {
 			return nil
 		}
 		target := queue[0]
 		result, err := core.DownloadWithDedupCheck(&target, outDir, withCover, withLyrics, allSongsSet)
-		return downloadOneFinishedMsg{
+		if err == nil && result != nil && !result.Skipped && lyricFormat != "" {
+			// 歌词文件写入失败不影响音频下载结果
+			_, _ = core.SaveLyricFile(result, lyricFormat)
+		}
+		msg := downloadOneFinishedMsg{
 			err:     err,
 			song:    target,
 			skipped: err == nil && result != nil && result.Skipped,
 		}
+		if err == nil && result != nil {
+			msg.path = result.SavedPath
+		}
+		return msg
 	}
 }
 
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +26,7 @@ const (
 
 	collectionKindManual   = "manual"
 	collectionKindImported = "imported"
+	collectionKindSmart    = "smart"
 
 	collectionContentPlaylist = "playlist"
 	collectionContentAlbum    = "album"
@@ -38,7 +41,8 @@ var (
 
 // Collection stores local entries shown in "My Collections".
 // Manual collections persist songs in SavedSong. Imported entries only keep
-// metadata and fetch songs on demand from the upstream source.
+// metadata and fetch songs on demand from the upstream source. Smart
+// collections keep a rule set in Rules and are evaluated when read.
 type Collection struct {
 	ID          uint        `gorm:"primaryKey" json:"id"`
 	Name        string      `gorm:"not null" json:"name"`
@@ -51,21 +55,56 @@ type Collection struct {
 	Link        string      `json:"link"`
 	Creator     string      `json:"creator"`
 	TrackCount  int         `json:"track_count"`
+	Rules       string      `json:"-"`
 	CreatedAt   time.Time   `json:"created_at"`
 	SavedSongs  []SavedSong `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
 }
 
 type SavedSong struct {
-	ID           uint      `gorm:"primaryKey" json:"db_id"`
-	CollectionID uint      `gorm:"uniqueIndex:idx_col_song_src" json:"collection_id"`
-	SongID       string    `gorm:"uniqueIndex:idx_col_song_src;not null" json:"song_id"`
-	Source       string    `gorm:"uniqueIndex:idx_col_song_src;not null" json:"source"`
-	Extra        string    `json:"extra"`
-	Name         string    `json:"name"`
-	Artist       string    `json:"artist"`
-	Cover        string    `json:"cover"`
-	Duration     int       `json:"duration"`
-	AddedAt      time.Time `json:"added_at"`
+	ID           uint   `gorm:"primaryKey" json:"db_id"`
+	CollectionID uint   `gorm:"uniqueIndex:idx_col_song_src" json:"collection_id"`
+	SongID       string `gorm:"uniqueIndex:idx_col_song_src;not null" json:"song_id"`
+	Source       string `gorm:"uniqueIndex:idx_col_song_src;not null" json:"source"`
+	Extra        string `json:"extra"`
+	Name         string `json:"name"`
+	Artist       string `json:"artist"`
+	Cover        string `json:"cover"`
+	Duration     int    `json:"duration"`
+	// Position orders songs within the collection, smallest first. New songs
+	// get a position above the current top, so it can go below 1 until the
+	// collection is reordered.
+	Position int       `gorm:"index" json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	// Rating (0-5 stars), comma separated Tags and Note are the user's own
+	// annotations on this entry.
+	Rating int    `gorm:"not null;default:0" json:"rating"`
+	Tags   string `gorm:"not null;default:''" json:"tags"`
+	Note   string `gorm:"not null;default:''" json:"note"`
+	// Health is the result of the last playability check: "" when never
+	// checked, otherwise ok, dead or unknown.
+	Health          string    `gorm:"not null;default:''" json:"health"`
+	HealthCheckedAt time.Time `json:"health_checked_at"`
+}
+
+// savedSongOrder lists a manual collection in its stored order.
+const savedSongOrder = "position, id DESC"
+
+// BeforeCreate puts songs inserted without a position on top of their
+// collection, matching the newest-first order collections had before.
+func (s *SavedSong) BeforeCreate(tx *gorm.DB) error {
+	if s.Position != 0 || s.CollectionID == 0 {
+		return nil
+	}
+	var top *int
+	if err := tx.Session(&gorm.Session{NewDB: true}).Model(&SavedSong{}).
+		Where("collection_id = ?", s.CollectionID).Select("MIN(position)").Scan(&top).Error; err != nil {
+		return err
+	}
+	s.Position = 1
+	if top != nil {
+		s.Position = *top - 1
+	}
+	return nil
 }
 
 type importCollectionRequest struct {
@@ -81,8 +120,11 @@ type importCollectionRequest struct {
 }
 
 func (c Collection) normalizedKind() string {
-	if strings.TrimSpace(c.Kind) == collectionKindImported {
+	switch strings.TrimSpace(c.Kind) {
+	case collectionKindImported:
 		return collectionKindImported
+	case collectionKindSmart:
+		return collectionKindSmart
 	}
 	return collectionKindManual
 }
@@ -110,11 +152,15 @@ func (c Collection) isImported() bool {
 }
 
 func (c Collection) isManual() bool {
-	return !c.isImported()
+	return c.normalizedKind() == collectionKindManual
+}
+
+func (c Collection) isSmart() bool {
+	return c.normalizedKind() == collectionKindSmart
 }
 
 func (c Collection) editable() bool {
-	return c.isManual()
+	return !c.isImported()
 }
 
 func (c Collection) displayCover() string {
@@ -152,6 +198,8 @@ func (c Collection) playlistCard() model.Playlist {
 	trackCount := c.TrackCount
 	if c.isManual() {
 		trackCount = countSavedSongs(c.ID)
+	} else if c.isSmart() {
+		trackCount = countSmartCollectionSongs(&c)
 	}
 
 	extra := map[string]string{
@@ -162,6 +210,9 @@ func (c Collection) playlistCard() model.Playlist {
 	if remoteSource := c.normalizedSource(); c.isImported() && remoteSource != "" {
 		extra["remote_source"] = remoteSource
 	}
+	if c.isSmart() {
+		extra["smart_rules"] = c.Rules
+	}
 
 	return model.Playlist{
 		ID:          fmt.Sprint(c.ID),
@@ -187,8 +238,12 @@ func InitDB() {
 	if err != nil {
 		panic("Failed to connect to SQLite: " + err.Error())
 	}
+	if err := registerSmartCountInvalidation(db); err != nil {
+		panic("Failed to register database callbacks: " + err.Error())
+	}
 
-	if err := db.AutoMigrate(&Collection{}, &SavedSong{}, &LocalMusicIndex{}); err != nil {
+	backfillPositions := !db.Migrator().HasColumn(&SavedSong{}, "position")
+	if err := db.AutoMigrate(&Collection{}, &SavedSong{}, &LocalMusicIndex{}, &CollectionSubscription{}, &CollectionSnapshot{}, &CSVImport{}, &CSVImportRow{}, &SavedSongHistory{}, &TrashItem{}); err != nil {
 		panic("Failed to migrate database: " + err.Error())
 	}
 
@@ -198,6 +253,11 @@ func InitDB() {
 	if err := backfillCollectionDefaults(); err != nil {
 		panic("Failed to normalize collection defaults: " + err.Error())
 	}
+	if backfillPositions {
+		if err := backfillSavedSongPositions(); err != nil {
+			panic("Failed to backfill song positions: " + err.Error())
+		}
+	}
 }
 
 func CloseDB() {
@@ -324,6 +384,49 @@ func backfillCollectionDefaults() error {
 	return nil
 }
 
+// backfillSavedSongPositions numbers songs of databases created before
+// positions existed, newest first. Songs saved without AddedAt take the time
+// of the song saved before them, so the old insertion order is kept.
+func backfillSavedSongPositions() error {
+	var songs []SavedSong
+	if err := db.Select("id", "collection_id", "added_at").Order("collection_id, id").Find(&songs).Error; err != nil {
+		return err
+	}
+	var last time.Time
+	for i := range songs {
+		if i > 0 && songs[i].CollectionID != songs[i-1].CollectionID {
+			last = time.Time{}
+		}
+		if songs[i].AddedAt.IsZero() {
+			songs[i].AddedAt = last
+		}
+		last = songs[i].AddedAt
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		a, b := songs[i], songs[j]
+		if a.CollectionID != b.CollectionID {
+			return a.CollectionID < b.CollectionID
+		}
+		if !a.AddedAt.Equal(b.AddedAt) {
+			return a.AddedAt.After(b.AddedAt)
+		}
+		return a.ID > b.ID
+	})
+	return db.Transaction(func(tx *gorm.DB) error {
+		position := 0
+		for i, song := range songs {
+			if i == 0 || song.CollectionID != songs[i-1].CollectionID {
+				position = 0
+			}
+			position++
+			if err := tx.Model(&SavedSong{}).Where("id = ?", song.ID).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func removeLegacyFavoritesFiles(legacyPath string) error {
 	candidates := []string{
 		legacyPath,
@@ -357,37 +460,61 @@ func loadCollectionSongs(collection *Collection) ([]model.Song, error) {
 	if collection == nil {
 		return nil, fmt.Errorf("collection is nil")
 	}
-	if collection.isImported() {
-		return loadImportedCollectionSongs(collection)
+	var songs []model.Song
+	var err error
+	switch {
+	case collection.isImported():
+		songs, err = loadImportedCollectionSongs(collection)
+	case collection.isSmart():
+		songs, err = loadSmartCollectionSongs(collection)
+	default:
+		songs, err = loadSavedSongs(collection.ID)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return loadSavedSongs(collection.ID)
+	songOverrideApply(songs)
+	return songs, nil
 }
 
 func loadSavedSongs(collectionID uint) ([]model.Song, error) {
 	var savedSongs []SavedSong
-	if err := db.Where("collection_id = ?", collectionID).Order("id DESC").Find(&savedSongs).Error; err != nil {
+	if err := db.Where("collection_id = ?", collectionID).Order(savedSongOrder).Find(&savedSongs).Error; err != nil {
 		return nil, err
 	}
 
 	songs := make([]model.Song, 0, len(savedSongs))
 	for _, ss := range savedSongs {
-		extra := decodeSongExtraMap(ss.Extra)
-		songs = append(songs, model.Song{
-			ID:       ss.SongID,
-			Source:   ss.Source,
-			Name:     ss.Name,
-			Artist:   ss.Artist,
-			Album:    extraMapValue(extra, "album"),
-			AlbumID:  extraMapValue(extra, "album_id"),
-			Link:     extraMapValue(extra, "link"),
-			Cover:    ss.Cover,
-			Duration: ss.Duration,
-			Extra:    extra,
-		})
+		songs = append(songs, savedSongModel(ss))
 	}
 	return songs, nil
 }
 
+func savedSongModel(ss SavedSong) model.Song {
+	extra := decodeSongExtraMap(ss.Extra)
+	if ss.Rating > 0 || ss.Tags != "" || ss.Note != "" {
+		extra = withSongAnnotation(extra, ss.Rating, ss.Tags, ss.Note)
+	}
+	if ss.Health == songHealthDead {
+		if extra == nil {
+			extra = map[string]string{}
+		}
+		extra[songExtraHealth] = songHealthDead
+	}
+	return model.Song{
+		ID:       ss.SongID,
+		Source:   ss.Source,
+		Name:     ss.Name,
+		Artist:   ss.Artist,
+		Album:    extraMapValue(extra, "album"),
+		AlbumID:  extraMapValue(extra, "album_id"),
+		Link:     extraMapValue(extra, "link"),
+		Cover:    ss.Cover,
+		Duration: ss.Duration,
+		Extra:    extra,
+	}
+}
+
 func loadImportedCollectionSongs(collection *Collection) ([]model.Song, error) {
 	if collection == nil || !collection.isImported() {
 		return nil, fmt.Errorf("collection is not imported")
@@ -407,14 +534,14 @@ func loadImportedCollectionSongs(collection *Collection) ([]model.Song, error) {
 		if externalID != "" {
 			if fn := albumDetailFuncProvider(source); fn != nil {
 				if songs, err := fn(externalID); err == nil && len(songs) > 0 {
-					return ensureSongSource(songs, source), nil
+					return core.ApplyAlbumTrackMetadata(ensureSongSource(songs, source)), nil
 				}
 			}
 		}
 		if link != "" {
 			if fn := parseAlbumFuncProvider(source); fn != nil {
 				if _, songs, err := fn(link); err == nil {
-					return ensureSongSource(songs, source), nil
+					return core.ApplyAlbumTrackMetadata(ensureSongSource(songs, source)), nil
 				}
 			}
 		}
@@ -549,16 +676,17 @@ func buildImportedCollection(req importCollectionRequest) (*Collection, error) {
 	}, nil
 }
 
-func collectionSongsJSON(collection *Collection) ([]gin.H, error) {
+func collectionSongsJSON(collection *Collection, filter songAnnotationFilter) ([]gin.H, error) {
 	if collection == nil {
 		return nil, fmt.Errorf("collection is nil")
 	}
 
-	if collection.isImported() {
-		songs, err := loadImportedCollectionSongs(collection)
+	if !collection.isManual() {
+		songs, err := loadCollectionSongs(collection)
 		if err != nil {
 			return nil, err
 		}
+		songs = filter.songs(songs)
 		resp := make([]gin.H, 0, len(songs))
 		for _, song := range songs {
 			resp = append(resp, gin.H{
@@ -579,27 +707,56 @@ func collectionSongsJSON(collection *Collection) ([]gin.H, error) {
 	}
 
 	var savedSongs []SavedSong
-	if err := db.Where("collection_id = ?", collection.ID).Order("id DESC").Find(&savedSongs).Error; err != nil {
+	if err := db.Where("collection_id = ?", collection.ID).Order(savedSongOrder).Find(&savedSongs).Error; err != nil {
 		return nil, err
 	}
+	if filter.active() {
+		kept := savedSongs[:0]
+		for _, s := range savedSongs {
+			if filter.matchesAnnotation(s.Rating, s.Tags) {
+				kept = append(kept, s)
+			}
+		}
+		savedSongs = kept
+	}
+
+	// Overrides only change what is shown; the saved rows keep upstream data.
+	display := make([]model.Song, len(savedSongs))
+	for i, s := range savedSongs {
+		display[i] = model.Song{
+			ID:     s.SongID,
+			Source: s.Source,
+			Name:   s.Name,
+			Artist: s.Artist,
+			Cover:  s.Cover,
+			Extra:  decodeSongExtraMap(s.Extra),
+		}
+		display[i].Album = extraMapValue(display[i].Extra, "album")
+	}
+	songOverrideApply(display)
 
 	resp := make([]gin.H, 0, len(savedSongs))
-	for _, s := range savedSongs {
-		extraMap := decodeSongExtraMap(s.Extra)
+	for i, s := range savedSongs {
+		extraMap := display[i].Extra
 		resp = append(resp, gin.H{
-			"db_id":         s.ID,
-			"collection_id": s.CollectionID,
-			"id":            s.SongID,
-			"source":        s.Source,
-			"extra":         decodeSongExtraObject(s.Extra),
-			"name":          s.Name,
-			"artist":        s.Artist,
-			"album":         extraMapValue(extraMap, "album"),
-			"album_id":      extraMapValue(extraMap, "album_id"),
-			"cover":         s.Cover,
-			"duration":      s.Duration,
-			"link":          extraMapValue(extraMap, "link"),
-			"added_at":      s.AddedAt,
+			"db_id":             s.ID,
+			"collection_id":     s.CollectionID,
+			"id":                s.SongID,
+			"source":            s.Source,
+			"extra":             decodeSongExtraObject(s.Extra),
+			"name":              display[i].Name,
+			"artist":            display[i].Artist,
+			"album":             display[i].Album,
+			"album_id":          extraMapValue(extraMap, "album_id"),
+			"cover":             display[i].Cover,
+			"duration":          s.Duration,
+			"link":              extraMapValue(extraMap, "link"),
+			"added_at":          s.AddedAt,
+			"rating":            s.Rating,
+			"tags":              songTagList(s.Tags),
+			"note":              s.Note,
+			"health":            s.Health,
+			"health_checked_at": s.HealthCheckedAt,
 		})
 	}
 	return resp, nil
@@ -639,6 +796,7 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 		if err != nil {
 			errMsg = fmt.Sprintf("获取歌单歌曲失败: %v", err)
 		}
+		songs = parseSongAnnotationFilter(c).songs(songs)
 
 		renderIndex(c, songs, nil, "", nil, errMsg, "song", collection.originalLink(), id, collection.Name, false, collection.normalizedKind(), nil)
 	})
@@ -757,9 +915,18 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 	})
 
 	colAPI.DELETE("/:id", func(c *gin.Context) {
-		id := c.Param("id")
-		if err := db.Delete(&Collection{}, id).Error; err != nil {
-			c.JSON(500, gin.H{"error": "删除失败"})
+		// 删除的歌单连同歌曲进入回收站，可在保留期内还原。
+		collectionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "歌单不存在"})
+			return
+		}
+		if err := trashCollection(uint(collectionID)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(404, gin.H{"error": "歌单不存在"})
+			} else {
+				c.JSON(500, gin.H{"error": "删除失败"})
+			}
 			return
 		}
 		c.JSON(200, gin.H{"status": "ok"})
@@ -772,7 +939,7 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 			return
 		}
 
-		resp, err := collectionSongsJSON(collection)
+		resp, err := collectionSongsJSON(collection, parseSongAnnotationFilter(c))
 		if err != nil {
 			c.JSON(500, gin.H{"error": "获取歌曲失败: " + err.Error()})
 			return
@@ -790,6 +957,10 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 			c.JSON(400, gin.H{"error": "外部导入歌单/专辑不保存歌曲明细，不能直接加入歌曲"})
 			return
 		}
+		if collection.isSmart() {
+			c.JSON(400, gin.H{"error": errSmartCollectionSongs.Error()})
+			return
+		}
 
 		var req struct {
 			SongID   string      `json:"id" binding:"required"`
@@ -822,6 +993,7 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 			Cover:        req.Cover,
 			Duration:     req.Duration,
 			Extra:        extraStr,
+			AddedAt:      time.Now(),
 		}
 
 		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&song).Error; err != nil {
@@ -841,6 +1013,10 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 			c.JSON(400, gin.H{"error": "外部导入歌单/专辑不保存歌曲明细，不能直接加入歌曲"})
 			return
 		}
+		if collection.isSmart() {
+			c.JSON(400, gin.H{"error": errSmartCollectionSongs.Error()})
+			return
+		}
 
 		var req struct {
 			Songs []struct {
@@ -882,17 +1058,14 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 				Cover:        item.Cover,
 				Duration:     item.Duration,
 				Extra:        extraStr,
+				AddedAt:      time.Now(),
 			})
 		}
 
-		added := 0
-		if len(songs) > 0 {
-			tx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&songs)
-			if tx.Error != nil {
-				c.JSON(500, gin.H{"error": "批量收藏失败: " + tx.Error.Error()})
-				return
-			}
-			added = int(tx.RowsAffected)
+		added, err := insertSavedSongs(songs)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "批量收藏失败: " + err.Error()})
+			return
 		}
 
 		c.JSON(200, gin.H{
@@ -914,6 +1087,10 @@ func RegisterCollectionRoutes(api *gin.RouterGroup) {
 			c.JSON(400, gin.H{"error": "外部导入歌单/专辑没有本地歌曲明细可删除"})
 			return
 		}
+		if collection.isSmart() {
+			c.JSON(400, gin.H{"error": errSmartCollectionSongs.Error()})
+			return
+		}
 
 		var req struct {
 			Songs []struct {
@@ -0,0 +1,387 @@
+package web
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// 歌单可播放性检查与批量修复
+// ==========================================
+
+const (
+	songHealthOK   = "ok"
+	songHealthDead = "dead"
+	// songHealthUnknown marks songs whose source cannot be range-probed.
+	songHealthUnknown = "unknown"
+
+	collectionHealthWorkers = 4
+	songExtraHealth         = "health"
+)
+
+var (
+	collectionHealthProbe = core.ValidatePlayable
+	// collectionRepairResolve finds the best playable match on another source.
+	collectionRepairResolve = func(name, artist, source string, duration int) (*model.Song, error) {
+		song, _, err := findBestSwitchSong(name, artist, source, "", duration)
+		return song, err
+	}
+)
+
+// SavedSongHistory keeps a collection entry that a repair replaced.
+// SavedSongID is the entry that now holds the replacement.
+type SavedSongHistory struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CollectionID uint      `gorm:"index" json:"collection_id"`
+	SavedSongID  uint      `gorm:"index" json:"saved_song_id"`
+	SongID       string    `json:"song_id"`
+	Source       string    `json:"source"`
+	Name         string    `json:"name"`
+	Artist       string    `json:"artist"`
+	Cover        string    `json:"cover"`
+	Duration     int       `json:"duration"`
+	Extra        string    `json:"extra"`
+	ReplacedBy   string    `json:"replaced_by"`
+	ReplacedAt   time.Time `json:"replaced_at"`
+}
+
+// collectionHealthProgress is the state of a running check.
+type collectionHealthProgress struct {
+	Total     int       `json:"total"`
+	Checked   int       `json:"checked"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+var (
+	collectionHealthMu      sync.Mutex
+	collectionHealthRunning = map[uint]*collectionHealthProgress{}
+	collectionRepairRunning = map[uint]bool{}
+)
+
+// probeSavedSongHealth checks one entry: local files must still exist,
+// online songs must resolve to a URL answering a range request.
+func probeSavedSongHealth(song SavedSong) string {
+	if isLocalMusicSource(song.Source) {
+		if _, err := localMusicTrackByID(song.SongID); err != nil {
+			return songHealthDead
+		}
+		return songHealthOK
+	}
+	if !songHealthProbeable(song.Source) {
+		return songHealthUnknown
+	}
+	if collectionHealthProbe(&model.Song{ID: song.SongID, Source: song.Source}) {
+		return songHealthOK
+	}
+	return songHealthDead
+}
+
+// songHealthProbeable reports whether core.ValidatePlayable can tell a dead
+// song of this source from one it simply cannot probe.
+func songHealthProbeable(source string) bool {
+	return source != "soda" && source != "fivesing" && core.GetDownloadFunc(source) != nil
+}
+
+func recordSavedSongHealth(query *gorm.DB, status string) error {
+	return query.Model(&SavedSong{}).Updates(map[string]interface{}{
+		"health":            status,
+		"health_checked_at": time.Now(),
+	}).Error
+}
+
+// startCollectionHealthCheck checks every song of a manual collection in the
+// background. It returns false when a check or repair is already running.
+func startCollectionHealthCheck(collectionID uint) bool {
+	collectionHealthMu.Lock()
+	if collectionHealthRunning[collectionID] != nil || collectionRepairRunning[collectionID] {
+		collectionHealthMu.Unlock()
+		return false
+	}
+	progress := &collectionHealthProgress{StartedAt: time.Now()}
+	collectionHealthRunning[collectionID] = progress
+	collectionHealthMu.Unlock()
+
+	go func() {
+		defer func() {
+			collectionHealthMu.Lock()
+			delete(collectionHealthRunning, collectionID)
+			collectionHealthMu.Unlock()
+		}()
+		runCollectionHealthCheck(collectionID, progress)
+	}()
+	return true
+}
+
+func runCollectionHealthCheck(collectionID uint, progress *collectionHealthProgress) {
+	var songs []SavedSong
+	if err := db.Where("collection_id = ?", collectionID).Order(savedSongOrder).Find(&songs).Error; err != nil {
+		return
+	}
+	collectionHealthMu.Lock()
+	progress.Total = len(songs)
+	collectionHealthMu.Unlock()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, collectionHealthWorkers)
+	for i := range songs {
+		wg.Add(1)
+		go func(song SavedSong) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			_ = recordSavedSongHealth(db.Where("id = ?", song.ID), probeSavedSongHealth(song))
+			collectionHealthMu.Lock()
+			progress.Checked++
+			collectionHealthMu.Unlock()
+		}(songs[i])
+	}
+	wg.Wait()
+}
+
+func collectionHealthStatus(collectionID uint) gin.H {
+	var rows []struct {
+		Health string
+		Count  int
+	}
+	db.Model(&SavedSong{}).Select("health, COUNT(*) AS count").
+		Where("collection_id = ?", collectionID).Group("health").Scan(&rows)
+	counts := map[string]int{songHealthOK: 0, songHealthDead: 0, songHealthUnknown: 0, "unchecked": 0}
+	for _, row := range rows {
+		if row.Health == "" {
+			counts["unchecked"] += row.Count
+		} else {
+			counts[row.Health] += row.Count
+		}
+	}
+
+	var dead []SavedSong
+	db.Where("collection_id = ? AND health = ?", collectionID, songHealthDead).Order(savedSongOrder).Find(&dead)
+	deadJSON := make([]gin.H, 0, len(dead))
+	for _, song := range dead {
+		deadJSON = append(deadJSON, gin.H{
+			"id": song.SongID, "source": song.Source, "name": song.Name, "artist": song.Artist,
+			"checked_at": song.HealthCheckedAt,
+		})
+	}
+
+	resp := gin.H{"running": false, "counts": counts, "dead": deadJSON}
+	collectionHealthMu.Lock()
+	if progress := collectionHealthRunning[collectionID]; progress != nil {
+		resp["running"] = true
+		resp["progress"] = *progress
+	}
+	collectionHealthMu.Unlock()
+	return resp
+}
+
+// startCollectionRepair marks a repair of the collection as running. It
+// returns false when a check or another repair is already running, so two
+// repairs never replace the same dead entries.
+func startCollectionRepair(collectionID uint) bool {
+	collectionHealthMu.Lock()
+	defer collectionHealthMu.Unlock()
+	if collectionHealthRunning[collectionID] != nil || collectionRepairRunning[collectionID] {
+		return false
+	}
+	collectionRepairRunning[collectionID] = true
+	return true
+}
+
+func finishCollectionRepair(collectionID uint) {
+	collectionHealthMu.Lock()
+	delete(collectionRepairRunning, collectionID)
+	collectionHealthMu.Unlock()
+}
+
+type collectionRepairResult struct {
+	Repaired   int      `json:"repaired"`
+	Unresolved []string `json:"unresolved"`
+}
+
+// repairCollectionSongs replaces dead entries, or only the listed ones, with
+// the best match on another source. The entry keeps its position and
+// annotations; the replaced song is kept in SavedSongHistory.
+func repairCollectionSongs(collectionID uint, refs []savedSongRef) (collectionRepairResult, error) {
+	result := collectionRepairResult{Unresolved: []string{}}
+	var dead []SavedSong
+	if err := db.Where("collection_id = ? AND health = ?", collectionID, songHealthDead).
+		Order(savedSongOrder).Find(&dead).Error; err != nil {
+		return result, err
+	}
+	if len(refs) > 0 {
+		wanted := make(map[string]bool, len(refs))
+		for _, ref := range refs {
+			wanted[ref.key()] = true
+		}
+		kept := dead[:0]
+		for _, song := range dead {
+			if wanted[savedSongKey(song)] {
+				kept = append(kept, song)
+			}
+		}
+		dead = kept
+	}
+
+	replacements := make([]*model.Song, len(dead))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, collectionHealthWorkers)
+	for i := range dead {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			song, err := collectionRepairResolve(dead[i].Name, dead[i].Artist, dead[i].Source, dead[i].Duration)
+			if err == nil && song != nil && song.ID != "" && song.Source != "" {
+				replacements[i] = song
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, song := range dead {
+		if replacements[i] == nil {
+			result.Unresolved = append(result.Unresolved, playlistSongLabel(song.Name, song.Artist))
+			continue
+		}
+		if err := replaceSavedSong(song, replacements[i]); err != nil {
+			return result, err
+		}
+		result.Repaired++
+	}
+	return result, nil
+}
+
+// replaceSavedSong swaps the song behind an entry. When the replacement is
+// already in the collection, the dead entry is removed instead.
+func replaceSavedSong(song SavedSong, replacement *model.Song) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		history := SavedSongHistory{
+			CollectionID: song.CollectionID, SavedSongID: song.ID, SongID: song.SongID, Source: song.Source,
+			Name: song.Name, Artist: song.Artist, Cover: song.Cover, Duration: song.Duration, Extra: song.Extra,
+			ReplacedBy: replacement.Source + ":" + replacement.ID, ReplacedAt: time.Now(),
+		}
+		var existing SavedSong
+		if err := tx.Where("collection_id = ? AND song_id = ? AND source = ?", song.CollectionID, replacement.ID, replacement.Source).
+			Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+		if existing.ID != 0 {
+			history.SavedSongID = existing.ID
+			if err := tx.Delete(&SavedSong{}, song.ID).Error; err != nil {
+				return err
+			}
+			return tx.Create(&history).Error
+		}
+
+		saved := savedSongFromModel(replacement)
+		if err := tx.Model(&SavedSong{}).Where("id = ?", song.ID).Updates(map[string]interface{}{
+			"song_id":           saved.SongID,
+			"source":            saved.Source,
+			"name":              saved.Name,
+			"artist":            saved.Artist,
+			"cover":             saved.Cover,
+			"duration":          saved.Duration,
+			"extra":             saved.Extra,
+			"health":            songHealthOK,
+			"health_checked_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&history).Error
+	})
+}
+
+func deleteCollectionSongHistory(tx *gorm.DB, collectionID uint) error {
+	return tx.Where("collection_id = ?", collectionID).Delete(&SavedSongHistory{}).Error
+}
+
+// loadCheckableCollection loads a manual collection, answering the request
+// itself when the collection is missing or has no saved songs to check.
+func loadCheckableCollection(c *gin.Context) (*Collection, bool) {
+	collection, err := loadCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "歌单不存在"})
+		return nil, false
+	}
+	if !collection.isManual() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有自建歌单保存歌曲明细，可以检查和修复"})
+		return nil, false
+	}
+	return collection, true
+}
+
+// RegisterCollectionHealthRoutes exposes
+// POST /collections/:id/health/check to start a background playability
+// check, GET /collections/:id/health for its progress and the dead
+// entries, POST /collections/:id/health/repair to replace dead entries
+// (all of them, or the "songs" listed) and
+// GET /collections/:id/health/history for the replaced originals.
+func RegisterCollectionHealthRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+	colAPI.POST("/:id/health/check", func(c *gin.Context) {
+		collection, ok := loadCheckableCollection(c)
+		if !ok {
+			return
+		}
+		if !startCollectionHealthCheck(collection.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "该歌单正在检查或修复中"})
+			return
+		}
+		c.JSON(http.StatusAccepted, collectionHealthStatus(collection.ID))
+	})
+
+	colAPI.GET("/:id/health", func(c *gin.Context) {
+		collection, ok := loadCheckableCollection(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, collectionHealthStatus(collection.ID))
+	})
+
+	colAPI.POST("/:id/health/repair", func(c *gin.Context) {
+		collection, ok := loadCheckableCollection(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Songs []savedSongRef `json:"songs"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+				return
+			}
+		}
+		if !startCollectionRepair(collection.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "该歌单正在检查或修复中，请稍后再修复"})
+			return
+		}
+		result, err := repairCollectionSongs(collection.ID, req.Songs)
+		finishCollectionRepair(collection.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修复失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	colAPI.GET("/:id/health/history", func(c *gin.Context) {
+		collection, ok := loadCheckableCollection(c)
+		if !ok {
+			return
+		}
+		var history []SavedSongHistory
+		if err := db.Where("collection_id = ?", collection.ID).Order("id DESC").Find(&history).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"history": history})
+	})
+}
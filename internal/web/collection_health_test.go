@@ -0,0 +1,193 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func stubCollectionHealth(t *testing.T, dead map[string]bool, alternates map[string]*model.Song) {
+	t.Helper()
+	prevProbe, prevResolve := collectionHealthProbe, collectionRepairResolve
+	collectionHealthProbe = func(song *model.Song) bool { return !dead[song.ID] }
+	collectionRepairResolve = func(name, artist, source string, duration int) (*model.Song, error) {
+		return alternates[name], nil
+	}
+	t.Cleanup(func() { collectionHealthProbe, collectionRepairResolve = prevProbe, prevResolve })
+}
+
+func waitForCollectionHealthCheck(t *testing.T, collectionID uint) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		collectionHealthMu.Lock()
+		running := collectionHealthRunning[collectionID] != nil
+		collectionHealthMu.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("health check of collection %d did not finish", collectionID)
+}
+
+func TestCollectionHealthCheckAndRepair(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := seedTransferCollection(t, "通勤", "a", "b", "c", "d")
+	db.Model(&SavedSong{}).Where("song_id = ?", "c").Updates(map[string]any{"source": "soda"})
+	db.Model(&SavedSong{}).Where("song_id = ?", "b").Updates(map[string]any{"rating": 5, "note": "副歌"})
+	stubCollectionHealth(t, map[string]bool{"b": true, "d": true}, map[string]*model.Song{
+		"Song b": {ID: "kb", Source: "kugou", Name: "Song b", Artist: "Singer"},
+		"Song d": {ID: "a", Source: "qq", Name: "Song a", Artist: "Singer"},
+	})
+
+	router := newCollectionTestRouter()
+	RegisterCollectionHealthRoutes(router.Group(RoutePrefix))
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var reader *bytes.Reader
+		if body == nil {
+			reader = bytes.NewReader(nil)
+		} else {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, RoutePrefix+"/collections/"+collectionIDString(collection.ID)+path, reader))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/health/check", nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("start check status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	waitForCollectionHealthCheck(t, collection.ID)
+
+	var status struct {
+		Running bool           `json:"running"`
+		Counts  map[string]int `json:"counts"`
+		Dead    []struct {
+			ID string `json:"id"`
+		} `json:"dead"`
+	}
+	rec := do(http.MethodGet, "/health", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode status: %v (%s)", err, rec.Body.String())
+	}
+	if status.Running || status.Counts["ok"] != 1 || status.Counts["dead"] != 2 || status.Counts["unknown"] != 1 || len(status.Dead) != 2 {
+		t.Fatalf("health status = %+v", status)
+	}
+	songs, err := loadSavedSongs(collection.ID)
+	if err != nil {
+		t.Fatalf("loadSavedSongs() error = %v", err)
+	}
+	for _, song := range songs {
+		if wantDead := song.ID == "b" || song.ID == "d"; (song.Extra[songExtraHealth] == songHealthDead) != wantDead {
+			t.Fatalf("song %s extra = %v", song.ID, song.Extra)
+		}
+	}
+
+	rec = do(http.MethodPost, "/health/repair", nil)
+	var result collectionRepairResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("repair = %d %s", rec.Code, rec.Body.String())
+	}
+	if result.Repaired != 2 || len(result.Unresolved) != 0 {
+		t.Fatalf("repair result = %+v", result)
+	}
+	// b keeps its place and annotations on the new source; d duplicated a and
+	// was merged into it.
+	if got := transferSongIDs(t, collection.ID); got != "qq:a,kugou:kb,soda:c" {
+		t.Fatalf("songs after repair = %s", got)
+	}
+	var repaired SavedSong
+	db.Where("collection_id = ? AND song_id = ?", collection.ID, "kb").First(&repaired)
+	if repaired.Rating != 5 || repaired.Note != "副歌" || repaired.Health != songHealthOK {
+		t.Fatalf("repaired entry = %+v", repaired)
+	}
+
+	rec = do(http.MethodGet, "/health/history", nil)
+	var history struct {
+		History []SavedSongHistory `json:"history"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil || len(history.History) != 2 {
+		t.Fatalf("history = %s", rec.Body.String())
+	}
+	for _, item := range history.History {
+		if item.Source != "qq" || (item.SongID != "b" && item.SongID != "d") || item.ReplacedBy == "" {
+			t.Fatalf("history item = %+v", item)
+		}
+	}
+}
+
+func TestCollectionHealthRepairRunsOncePerCollection(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := seedTransferCollection(t, "通勤", "a", "b")
+	db.Model(&SavedSong{}).Where("song_id = ?", "b").Update("health", songHealthDead)
+	stubCollectionHealth(t, nil, nil)
+	entered, release := make(chan struct{}), make(chan struct{})
+	collectionRepairResolve = func(name, artist, source string, duration int) (*model.Song, error) {
+		close(entered)
+		<-release
+		return &model.Song{ID: "kb", Source: "kugou", Name: name, Artist: artist}, nil
+	}
+
+	router := newCollectionTestRouter()
+	RegisterCollectionHealthRoutes(router.Group(RoutePrefix))
+	repair := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, RoutePrefix+"/collections/"+collectionIDString(collection.ID)+"/health/repair", nil))
+		return rec
+	}
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- repair() }()
+	<-entered
+
+	if rec := repair(); rec.Code != http.StatusConflict {
+		t.Fatalf("concurrent repair status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if startCollectionHealthCheck(collection.ID) {
+		t.Fatalf("health check started during a repair")
+	}
+	close(release)
+	if rec := <-first; rec.Code != http.StatusOK {
+		t.Fatalf("first repair status = %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	var history int64
+	db.Model(&SavedSongHistory{}).Where("collection_id = ?", collection.ID).Count(&history)
+	if got := transferSongIDs(t, collection.ID); got != "qq:a,kugou:kb" || history != 1 {
+		t.Fatalf("songs after repair = %s, history = %d", got, history)
+	}
+	if !startCollectionRepair(collection.ID) {
+		t.Fatalf("repair still marked as running")
+	}
+	finishCollectionRepair(collection.ID)
+}
+
+func TestCollectionHealthRepairReportsUnresolvedAndRejectsOtherKinds(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := seedTransferCollection(t, "通勤", "a", "b")
+	db.Model(&SavedSong{}).Where("collection_id = ?", collection.ID).Update("health", songHealthDead)
+	stubCollectionHealth(t, nil, nil)
+
+	result, err := repairCollectionSongs(collection.ID, []savedSongRef{{SongID: "b", Source: "qq"}})
+	if err != nil || result.Repaired != 0 || len(result.Unresolved) != 1 || !strings.Contains(result.Unresolved[0], "Song b") {
+		t.Fatalf("repairCollectionSongs() = %+v, %v", result, err)
+	}
+
+	imported := Collection{Name: "外部", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "1"}
+	db.Create(&imported)
+	router := newCollectionTestRouter()
+	RegisterCollectionHealthRoutes(router.Group(RoutePrefix))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, RoutePrefix+"/collections/"+collectionIDString(imported.ID)+"/health/check", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("check imported collection status = %d", rec.Code)
+	}
+}
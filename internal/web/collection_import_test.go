@@ -24,6 +24,7 @@ func initCollectionDBForTest(t *testing.T) {
 	t.Setenv("MUSIC_DL_FAVORITES_DB", legacyDB)
 	resetCollectionStateForTest()
 	t.Cleanup(resetCollectionStateForTest)
+	stubSongOverrideStore(t)
 
 	InitDB()
 }
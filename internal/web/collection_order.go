@@ -0,0 +1,261 @@
+package web
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errSavedSongNotFound = errors.New("歌曲不在歌单中")
+
+// savedSongSortKeys are the fields a collection can be sorted by.
+var savedSongSortKeys = map[string]func(a, b *SavedSong) int{
+	"name": func(a, b *SavedSong) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"artist": func(a, b *SavedSong) int {
+		return strings.Compare(strings.ToLower(a.Artist), strings.ToLower(b.Artist))
+	},
+	"duration": func(a, b *SavedSong) int {
+		return cmp.Compare(a.Duration, b.Duration)
+	},
+	"added_at": func(a, b *SavedSong) int {
+		return a.AddedAt.Compare(b.AddedAt)
+	},
+}
+
+type savedSongRef struct {
+	SongID string `json:"id"`
+	Source string `json:"source"`
+}
+
+func (r savedSongRef) key() string {
+	return strings.TrimSpace(r.Source) + "\x00" + strings.TrimSpace(r.SongID)
+}
+
+func savedSongKey(song SavedSong) string {
+	return song.Source + "\x00" + song.SongID
+}
+
+// insertSavedSongs saves songs so that they keep the given order, the first
+// one on top of the collection, and returns how many were not duplicates.
+func insertSavedSongs(songs []SavedSong) (int, error) {
+	added := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		added, err = insertSavedSongsTx(tx, songs)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// insertSavedSongsTx is insertSavedSongs inside a transaction the caller owns.
+func insertSavedSongsTx(tx *gorm.DB, songs []SavedSong) (int, error) {
+	added := 0
+	for i := len(songs) - 1; i >= 0; i-- {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&songs[i])
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		added += int(result.RowsAffected)
+	}
+	return added, nil
+}
+
+// reorderSavedSongs loads the collection in its stored order, lets arrange
+// return the new order and renumbers the positions from 1.
+func reorderSavedSongs(collectionID uint, arrange func([]SavedSong) ([]SavedSong, error)) ([]SavedSong, error) {
+	var ordered []SavedSong
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var songs []SavedSong
+		if err := tx.Where("collection_id = ?", collectionID).Order(savedSongOrder).Find(&songs).Error; err != nil {
+			return err
+		}
+		var err error
+		if ordered, err = arrange(songs); err != nil {
+			return err
+		}
+		for i := range ordered {
+			if ordered[i].Position == i+1 {
+				continue
+			}
+			ordered[i].Position = i + 1
+			if err := tx.Model(&SavedSong{}).Where("id = ?", ordered[i].ID).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return ordered, err
+}
+
+// moveSavedSong moves one song to a 1-based position, clamped to the list.
+func moveSavedSong(collectionID uint, ref savedSongRef, position int) ([]SavedSong, error) {
+	return reorderSavedSongs(collectionID, func(songs []SavedSong) ([]SavedSong, error) {
+		from := -1
+		for i, song := range songs {
+			if savedSongKey(song) == ref.key() {
+				from = i
+				break
+			}
+		}
+		if from < 0 {
+			return nil, errSavedSongNotFound
+		}
+		moved := songs[from]
+		rest := append(append([]SavedSong{}, songs[:from]...), songs[from+1:]...)
+		to := min(max(position, 1), len(songs)) - 1
+		return append(rest[:to], append([]SavedSong{moved}, rest[to:]...)...), nil
+	})
+}
+
+// setSavedSongOrder puts the listed songs first in the given order; songs
+// left out keep their relative order after them.
+func setSavedSongOrder(collectionID uint, refs []savedSongRef) ([]SavedSong, error) {
+	return reorderSavedSongs(collectionID, func(songs []SavedSong) ([]SavedSong, error) {
+		byKey := make(map[string]int, len(songs))
+		for i, song := range songs {
+			byKey[savedSongKey(song)] = i
+		}
+		used := make([]bool, len(songs))
+		ordered := make([]SavedSong, 0, len(songs))
+		for _, ref := range refs {
+			i, ok := byKey[ref.key()]
+			if !ok {
+				return nil, errSavedSongNotFound
+			}
+			if !used[i] {
+				used[i] = true
+				ordered = append(ordered, songs[i])
+			}
+		}
+		for i, song := range songs {
+			if !used[i] {
+				ordered = append(ordered, song)
+			}
+		}
+		return ordered, nil
+	})
+}
+
+// sortSavedSongs sorts the collection by a field; ties keep their order.
+func sortSavedSongs(collectionID uint, by string, desc bool) ([]SavedSong, error) {
+	compare, ok := savedSongSortKeys[by]
+	if !ok {
+		return nil, errors.New("不支持的排序字段")
+	}
+	return reorderSavedSongs(collectionID, func(songs []SavedSong) ([]SavedSong, error) {
+		sort.SliceStable(songs, func(i, j int) bool {
+			if desc {
+				return compare(&songs[i], &songs[j]) > 0
+			}
+			return compare(&songs[i], &songs[j]) < 0
+		})
+		return songs, nil
+	})
+}
+
+func savedSongRefsJSON(songs []SavedSong) []gin.H {
+	resp := make([]gin.H, 0, len(songs))
+	for _, song := range songs {
+		resp = append(resp, gin.H{"id": song.SongID, "source": song.Source, "position": song.Position})
+	}
+	return resp
+}
+
+func respondSavedSongOrder(c *gin.Context, songs []SavedSong, err error) {
+	switch {
+	case errors.Is(err, errSavedSongNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "调整顺序失败: " + err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "songs": savedSongRefsJSON(songs)})
+	}
+}
+
+// loadOrderableCollection loads a manual collection, answering the request
+// itself when the collection is missing, imported or smart.
+func loadOrderableCollection(c *gin.Context) (*Collection, bool) {
+	collection, err := loadCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "歌单不存在"})
+		return nil, false
+	}
+	if collection.isImported() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "外部导入歌单/专辑按来源顺序展示，不支持调整顺序"})
+		return nil, false
+	}
+	if collection.isSmart() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "智能歌单按规则中的排序展示，请修改规则"})
+		return nil, false
+	}
+	return collection, true
+}
+
+func RegisterCollectionOrderRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+
+	colAPI.POST("/:id/songs/move", func(c *gin.Context) {
+		collection, ok := loadOrderableCollection(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			savedSongRef
+			Position int `json:"position"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.SongID) == "" || req.Position < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误，需要 id、source 和从 1 开始的 position"})
+			return
+		}
+		songs, err := moveSavedSong(collection.ID, req.savedSongRef, req.Position)
+		respondSavedSongOrder(c, songs, err)
+	})
+
+	colAPI.PUT("/:id/songs/order", func(c *gin.Context) {
+		collection, ok := loadOrderableCollection(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Songs []savedSongRef `json:"songs"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.Songs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少歌曲顺序列表"})
+			return
+		}
+		songs, err := setSavedSongOrder(collection.ID, req.Songs)
+		respondSavedSongOrder(c, songs, err)
+	})
+
+	colAPI.POST("/:id/songs/sort", func(c *gin.Context) {
+		collection, ok := loadOrderableCollection(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			By    string `json:"by"`
+			Order string `json:"order"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+		if _, ok := savedSongSortKeys[req.By]; !ok || (req.Order != "" && req.Order != "asc" && req.Order != "desc") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "by 只支持 name、artist、duration、added_at，order 只支持 asc、desc"})
+			return
+		}
+		songs, err := sortSavedSongs(collection.ID, req.By, req.Order == "desc")
+		respondSavedSongOrder(c, songs, err)
+	})
+}
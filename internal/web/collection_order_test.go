@@ -0,0 +1,110 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSavedSongPositionsBackfillAndNewSongsOnTop(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := Collection{Name: "旧歌单", Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	db.Create(&collection)
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	// Rows as an older version stored them: "b" was saved without AddedAt
+	// right after "a", and "c" was imported with an earlier AddedAt.
+	for _, song := range []SavedSong{
+		{SongID: "a", AddedAt: day(2)},
+		{SongID: "b"},
+		{SongID: "c", AddedAt: day(1)},
+		{SongID: "d", AddedAt: day(3)},
+	} {
+		song.CollectionID, song.Source = collection.ID, "qq"
+		if err := db.Create(&song).Error; err != nil {
+			t.Fatalf("create song: %v", err)
+		}
+	}
+	for _, stmt := range []string{"DROP INDEX idx_saved_songs_position", "ALTER TABLE saved_songs DROP COLUMN position"} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	CloseDB()
+	InitDB()
+
+	if got := transferSongIDs(t, collection.ID); got != "qq:d,qq:b,qq:a,qq:c" {
+		t.Fatalf("backfilled order = %s", got)
+	}
+
+	added, err := insertSavedSongs([]SavedSong{
+		{CollectionID: collection.ID, SongID: "x", Source: "qq"},
+		{CollectionID: collection.ID, SongID: "a", Source: "qq"},
+		{CollectionID: collection.ID, SongID: "y", Source: "qq"},
+	})
+	if err != nil || added != 2 {
+		t.Fatalf("insertSavedSongs() = %d, %v", added, err)
+	}
+	if got := transferSongIDs(t, collection.ID); got != "qq:x,qq:y,qq:d,qq:b,qq:a,qq:c" {
+		t.Fatalf("order after batch add = %s", got)
+	}
+}
+
+func TestCollectionOrderEndpoints(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := seedTransferCollection(t, "通勤", "a", "b", "c", "d")
+	db.Model(&SavedSong{}).Where("song_id = ?", "a").Updates(map[string]any{"name": "delta", "duration": 200})
+	db.Model(&SavedSong{}).Where("song_id = ?", "b").Updates(map[string]any{"name": "Alpha", "duration": 100})
+	db.Model(&SavedSong{}).Where("song_id = ?", "c").Updates(map[string]any{"name": "charlie", "duration": 300})
+	db.Model(&SavedSong{}).Where("song_id = ?", "d").Updates(map[string]any{"name": "bravo", "duration": 100})
+	imported := Collection{Name: "外部", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "1"}
+	db.Create(&imported)
+
+	router := newCollectionTestRouter()
+	RegisterCollectionOrderRoutes(router.Group(RoutePrefix))
+	do := func(method, path string, body any) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, RoutePrefix+path, bytes.NewReader(data)))
+		return rec.Code
+	}
+	base := "/collections/" + collectionIDString(collection.ID) + "/songs/"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		code   int
+		want   string
+	}{
+		{"move down", http.MethodPost, "move", map[string]any{"id": "a", "source": "qq", "position": 3}, 200, "qq:b,qq:c,qq:a,qq:d"},
+		{"move past the end", http.MethodPost, "move", map[string]any{"id": "b", "source": "qq", "position": 99}, 200, "qq:c,qq:a,qq:d,qq:b"},
+		{"move unknown song", http.MethodPost, "move", map[string]any{"id": "z", "source": "qq", "position": 1}, 404, "qq:c,qq:a,qq:d,qq:b"},
+		{"move without position", http.MethodPost, "move", map[string]any{"id": "a", "source": "qq"}, 400, "qq:c,qq:a,qq:d,qq:b"},
+		{"partial reorder", http.MethodPut, "order", map[string]any{"songs": []map[string]string{{"id": "b", "source": "qq"}, {"id": "d", "source": "qq"}}}, 200, "qq:b,qq:d,qq:c,qq:a"},
+		{"sort by name", http.MethodPost, "sort", map[string]string{"by": "name"}, 200, "qq:b,qq:d,qq:c,qq:a"},
+		{"sort by duration desc keeps ties", http.MethodPost, "sort", map[string]string{"by": "duration", "order": "desc"}, 200, "qq:c,qq:a,qq:b,qq:d"},
+		{"sort by added time", http.MethodPost, "sort", map[string]string{"by": "added_at"}, 200, "qq:a,qq:b,qq:c,qq:d"},
+		{"sort by unknown field", http.MethodPost, "sort", map[string]string{"by": "rating"}, 400, "qq:a,qq:b,qq:c,qq:d"},
+	}
+	for _, tt := range tests {
+		if code := do(tt.method, base+tt.path, tt.body); code != tt.code {
+			t.Fatalf("%s: status = %d, want %d", tt.name, code, tt.code)
+		}
+		if got := transferSongIDs(t, collection.ID); got != tt.want {
+			t.Fatalf("%s: order = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	songs, err := loadSavedSongs(collection.ID)
+	if err != nil || len(songs) != 4 || songs[0].ID != "a" || songs[3].ID != "d" {
+		t.Fatalf("loadSavedSongs() = %+v, %v", songs, err)
+	}
+	if code := do(http.MethodPost, "/collections/"+collectionIDString(imported.ID)+"/songs/sort", map[string]string{"by": "name"}); code != 400 {
+		t.Fatalf("sort imported collection status = %d", code)
+	}
+}
@@ -0,0 +1,786 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// 歌单导出 / 导入：版本化 JSON 与 CSV
+// ==========================================
+
+const (
+	collectionExportFormat  = "go-music-dl.collections"
+	collectionExportVersion = 1
+
+	collectionConflictMerge   = "merge"
+	collectionConflictRename  = "rename"
+	collectionConflictSkip    = "skip"
+	collectionConflictReplace = "replace"
+
+	maxCollectionImportBytes = 32 << 20
+	collectionResolveWorkers = 4
+)
+
+var (
+	// transferResolveSong finds a replacement for a song whose source is not
+	// available here.
+	transferResolveSong = func(name, artist, source string, duration int) (*model.Song, error) {
+		song, _, err := findBestSwitchSong(name, artist, source, "", duration)
+		return song, err
+	}
+	transferSourceAvailable = func(source string) bool { return core.GetDownloadFunc(source) != nil }
+)
+
+var collectionCSVHeader = []string{
+	"collection", "kind", "content_type", "collection_source", "external_id", "link", "creator", "description", "cover",
+	"position", "source", "song_id", "name", "artist", "duration", "song_cover", "added_at", "extra",
+	"rating", "tags", "note",
+}
+
+// collectionExport is the portable file format. Version only grows when an
+// older reader could misinterpret the file.
+type collectionExport struct {
+	Format      string               `json:"format"`
+	Version     int                  `json:"version"`
+	ExportedAt  time.Time            `json:"exported_at"`
+	AppVersion  string               `json:"app_version,omitempty"`
+	Collections []exportedCollection `json:"collections"`
+}
+
+// exportedCollection is one collection. Rules are only set for smart
+// collections, whose Songs are the result at export time.
+type exportedCollection struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Cover       string                `json:"cover,omitempty"`
+	Kind        string                `json:"kind"`
+	ContentType string                `json:"content_type"`
+	Source      string                `json:"source,omitempty"`
+	ExternalID  string                `json:"external_id,omitempty"`
+	Link        string                `json:"link,omitempty"`
+	Creator     string                `json:"creator,omitempty"`
+	TrackCount  int                   `json:"track_count,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	Rules       *smartCollectionRules `json:"rules,omitempty"`
+	Songs       []exportedSong        `json:"songs"`
+}
+
+// exportedSong is one saved song. Position is 1-based in display order.
+type exportedSong struct {
+	Position int               `json:"position"`
+	Source   string            `json:"source"`
+	SongID   string            `json:"song_id"`
+	Name     string            `json:"name"`
+	Artist   string            `json:"artist,omitempty"`
+	Cover    string            `json:"cover,omitempty"`
+	Duration int               `json:"duration,omitempty"`
+	AddedAt  time.Time         `json:"added_at"`
+	Extra    map[string]string `json:"extra,omitempty"`
+	Rating   int               `json:"rating,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Note     string            `json:"note,omitempty"`
+}
+
+func exportCollections(ids []uint) (*collectionExport, error) {
+	var collections []Collection
+	query := db.Order("id")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	if err := query.Find(&collections).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 && len(collections) == 0 {
+		return nil, errors.New("歌单不存在")
+	}
+
+	out := &collectionExport{
+		Format: collectionExportFormat, Version: collectionExportVersion,
+		ExportedAt: time.Now(), AppVersion: core.AppVersion,
+		Collections: make([]exportedCollection, 0, len(collections)),
+	}
+	for _, collection := range collections {
+		item := exportedCollection{
+			Name: collection.Name, Description: collection.Description, Cover: collection.Cover,
+			Kind: collection.normalizedKind(), ContentType: collection.normalizedContentType(),
+			Source: collection.normalizedSource(), ExternalID: collection.ExternalID, Link: collection.Link,
+			Creator: collection.Creator, TrackCount: collection.TrackCount, CreatedAt: collection.CreatedAt,
+			Songs: []exportedSong{},
+		}
+		if collection.isManual() {
+			var saved []SavedSong
+			if err := db.Where("collection_id = ?", collection.ID).Order(savedSongOrder).Find(&saved).Error; err != nil {
+				return nil, err
+			}
+			for i, song := range saved {
+				item.Songs = append(item.Songs, exportedSong{
+					Position: i + 1, Source: song.Source, SongID: song.SongID, Name: song.Name, Artist: song.Artist,
+					Cover: song.Cover, Duration: song.Duration, AddedAt: song.AddedAt, Extra: decodeSavedSongExtra(song.Extra),
+					Rating: song.Rating, Tags: songTagList(song.Tags), Note: song.Note,
+				})
+			}
+			item.TrackCount = len(item.Songs)
+		} else if collection.isSmart() {
+			rules, err := parseSmartCollectionRules(collection.Rules)
+			if err != nil {
+				return nil, err
+			}
+			songs, err := evaluateSmartCollection(rules, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			item.Rules = &rules
+			for i, song := range songs {
+				rating, _ := strconv.Atoi(song.Extra[songExtraRating])
+				item.Songs = append(item.Songs, exportedSong{
+					Position: i + 1, Source: song.Source, SongID: song.ID, Name: song.Name, Artist: song.Artist,
+					Cover: song.Cover, Duration: song.Duration, Extra: withSongAnnotation(song.Extra, 0, "", ""),
+					Rating: rating, Tags: songTagList(song.Extra[songExtraTags]), Note: song.Extra[songExtraNote],
+				})
+			}
+			item.TrackCount = len(item.Songs)
+		}
+		out.Collections = append(out.Collections, item)
+	}
+	return out, nil
+}
+
+func decodeSavedSongExtra(raw string) map[string]string {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var extra map[string]string
+	if err := json.Unmarshal([]byte(raw), &extra); err == nil && len(extra) > 0 {
+		return extra
+	}
+	// Older rows may hold non-string values.
+	var loose map[string]any
+	if err := json.Unmarshal([]byte(raw), &loose); err != nil || len(loose) == 0 {
+		return nil
+	}
+	extra = make(map[string]string, len(loose))
+	for k, v := range loose {
+		extra[k] = fmt.Sprint(v)
+	}
+	return extra
+}
+
+func encodeSavedSongExtra(extra map[string]string) string {
+	if len(extra) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(extra)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func writeCollectionsCSV(w io.Writer, export *collectionExport) error {
+	// A BOM lets spreadsheet apps detect UTF-8.
+	if _, err := w.Write([]byte("\uFEFF")); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(collectionCSVHeader); err != nil {
+		return err
+	}
+	for _, collection := range export.Collections {
+		head := []string{
+			collection.Name, collection.Kind, collection.ContentType, collection.Source, collection.ExternalID,
+			collection.Link, collection.Creator, collection.Description, collection.Cover,
+		}
+		if len(collection.Songs) == 0 {
+			if err := cw.Write(append(head, make([]string, 12)...)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, song := range collection.Songs {
+			added, rating := "", ""
+			if song.Rating > 0 {
+				rating = strconv.Itoa(song.Rating)
+			}
+			if !song.AddedAt.IsZero() {
+				added = song.AddedAt.Format(time.RFC3339)
+			}
+			row := append(append([]string{}, head...),
+				strconv.Itoa(song.Position), song.Source, song.SongID, song.Name, song.Artist,
+				strconv.Itoa(song.Duration), song.Cover, added, encodeSavedSongExtra(song.Extra),
+				rating, strings.Join(song.Tags, ","), song.Note)
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseCollectionsCSV reads the CSV export. Rows of one collection must be
+// consecutive; a row without song_id only carries collection metadata.
+func parseCollectionsCSV(data []byte) (*collectionExport, error) {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("CSV 为空")
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"collection", "source", "song_id"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV 缺少 %s 列", required)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	export := &collectionExport{Format: collectionExportFormat, Version: collectionExportVersion}
+	var current *exportedCollection
+	for _, row := range rows[1:] {
+		name := field(row, "collection")
+		if name == "" {
+			continue
+		}
+		if current == nil || current.Name != name {
+			export.Collections = append(export.Collections, exportedCollection{
+				Name: name, Kind: field(row, "kind"), ContentType: field(row, "content_type"),
+				Source: field(row, "collection_source"), ExternalID: field(row, "external_id"), Link: field(row, "link"),
+				Creator: field(row, "creator"), Description: field(row, "description"), Cover: field(row, "cover"),
+				Songs: []exportedSong{},
+			})
+			current = &export.Collections[len(export.Collections)-1]
+		}
+		songID := field(row, "song_id")
+		if songID == "" {
+			continue
+		}
+		song := exportedSong{
+			Source: field(row, "source"), SongID: songID, Name: field(row, "name"), Artist: field(row, "artist"),
+			Cover: field(row, "song_cover"),
+		}
+		song.Position, _ = strconv.Atoi(field(row, "position"))
+		song.Duration, _ = strconv.Atoi(field(row, "duration"))
+		song.AddedAt, _ = time.Parse(time.RFC3339, field(row, "added_at"))
+		song.Extra = decodeSavedSongExtra(field(row, "extra"))
+		song.Rating, _ = strconv.Atoi(field(row, "rating"))
+		song.Tags = songTagList(field(row, "tags"))
+		song.Note = field(row, "note")
+		current.Songs = append(current.Songs, song)
+	}
+	return export, nil
+}
+
+// parseCollectionImport accepts either export format, detected by content.
+func parseCollectionImport(data []byte) (*collectionExport, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\uFEFF")))
+	if len(trimmed) == 0 {
+		return nil, errors.New("导入文件为空")
+	}
+	if trimmed[0] != '{' {
+		return parseCollectionsCSV(trimmed)
+	}
+	var export collectionExport
+	if err := json.Unmarshal(trimmed, &export); err != nil {
+		return nil, fmt.Errorf("JSON 格式错误: %w", err)
+	}
+	if export.Format != collectionExportFormat {
+		return nil, errors.New("不是 go-music-dl 歌单导出文件")
+	}
+	if export.Version < 1 || export.Version > collectionExportVersion {
+		return nil, fmt.Errorf("不支持的导出版本 %d，请升级程序", export.Version)
+	}
+	return &export, nil
+}
+
+// ==========================================
+// 导入与冲突处理
+// ==========================================
+
+type collectionImportOptions struct {
+	Conflict string
+	Resolve  bool
+}
+
+type collectionImportResult struct {
+	Name       string   `json:"name"`
+	ID         uint     `json:"id,omitempty"`
+	Action     string   `json:"action"`
+	Added      int      `json:"added"`
+	Duplicate  int      `json:"duplicate"`
+	Resolved   int      `json:"resolved"`
+	Unresolved []string `json:"unresolved"`
+}
+
+func normalizeCollectionConflict(mode string) (string, error) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "":
+		return collectionConflictMerge, nil
+	case collectionConflictMerge, collectionConflictRename, collectionConflictSkip, collectionConflictReplace:
+		return mode, nil
+	}
+	return "", fmt.Errorf("未知的冲突处理方式: %s", mode)
+}
+
+func importCollections(export *collectionExport, opts collectionImportOptions) ([]collectionImportResult, error) {
+	results := make([]collectionImportResult, 0, len(export.Collections))
+	for _, item := range export.Collections {
+		item.Name = strings.TrimSpace(item.Name)
+		if item.Name == "" {
+			continue
+		}
+		var (
+			result collectionImportResult
+			err    error
+		)
+		switch kind := strings.TrimSpace(item.Kind); {
+		case kind == collectionKindImported:
+			result, err = importExportedRemoteCollection(item)
+		case kind == collectionKindSmart && item.Rules != nil:
+			result, err = importExportedSmartCollection(item, opts)
+		default:
+			result, err = importExportedManualCollection(item, opts)
+		}
+		if err != nil {
+			return results, fmt.Errorf("导入歌单 %s 失败: %w", item.Name, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// importExportedRemoteCollection recreates an imported playlist or album
+// entry; it has no songs, so an existing entry is simply reused.
+func importExportedRemoteCollection(item exportedCollection) (collectionImportResult, error) {
+	result := collectionImportResult{Name: item.Name, Unresolved: []string{}}
+	collection, err := buildImportedCollection(importCollectionRequest{
+		Name: item.Name, Description: item.Description, Cover: item.Cover, Creator: item.Creator,
+		TrackCount: item.TrackCount, Source: item.Source, ExternalID: item.ExternalID, Link: item.Link,
+		ContentType: item.ContentType,
+	})
+	if err != nil {
+		return result, err
+	}
+	var existing Collection
+	err = db.Where("kind = ? AND content_type = ? AND source = ? AND external_id = ?",
+		collectionKindImported, collection.ContentType, collection.Source, collection.ExternalID).
+		Limit(1).Find(&existing).Error
+	if err != nil {
+		return result, err
+	}
+	if existing.ID != 0 {
+		result.ID, result.Action = existing.ID, "existing"
+		return result, nil
+	}
+	if !item.CreatedAt.IsZero() {
+		collection.CreatedAt = item.CreatedAt
+	}
+	if err := db.Create(collection).Error; err != nil {
+		return result, err
+	}
+	result.ID, result.Action = collection.ID, "created"
+	return result, nil
+}
+
+// importExportedSmartCollection recreates a smart collection from its rules.
+// Rules cannot be merged, so for an existing smart collection with the same
+// name merge behaves like rename; only replace overwrites its rules.
+func importExportedSmartCollection(item exportedCollection, opts collectionImportOptions) (collectionImportResult, error) {
+	result := collectionImportResult{Name: item.Name, Unresolved: []string{}}
+	rules := *item.Rules
+	if err := rules.normalize(); err != nil {
+		return result, err
+	}
+	var existing Collection
+	if err := db.Where("name = ? AND kind = ?", item.Name, collectionKindSmart).
+		Order("id").Limit(1).Find(&existing).Error; err != nil {
+		return result, err
+	}
+	switch {
+	case existing.ID != 0 && opts.Conflict == collectionConflictSkip:
+		result.ID, result.Action = existing.ID, "skipped"
+		return result, nil
+	case existing.ID != 0 && opts.Conflict == collectionConflictReplace:
+		if err := db.Model(&existing).Update("rules", encodeSmartCollectionRules(rules)).Error; err != nil {
+			return result, err
+		}
+		result.ID, result.Action = existing.ID, "replaced"
+		return result, nil
+	}
+
+	result.Action = "created"
+	name := item.Name
+	if existing.ID != 0 {
+		name = uniqueCollectionName(item.Name)
+		result.Action, result.Name = "renamed", name
+	}
+	collection := Collection{
+		Name: name, Description: strings.TrimSpace(item.Description), Cover: strings.TrimSpace(item.Cover),
+		Kind: collectionKindSmart, ContentType: collectionContentPlaylist, Source: "local",
+		Rules: encodeSmartCollectionRules(rules),
+	}
+	if !item.CreatedAt.IsZero() {
+		collection.CreatedAt = item.CreatedAt
+	}
+	if err := db.Create(&collection).Error; err != nil {
+		return result, err
+	}
+	result.ID = collection.ID
+	return result, nil
+}
+
+// importExportedManualCollection adds the exported songs to a new collection
+// or to the one with the same name. Songs are resolved before anything is
+// written, and replace moves the songs it drops into the recycle bin in the
+// same transaction that saves the new ones.
+func importExportedManualCollection(item exportedCollection, opts collectionImportOptions) (collectionImportResult, error) {
+	result := collectionImportResult{Name: item.Name, Unresolved: []string{}}
+	var existing Collection
+	if err := db.Where("name = ? AND (kind = ? OR kind = '' OR kind IS NULL)", item.Name, collectionKindManual).
+		Order("id").Limit(1).Find(&existing).Error; err != nil {
+		return result, err
+	}
+	if existing.ID != 0 && opts.Conflict == collectionConflictSkip {
+		result.ID, result.Action = existing.ID, "skipped"
+		return result, nil
+	}
+
+	target := &existing
+	result.Action = "merged"
+	if existing.ID == 0 || opts.Conflict == collectionConflictRename {
+		name := item.Name
+		result.Action = "created"
+		if existing.ID != 0 {
+			name = uniqueCollectionName(item.Name)
+			result.Action = "renamed"
+			result.Name = name
+		}
+		target = &Collection{
+			Name: name, Description: strings.TrimSpace(item.Description), Cover: strings.TrimSpace(item.Cover),
+			Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local",
+		}
+		if !item.CreatedAt.IsZero() {
+			target.CreatedAt = item.CreatedAt
+		}
+	} else if opts.Conflict == collectionConflictReplace {
+		result.Action = "replaced"
+	}
+
+	songs := orderedExportedSongs(item.Songs)
+	resolved := resolveExportedSongs(songs, opts.Resolve)
+	rows := make([]SavedSong, 0, len(songs))
+	for i := range songs {
+		song := songs[i]
+		switch resolved[i].state {
+		case songResolved:
+			result.Resolved++
+			song = resolved[i].song
+		case songUnresolved:
+			result.Unresolved = append(result.Unresolved, playlistSongLabel(song.Name, song.Artist))
+		}
+		row := SavedSong{
+			SongID: song.SongID, Source: song.Source, Name: song.Name, Artist: song.Artist,
+			Cover: song.Cover, Duration: song.Duration, Extra: encodeSavedSongExtra(song.Extra), AddedAt: song.AddedAt,
+			Rating: min(max(song.Rating, 0), core.MaxSongRating), Tags: normalizeSongTags(song.Tags), Note: song.Note,
+		}
+		if row.AddedAt.IsZero() {
+			row.AddedAt = time.Now()
+		}
+		rows = append(rows, row)
+	}
+
+	added := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if target.ID == 0 {
+			if err := tx.Create(target).Error; err != nil {
+				return err
+			}
+		} else if result.Action == "replaced" {
+			if err := trashReplacedSavedSongs(tx, target); err != nil {
+				return err
+			}
+		}
+		for i := range rows {
+			rows[i].CollectionID = target.ID
+		}
+		var err error
+		added, err = insertSavedSongsTx(tx, rows)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+	result.ID = target.ID
+	result.Added += added
+	result.Duplicate += len(rows) - added
+	return result, nil
+}
+
+// trashReplacedSavedSongs moves the songs of a collection into the recycle bin
+// as a copy of the collection, so a replacing import can be undone.
+func trashReplacedSavedSongs(tx *gorm.DB, collection *Collection) error {
+	payload := trashedCollection{Collection: *collection, Rules: collection.Rules}
+	if err := tx.Where("collection_id = ?", collection.ID).Order("id").Find(&payload.Songs).Error; err != nil {
+		return err
+	}
+	if len(payload.Songs) == 0 {
+		return nil
+	}
+	detail := fmt.Sprintf("导入替换前的 %d 首", len(payload.Songs))
+	if err := createTrashItem(tx, trashKindCollection, collection.Name, detail, payload); err != nil {
+		return err
+	}
+	return tx.Where("collection_id = ?", collection.ID).Delete(&SavedSong{}).Error
+}
+
+func orderedExportedSongs(songs []exportedSong) []exportedSong {
+	out := make([]exportedSong, 0, len(songs))
+	for _, song := range songs {
+		song.SongID = strings.TrimSpace(song.SongID)
+		song.Source = strings.TrimSpace(song.Source)
+		if song.SongID == "" || song.Source == "" {
+			continue
+		}
+		out = append(out, song)
+	}
+	// Files edited by hand may drop positions; keep their row order then.
+	for _, song := range out {
+		if song.Position <= 0 {
+			return out
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Position < out[j].Position })
+	return out
+}
+
+func uniqueCollectionName(name string) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		var count int64
+		db.Model(&Collection{}).Where("name = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+	}
+}
+
+const (
+	songAvailable = iota
+	songResolved
+	songUnresolved
+)
+
+type exportedSongResolution struct {
+	state int
+	song  exportedSong
+}
+
+// resolveExportedSongs finds replacements for songs whose source does not
+// work here: local files are looked up in this machine's library first, then
+// every unavailable song goes through the source-switch similarity search.
+// Unresolved songs are kept as they are so they can be switched later.
+func resolveExportedSongs(songs []exportedSong, resolve bool) []exportedSongResolution {
+	out := make([]exportedSongResolution, len(songs))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, collectionResolveWorkers)
+	for i := range songs {
+		if exportedSongAvailable(songs[i]) {
+			continue
+		}
+		out[i].state = songUnresolved
+		if !resolve || strings.TrimSpace(songs[i].Name) == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if replacement, ok := resolveExportedSong(songs[i]); ok {
+				out[i] = exportedSongResolution{state: songResolved, song: replacement}
+			}
+		}(i)
+	}
+	wg.Wait()
+	return out
+}
+
+func exportedSongAvailable(song exportedSong) bool {
+	if isLocalMusicSource(song.Source) {
+		_, err := localMusicTrackByID(song.SongID)
+		return err == nil
+	}
+	return transferSourceAvailable(song.Source)
+}
+
+func resolveExportedSong(song exportedSong) (exportedSong, bool) {
+	original := song.Source + ":" + song.SongID
+	if row, _, err := findLocalMusicMatch(song.Name, song.Artist); err == nil && row != nil {
+		song.Source, song.SongID = localMusicSource, row.ID
+		song.Extra = map[string]string{"resolved_from": original}
+		return song, true
+	}
+	found, err := transferResolveSong(song.Name, song.Artist, song.Source, song.Duration)
+	if err != nil || found == nil {
+		return song, false
+	}
+	extra := map[string]string{}
+	for k, v := range found.Extra {
+		extra[k] = v
+	}
+	extra["resolved_from"] = original
+	return exportedSong{
+		Position: song.Position, Source: found.Source, SongID: found.ID, Name: found.Name, Artist: found.Artist,
+		Cover: found.Cover, Duration: found.Duration, AddedAt: song.AddedAt, Extra: extra,
+		Rating: song.Rating, Tags: song.Tags, Note: song.Note,
+	}, true
+}
+
+// ==========================================
+// 路由
+// ==========================================
+
+func parseCollectionIDs(raw string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("歌单 ID 错误: %s", part)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+func writeCollectionExport(c *gin.Context, export *collectionExport, baseName string) {
+	stamp := time.Now().Format("20060102-150405")
+	filename := strings.TrimSpace(baseName) + "-" + stamp
+	if strings.EqualFold(c.Query("format"), "csv") {
+		var buf bytes.Buffer
+		if err := writeCollectionsCSV(&buf, export); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败: " + err.Error()})
+			return
+		}
+		setDownloadHeader(c, filename+".csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败: " + err.Error()})
+		return
+	}
+	setDownloadHeader(c, filename+".json")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// readCollectionImportBody reads an uploaded "file" field or the raw body.
+func readCollectionImportBody(c *gin.Context) ([]byte, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, errors.New("缺少导入文件")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(io.LimitReader(file, maxCollectionImportBytes))
+	}
+	return io.ReadAll(io.LimitReader(c.Request.Body, maxCollectionImportBytes))
+}
+
+// RegisterCollectionTransferRoutes exposes collection export and import:
+// GET /collections/export?ids=&format=json|csv exports several (or all)
+// collections, GET /collections/:id/export one, and
+// POST /collections/import_exported?conflict=merge|rename|skip|replace&resolve=1
+// imports either format.
+func RegisterCollectionTransferRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+	colAPI.GET("/export", func(c *gin.Context) {
+		ids, err := parseCollectionIDs(c.Query("ids"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		export, err := exportCollections(ids)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		writeCollectionExport(c, export, "collections")
+	})
+
+	colAPI.GET("/:id/export", func(c *gin.Context) {
+		collection, err := loadCollection(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "歌单不存在"})
+			return
+		}
+		export, err := exportCollections([]uint{collection.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		writeCollectionExport(c, export, collection.Name)
+	})
+
+	colAPI.POST("/import_exported", func(c *gin.Context) {
+		conflict, err := normalizeCollectionConflict(c.Query("conflict"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := readCollectionImportBody(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		export, err := parseCollectionImport(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		results, err := importCollections(export, collectionImportOptions{
+			Conflict: conflict,
+			Resolve:  c.DefaultQuery("resolve", "1") != "0",
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "collections": results})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"collections": results})
+	})
+}
@@ -0,0 +1,267 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func seedTransferCollection(t *testing.T, name string, ids ...string) Collection {
+	t.Helper()
+	collection := Collection{Name: name, Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	// New songs go on top, so insert in reverse display order.
+	for i := len(ids) - 1; i >= 0; i-- {
+		song := SavedSong{
+			CollectionID: collection.ID, SongID: ids[i], Source: "qq", Name: "Song " + ids[i], Artist: "Singer",
+			Extra: `{"album":"Album ` + ids[i] + `"}`, AddedAt: time.Date(2026, 1, i+1, 0, 0, 0, 0, time.UTC),
+		}
+		if err := db.Create(&song).Error; err != nil {
+			t.Fatalf("create song: %v", err)
+		}
+	}
+	return collection
+}
+
+func transferSongIDs(t *testing.T, collectionID uint) string {
+	t.Helper()
+	var songs []SavedSong
+	if err := db.Where("collection_id = ?", collectionID).Order(savedSongOrder).Find(&songs).Error; err != nil {
+		t.Fatalf("load songs: %v", err)
+	}
+	ids := make([]string, 0, len(songs))
+	for _, song := range songs {
+		ids = append(ids, song.Source+":"+song.SongID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func stubTransferSources(t *testing.T, available func(string) bool, resolve func(name, artist, source string, duration int) (*model.Song, error)) {
+	t.Helper()
+	origAvailable, origResolve := transferSourceAvailable, transferResolveSong
+	transferSourceAvailable, transferResolveSong = available, resolve
+	t.Cleanup(func() { transferSourceAvailable, transferResolveSong = origAvailable, origResolve })
+}
+
+func TestCollectionExportRoundTripsJSONAndCSV(t *testing.T) {
+	initCollectionDBForTest(t)
+	stubTransferSources(t, func(string) bool { return true }, nil)
+	source := seedTransferCollection(t, "通勤", "a", "b", "c")
+	db.Model(&SavedSong{}).Where("song_id = ?", "a").Updates(map[string]any{"rating": 4, "tags": "夜跑,rock", "note": "副歌"})
+
+	export, err := exportCollections([]uint{source.ID})
+	if err != nil {
+		t.Fatalf("exportCollections() error = %v", err)
+	}
+	songs := export.Collections[0].Songs
+	if len(songs) != 3 || songs[0].SongID != "a" || songs[0].Position != 1 || songs[2].Extra["album"] != "Album c" {
+		t.Fatalf("exported songs = %+v", songs)
+	}
+
+	var csvData bytes.Buffer
+	if err := writeCollectionsCSV(&csvData, export); err != nil {
+		t.Fatalf("writeCollectionsCSV() error = %v", err)
+	}
+	jsonData, _ := json.Marshal(export)
+
+	for _, tt := range []struct {
+		format string
+		data   []byte
+	}{
+		{format: "json", data: jsonData},
+		{format: "csv", data: csvData.Bytes()},
+	} {
+		parsed, err := parseCollectionImport(tt.data)
+		if err != nil {
+			t.Fatalf("%s: parseCollectionImport() error = %v", tt.format, err)
+		}
+		results, err := importCollections(parsed, collectionImportOptions{Conflict: collectionConflictRename})
+		if err != nil || len(results) != 1 {
+			t.Fatalf("%s: importCollections() = %+v, %v", tt.format, results, err)
+		}
+		result := results[0]
+		if result.Action != "renamed" || result.Added != 3 || !strings.HasPrefix(result.Name, "通勤 (") {
+			t.Fatalf("%s: import result = %+v", tt.format, result)
+		}
+		if got := transferSongIDs(t, result.ID); got != "qq:a,qq:b,qq:c" {
+			t.Fatalf("%s: imported order = %s", tt.format, got)
+		}
+		var first SavedSong
+		db.Where("collection_id = ? AND song_id = ?", result.ID, "a").First(&first)
+		if !first.AddedAt.Equal(songs[0].AddedAt) || decodeSavedSongExtra(first.Extra)["album"] != "Album a" ||
+			first.Rating != 4 || first.Tags != "夜跑,rock" || first.Note != "副歌" {
+			t.Fatalf("%s: imported song = %+v", tt.format, first)
+		}
+	}
+
+	if _, err := parseCollectionImport([]byte(`{"format":"other","version":1}`)); err == nil {
+		t.Fatal("parseCollectionImport() should reject foreign JSON")
+	}
+	if _, err := parseCollectionImport([]byte(`{"format":"go-music-dl.collections","version":99}`)); err == nil {
+		t.Fatal("parseCollectionImport() should reject newer versions")
+	}
+}
+
+func TestCollectionImportFailureLeavesCollectionUntouched(t *testing.T) {
+	initCollectionDBForTest(t)
+	stubTransferSources(t, func(string) bool { return true }, nil)
+	target := seedTransferCollection(t, "通勤", "a")
+	source := seedTransferCollection(t, "源", "b", "c", "d")
+	export, err := exportCollections([]uint{source.ID})
+	if err != nil {
+		t.Fatalf("exportCollections() error = %v", err)
+	}
+	export.Collections[0].Name = "通勤"
+	if err := db.Exec("CREATE TRIGGER fail_song BEFORE INSERT ON saved_songs WHEN NEW.song_id = 'c' BEGIN SELECT RAISE(ABORT, 'disk full'); END").Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	for _, conflict := range []string{collectionConflictMerge, collectionConflictReplace, collectionConflictRename} {
+		if _, err := importCollections(export, collectionImportOptions{Conflict: conflict}); err == nil {
+			t.Fatalf("importCollections(%s) should fail", conflict)
+		}
+		if got := transferSongIDs(t, target.ID); got != "qq:a" {
+			t.Fatalf("songs after failed %s import = %s, want only the original", conflict, got)
+		}
+	}
+	var collections, trashed int64
+	db.Model(&Collection{}).Count(&collections)
+	db.Model(&TrashItem{}).Count(&trashed)
+	if collections != 2 || trashed != 0 {
+		t.Fatalf("collections = %d, trash items = %d after failed imports, want 2 and 0", collections, trashed)
+	}
+}
+
+func TestCollectionImportConflictsAndResolve(t *testing.T) {
+	initCollectionDBForTest(t)
+	stubTransferSources(t,
+		func(source string) bool { return source != "gone" },
+		func(name, artist, source string, duration int) (*model.Song, error) {
+			if name == "Lost" {
+				return nil, errors.New("no match")
+			}
+			return &model.Song{ID: "k-" + name, Source: "kugou", Name: name, Artist: artist}, nil
+		})
+	existing := seedTransferCollection(t, "收藏", "a", "b")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterCollectionTransferRoutes(router.Group(""))
+	importFile := func(conflict string, export collectionExport) []collectionImportResult {
+		t.Helper()
+		export.Format, export.Version = collectionExportFormat, collectionExportVersion
+		body, _ := json.Marshal(export)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/collections/import_exported?conflict="+conflict, bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("import %s = %d %s", conflict, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Collections []collectionImportResult `json:"collections"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Collections) != 1 {
+			t.Fatalf("import response = %s", rec.Body.String())
+		}
+		return resp.Collections
+	}
+	incoming := collectionExport{Collections: []exportedCollection{{
+		Name: "收藏", Kind: collectionKindManual,
+		Songs: []exportedSong{
+			{Position: 1, Source: "qq", SongID: "c", Name: "Song c"},
+			{Position: 2, Source: "qq", SongID: "a", Name: "Song a"},
+			{Position: 3, Source: "gone", SongID: "x", Name: "Found"},
+			{Position: 4, Source: "gone", SongID: "y", Name: "Lost"},
+		},
+	}}}
+
+	if got := importFile("skip", incoming)[0]; got.Action != "skipped" || got.Added != 0 {
+		t.Fatalf("skip result = %+v", got)
+	}
+	got := importFile("merge", incoming)[0]
+	if got.ID != existing.ID || got.Action != "merged" || got.Added != 3 || got.Duplicate != 1 || got.Resolved != 1 {
+		t.Fatalf("merge result = %+v", got)
+	}
+	if len(got.Unresolved) != 1 || got.Unresolved[0] != "Lost" {
+		t.Fatalf("merge unresolved = %v", got.Unresolved)
+	}
+	var resolved SavedSong
+	db.Where("collection_id = ? AND source = ?", existing.ID, "kugou").First(&resolved)
+	if resolved.SongID != "k-Found" || decodeSavedSongExtra(resolved.Extra)["resolved_from"] != "gone:x" {
+		t.Fatalf("resolved song = %+v", resolved)
+	}
+
+	got = importFile("replace", incoming)[0]
+	if got.Action != "replaced" || got.Added != 4 {
+		t.Fatalf("replace result = %+v", got)
+	}
+	if ids := transferSongIDs(t, existing.ID); ids != "qq:c,qq:a,kugou:k-Found,gone:y" {
+		t.Fatalf("replaced order = %s", ids)
+	}
+	var trashed TrashItem
+	if err := db.Where("kind = ?", trashKindCollection).First(&trashed).Error; err != nil {
+		t.Fatalf("replaced songs should be in the recycle bin: %v", err)
+	}
+	var payload trashedCollection
+	if err := json.Unmarshal([]byte(trashed.Payload), &payload); err != nil || trashed.Name != "收藏" || len(payload.Songs) != 5 {
+		t.Fatalf("trash item = %+v with %d songs, %v", trashed, len(payload.Songs), err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/collections/export?format=csv", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Disposition"), ".csv") ||
+		!strings.Contains(rec.Body.String(), "k-Found") {
+		t.Fatalf("csv export = %d %q", rec.Code, rec.Header().Get("Content-Disposition"))
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/collections/999/export", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing collection export = %d", rec.Code)
+	}
+}
+
+func TestSmartCollectionImportMergeKeepsExistingRules(t *testing.T) {
+	initCollectionDBForTest(t)
+	oldRules := encodeSmartCollectionRules(smartCollectionRules{Rules: []smartRule{{"rating", "gte", "4"}}})
+	existing := Collection{Name: "高分", Kind: collectionKindSmart, ContentType: collectionContentPlaylist, Source: "local", Rules: oldRules}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatalf("create smart collection: %v", err)
+	}
+	incoming := &collectionExport{Collections: []exportedCollection{{
+		Name: "高分", Kind: collectionKindSmart,
+		Rules: &smartCollectionRules{Rules: []smartRule{{"rating", "gte", "5"}}},
+	}}}
+	rulesOf := func(id uint) string {
+		t.Helper()
+		var collection Collection
+		if err := db.First(&collection, id).Error; err != nil {
+			t.Fatalf("load collection %d: %v", id, err)
+		}
+		return collection.Rules
+	}
+
+	results, err := importCollections(incoming, collectionImportOptions{Conflict: collectionConflictMerge})
+	if err != nil || results[0].Action != "renamed" || results[0].ID == existing.ID {
+		t.Fatalf("merge result = %+v, %v, want a renamed copy", results, err)
+	}
+	if rulesOf(existing.ID) != oldRules || !strings.Contains(rulesOf(results[0].ID), `"5"`) {
+		t.Fatalf("merge should leave the existing rules alone and store the imported ones on the copy")
+	}
+
+	results, err = importCollections(incoming, collectionImportOptions{Conflict: collectionConflictReplace})
+	if err != nil || results[0].Action != "replaced" || results[0].ID != existing.ID {
+		t.Fatalf("replace result = %+v, %v", results, err)
+	}
+	if !strings.Contains(rulesOf(existing.ID), `"5"`) {
+		t.Fatalf("replace should overwrite the existing rules, got %s", rulesOf(existing.ID))
+	}
+}
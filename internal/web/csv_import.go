@@ -0,0 +1,764 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// 第三方 CSV 歌单导入：在线匹配 + 人工确认队列
+// ==========================================
+
+const (
+	csvImportMatching = "matching"
+	csvImportReview   = "review"
+	csvImportDone     = "done"
+	csvImportFailed   = "failed" // a row could not be stored; Error says why
+
+	csvRowPending   = "pending"
+	csvRowMatched   = "matched"   // auto-accepted
+	csvRowReview    = "review"    // low confidence, waits for the user
+	csvRowUnmatched = "unmatched" // no candidate, waits for the user
+	csvRowConfirmed = "confirmed"
+	csvRowSkipped   = "skipped"
+
+	// csvImportAutoAcceptScore is the default confidence saved without review.
+	csvImportAutoAcceptScore = 0.9
+	csvImportMaxCandidates   = 5
+	csvImportWorkers         = 4
+)
+
+// CSVImport is one third-party CSV being matched into a manual collection.
+type CSVImport struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CollectionID uint      `gorm:"index" json:"collection_id"`
+	Name         string    `json:"name"`
+	Sources      string    `json:"sources"`
+	Threshold    float64   `json:"threshold"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CSVImportRow is one CSV track and its matching state. Choice is the song
+// that is (or will be) saved; Candidates are what the user can pick from.
+type CSVImportRow struct {
+	ID         uint `gorm:"primaryKey"`
+	ImportID   uint `gorm:"index"`
+	Position   int  // 1-based row in the CSV
+	Track      string
+	Artist     string
+	Album      string
+	Duration   int
+	Status     string `gorm:"index"`
+	Score      float64
+	Saved      bool
+	Choice     string // JSON model.Song
+	Candidates string // JSON []csvImportCandidate
+}
+
+type csvImportCandidate struct {
+	Song  model.Song `json:"song"`
+	Score float64    `json:"score"`
+}
+
+type csvImportRowJSON struct {
+	ID         uint                 `json:"id"`
+	Position   int                  `json:"position"`
+	Track      string               `json:"track"`
+	Artist     string               `json:"artist"`
+	Album      string               `json:"album"`
+	Duration   int                  `json:"duration"`
+	Status     string               `json:"status"`
+	Score      float64              `json:"score"`
+	Song       *model.Song          `json:"song,omitempty"`
+	Candidates []csvImportCandidate `json:"candidates"`
+}
+
+type csvImportJSON struct {
+	CSVImport
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+}
+
+func (row CSVImportRow) choice() *model.Song {
+	if row.Choice == "" {
+		return nil
+	}
+	var song model.Song
+	if err := json.Unmarshal([]byte(row.Choice), &song); err != nil {
+		return nil
+	}
+	return &song
+}
+
+func (row CSVImportRow) candidates() []csvImportCandidate {
+	candidates := []csvImportCandidate{}
+	if row.Candidates != "" {
+		_ = json.Unmarshal([]byte(row.Candidates), &candidates)
+	}
+	return candidates
+}
+
+func (row CSVImportRow) toJSON() csvImportRowJSON {
+	return csvImportRowJSON{
+		ID: row.ID, Position: row.Position, Track: row.Track, Artist: row.Artist, Album: row.Album,
+		Duration: row.Duration, Status: row.Status, Score: row.Score, Song: row.choice(), Candidates: row.candidates(),
+	}
+}
+
+func (row *CSVImportRow) setCandidates(candidates []csvImportCandidate) {
+	data, _ := json.Marshal(candidates)
+	row.Candidates = string(data)
+}
+
+func (row *CSVImportRow) setChoice(song *model.Song) {
+	row.Choice = ""
+	if song != nil {
+		data, _ := json.Marshal(song)
+		row.Choice = string(data)
+	}
+}
+
+// csvImportSourceNames picks the searchable sources to match against,
+// the default search sources when none are requested.
+func csvImportSourceNames(requested string) []string {
+	names := strings.Split(requested, ",")
+	if strings.TrimSpace(requested) == "" {
+		names = switchDefaultSourceNames()
+	}
+	seen := map[string]bool{}
+	var sources []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if seen[name] || !isSwitchSourceAllowed(name, "") || switchSearchFuncProvider(name) == nil {
+			continue
+		}
+		seen[name] = true
+		sources = append(sources, name)
+	}
+	return sources
+}
+
+// csvImportConfidence blends name/artist similarity with how close the
+// durations are; a 30 second difference costs the whole duration share.
+func csvImportConfidence(candidate switchCandidate, duration int) float64 {
+	if duration <= 0 || candidate.song.Duration <= 0 {
+		return candidate.score
+	}
+	closeness := 1 - float64(candidate.durDiff)/30
+	if closeness < 0 {
+		closeness = 0
+	}
+	return candidate.score*0.8 + closeness*0.2
+}
+
+// searchCSVImportCandidates searches every source and returns the best
+// candidates, most confident first.
+func searchCSVImportCandidates(keyword, title, artist string, duration int, sources []string) []csvImportCandidate {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		all []csvImportCandidate
+	)
+	for _, source := range sources {
+		fn := switchSearchFuncProvider(source)
+		if fn == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(source string, fn func(string) ([]model.Song, error)) {
+			defer wg.Done()
+			found := searchSwitchSourceCandidates(source, fn, keyword, title, artist, duration)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, candidate := range found {
+				all = append(all, csvImportCandidate{Song: candidate.song, Score: csvImportConfidence(candidate, duration)})
+			}
+		}(source, fn)
+	}
+	wg.Wait()
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	if len(all) > csvImportMaxCandidates {
+		all = all[:csvImportMaxCandidates]
+	}
+	return all
+}
+
+func csvImportKeyword(title, artist string) string {
+	if artist == "" {
+		return title
+	}
+	return title + " " + artist
+}
+
+// matchCSVImportRow searches for the row and decides whether it can be saved
+// without review.
+func matchCSVImportRow(row *CSVImportRow, sources []string, threshold float64) {
+	candidates := searchCSVImportCandidates(csvImportKeyword(row.Track, row.Artist), row.Track, row.Artist, row.Duration, sources)
+	row.setCandidates(candidates)
+	if len(candidates) == 0 {
+		row.Status, row.Score = csvRowUnmatched, 0
+		row.setChoice(nil)
+		return
+	}
+	best := candidates[0]
+	row.Score = best.Score
+	row.setChoice(&best.Song)
+	row.Status = csvRowReview
+	if best.Score >= threshold {
+		row.Status = csvRowMatched
+	}
+}
+
+var (
+	csvImportRunningMu sync.Mutex
+	csvImportRunning   = map[uint]bool{}
+)
+
+func createCSVImport(name string, entries []core.PlaylistEntry, sources []string, threshold float64) (*CSVImport, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "CSV 导入"
+	}
+	var existing int64
+	db.Model(&Collection{}).Where("name = ?", name).Count(&existing)
+	if existing > 0 {
+		name = uniqueCollectionName(name)
+	}
+	collection := Collection{Name: name, Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	if err := db.Create(&collection).Error; err != nil {
+		return nil, err
+	}
+	imp := &CSVImport{
+		CollectionID: collection.ID, Name: name, Sources: strings.Join(sources, ","),
+		Threshold: threshold, Status: csvImportMatching,
+	}
+	if err := db.Create(imp).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]CSVImportRow, 0, len(entries))
+	for i, entry := range entries {
+		rows = append(rows, CSVImportRow{
+			ImportID: imp.ID, Position: i + 1, Track: entry.Title, Artist: entry.Artist,
+			Album: entry.Album, Duration: entry.Duration, Status: csvRowPending,
+		})
+	}
+	if err := db.CreateInBatches(rows, 200).Error; err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// runCSVImport matches the pending rows of an import, saves the confident
+// matches in CSV order and leaves the rest for review. When a row cannot be
+// stored the import is marked failed with the error; a restart retries it.
+func runCSVImport(importID uint) {
+	csvImportRunningMu.Lock()
+	if csvImportRunning[importID] {
+		csvImportRunningMu.Unlock()
+		return
+	}
+	csvImportRunning[importID] = true
+	csvImportRunningMu.Unlock()
+	defer func() {
+		csvImportRunningMu.Lock()
+		delete(csvImportRunning, importID)
+		csvImportRunningMu.Unlock()
+	}()
+
+	var imp CSVImport
+	if err := db.First(&imp, importID).Error; err != nil {
+		return
+	}
+	sources := csvImportSourceNames(imp.Sources)
+	var rows []CSVImportRow
+	if err := db.Where("import_id = ? AND status = ?", importID, csvRowPending).Order("position").Find(&rows).Error; err != nil {
+		failCSVImport(&imp, err)
+		return
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, csvImportWorkers)
+	for i := range rows {
+		wg.Add(1)
+		go func(row *CSVImportRow) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			matchCSVImportRow(row, sources, imp.Threshold)
+			if err := db.Select("status", "score", "choice", "candidates").Save(row).Error; err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+		}(&rows[i])
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		failCSVImport(&imp, firstErr)
+		return
+	}
+	if err := saveMatchedCSVImportRows(&imp); err != nil {
+		failCSVImport(&imp, err)
+		return
+	}
+	if err := refreshCSVImportStatus(&imp); err != nil {
+		failCSVImport(&imp, err)
+	}
+}
+
+func failCSVImport(imp *CSVImport, err error) {
+	imp.Status, imp.Error = csvImportFailed, err.Error()
+	_ = db.Model(imp).Updates(map[string]any{"status": imp.Status, "error": imp.Error}).Error
+}
+
+// saveMatchedCSVImportRows saves auto-matched rows not yet in the collection,
+// in CSV order.
+func saveMatchedCSVImportRows(imp *CSVImport) error {
+	var rows []CSVImportRow
+	if err := db.Where("import_id = ? AND status = ? AND saved = ?", imp.ID, csvRowMatched, false).
+		Order("position").Find(&rows).Error; err != nil {
+		return err
+	}
+	songs := make([]SavedSong, 0, len(rows))
+	ids := make([]uint, 0, len(rows))
+	now := time.Now()
+	for _, row := range rows {
+		song := row.choice()
+		if song == nil {
+			continue
+		}
+		saved := savedSongFromModel(song)
+		saved.CollectionID = imp.CollectionID
+		saved.AddedAt = now
+		songs = append(songs, *saved)
+		ids = append(ids, row.ID)
+	}
+	if len(songs) == 0 {
+		return nil
+	}
+	if _, err := insertSavedSongs(songs); err != nil {
+		return err
+	}
+	return db.Model(&CSVImportRow{}).Where("id IN ?", ids).Update("saved", true).Error
+}
+
+// saveCSVImportRow saves a reviewed row at its CSV position among the rows
+// already in the collection.
+func saveCSVImportRow(imp *CSVImport, row *CSVImportRow) error {
+	song := row.choice()
+	if song == nil {
+		return errors.New("没有可保存的歌曲")
+	}
+	saved := savedSongFromModel(song)
+	saved.CollectionID = imp.CollectionID
+	saved.AddedAt = time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&SavedSong{}).Where("collection_id = ? AND source = ? AND song_id = ?",
+			saved.CollectionID, saved.Source, saved.SongID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			slot, found, err := csvImportRowSlot(tx, imp, row)
+			if err != nil {
+				return err
+			}
+			if found {
+				if err := tx.Model(&SavedSong{}).Where("collection_id = ? AND position >= ?", saved.CollectionID, slot).
+					Update("position", gorm.Expr("position + 1")).Error; err != nil {
+					return err
+				}
+				saved.Position = slot
+			}
+			if err := tx.Create(saved).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(row).Update("saved", true).Error
+	})
+	if err != nil {
+		return err
+	}
+	row.Saved = true
+	return nil
+}
+
+// csvImportRowSlot returns the position a row takes in the collection: right
+// after the closest earlier CSV row still there, else in place of the closest
+// later one. found is false when no neighbour is left.
+func csvImportRowSlot(tx *gorm.DB, imp *CSVImport, row *CSVImportRow) (slot int, found bool, err error) {
+	for _, side := range []struct {
+		where, order string
+		offset       int
+	}{
+		{where: "position < ?", order: "position DESC", offset: 1},
+		{where: "position > ?", order: "position", offset: 0},
+	} {
+		var neighbours []CSVImportRow
+		if err := tx.Where("import_id = ? AND saved = ?", imp.ID, true).Where(side.where, row.Position).
+			Order(side.order).Find(&neighbours).Error; err != nil {
+			return 0, false, err
+		}
+		for _, neighbour := range neighbours {
+			song := neighbour.choice()
+			if song == nil {
+				continue
+			}
+			var saved SavedSong
+			result := tx.Where("collection_id = ? AND source = ? AND song_id = ?", imp.CollectionID, song.Source, song.ID).
+				Limit(1).Find(&saved)
+			if result.Error != nil {
+				return 0, false, result.Error
+			}
+			if result.RowsAffected > 0 {
+				return saved.Position + side.offset, true, nil
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+func refreshCSVImportStatus(imp *CSVImport) error {
+	counts, err := csvImportCounts(imp.ID)
+	if err != nil {
+		return err
+	}
+	status := csvImportDone
+	switch {
+	case counts[csvRowPending] > 0:
+		status = csvImportMatching
+	case counts[csvRowReview]+counts[csvRowUnmatched] > 0:
+		status = csvImportReview
+	}
+	imp.Status, imp.Error = status, ""
+	return db.Model(imp).Updates(map[string]any{"status": status, "error": ""}).Error
+}
+
+func csvImportCounts(importID uint) (map[string]int, error) {
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	if err := db.Model(&CSVImportRow{}).Select("status, COUNT(*) AS count").
+		Where("import_id = ?", importID).Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+func csvImportSummary(imp CSVImport) csvImportJSON {
+	counts, _ := csvImportCounts(imp.ID)
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return csvImportJSON{CSVImport: imp, Total: total, Counts: counts}
+}
+
+// resumeCSVImports restarts matching for imports interrupted by a restart or
+// stopped by an error.
+func resumeCSVImports() {
+	if db == nil {
+		return
+	}
+	var imports []CSVImport
+	if err := db.Where("status IN ?", []string{csvImportMatching, csvImportFailed}).Find(&imports).Error; err != nil {
+		return
+	}
+	for _, imp := range imports {
+		go runCSVImport(imp.ID)
+	}
+}
+
+func deleteCollectionCSVImports(tx *gorm.DB, collectionID uint) error {
+	var ids []uint
+	if err := tx.Model(&CSVImport{}).Where("collection_id = ?", collectionID).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("import_id IN ?", ids).Delete(&CSVImportRow{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", ids).Delete(&CSVImport{}).Error
+}
+
+func loadCSVImport(idStr string) (*CSVImport, error) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return nil, errors.New("导入任务不存在")
+	}
+	var imp CSVImport
+	if err := db.Limit(1).Find(&imp, id).Error; err != nil || imp.ID == 0 {
+		return nil, errors.New("导入任务不存在")
+	}
+	return &imp, nil
+}
+
+func loadCSVImportRow(imp *CSVImport, rowStr string) (*CSVImportRow, error) {
+	id, err := strconv.ParseUint(rowStr, 10, 64)
+	if err != nil {
+		return nil, errors.New("条目不存在")
+	}
+	var row CSVImportRow
+	if err := db.Where("import_id = ?", imp.ID).Limit(1).Find(&row, id).Error; err != nil || row.ID == 0 {
+		return nil, errors.New("条目不存在")
+	}
+	return &row, nil
+}
+
+// RegisterCSVImportRoutes exposes third-party CSV imports:
+// POST /collections/import_csv starts one (multipart "file", "name",
+// "sources", "threshold"), GET /collections/csv_imports[/:id] shows
+// progress and the review queue (?status=review), and
+// POST /collections/csv_imports/:id/rows/:row/{confirm,search,skip}
+// resolves queued rows.
+func RegisterCSVImportRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+	colAPI.POST("/import_csv", func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 CSV 文件"})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取 CSV 文件失败"})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxCollectionImportBytes))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取 CSV 文件失败"})
+			return
+		}
+		entries, err := core.ParseTrackListCSV(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CSV 解析失败: " + err.Error()})
+			return
+		}
+		sources := csvImportSourceNames(c.PostForm("sources"))
+		if len(sources) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "没有可用于搜索的音乐源"})
+			return
+		}
+		threshold := csvImportAutoAcceptScore
+		if raw := strings.TrimSpace(c.PostForm("threshold")); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil || value <= 0 || value > 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "阈值需在 0 到 1 之间"})
+				return
+			}
+			threshold = value
+		}
+		name := c.PostForm("name")
+		if strings.TrimSpace(name) == "" {
+			name = strings.TrimSuffix(header.Filename, ".csv")
+		}
+
+		imp, err := createCSVImport(name, entries, sources, threshold)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建导入任务失败: " + err.Error()})
+			return
+		}
+		go runCSVImport(imp.ID)
+		c.JSON(http.StatusAccepted, csvImportSummary(*imp))
+	})
+
+	colAPI.GET("/csv_imports", func(c *gin.Context) {
+		var imports []CSVImport
+		if err := db.Order("id DESC").Limit(50).Find(&imports).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out := make([]csvImportJSON, 0, len(imports))
+		for _, imp := range imports {
+			out = append(out, csvImportSummary(imp))
+		}
+		c.JSON(http.StatusOK, gin.H{"imports": out})
+	})
+
+	colAPI.GET("/csv_imports/:id", func(c *gin.Context) {
+		imp, err := loadCSVImport(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		query := db.Where("import_id = ?", imp.ID).Order("position")
+		switch status := c.Query("status"); status {
+		case "":
+		case csvRowReview:
+			// The review queue holds both uncertain and unmatched rows.
+			query = query.Where("status IN ?", []string{csvRowReview, csvRowUnmatched})
+		default:
+			query = query.Where("status = ?", status)
+		}
+		var rows []CSVImportRow
+		if err := query.Find(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out := make([]csvImportRowJSON, 0, len(rows))
+		for _, row := range rows {
+			out = append(out, row.toJSON())
+		}
+		c.JSON(http.StatusOK, gin.H{"import": csvImportSummary(*imp), "rows": out})
+	})
+
+	colAPI.DELETE("/csv_imports/:id", func(c *gin.Context) {
+		imp, err := loadCSVImport(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("import_id = ?", imp.ID).Delete(&CSVImportRow{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(imp).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除导入任务失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	colAPI.POST("/csv_imports/:id/rows/:row/:action", func(c *gin.Context) {
+		imp, err := loadCSVImport(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		row, err := loadCSVImportRow(imp, c.Param("row"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if row.Status == csvRowPending {
+			c.JSON(http.StatusConflict, gin.H{"error": "该条目仍在匹配中"})
+			return
+		}
+
+		switch c.Param("action") {
+		case "confirm":
+			var req struct {
+				Candidate *int        `json:"candidate"`
+				Song      *model.Song `json:"song"`
+			}
+			_ = c.ShouldBindJSON(&req)
+			if row.Saved {
+				c.JSON(http.StatusConflict, gin.H{"error": "该条目已保存"})
+				return
+			}
+			song := row.choice()
+			switch {
+			case req.Song != nil:
+				if strings.TrimSpace(req.Song.ID) == "" || strings.TrimSpace(req.Song.Source) == "" {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "歌曲缺少 id 或 source"})
+					return
+				}
+				song = req.Song
+			case req.Candidate != nil:
+				candidates := row.candidates()
+				if *req.Candidate < 0 || *req.Candidate >= len(candidates) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "候选歌曲不存在"})
+					return
+				}
+				song = &candidates[*req.Candidate].Song
+			}
+			if song == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要保存的歌曲"})
+				return
+			}
+			row.setChoice(song)
+			row.Status = csvRowConfirmed
+			if err := db.Select("status", "choice").Save(row).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if err := saveCSVImportRow(imp, row); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败: " + err.Error()})
+				return
+			}
+
+		case "skip":
+			if row.Saved {
+				c.JSON(http.StatusConflict, gin.H{"error": "该条目已保存"})
+				return
+			}
+			row.Status = csvRowSkipped
+			if err := db.Model(row).Update("status", csvRowSkipped).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+		case "search":
+			var req struct {
+				Keyword string `json:"keyword"`
+				Sources string `json:"sources"`
+			}
+			_ = c.ShouldBindJSON(&req)
+			if row.Saved {
+				c.JSON(http.StatusConflict, gin.H{"error": "该条目已保存"})
+				return
+			}
+			keyword := strings.TrimSpace(req.Keyword)
+			if keyword == "" {
+				keyword = csvImportKeyword(row.Track, row.Artist)
+			}
+			sourceList := imp.Sources
+			if strings.TrimSpace(req.Sources) != "" {
+				sourceList = req.Sources
+			}
+			candidates := searchCSVImportCandidates(keyword, row.Track, row.Artist, row.Duration, csvImportSourceNames(sourceList))
+			row.setCandidates(candidates)
+			row.Status, row.Score = csvRowUnmatched, 0
+			row.setChoice(nil)
+			if len(candidates) > 0 {
+				row.Status, row.Score = csvRowReview, candidates[0].Score
+				row.setChoice(&candidates[0].Song)
+			}
+			if err := db.Select("status", "score", "choice", "candidates").Save(row).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("未知操作: %s", c.Param("action"))})
+			return
+		}
+
+		_ = refreshCSVImportStatus(imp)
+		c.JSON(http.StatusOK, gin.H{"import": csvImportSummary(*imp), "row": row.toJSON()})
+	})
+}
@@ -0,0 +1,261 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func stubCSVImportSearch(t *testing.T) {
+	t.Helper()
+	withSwitchSourceTestHooks(t)
+	catalog := map[string][]model.Song{
+		"qq": {
+			{ID: "q1", Name: "晴天", Artist: "周杰伦", Duration: 269},
+			{ID: "q2", Name: "十年 (Live)", Artist: "陈奕迅", Duration: 215},
+		},
+		"kugou": {
+			{ID: "k2", Name: "十年", Artist: "陈奕迅", Duration: 205},
+		},
+	}
+	switchDefaultSourceNames = func() []string { return []string{"qq"} }
+	switchSearchFuncProvider = func(source string) func(string) ([]model.Song, error) {
+		songs, ok := catalog[source]
+		if !ok {
+			return nil
+		}
+		return func(keyword string) ([]model.Song, error) {
+			var out []model.Song
+			for _, song := range songs {
+				if strings.Contains(keyword, strings.Fields(song.Name)[0]) {
+					out = append(out, song)
+				}
+			}
+			return out, nil
+		}
+	}
+}
+
+func TestCSVImportMatchesAndQueuesLowConfidenceRows(t *testing.T) {
+	initCollectionDBForTest(t)
+	stubCSVImportSearch(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterCSVImportRoutes(router.Group(""))
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var reader *bytes.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, reader))
+		return rec
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "spotify.csv")
+	part.Write([]byte("Track Name,Artist Name(s),Duration (ms)\n晴天,周杰伦,269000\n十年,陈奕迅,205000\nNothing,Nobody,\n"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/collections/import_csv", &form)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("import status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var started csvImportJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &started); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if started.Name != "spotify" || started.Sources != "qq" || started.Total != 3 {
+		t.Fatalf("started import = %+v", started)
+	}
+
+	type detail struct {
+		Import csvImportJSON      `json:"import"`
+		Rows   []csvImportRowJSON `json:"rows"`
+	}
+	var got detail
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec = do(http.MethodGet, fmt.Sprintf("/collections/csv_imports/%d", started.ID), nil)
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+		if got.Import.Status != csvImportMatching || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Import.Status != csvImportReview || len(got.Rows) != 3 {
+		t.Fatalf("import after matching = %+v", got.Import)
+	}
+	statuses := []string{got.Rows[0].Status, got.Rows[1].Status, got.Rows[2].Status}
+	if strings.Join(statuses, ",") != "matched,review,unmatched" {
+		t.Fatalf("row statuses = %v", statuses)
+	}
+	if got.Rows[1].Song == nil || got.Rows[1].Song.ID != "q2" || got.Rows[1].Score >= csvImportAutoAcceptScore {
+		t.Fatalf("review row = %+v", got.Rows[1])
+	}
+
+	var saved []SavedSong
+	db.Where("collection_id = ?", started.CollectionID).Find(&saved)
+	if len(saved) != 1 || saved[0].SongID != "q1" {
+		t.Fatalf("saved songs before review = %+v", saved)
+	}
+
+	rec = do(http.MethodGet, fmt.Sprintf("/collections/csv_imports/%d?status=review", started.ID), nil)
+	_ = json.Unmarshal(rec.Body.Bytes(), &got)
+	if len(got.Rows) != 2 {
+		t.Fatalf("review queue = %+v", got.Rows)
+	}
+	review, unmatched := got.Rows[0], got.Rows[1]
+
+	// Fix the uncertain row by searching another source and picking its best hit.
+	rec = do(http.MethodPost, fmt.Sprintf("/collections/csv_imports/%d/rows/%d/search", started.ID, review.ID),
+		map[string]string{"sources": "kugou"})
+	var action struct {
+		Import csvImportJSON    `json:"import"`
+		Row    csvImportRowJSON `json:"row"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &action)
+	if rec.Code != http.StatusOK || len(action.Row.Candidates) != 1 || action.Row.Candidates[0].Song.ID != "k2" {
+		t.Fatalf("search = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = do(http.MethodPost, fmt.Sprintf("/collections/csv_imports/%d/rows/%d/confirm", started.ID, review.ID),
+		map[string]int{"candidate": 0})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec = do(http.MethodPost, fmt.Sprintf("/collections/csv_imports/%d/rows/%d/confirm", started.ID, review.ID), nil); rec.Code != http.StatusConflict {
+		t.Fatalf("second confirm = %d", rec.Code)
+	}
+	if rec = do(http.MethodPost, fmt.Sprintf("/collections/csv_imports/%d/rows/%d/confirm", started.ID, unmatched.ID), nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("confirm without a song = %d", rec.Code)
+	}
+
+	rec = do(http.MethodPost, fmt.Sprintf("/collections/csv_imports/%d/rows/%d/skip", started.ID, unmatched.ID), nil)
+	_ = json.Unmarshal(rec.Body.Bytes(), &action)
+	if rec.Code != http.StatusOK || action.Import.Status != csvImportDone || action.Import.Counts[csvRowSkipped] != 1 {
+		t.Fatalf("skip = %d %s", rec.Code, rec.Body.String())
+	}
+
+	if got := transferSongIDs(t, started.CollectionID); got != "qq:q1,kugou:k2" {
+		t.Fatalf("saved songs after review = %s", got)
+	}
+
+	if err := deleteCollectionCSVImports(db, started.CollectionID); err != nil {
+		t.Fatalf("deleteCollectionCSVImports() error = %v", err)
+	}
+	if rec = do(http.MethodGet, fmt.Sprintf("/collections/csv_imports/%d", started.ID), nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleted import status = %d", rec.Code)
+	}
+}
+
+func TestConfirmedCSVImportRowsKeepCSVOrder(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := Collection{Name: "CSV", Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	db.Create(&collection)
+	imp := CSVImport{CollectionID: collection.ID, Name: "CSV", Status: csvImportReview}
+	db.Create(&imp)
+	rows := map[string]*CSVImportRow{}
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		row := &CSVImportRow{ImportID: imp.ID, Position: i + 1, Track: "Song " + id, Status: csvRowReview}
+		if id == "a" || id == "d" {
+			row.Status = csvRowMatched
+		}
+		row.setChoice(&model.Song{ID: id, Source: "qq", Name: "Song " + id})
+		db.Create(row)
+		rows[id] = row
+	}
+	if err := saveMatchedCSVImportRows(&imp); err != nil {
+		t.Fatalf("saveMatchedCSVImportRows() error = %v", err)
+	}
+	// A song the user added by hand stays on top.
+	db.Create(&SavedSong{CollectionID: collection.ID, SongID: "x", Source: "qq", Name: "Song x"})
+
+	for _, id := range []string{"c", "e", "b"} {
+		if err := saveCSVImportRow(&imp, rows[id]); err != nil {
+			t.Fatalf("saveCSVImportRow(%s) error = %v", id, err)
+		}
+	}
+	if got := transferSongIDs(t, collection.ID); got != "qq:x,qq:a,qq:b,qq:c,qq:d,qq:e" {
+		t.Fatalf("songs after review = %s", got)
+	}
+}
+
+func TestCSVImportFailuresAreReported(t *testing.T) {
+	initCollectionDBForTest(t)
+	stubCSVImportSearch(t)
+	collection := Collection{Name: "spotify", Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	imp := CSVImport{CollectionID: collection.ID, Name: "spotify", Sources: "qq", Threshold: csvImportAutoAcceptScore, Status: csvImportMatching}
+	if err := db.Create(&imp).Error; err != nil {
+		t.Fatalf("create import: %v", err)
+	}
+	if err := db.Create(&CSVImportRow{ImportID: imp.ID, Position: 1, Track: "晴天", Artist: "周杰伦", Duration: 269, Status: csvRowPending}).Error; err != nil {
+		t.Fatalf("create row: %v", err)
+	}
+	reload := func() CSVImport {
+		t.Helper()
+		var got CSVImport
+		if err := db.First(&got, imp.ID).Error; err != nil {
+			t.Fatalf("load import: %v", err)
+		}
+		return got
+	}
+
+	if err := db.Exec("CREATE TRIGGER fail_song BEFORE INSERT ON saved_songs BEGIN SELECT RAISE(ABORT, 'disk full'); END").Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	runCSVImport(imp.ID)
+	if got := reload(); got.Status != csvImportFailed || !strings.Contains(got.Error, "disk full") {
+		t.Fatalf("import after failed save = %+v, want failed with the error", got)
+	}
+	db.Exec("DROP TRIGGER fail_song")
+	runCSVImport(imp.ID)
+	if got := reload(); got.Status != csvImportDone || got.Error != "" {
+		t.Fatalf("import after retry = %+v, want done", got)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterCSVImportRoutes(router.Group(""))
+	deleteImport := func() int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/collections/csv_imports/%d", imp.ID), nil))
+		return rec.Code
+	}
+	if err := db.Exec("CREATE TRIGGER fail_import BEFORE DELETE ON csv_imports BEGIN SELECT RAISE(ABORT, 'disk full'); END").Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	if code := deleteImport(); code != http.StatusInternalServerError {
+		t.Fatalf("failed delete status = %d, want 500", code)
+	}
+	var rows int64
+	if db.Model(&CSVImportRow{}).Where("import_id = ?", imp.ID).Count(&rows); rows != 1 {
+		t.Fatalf("rows after failed delete = %d, want 1", rows)
+	}
+	db.Exec("DROP TRIGGER fail_import")
+	if code := deleteImport(); code != http.StatusOK {
+		t.Fatalf("delete status = %d, want 200", code)
+	}
+	if db.Model(&CSVImportRow{}).Where("import_id = ?", imp.ID).Count(&rows); rows != 0 {
+		t.Fatalf("rows after delete = %d, want 0", rows)
+	}
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+var filenamePreviewSettings = core.GetWebSettings
+
+// filenamePreviewSongs are the sample songs the template preview renders: an
+// album track from a playlist and a single without album or track data, so
+// conditional parts show both ways.
+var filenamePreviewSongs = []struct {
+	Label string
+	Song  model.Song
+}{
+	{
+		Label: "专辑曲目",
+		Song: model.Song{
+			ID: "186001", Source: "netease", Name: "晴天", Artist: "周杰伦", Album: "叶惠美", Bitrate: 320,
+			Extra: map[string]string{
+				"track": "3", "track_total": "11", "disc": "1", "release_date": "2003-07-31",
+				"album_artist": "周杰伦", "genre": "Pop", "composer": "周杰伦",
+				"playlist": "我喜欢的音乐", "playlist_index": "7",
+			},
+		},
+	},
+	{
+		Label: "单曲",
+		Song:  model.Song{ID: "1901371647", Source: "qq", Name: "Letting Go", Artist: "蔡健雅 feat. 陶喆", Bitrate: 128},
+	},
+}
+
+// RegisterFilenamePreviewRoutes exposes GET /api/filename_preview, which
+// renders ?template= (the saved template when omitted) for sample songs.
+func RegisterFilenamePreviewRoutes(api *gin.RouterGroup) {
+	api.GET("/api/filename_preview", func(c *gin.Context) {
+		template := strings.TrimSpace(c.Query("template"))
+		if template == "" {
+			template = filenamePreviewSettings().DownloadFilenameTemplate
+		}
+		if _, err := core.ParseFilenameTemplate(template); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "模板错误: " + err.Error()})
+			return
+		}
+		ext := strings.TrimPrefix(strings.TrimSpace(c.Query("ext")), ".")
+		if ext == "" {
+			ext = "flac"
+		}
+
+		previews := make([]gin.H, 0, len(filenamePreviewSongs))
+		for _, sample := range filenamePreviewSongs {
+			song := sample.Song
+			filename := core.BuildDownloadFilename(&song, ext, template)
+			previews = append(previews, gin.H{
+				"label":    sample.Label,
+				"filename": filepath.ToSlash(filename),
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"template": template, "previews": previews})
+	})
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+)
+
+func TestFilenamePreviewRendersSamples(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := filenamePreviewSettings
+	filenamePreviewSettings = func() core.WebSettings {
+		return core.WebSettings{DownloadFilenameTemplate: "{artist} - {name}"}
+	}
+	t.Cleanup(func() { filenamePreviewSettings = original })
+
+	router := gin.New()
+	RegisterFilenamePreviewRoutes(router.Group(""))
+
+	tests := []struct {
+		name     string
+		template string
+		status   int
+		want     []string
+	}{
+		{name: "saved template", status: http.StatusOK, want: []string{"周杰伦 - 晴天.flac", "蔡健雅 feat. 陶喆 - Letting Go.flac"}},
+		{
+			name:     "conditional album folder",
+			template: "{first_artist}/{if album}{album}/{track} {else}Singles/{end}{name}.{ext}",
+			status:   http.StatusOK,
+			want:     []string{"周杰伦/叶惠美/03 晴天.flac", "蔡健雅/Singles/Letting Go.flac"},
+		},
+		{name: "invalid template", template: "{if album}{name}", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/filename_preview?template="+url.QueryEscape(tt.template), nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Previews []struct {
+					Filename string `json:"filename"`
+				} `json:"previews"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Previews) != len(tt.want) {
+				t.Fatalf("previews = %+v, want %v", resp.Previews, tt.want)
+			}
+			for i, want := range tt.want {
+				if resp.Previews[i].Filename != want {
+					t.Fatalf("preview %d = %q, want %q", i, resp.Previews[i].Filename, want)
+				}
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/dhowden/tag"
 	"github.com/gin-gonic/gin"
 	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 	"github.com/guohuiyuan/music-lib/model"
 	"github.com/guohuiyuan/music-lib/utils"
 	"gorm.io/gorm/clause"
@@ -61,7 +62,7 @@ var localMusicScanRefreshInFlight bool
 var autoCacheMu sync.Mutex
 var autoCacheInFlight = make(map[string]struct{})
 var autoCacheSlots = make(chan struct{}, autoCacheMaxConcurrent)
-var autoCacheSaveSong = core.SaveSongToFileWithTemplate
+var autoCacheSaveSong = core.SaveSongToTarget
 var autoCacheIndexSavedSong = indexAutoCachedLocalMusic
 var autoCacheSettingsProvider = core.GetWebSettings
 
@@ -183,15 +184,13 @@ func indexAutoCachedLocalMusic(result *core.DownloadedSong, downloadDir string)
 		return
 	}
 
-	rootDir := strings.TrimSpace(downloadDir)
-	if rootDir == "" {
-		rootDir = localMusicDownloadDir()
-	}
-	rootAbs, err := filepath.Abs(rootDir)
+	savedAbs, err := filepath.Abs(result.SavedPath)
 	if err != nil {
 		return
 	}
-	track, err := buildLocalMusicTrackFast(rootAbs, result.SavedPath)
+	// Routes can save outside downloadDir, so index against whichever scanned
+	// root holds the file.
+	track, err := buildLocalMusicTrackFast(localMusicRootForPath(savedAbs), savedAbs)
 	if err != nil {
 		return
 	}
@@ -228,9 +227,10 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 		forceRefresh := c.Query("refresh") == "1" || c.Query("force") == "1"
 		offset := parseLocalMusicRangeInt(c.Query("offset"), 0)
 		limit := parseLocalMusicRangeInt(c.Query("limit"), 0)
+		filter := parseSongAnnotationFilter(c)
 
-		// 快速路径：从 SQLite 索引加载（无文件 IO）
-		if !forceRefresh && db != nil {
+		// 快速路径：从 SQLite 索引加载（无文件 IO）；按标注筛选时需要完整列表，走下面的扫描缓存。
+		if !forceRefresh && !filter.active() && db != nil {
 			if tracks, total, ok := loadTracksFromIndex(offset, limit); ok && total > 0 {
 				c.JSON(http.StatusOK, gin.H{
 					"download_dir": filepath.ToSlash(localMusicDownloadDir()),
@@ -256,7 +256,15 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 			return
 		}
 
-		pageTracks := paginateLocalMusicTracks(tracks, offset, limit)
+		// 标注保存在索引表里，扫描结果需要合并后再筛选/分页。
+		listed := tracks
+		if filter.active() {
+			listed = filter.tracks(annotateLocalMusicTracks(tracks))
+		}
+		pageTracks := paginateLocalMusicTracks(listed, offset, limit)
+		if !filter.active() {
+			pageTracks = annotateLocalMusicTracks(pageTracks)
+		}
 		markAlreadyAddedLocalTracks(c.Query("collection_id"), pageTracks)
 
 		// 扫描完成后同步到 SQLite 索引（异步），空扫描也要清除旧行。
@@ -268,10 +276,10 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 			"download_dir": filepath.ToSlash(dir),
 			"exists":       exists,
 			"tracks":       pageTracks,
-			"total":        len(tracks),
+			"total":        len(listed),
 			"offset":       offset,
 			"limit":        limit,
-			"has_more":     offset+len(pageTracks) < len(tracks),
+			"has_more":     offset+len(pageTracks) < len(listed),
 			"refreshing":   refreshing,
 			"scanned_at":   scannedAt,
 		})
@@ -461,10 +469,9 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 				Order("size DESC").
 				Find(&songs)
 
-			rootAbs, _ := filepath.Abs(localMusicDownloadDir())
 			items := make([]localMusicDupItem, 0, len(songs))
 			for _, s := range songs {
-				absPath := filepath.Join(rootAbs, filepath.FromSlash(s.RelPath))
+				absPath := localMusicAbsPath(s.RelPath)
 				if info, statErr := os.Stat(absPath); statErr != nil || info.IsDir() {
 					continue
 				}
@@ -545,7 +552,7 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 
 		go func() {
 			defer releaseAutoCache(cacheKey)
-			result, err := autoCacheSaveSong(song, settings.DownloadDir, true, true, settings.DownloadFilenameTemplate)
+			result, err := autoCacheSaveSong(song, core.WebDownloadTarget(settings), true, true)
 			if err != nil || result == nil {
 				return
 			}
@@ -579,6 +586,10 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "外部导入歌单/专辑不支持直接添加本地音乐"})
 			return
 		}
+		if collection.isSmart() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errSmartCollectionSongs.Error()})
+			return
+		}
 
 		var req struct {
 			ID string `json:"id" binding:"required"`
@@ -630,6 +641,10 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "外部导入歌单/专辑不支持直接添加本地音乐"})
 			return
 		}
+		if collection.isSmart() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errSmartCollectionSongs.Error()})
+			return
+		}
 
 		var req struct {
 			IDs []string `json:"ids" binding:"required"`
@@ -661,14 +676,10 @@ func RegisterLocalMusicRoutes(api *gin.RouterGroup) {
 			})
 		}
 
-		added := 0
-		if len(songs) > 0 {
-			tx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&songs)
-			if tx.Error != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "批量添加失败: " + tx.Error.Error()})
-				return
-			}
-			added = int(tx.RowsAffected)
+		added, err := insertSavedSongs(songs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "批量添加失败: " + err.Error()})
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -711,7 +722,7 @@ func scanLocalMusicTracks() ([]*localMusicTrack, string, bool, error) {
 	info, err := os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return []*localMusicTrack{}, dir, false, nil
+			return scanLocalMusicExtraRoots([]*localMusicTrack{}), dir, false, nil
 		}
 		return nil, dir, false, err
 	}
@@ -724,8 +735,44 @@ func scanLocalMusicTracks() ([]*localMusicTrack, string, bool, error) {
 		return nil, dir, true, err
 	}
 
-	tracks := make([]*localMusicTrack, 0)
-	err = filepath.WalkDir(rootAbs, func(path string, entry fs.DirEntry, walkErr error) error {
+	roots := localMusicRoots()
+	tracks, err := walkLocalMusicRoot(rootAbs, roots, make([]*localMusicTrack, 0))
+	if err != nil {
+		return nil, dir, true, err
+	}
+	return scanLocalMusicExtraRoots(tracks), dir, true, nil
+}
+
+// scanLocalMusicExtraRoots adds the tracks of the download route directories
+// outside the download directory; missing ones are skipped.
+func scanLocalMusicExtraRoots(tracks []*localMusicTrack) []*localMusicTrack {
+	roots := localMusicRoots()
+	for _, root := range roots[1:] {
+		if info, err := os.Stat(root.Abs); err != nil || !info.IsDir() {
+			continue
+		}
+		if next, err := walkLocalMusicRoot(root.Abs, roots, tracks); err == nil {
+			tracks = next
+		}
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if !tracks[i].modTime.Equal(tracks[j].modTime) {
+			return tracks[i].modTime.After(tracks[j].modTime)
+		}
+		return strings.ToLower(tracks[i].RelPath) < strings.ToLower(tracks[j].RelPath)
+	})
+	return tracks
+}
+
+func walkLocalMusicRoot(rootAbs string, roots []localMusicRoot, tracks []*localMusicTrack) ([]*localMusicTrack, error) {
+	otherRoots := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		if root.Abs != rootAbs {
+			otherRoots[root.Abs] = true
+		}
+	}
+	err := filepath.WalkDir(rootAbs, func(path string, entry fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return nil
 		}
@@ -735,6 +782,10 @@ func scanLocalMusicTracks() ([]*localMusicTrack, string, bool, error) {
 					return filepath.SkipDir
 				}
 			}
+			// Nested roots are walked on their own, with their own prefix.
+			if otherRoots[path] {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 		if !isLocalMusicAudioFile(path) {
@@ -747,18 +798,7 @@ func scanLocalMusicTracks() ([]*localMusicTrack, string, bool, error) {
 		}
 		return nil
 	})
-	if err != nil {
-		return nil, dir, true, err
-	}
-
-	sort.SliceStable(tracks, func(i, j int) bool {
-		if !tracks[i].modTime.Equal(tracks[j].modTime) {
-			return tracks[i].modTime.After(tracks[j].modTime)
-		}
-		return strings.ToLower(tracks[i].RelPath) < strings.ToLower(tracks[j].RelPath)
-	})
-
-	return tracks, dir, true, nil
+	return tracks, err
 }
 
 func scanLocalMusicTracksCached(force bool) ([]*localMusicTrack, string, bool, error, bool, time.Time) {
@@ -907,7 +947,7 @@ func markAlreadyAddedLocalTracks(collectionID string, tracks []*localMusicTrack)
 	}
 
 	collection, err := loadCollection(collectionID)
-	if err != nil || collection.isImported() {
+	if err != nil || !collection.isManual() {
 		return
 	}
 
@@ -982,7 +1022,7 @@ func buildLocalMusicTrackFallback(rootAbs string, audioPath string) (*localMusic
 	if err != nil {
 		return nil, err
 	}
-	rel = filepath.ToSlash(rel)
+	rel = localMusicRootPrefix(rootAbs) + filepath.ToSlash(rel)
 
 	filename := info.Name()
 	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
@@ -1049,7 +1089,7 @@ func buildLocalMusicTrack(rootAbs string, audioPath string) (*localMusicTrack, e
 	if err != nil {
 		return nil, err
 	}
-	rel = filepath.ToSlash(rel)
+	rel = localMusicRootPrefix(rootAbs) + filepath.ToSlash(rel)
 
 	filename := info.Name()
 	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
@@ -1222,11 +1262,8 @@ func localMusicTrackByID(id string) (*localMusicTrack, error) {
 		return nil, errors.New("invalid local music path")
 	}
 
-	rootAbs, err := filepath.Abs(localMusicDownloadDir())
-	if err != nil {
-		return nil, err
-	}
-	audioPath := filepath.Join(rootAbs, cleanRel)
+	rootAbs, inner := localMusicResolveRel(filepath.ToSlash(cleanRel))
+	audioPath := filepath.Join(rootAbs, filepath.FromSlash(inner))
 	absPath, err := filepath.Abs(audioPath)
 	if err != nil {
 		return nil, err
@@ -1645,6 +1682,17 @@ func serveLocalMusicLyric(c *gin.Context, song *model.Song, download bool, saveL
 		c.String(http.StatusNotFound, "Lyric not found")
 		return
 	}
+	target := lyrics.FormatLRC
+	if download {
+		var ok bool
+		if target, ok = lyricTargetFromQuery(c); !ok {
+			return
+		}
+	}
+	lyricOpts, ok := lyricOptionsFromQuery(c)
+	if !ok {
+		return
+	}
 	track, err := localMusicTrackByID(song.ID)
 	if err != nil {
 		if download {
@@ -1655,8 +1703,12 @@ func serveLocalMusicLyric(c *gin.Context, song *model.Song, download bool, saveL
 		return
 	}
 
-	lyrics, err := readLocalMusicLyrics(track.absPath)
-	if err != nil || strings.TrimSpace(lyrics) == "" {
+	lyricText, err := readLocalMusicLyrics(track.absPath)
+	if override, _ := songOverrideGet(song.Source, song.ID); override != nil && (override.Lyric != "" || override.LyricOffsetMs != 0) {
+		lyricText, err = override.ApplyLyric(lyricText), nil
+		c.Header("X-Lyric-Override", "1")
+	}
+	if err != nil || strings.TrimSpace(lyricText) == "" {
 		if download {
 			c.String(http.StatusNotFound, "Lyric not found")
 		} else {
@@ -1665,16 +1717,20 @@ func serveLocalMusicLyric(c *gin.Context, song *model.Song, download bool, saveL
 		return
 	}
 
-	lyrics = formatLyricForMode(lyrics, c.DefaultQuery("format", "auto"))
-	c.Header("X-Lyric-Format", classifyLyricFormat(lyrics))
+	lyricText = formatLyricForMode(lyricText, c.DefaultQuery("format", "auto"), lyricOpts)
+	c.Header("X-Lyric-Format", classifyLyricFormat(lyricText))
 	if download {
+		filename := strings.TrimSuffix(localMusicLyricFilename(track), ".lrc") + "." + target.Ext()
+		data := []byte(convertLyricForTarget(lyricText, target))
 		if len(saveLocal) > 0 && saveLocal[0] {
-			saveWebAssetResponse(c, localMusicLyricFilename(track), []byte(lyrics))
+			saveWebAssetResponse(c, filename, data)
 			return
 		}
-		setDownloadHeader(c, localMusicLyricFilename(track))
+		setDownloadHeader(c, filename)
+		c.Data(http.StatusOK, target.ContentType(), data)
+		return
 	}
-	c.String(http.StatusOK, lyrics)
+	c.String(http.StatusOK, lyricText)
 }
 
 func inspectLocalMusicFile(id string, duration string) (gin.H, error) {
@@ -1686,9 +1742,7 @@ func inspectLocalMusicFile(id string, duration string) (gin.H, error) {
 	if probe, err := probeLocalMusicTrack(track); err == nil && probe != nil {
 		applyLocalProbeResult(track, probe)
 	}
-	if rootAbs, err := filepath.Abs(localMusicDownloadDir()); err == nil {
-		cacheLocalMusicTrack(rootAbs, track)
-	}
+	cacheLocalMusicTrack(localMusicRootForPath(track.absPath), track)
 
 	bitrate := "-"
 	if kbps, _ := strconv.Atoi(track.Extra["bitrate"]); kbps > 0 {
@@ -1742,9 +1796,9 @@ func deleteLocalMusicTrack(id string) error {
 	if err != nil {
 		return errors.New("本地音乐不存在或已不在下载目录内")
 	}
-	// 硬删除：删磁盘文件 + 删索引行。收藏歌单里的引用条目保留，
-	// 之后在歌单详情页会显示为失效，可换源到在线源。
-	if err := os.Remove(track.absPath); err != nil {
+	// 软删除：文件移入所在音乐目录的 .trash，可从回收站还原；索引行删除。
+	// 收藏歌单里的引用条目保留，之后在歌单详情页会显示为失效，可换源到在线源。
+	if err := trashLocalMusicTrack(track); err != nil {
 		return err
 	}
 	deleteLocalMusicIndexRow(track.ID)
@@ -34,6 +34,11 @@ type LocalMusicIndex struct {
 	HasLyric  bool      `gorm:"column:has_lyric"`
 	ModTime   time.Time `gorm:"column:mod_time"`
 	ScannedAt time.Time `gorm:"column:scanned_at;index"`
+	// Annotations are set by the user, never by a scan, so the upserts below
+	// leave them alone.
+	Rating int    `gorm:"column:rating;not null;default:0"`
+	Tags   string `gorm:"column:tags;not null;default:''"`
+	Note   string `gorm:"column:note;not null;default:''"`
 }
 
 func (LocalMusicIndex) TableName() string { return "local_music_index" }
@@ -60,6 +65,9 @@ func localMusicIndexExtra(row *LocalMusicIndex) map[string]string {
 	if row.HasLyric {
 		extra["lyric"] = "true"
 	}
+	if row.Rating > 0 || row.Tags != "" || row.Note != "" {
+		extra = withSongAnnotation(extra, row.Rating, row.Tags, row.Note)
+	}
 	return extra
 }
 
@@ -138,13 +146,12 @@ func loadTracksFromIndex(offset int, limit int) ([]*localMusicTrack, int, bool)
 		return nil, 0, false
 	}
 
-	rootAbs, _ := filepath.Abs(localMusicDownloadDir())
 	tracks := make([]*localMusicTrack, 0, len(rows))
 	missingIDs := make([]string, 0)
 	for i := range rows {
 		row := &rows[i]
 		// 快速校验文件是否还在磁盘上
-		absPath := filepath.Join(rootAbs, filepath.FromSlash(row.RelPath))
+		absPath := localMusicAbsPath(row.RelPath)
 		if info, statErr := os.Stat(absPath); statErr != nil || info.IsDir() {
 			missingIDs = append(missingIDs, row.ID)
 			continue
@@ -218,11 +225,6 @@ func findLocalMusicMatch(name string, artist string) (*LocalMusicIndex, string,
 	if db == nil {
 		return nil, "", nil
 	}
-	rootAbs, err := filepath.Abs(localMusicDownloadDir())
-	if err != nil {
-		return nil, "", err
-	}
-
 	seenIDs := make(map[string]struct{})
 	staleIDs := make([]string, 0)
 	findExisting := func(rows []LocalMusicIndex) (*LocalMusicIndex, string) {
@@ -233,7 +235,7 @@ func findLocalMusicMatch(name string, artist string) (*LocalMusicIndex, string,
 			}
 			seenIDs[row.ID] = struct{}{}
 
-			absPath := filepath.Join(rootAbs, filepath.FromSlash(row.RelPath))
+			absPath := localMusicAbsPath(row.RelPath)
 			if info, statErr := os.Stat(absPath); statErr != nil || info.IsDir() {
 				staleIDs = append(staleIDs, row.ID)
 				continue
@@ -323,39 +325,35 @@ func localMusicSearchSongs(keyword string, limit int) []model.Song {
 		return nil
 	}
 
-	rootAbs, err := filepath.Abs(localMusicDownloadDir())
-	if err != nil {
-		rootAbs = ""
-	}
-
 	songs := make([]model.Song, 0, len(rows))
 	for i := range rows {
 		row := &rows[i]
-		if rootAbs != "" {
-			absPath := filepath.Join(rootAbs, filepath.FromSlash(row.RelPath))
-			if info, statErr := os.Stat(absPath); statErr != nil || info.IsDir() {
-				deleteLocalMusicIndexRow(row.ID)
-				continue
-			}
-		}
-		cover := row.Cover
-		if cover == "" && row.HasCover {
-			cover = RoutePrefix + "/local_music/cover?id=" + url.QueryEscape(row.ID)
+		if info, statErr := os.Stat(localMusicAbsPath(row.RelPath)); statErr != nil || info.IsDir() {
+			deleteLocalMusicIndexRow(row.ID)
+			continue
 		}
-		songs = append(songs, model.Song{
-			ID:       row.ID,
-			Source:   localMusicSource,
-			Name:     row.Name,
-			Artist:   row.Artist,
-			Album:    row.Album,
-			Cover:    cover,
-			Duration: row.Duration,
-			Extra:    localMusicIndexExtra(row),
-		})
+		songs = append(songs, localMusicIndexSong(row))
 	}
 	return songs
 }
 
+func localMusicIndexSong(row *LocalMusicIndex) model.Song {
+	cover := row.Cover
+	if cover == "" && row.HasCover {
+		cover = RoutePrefix + "/local_music/cover?id=" + url.QueryEscape(row.ID)
+	}
+	return model.Song{
+		ID:       row.ID,
+		Source:   localMusicSource,
+		Name:     row.Name,
+		Artist:   row.Artist,
+		Album:    row.Album,
+		Cover:    cover,
+		Duration: row.Duration,
+		Extra:    localMusicIndexExtra(row),
+	}
+}
+
 // localCollectionSearchPlaylists 在本地歌单（Collection）里按名称/描述/创建者搜索，
 // 返回 model.Playlist 卡片（Source=local），用于"歌单搜索 + 勾选 local"。
 func localCollectionSearchPlaylists(keyword string) []model.Playlist {
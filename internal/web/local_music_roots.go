@@ -0,0 +1,101 @@
+package web
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/guohuiyuan/go-music-dl/core"
+)
+
+// localMusicExtraRootsProvider lists the directories outside the download
+// directory that download routes save to; the scanner indexes them as well.
+var localMusicExtraRootsProvider = func() []string {
+	return core.DownloadRouteRoots(core.GetWebSettings().DownloadRoutes)
+}
+
+// localMusicRoot is one scanned directory. Tracks in extra roots carry the
+// root's Prefix ("@<hash>/") in their relative path, and so in their ID, which
+// keeps IDs unique across roots and lets them resolve back to the directory.
+type localMusicRoot struct {
+	Abs    string
+	Prefix string
+}
+
+var (
+	localMusicRootPrefixesMu sync.RWMutex
+	// localMusicRootPrefixes maps extra root directories to their prefix. It is
+	// refreshed by localMusicRoots, which every path into an extra root calls.
+	localMusicRootPrefixes = map[string]string{}
+)
+
+// localMusicRoots returns the download directory followed by the extra roots.
+func localMusicRoots() []localMusicRoot {
+	primary, err := filepath.Abs(localMusicDownloadDir())
+	if err != nil {
+		primary = localMusicDownloadDir()
+	}
+	roots := []localMusicRoot{{Abs: primary}}
+	prefixes := map[string]string{}
+	for _, dir := range localMusicExtraRootsProvider() {
+		abs, err := filepath.Abs(dir)
+		if err != nil || isPathInside(primary, abs) {
+			// Directories inside the download directory are scanned with it.
+			continue
+		}
+		if _, seen := prefixes[abs]; seen {
+			continue
+		}
+		sum := sha1.Sum([]byte(filepath.ToSlash(abs)))
+		prefix := "@" + hex.EncodeToString(sum[:4]) + "/"
+		prefixes[abs] = prefix
+		roots = append(roots, localMusicRoot{Abs: abs, Prefix: prefix})
+	}
+
+	localMusicRootPrefixesMu.Lock()
+	localMusicRootPrefixes = prefixes
+	localMusicRootPrefixesMu.Unlock()
+	return roots
+}
+
+// localMusicRootPrefix is the relative path prefix of tracks under rootAbs.
+func localMusicRootPrefix(rootAbs string) string {
+	localMusicRootPrefixesMu.RLock()
+	defer localMusicRootPrefixesMu.RUnlock()
+	return localMusicRootPrefixes[filepath.Clean(rootAbs)]
+}
+
+// localMusicResolveRel splits a track's relative path into its root directory
+// and the path inside that root.
+func localMusicResolveRel(rel string) (string, string) {
+	roots := localMusicRoots()
+	if strings.HasPrefix(rel, "@") {
+		for _, root := range roots[1:] {
+			if strings.HasPrefix(rel, root.Prefix) {
+				return root.Abs, strings.TrimPrefix(rel, root.Prefix)
+			}
+		}
+	}
+	return roots[0].Abs, rel
+}
+
+// localMusicAbsPath is the file a track's relative path points at.
+func localMusicAbsPath(rel string) string {
+	rootAbs, inner := localMusicResolveRel(rel)
+	return filepath.Join(rootAbs, filepath.FromSlash(inner))
+}
+
+// localMusicRootForPath returns the scanned root containing absPath, the
+// innermost one when roots are nested, or the download directory.
+func localMusicRootForPath(absPath string) string {
+	roots := localMusicRoots()
+	best := roots[0].Abs
+	for _, root := range roots[1:] {
+		if isPathInside(root.Abs, absPath) && (!isPathInside(best, absPath) || len(root.Abs) > len(best)) {
+			best = root.Abs
+		}
+	}
+	return best
+}
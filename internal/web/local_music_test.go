@@ -23,11 +23,24 @@ func withLocalMusicDownloadDir(t *testing.T, dir string) {
 	t.Helper()
 
 	original := localMusicDownloadDirProvider
+	originalExtra := localMusicExtraRootsProvider
 	localMusicDownloadDirProvider = func() string {
 		return dir
 	}
+	localMusicExtraRootsProvider = func() []string { return nil }
 	t.Cleanup(func() {
 		localMusicDownloadDirProvider = original
+		localMusicExtraRootsProvider = originalExtra
+	})
+}
+
+func withLocalMusicExtraRoots(t *testing.T, roots ...string) {
+	t.Helper()
+
+	original := localMusicExtraRootsProvider
+	localMusicExtraRootsProvider = func() []string { return roots }
+	t.Cleanup(func() {
+		localMusicExtraRootsProvider = original
 	})
 }
 
@@ -489,6 +502,28 @@ func TestLocalMusicSidecarCoverAndLyricFallbacks(t *testing.T) {
 		t.Fatalf("local download_lrc missing lrc download header: %q", rec.Header().Get("Content-Disposition"))
 	}
 
+	req = httptest.NewRequest(http.MethodGet, lyricURL+"&target=srt", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET local download_lrc srt status = %d, want %d, body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if want := "1\n00:00:01,000 --> 00:00:06,000\nSidecar lyric line\n"; rec.Body.String() != want {
+		t.Fatalf("local download_lrc srt body = %q, want %q", rec.Body.String(), want)
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), ".srt") {
+		t.Fatalf("local download_lrc missing srt download header: %q", rec.Header().Get("Content-Disposition"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, lyricURL+"&target=docx", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("GET local download_lrc unsupported target status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
 	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/lyric?id=%s&source=%s", RoutePrefix, url.QueryEscape(track.ID), localMusicSource), nil)
 	rec = httptest.NewRecorder()
 	router.ServeHTTP(rec, req)
@@ -757,7 +792,7 @@ func TestAutoCacheEndpointSkipsWhenDisabled(t *testing.T) {
 	})
 
 	called := make(chan struct{}, 1)
-	autoCacheSaveSong = func(_ *model.Song, _ string, _ bool, _ bool, _ string) (*core.DownloadedSong, error) {
+	autoCacheSaveSong = func(_ *model.Song, _ core.DownloadTarget, _ bool, _ bool) (*core.DownloadedSong, error) {
 		called <- struct{}{}
 		return nil, nil
 	}
@@ -801,7 +836,7 @@ func TestAutoCacheEndpointStartsDownloadAndIndexesSavedSong(t *testing.T) {
 
 	saved := make(chan *model.Song, 1)
 	indexed := make(chan struct{}, 1)
-	autoCacheSaveSong = func(song *model.Song, _ string, _ bool, _ bool, _ string) (*core.DownloadedSong, error) {
+	autoCacheSaveSong = func(song *model.Song, _ core.DownloadTarget, _ bool, _ bool) (*core.DownloadedSong, error) {
 		saved <- song
 		return &core.DownloadedSong{}, nil
 	}
@@ -856,7 +891,7 @@ func TestAutoCacheEndpointDeduplicatesInFlightRequests(t *testing.T) {
 	started := make(chan struct{}, 1)
 	release := make(chan struct{})
 	indexed := make(chan struct{}, 1)
-	autoCacheSaveSong = func(_ *model.Song, _ string, _ bool, _ bool, _ string) (*core.DownloadedSong, error) {
+	autoCacheSaveSong = func(_ *model.Song, _ core.DownloadTarget, _ bool, _ bool) (*core.DownloadedSong, error) {
 		started <- struct{}{}
 		<-release
 		return &core.DownloadedSong{}, nil
@@ -936,6 +971,68 @@ func TestAutoCacheClientWaitsForConfirmedLocalMatch(t *testing.T) {
 	}
 }
 
+func TestLocalMusicScansDownloadRouteRoots(t *testing.T) {
+	initCollectionDBForTest(t)
+
+	downloadDir := t.TempDir()
+	routeDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	withLocalMusicExtraRoots(t, routeDir, filepath.Join(downloadDir, "Inside"))
+
+	for _, path := range []string{
+		filepath.Join(downloadDir, "Main Song.mp3"),
+		filepath.Join(downloadDir, "Inside", "Inside Song.mp3"),
+		filepath.Join(routeDir, "Lossless", "Routed Song.flac"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte("audio"), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	tracks, _, exists, err := scanLocalMusicTracks()
+	if err != nil || !exists {
+		t.Fatalf("scanLocalMusicTracks() exists=%v err=%v", exists, err)
+	}
+	relPaths := map[string]string{}
+	for _, track := range tracks {
+		relPaths[track.Name] = track.RelPath
+	}
+	if len(tracks) != 3 {
+		t.Fatalf("scanned %d tracks (%v), want 3", len(tracks), relPaths)
+	}
+	if relPaths["Main Song"] != "Main Song.mp3" || relPaths["Inside Song"] != "Inside/Inside Song.mp3" {
+		t.Fatalf("download dir rel paths = %v, want them unprefixed", relPaths)
+	}
+	routed := relPaths["Routed Song"]
+	if !strings.HasPrefix(routed, "@") || !strings.HasSuffix(routed, "/Lossless/Routed Song.flac") {
+		t.Fatalf("routed rel path = %q, want an @root prefix", routed)
+	}
+
+	track, err := localMusicTrackByID(encodeLocalMusicID(routed))
+	if err != nil {
+		t.Fatalf("localMusicTrackByID(routed) error = %v", err)
+	}
+	if want := filepath.Join(routeDir, "Lossless", "Routed Song.flac"); track.absPath != want {
+		t.Fatalf("routed absPath = %q, want %q", track.absPath, want)
+	}
+
+	savedPath := filepath.Join(routeDir, "Cached Song.mp3")
+	if err := os.WriteFile(savedPath, []byte("audio"), 0644); err != nil {
+		t.Fatalf("write cached audio: %v", err)
+	}
+	indexAutoCachedLocalMusic(&core.DownloadedSong{SavedPath: savedPath}, downloadDir)
+	var row LocalMusicIndex
+	if err := db.Where("name = ?", "Cached Song").First(&row).Error; err != nil {
+		t.Fatalf("load indexed routed song: %v", err)
+	}
+	if localMusicAbsPath(row.RelPath) != savedPath {
+		t.Fatalf("indexed routed song resolves to %q, want %q", localMusicAbsPath(row.RelPath), savedPath)
+	}
+}
+
 func TestLocalMusicDuplicateEndpointPaginatesGroups(t *testing.T) {
 	initCollectionDBForTest(t)
 
@@ -0,0 +1,311 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// lyricAuthorSession is one timed-lyric authoring run: the plain lines of a song
+// and the tap timestamps recorded against its playback.
+type lyricAuthorSession struct {
+	ID         string
+	Song       model.Song
+	Lines      []string
+	Stamps     []int
+	Cursor     int
+	LastActive time.Time
+}
+
+var (
+	lyricAuthorSessions = make(map[string]*lyricAuthorSession)
+	lyricAuthorMu       sync.Mutex
+)
+
+const (
+	lyricAuthorSessionMaxIdle = 2 * time.Hour
+	lyricAuthorMaxLines       = 2000
+)
+
+type lyricAuthorCreateRequest struct {
+	Source   string `json:"source"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Artist   string `json:"artist"`
+	Duration int    `json:"duration"`
+	Text     string `json:"text"`
+}
+
+type lyricAuthorTapRequest struct {
+	Line   *int `json:"line"`
+	TimeMs int  `json:"time_ms"`
+}
+
+func (s *lyricAuthorSession) durationMs() int {
+	return s.Song.Duration * 1000
+}
+
+func (s *lyricAuthorSession) lyric() *lyrics.Lyric {
+	lyric := lyrics.Author(s.Lines, s.Stamps, s.durationMs())
+	if s.Song.Name != "" {
+		lyric.Tags = append(lyric.Tags, lyrics.Tag{Key: "ti", Value: s.Song.Name})
+	}
+	if s.Song.Artist != "" {
+		lyric.Tags = append(lyric.Tags, lyrics.Tag{Key: "ar", Value: s.Song.Artist})
+	}
+	return lyric
+}
+
+func (s *lyricAuthorSession) state() gin.H {
+	lines := make([]gin.H, len(s.Lines))
+	timed := 0
+	for i, text := range s.Lines {
+		lines[i] = gin.H{"index": i, "text": text, "time_ms": s.Stamps[i]}
+		if s.Stamps[i] >= 0 {
+			timed++
+		}
+	}
+	return gin.H{
+		"id":       s.ID,
+		"source":   s.Song.Source,
+		"song_id":  s.Song.ID,
+		"name":     s.Song.Name,
+		"artist":   s.Song.Artist,
+		"duration": s.Song.Duration,
+		"cursor":   s.Cursor,
+		"timed":    timed,
+		"lines":    lines,
+		"lrc":      lyrics.Export(s.lyric(), lyrics.FormatLRC),
+	}
+}
+
+func cleanupLyricAuthorSessions(now time.Time) {
+	for id, sess := range lyricAuthorSessions {
+		if now.Sub(sess.LastActive) > lyricAuthorSessionMaxIdle {
+			delete(lyricAuthorSessions, id)
+		}
+	}
+}
+
+// withLyricAuthorSession runs fn on the session named in the path while holding
+// the session lock, answering 404 when it is unknown or expired.
+func withLyricAuthorSession(c *gin.Context, fn func(*lyricAuthorSession)) {
+	lyricAuthorMu.Lock()
+	defer lyricAuthorMu.Unlock()
+	cleanupLyricAuthorSessions(time.Now())
+	sess, ok := lyricAuthorSessions[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "歌词制作会话不存在或已过期"})
+		return
+	}
+	sess.LastActive = time.Now()
+	fn(sess)
+}
+
+// currentSongLyricText loads the lyric the song shows today, used as the
+// starting text when none is submitted.
+func currentSongLyricText(song *model.Song) string {
+	if isLocalMusicSource(song.Source) {
+		track, err := localMusicTrackByID(song.ID)
+		if err != nil {
+			return ""
+		}
+		text, _ := readLocalMusicLyrics(track.absPath)
+		return text
+	}
+	resolved, err := lyricResolver(song)
+	if err != nil || resolved == nil {
+		return ""
+	}
+	return resolved.Lyric
+}
+
+// RegisterLyricAuthorRoutes exposes the tap-to-time lyric authoring workflow.
+// A session holds plain lines; taps record when each line starts, untimed lines
+// can be spread over the song, and the result is saved as the song's lyric
+// override or written as an .lrc next to a local file.
+func RegisterLyricAuthorRoutes(api *gin.RouterGroup) {
+	authorAPI := api.Group("/api/lyric_author")
+
+	authorAPI.POST("", func(c *gin.Context) {
+		var req lyricAuthorCreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+		song := model.Song{
+			ID:       strings.TrimSpace(req.ID),
+			Source:   strings.TrimSpace(req.Source),
+			Name:     strings.TrimSpace(req.Name),
+			Artist:   strings.TrimSpace(req.Artist),
+			Duration: req.Duration,
+		}
+		if song.ID == "" || song.Source == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少歌曲来源或 ID"})
+			return
+		}
+		if song.Duration < 0 {
+			song.Duration = 0
+		}
+
+		text := req.Text
+		if strings.TrimSpace(text) == "" {
+			text = currentSongLyricText(&song)
+		}
+		lines := lyrics.PlainLines(text)
+		if len(lines) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "歌词文本为空"})
+			return
+		}
+		if len(lines) > lyricAuthorMaxLines {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "歌词行数过多"})
+			return
+		}
+
+		token, err := randomToken(12)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
+			return
+		}
+		stamps := make([]int, len(lines))
+		for i := range stamps {
+			stamps[i] = lyrics.Untimed
+		}
+		sess := &lyricAuthorSession{ID: token, Song: song, Lines: lines, Stamps: stamps, LastActive: time.Now()}
+
+		lyricAuthorMu.Lock()
+		cleanupLyricAuthorSessions(time.Now())
+		lyricAuthorSessions[sess.ID] = sess
+		state := sess.state()
+		lyricAuthorMu.Unlock()
+		c.JSON(http.StatusOK, state)
+	})
+
+	authorAPI.GET("/:id", func(c *gin.Context) {
+		withLyricAuthorSession(c, func(sess *lyricAuthorSession) {
+			c.JSON(http.StatusOK, sess.state())
+		})
+	})
+
+	authorAPI.DELETE("/:id", func(c *gin.Context) {
+		withLyricAuthorSession(c, func(sess *lyricAuthorSession) {
+			delete(lyricAuthorSessions, sess.ID)
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		})
+	})
+
+	// tap 记录某一行的开始时间；不传 line 时记录到当前光标行，time_ms 为负数时清除该行时间。
+	authorAPI.POST("/:id/tap", func(c *gin.Context) {
+		var req lyricAuthorTapRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+		withLyricAuthorSession(c, func(sess *lyricAuthorSession) {
+			line := sess.Cursor
+			if req.Line != nil {
+				line = *req.Line
+			}
+			if line < 0 || line >= len(sess.Lines) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "歌词行不存在"})
+				return
+			}
+			if req.TimeMs < 0 {
+				sess.Stamps[line] = lyrics.Untimed
+				sess.Cursor = line
+			} else {
+				sess.Stamps[line] = req.TimeMs
+				sess.Cursor = min(line+1, len(sess.Lines))
+			}
+			c.JSON(http.StatusOK, sess.state())
+		})
+	})
+
+	authorAPI.POST("/:id/distribute", func(c *gin.Context) {
+		withLyricAuthorSession(c, func(sess *lyricAuthorSession) {
+			sess.Stamps = lyrics.Distribute(sess.Stamps, sess.durationMs())
+			sess.Cursor = len(sess.Lines)
+			c.JSON(http.StatusOK, sess.state())
+		})
+	})
+
+	authorAPI.POST("/:id/save", func(c *gin.Context) {
+		withLyricAuthorSession(c, func(sess *lyricAuthorSession) {
+			override, err := songOverrideGet(sess.Song.Source, sess.Song.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "读取覆盖信息失败"})
+				return
+			}
+			if override == nil {
+				override = &core.SongOverride{Source: sess.Song.Source, SongID: sess.Song.ID}
+			}
+			// The taps were made against the audio, so any earlier offset no longer applies.
+			override.Lyric = lyrics.Export(sess.lyric(), lyrics.FormatLRC)
+			override.LyricOffsetMs = 0
+			if err := songOverrideSave(override); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败: " + err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, override)
+		})
+	})
+
+	authorAPI.POST("/:id/export", func(c *gin.Context) {
+		withLyricAuthorSession(c, func(sess *lyricAuthorSession) {
+			if !isLocalMusicSource(sess.Song.Source) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "仅本地音乐支持导出歌词文件"})
+				return
+			}
+			track, err := localMusicTrackByID(sess.Song.ID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "本地音乐不存在"})
+				return
+			}
+			lrcPath, err := writeLocalMusicLRC(track, lyrics.Export(sess.lyric(), lyrics.FormatLRC), c.Query("overwrite") == "1")
+			if os.IsExist(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "歌词文件已存在"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败: " + err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "ok", "filename": filepath.Base(lrcPath)})
+		})
+	})
+}
+
+// writeLocalMusicLRC writes the lyric as an .lrc with the audio file's base name
+// and refreshes the track's cached lyric flags.
+func writeLocalMusicLRC(track *localMusicTrack, lrc string, overwrite bool) (string, error) {
+	lrcPath := strings.TrimSuffix(track.absPath, filepath.Ext(track.absPath)) + ".lrc"
+	if existing, _, ok := localMusicExactSidecarFile(track.absPath, []string{".lrc", ".LRC"}); ok {
+		if !overwrite {
+			return "", os.ErrExist
+		}
+		lrcPath = existing
+	}
+	if err := os.WriteFile(lrcPath, []byte(lrc+"\n"), 0644); err != nil {
+		return "", err
+	}
+
+	if track.Extra == nil {
+		track.Extra = map[string]string{}
+	}
+	if track.Extra["lyric"] != "true" {
+		track.Extra["lyric"] = "true"
+		track.Extra["lyric_source"] = "sidecar"
+	}
+	cacheLocalMusicTrack(localMusicRootForPath(track.absPath), track)
+	upsertLocalMusicIndexRow(track)
+	invalidateLocalMusicScanCache()
+	return lrcPath, nil
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLyricAuthorSessionTapsSavesAndExports(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	audioPath := filepath.Join(downloadDir, "Song - Artist.mp3")
+	if err := os.WriteFile(audioPath, []byte("audio"), 0644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	localID := encodeLocalMusicID("Song - Artist.mp3")
+
+	router := newLocalMusicTestRouter()
+	RegisterLyricAuthorRoutes(router.Group(RoutePrefix))
+
+	send := func(method, path string, body any) (*httptest.ResponseRecorder, map[string]any) {
+		var payload bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&payload).Encode(body)
+		}
+		req := httptest.NewRequest(method, RoutePrefix+path, &payload)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var state map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &state)
+		return rec, state
+	}
+
+	rec, state := send(http.MethodPost, "/api/lyric_author", map[string]any{
+		"source": "local", "id": localID, "name": "Song", "duration": 10, "text": "第一句\n第二句\n\n第三句\n第四句",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body.String())
+	}
+	sessionPath := "/api/lyric_author/" + state["id"].(string)
+
+	send(http.MethodPost, sessionPath+"/tap", map[string]any{"time_ms": 1000})
+	rec, state = send(http.MethodPost, sessionPath+"/tap", map[string]any{"line": 2, "time_ms": 5000})
+	if rec.Code != http.StatusOK || state["cursor"].(float64) != 3 || state["timed"].(float64) != 2 {
+		t.Fatalf("tap state = %d %v", rec.Code, state)
+	}
+	if rec, _ := send(http.MethodPost, sessionPath+"/tap", map[string]any{"line": 9, "time_ms": 1}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("tap on missing line status = %d, want 400", rec.Code)
+	}
+
+	_, state = send(http.MethodPost, sessionPath+"/distribute", nil)
+	const wantLRC = "[ti:Song]\n[00:01.00]第一句\n[00:03.00]第二句\n[00:05.00]第三句\n[00:07.50]第四句"
+	if state["lrc"] != wantLRC {
+		t.Fatalf("lrc = %q, want %q", state["lrc"], wantLRC)
+	}
+
+	if rec, _ := send(http.MethodPost, sessionPath+"/save", nil); rec.Code != http.StatusOK {
+		t.Fatalf("save status = %d: %s", rec.Code, rec.Body.String())
+	}
+	rec, _ = send(http.MethodGet, "/lyric?source=local&id="+localID, nil)
+	if rec.Body.String() != wantLRC || rec.Header().Get("X-Lyric-Override") != "1" {
+		t.Fatalf("/lyric after save = %q (override header %q)", rec.Body.String(), rec.Header().Get("X-Lyric-Override"))
+	}
+
+	if rec, _ := send(http.MethodPost, sessionPath+"/export", nil); rec.Code != http.StatusOK {
+		t.Fatalf("export status = %d: %s", rec.Code, rec.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(downloadDir, "Song - Artist.lrc"))
+	if err != nil || strings.TrimSpace(string(data)) != wantLRC {
+		t.Fatalf("exported lrc = %q, %v", data, err)
+	}
+	if rec, _ := send(http.MethodPost, sessionPath+"/export", nil); rec.Code != http.StatusConflict {
+		t.Fatalf("second export status = %d, want 409", rec.Code)
+	}
+	if rec, _ := send(http.MethodPost, sessionPath+"/export?overwrite=1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("overwrite export status = %d", rec.Code)
+	}
+
+	if rec, _ := send(http.MethodDelete, sessionPath, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if rec, _ := send(http.MethodGet, sessionPath, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("get after delete status = %d, want 404", rec.Code)
+	}
+}
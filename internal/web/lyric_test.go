@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
 )
 
 func TestLyricEndpointReturnsReadableFallbackWhenLyricMissing(t *testing.T) {
@@ -27,3 +29,33 @@ func TestLyricEndpointReturnsReadableFallbackWhenLyricMissing(t *testing.T) {
 		t.Fatalf("body = %q, want %q", got, want)
 	}
 }
+
+func TestLyricEndpointReportsFallbackSource(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldResolver := lyricResolver
+	lyricResolver = func(song *model.Song) (*core.ResolvedLyric, error) {
+		if song.Source != "netease" || song.Name != "晴天" {
+			t.Fatalf("resolver got song %+v", song)
+		}
+		return &core.ResolvedLyric{Lyric: "[00:01.00]晴天", Source: "qq", SongID: "q1", Fallback: true}, nil
+	}
+	defer func() { lyricResolver = oldResolver }()
+
+	router := gin.New()
+	RegisterMusicRoutes(router.Group(RoutePrefix), router.Group(RoutePrefix))
+
+	req := httptest.NewRequest(http.MethodGet, RoutePrefix+"/lyric?id=1&source=netease&name=%E6%99%B4%E5%A4%A9", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "[00:01.00]晴天" {
+		t.Fatalf("response = %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-Lyric-Source"); got != "qq" {
+		t.Fatalf("X-Lyric-Source = %q, want qq", got)
+	}
+	if got := rec.Header().Get("X-Lyric-Song-Id"); got != "q1" {
+		t.Fatalf("X-Lyric-Song-Id = %q, want q1", got)
+	}
+}
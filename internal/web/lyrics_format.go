@@ -1,102 +1,111 @@
 package web
 
 import (
-	"regexp"
-	"sort"
+	"net/http"
 	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
+	"github.com/guohuiyuan/music-lib/model"
 )
 
 const (
-	lyricFormatKaraoke = "karaoke"
-	lyricFormatLine    = "line"
+	lyricFormatKaraoke      = "karaoke"
+	lyricFormatLine         = "line"
+	lyricFormatRomanization = "roma"
 )
 
-var (
-	lrcTimestampRe = regexp.MustCompile(`\[(\d+):(\d+)\.(\d{1,3})\]`)
-	lrcTagLineRe   = regexp.MustCompile(`^\[[A-Za-z]+:[^\]]*\]$`)
-)
+var lyricResolver = core.ResolveLyric
 
-func classifyLyricFormat(raw string) string {
-	startCounts := map[string]int{}
-	for _, rawLine := range strings.Split(raw, "\n") {
-		line := strings.TrimSpace(rawLine)
-		if line == "" || lrcTagLineRe.MatchString(line) {
-			continue
-		}
-		matches := lrcTimestampRe.FindAllStringIndex(line, -1)
-		if len(matches) == 0 {
-			continue
-		}
-		if len(matches) > 1 {
-			return lyricFormatKaraoke
-		}
-		start := line[matches[0][0]:matches[0][1]]
-		startCounts[start]++
-		if startCounts[start] > 1 {
-			return lyricFormatKaraoke
-		}
+// resolveLyricForRequest fetches the lyric through the cross-source resolver and
+// reports where it came from in X-Lyric-Source (and X-Lyric-Song-Id when
+// another source supplied it). X-Lyric-Override marks a user override.
+func resolveLyricForRequest(c *gin.Context, song *model.Song) (string, bool) {
+	resolved, err := lyricResolver(song)
+	if err != nil || resolved == nil || strings.TrimSpace(resolved.Lyric) == "" {
+		return "", false
 	}
-	return lyricFormatLine
+	c.Header("X-Lyric-Source", resolved.Source)
+	if resolved.Fallback {
+		c.Header("X-Lyric-Song-Id", resolved.SongID)
+	}
+	if resolved.Overridden {
+		c.Header("X-Lyric-Override", "1")
+	}
+	return resolved.Lyric, true
 }
 
-func formatLyricForMode(raw string, mode string) string {
-	if strings.EqualFold(mode, lyricFormatLine) {
-		return lyricOriginalLineOnly(raw)
+func classifyLyricFormat(raw string) string {
+	if lyrics.Parse(raw).HasWords() {
+		return lyricFormatKaraoke
 	}
-	return raw
+	return lyricFormatLine
 }
 
-func lyricOriginalLineOnly(raw string) string {
-	seenStarts := map[string]struct{}{}
-	type lyricLine struct {
-		start string
-		text  string
+// lyricOptionsFromQuery reads ?mode=, ?sep= and ?roma=. The second result is
+// false when no mode was requested, so the source lyric is served as is.
+func lyricOptionsFromQuery(c *gin.Context) (*lyrics.Options, bool) {
+	rawMode := strings.TrimSpace(c.Query("mode"))
+	if rawMode == "" {
+		return nil, true
 	}
-	var tags []string
-	var lines []lyricLine
-
-	for _, rawLine := range strings.Split(raw, "\n") {
-		line := strings.TrimSpace(rawLine)
-		if line == "" {
-			continue
-		}
-		if lrcTagLineRe.MatchString(line) {
-			tags = append(tags, line)
-			continue
-		}
-		matches := lrcTimestampRe.FindAllStringIndex(line, -1)
-		if len(matches) == 0 {
-			continue
-		}
-		start := line[matches[0][0]:matches[0][1]]
-		if _, ok := seenStarts[start]; ok {
-			continue
-		}
-		seenStarts[start] = struct{}{}
+	mode, err := lyrics.ParseMode(rawMode)
+	if err != nil {
+		c.String(http.StatusBadRequest, "不支持的歌词显示模式")
+		return nil, false
+	}
+	roma := c.Query("roma")
+	return &lyrics.Options{
+		Mode:         mode,
+		Separator:    c.Query("sep"),
+		Romanization: roma == "1" || strings.EqualFold(roma, "true"),
+	}, true
+}
 
-		text := strings.TrimSpace(lrcTimestampRe.ReplaceAllString(line, ""))
-		if text == "" {
-			continue
+// formatLyricForMode applies ?format= (line strips word timing, roma adds a
+// generated romanization layer) and the layer options. Line format without
+// options keeps only the original layer; roma without options stacks the
+// romanization under the original and keeps word timing.
+func formatLyricForMode(raw string, format string, opts *lyrics.Options) string {
+	if strings.EqualFold(format, lyricFormatRomanization) {
+		withRoma := lyrics.Options{Mode: lyrics.ModeStacked}
+		if opts != nil {
+			withRoma = *opts
 		}
-		lines = append(lines, lyricLine{start: start, text: text})
+		withRoma.Romanization = true
+		return lyrics.FormatMode(lyrics.WithRomanization(raw), withRoma, true)
+	}
+	line := strings.EqualFold(format, lyricFormatLine)
+	switch {
+	case opts != nil:
+		return lyrics.FormatMode(raw, *opts, !line)
+	case line:
+		return lyricOriginalLineOnly(raw)
+	default:
+		return raw
 	}
+}
 
-	sort.SliceStable(lines, func(i, j int) bool {
-		return lines[i].start < lines[j].start
-	})
+func lyricOriginalLineOnly(raw string) string {
+	return lyrics.FormatMode(raw, lyrics.Options{Mode: lyrics.ModeOriginal}, false)
+}
 
-	var b strings.Builder
-	for _, tag := range tags {
-		b.WriteString(tag)
-		b.WriteByte('\n')
+// lyricTargetFromQuery reads the ?target= export format of /download_lrc and
+// answers 400 when it is not supported.
+func lyricTargetFromQuery(c *gin.Context) (lyrics.Format, bool) {
+	target, err := lyrics.ParseFormat(c.Query("target"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "不支持的歌词格式")
+		return "", false
 	}
-	if len(tags) > 0 && len(lines) > 0 {
-		b.WriteByte('\n')
-	}
-	for _, line := range lines {
-		b.WriteString(line.start)
-		b.WriteString(line.text)
-		b.WriteByte('\n')
+	return target, true
+}
+
+// convertLyricForTarget keeps LRC downloads byte for byte and converts others.
+func convertLyricForTarget(raw string, target lyrics.Format) string {
+	if target == lyrics.FormatLRC {
+		return raw
 	}
-	return strings.TrimRight(b.String(), "\n")
+	return lyrics.Convert(raw, target)
 }
@@ -3,6 +3,8 @@ package web
 import (
 	"strings"
 	"testing"
+
+	"github.com/guohuiyuan/go-music-dl/core/lyrics"
 )
 
 func TestClassifyLyricFormat(t *testing.T) {
@@ -29,3 +31,34 @@ func TestLyricOriginalLineOnly(t *testing.T) {
 		t.Fatalf("line-only lyric still contains translation or word timestamp:\n%s", got)
 	}
 }
+
+func TestClassifyLyricFormatIgnoresTranslationLines(t *testing.T) {
+	bilingual := "[00:01.00]你好\n[00:01.00]hello\n[00:02.00]世界\n[00:02.00]world"
+	if got := classifyLyricFormat(bilingual); got != lyricFormatLine {
+		t.Fatalf("bilingual line lyric format = %q, want %q", got, lyricFormatLine)
+	}
+}
+
+func TestFormatLyricForModeAppliesLayerOptions(t *testing.T) {
+	raw := "[00:01.00]你[00:01.50]好[00:02.00]\n[00:01.00]hello"
+	tests := []struct {
+		name   string
+		format string
+		opts   *lyrics.Options
+		want   string
+	}{
+		{name: "auto without mode keeps source", format: "auto", want: raw},
+		{name: "line without mode keeps original", format: "line", want: "[00:01.00]你好"},
+		{name: "line translation", format: "line", opts: &lyrics.Options{Mode: lyrics.ModeTranslation}, want: "[00:01.00]hello"},
+		{name: "auto side by side", format: "auto", opts: &lyrics.Options{Mode: lyrics.ModeSideBySide}, want: "[00:01.00]你好 / hello"},
+		{name: "roma stacks generated pinyin", format: "roma", want: "[00:01.00]你[00:01.50]好[00:02.00]\n[00:01.00]nǐ hǎo\n[00:01.00]hello"},
+		{name: "roma original", format: "roma", opts: &lyrics.Options{Mode: lyrics.ModeOriginal}, want: "[00:01.00]你[00:01.50]好[00:02.00]\n[00:01.00]nǐ hǎo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatLyricForMode(raw, tt.format, tt.opts); got != tt.want {
+				t.Fatalf("formatLyricForMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -586,6 +586,9 @@ func RegisterMusicRoutes(api, configAPI *gin.RouterGroup) {
 		if searchType == "song" && exactArtist != "" && len(allSongs) > 0 {
 			allSongs = filterSongsByExactArtist(allSongs, exactArtist)
 		}
+		if filter := parseSongAnnotationFilter(c); searchType == "song" && filter.active() {
+			allSongs = filter.songs(annotateSearchSongs(allSongs))
+		}
 
 		renderIndex(c, allSongs, allPlaylists, keyword, sources, errorMsg, searchType, "", "", "", false, "", importCollection)
 	})
@@ -632,6 +635,7 @@ func RegisterMusicRoutes(api, configAPI *gin.RouterGroup) {
 		if err != nil {
 			errMsg = fmt.Sprintf("获取专辑失败: %v", err)
 		}
+		songs = core.ApplyAlbumTrackMetadata(songs)
 		albumLink := core.GetOriginalLink(src, id, "album")
 		importCollection := importCollectionFromQuery(c, collectionContentAlbum, src, id, albumLink, len(songs))
 		renderIndex(c, songs, nil, "", []string{src}, errMsg, "album", albumLink, "", "", false, "", importCollection)
@@ -832,7 +836,7 @@ func RegisterMusicRoutes(api, configAPI *gin.RouterGroup) {
 			// 加载 SQLite 去重集合。
 			allSongsSet, _ := core.LoadDownloadDedupSet()
 
-			result, err := core.DownloadWithDedupCheckWithTemplate(tempSong, settings.DownloadDir, embedMeta, embedMeta, settings.DownloadFilenameTemplate, allSongsSet)
+			result, err := core.DownloadWithDedupCheckToTarget(tempSong, core.WebDownloadTarget(settings), embedMeta, embedMeta, allSongsSet)
 			if err != nil {
 				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 				return
@@ -848,6 +852,9 @@ func RegisterMusicRoutes(api, configAPI *gin.RouterGroup) {
 			if result.Warning != "" {
 				payload["warning"] = result.Warning
 			}
+			if result.Route != "" {
+				payload["route"] = result.Route
+			}
 			c.JSON(200, payload)
 			return
 		}
@@ -998,8 +1005,6 @@ func RegisterMusicRoutes(api, configAPI *gin.RouterGroup) {
 
 	downloadLRCHandler := func(c *gin.Context) {
 		song := lyricSongFromQuery(c)
-		name := song.Name
-		artist := song.Artist
 		saveLocal := wantsSaveLocal(c)
 		if saveLocal && !allowSaveLocalRequest(c) {
 			return
@@ -1010,27 +1015,32 @@ func RegisterMusicRoutes(api, configAPI *gin.RouterGroup) {
 			return
 		}
 
-		fn := core.GetLyricFunc(song.Source)
-		if fn == nil {
-			c.String(404, "No support")
+		target, ok := lyricTargetFromQuery(c)
+		if !ok {
+			return
+		}
+		lyricOpts, ok := lyricOptionsFromQuery(c)
+		if !ok {
 			return
 		}
 
-		lrc, err := fn(song)
-		if err != nil || lrc == "" {
+		lrc, ok := resolveLyricForRequest(c, song)
+		if !ok {
 			c.String(404, "Lyric not found")
 			return
 		}
-		lrc = formatLyricForMode(lrc, c.DefaultQuery("format", "auto"))
+		lrc = formatLyricForMode(lrc, c.DefaultQuery("format", "auto"), lyricOpts)
 		c.Header("X-Lyric-Format", classifyLyricFormat(lrc))
 
-		filename := fmt.Sprintf("%s - %s.lrc", name, artist)
+		core.ApplySongOverride(song)
+		filename := fmt.Sprintf("%s - %s.%s", song.Name, song.Artist, target.Ext())
+		data := []byte(convertLyricForTarget(lrc, target))
 		if saveLocal {
-			saveWebAssetResponse(c, filename, []byte(lrc))
+			saveWebAssetResponse(c, filename, data)
 			return
 		}
 		setDownloadHeader(c, filename)
-		c.String(200, lrc)
+		c.Data(200, target.ContentType(), data)
 	}
 	api.GET("/download_lrc", downloadLRCHandler)
 	api.POST("/download_lrc", downloadLRCHandler)
@@ -1084,16 +1094,16 @@ func RegisterMusicRoutes(api, configAPI *gin.RouterGroup) {
 			serveLocalMusicLyric(c, song, false)
 			return
 		}
+		lyricOpts, ok := lyricOptionsFromQuery(c)
+		if !ok {
+			return
+		}
 
-		fn := core.GetLyricFunc(song.Source)
-		if fn != nil {
-			lrc, _ := fn(song)
-			if lrc != "" {
-				lrc = formatLyricForMode(lrc, c.DefaultQuery("format", "auto"))
-				c.Header("X-Lyric-Format", classifyLyricFormat(lrc))
-				c.String(200, lrc)
-				return
-			}
+		if lrc, ok := resolveLyricForRequest(c, song); ok {
+			lrc = formatLyricForMode(lrc, c.DefaultQuery("format", "auto"), lyricOpts)
+			c.Header("X-Lyric-Format", classifyLyricFormat(lrc))
+			c.String(200, lrc)
+			return
 		}
 		c.String(200, "[00:00.00] 纯音乐 / 无歌词")
 	})
@@ -0,0 +1,258 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+)
+
+var playlistFileSettings = core.GetWebSettings
+
+// playlistFileSong is one song of a batch download, in playlist order. Path is
+// where the download was saved; local songs resolve by ID and the rest are
+// looked up in the local music index.
+type playlistFileSong struct {
+	ID       string `json:"id"`
+	Source   string `json:"source"`
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Duration int    `json:"duration"`
+}
+
+type playlistFilesRequest struct {
+	Name    string             `json:"name"`
+	Formats string             `json:"formats"`
+	Songs   []playlistFileSong `json:"songs"`
+}
+
+// PlaylistFilesResult reports the playlist files written for a collection or
+// batch download, and the songs that had no local file.
+type PlaylistFilesResult struct {
+	Files   []string `json:"files"`
+	Entries int      `json:"entries"`
+	Missing []string `json:"missing"`
+}
+
+// playlistFileFormats parses the requested formats, falling back to the
+// playlistFileFormats setting.
+func playlistFileFormats(requested string) ([]core.PlaylistFormat, error) {
+	if strings.TrimSpace(requested) == "" {
+		requested = playlistFileSettings().PlaylistFileFormats
+	}
+	return core.ParsePlaylistFormats(requested)
+}
+
+func playlistSongLabel(name, artist string) string {
+	if artist == "" {
+		return name
+	}
+	return name + " - " + artist
+}
+
+// localPlaylistEntry finds the local file of a song: its track for local
+// songs, the given path when it lies in a scanned root, then the local music
+// index.
+func localPlaylistEntry(song playlistFileSong) (core.PlaylistEntry, bool) {
+	entry := core.PlaylistEntry{Title: song.Name, Artist: song.Artist, Album: song.Album, Duration: song.Duration}
+	if isLocalMusicSource(song.Source) {
+		track, err := localMusicTrackByID(song.ID)
+		if err != nil {
+			return entry, false
+		}
+		entry.Path = track.absPath
+		if entry.Duration <= 0 {
+			entry.Duration = track.Duration
+		}
+		return entry, true
+	}
+	if path := strings.TrimSpace(song.Path); path != "" {
+		if abs, err := filepath.Abs(path); err == nil && localMusicPathInRoots(abs) {
+			if info, statErr := os.Stat(abs); statErr == nil && !info.IsDir() {
+				entry.Path = abs
+				return entry, true
+			}
+		}
+	}
+	row, absPath, err := findLocalMusicMatch(song.Name, song.Artist)
+	if err != nil || row == nil {
+		return entry, false
+	}
+	entry.Path = absPath
+	if entry.Album == "" {
+		entry.Album = row.Album
+	}
+	if entry.Duration <= 0 {
+		entry.Duration = row.Duration
+	}
+	return entry, true
+}
+
+func localMusicPathInRoots(absPath string) bool {
+	for _, root := range localMusicRoots() {
+		if isPathInside(root.Abs, absPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func resolvePlaylistFileEntries(songs []playlistFileSong) ([]core.PlaylistEntry, []string) {
+	entries := make([]core.PlaylistEntry, 0, len(songs))
+	missing := make([]string, 0)
+	for _, song := range songs {
+		song.Name = strings.TrimSpace(song.Name)
+		song.Artist = strings.TrimSpace(song.Artist)
+		entry, ok := localPlaylistEntry(song)
+		if !ok {
+			missing = append(missing, playlistSongLabel(song.Name, song.Artist))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, missing
+}
+
+// collectionPlaylistSongs lists a manual or smart collection's songs in
+// display order.
+func collectionPlaylistSongs(collection *Collection) ([]playlistFileSong, error) {
+	if collection.isImported() {
+		return nil, errors.New("导入的歌单没有本地歌曲，请先收藏到自建歌单")
+	}
+	songs, err := loadCollectionSongs(collection)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]playlistFileSong, 0, len(songs))
+	for _, song := range songs {
+		out = append(out, playlistFileSong{
+			ID: song.ID, Source: song.Source, Name: song.Name, Artist: song.Artist, Album: song.Album, Duration: song.Duration,
+		})
+	}
+	return out, nil
+}
+
+// writePlaylistFiles writes the playlist next to its songs. When the songs
+// span several roots the download directory is used instead of a common
+// ancestor outside every root.
+func writePlaylistFiles(name string, songs []playlistFileSong, formats []core.PlaylistFormat, dir string) (*PlaylistFilesResult, error) {
+	entries, missing := resolvePlaylistFileEntries(songs)
+	result := &PlaylistFilesResult{Entries: len(entries), Missing: missing, Files: []string{}}
+	if len(entries) == 0 {
+		return result, errors.New("没有找到已保存到本地的歌曲")
+	}
+	if dir == "" {
+		dir = core.PlaylistDir(entries)
+		if !localMusicPathInRoots(dir) {
+			dir = localMusicRoots()[0].Abs
+		}
+	}
+	files, err := core.WritePlaylistFiles(dir, name, entries, formats)
+	if err != nil {
+		return result, err
+	}
+	result.Files = files
+	return result, nil
+}
+
+// findCollectionByRef loads a collection by ID or exact name.
+func findCollectionByRef(ref string) (*Collection, error) {
+	ref = strings.TrimSpace(ref)
+	if _, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		if collection, err := loadCollection(ref); err == nil {
+			return collection, nil
+		}
+	}
+	var collection Collection
+	if err := db.Where("name = ?", ref).Order("id DESC").First(&collection).Error; err != nil {
+		return nil, errors.New("歌单不存在: " + ref)
+	}
+	return &collection, nil
+}
+
+// ExportCollectionPlaylist writes playlist files for a local collection (ID or
+// name), matching its songs against a freshly synced local music index. An
+// empty dir writes next to the songs; formats defaults to the setting. InitDB
+// must have been called.
+func ExportCollectionPlaylist(ref string, formats string, dir string) (*PlaylistFilesResult, error) {
+	parsed, err := playlistFileFormats(formats)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		parsed = []core.PlaylistFormat{core.PlaylistFormatM3U8}
+	}
+	collection, err := findCollectionByRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	songs, err := collectionPlaylistSongs(collection)
+	if err != nil {
+		return nil, err
+	}
+	_ = syncLocalMusicIndex()
+	return writePlaylistFiles(collection.Name, songs, parsed, dir)
+}
+
+// RegisterPlaylistFileRoutes exposes playlist file generation:
+// POST /api/playlist_files writes a batch download's playlist, and
+// POST /collections/:id/playlist_files one for a local collection.
+func RegisterPlaylistFileRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+	api.POST("/api/playlist_files", func(c *gin.Context) {
+		var req playlistFilesRequest
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.Songs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+			return
+		}
+		formats, err := playlistFileFormats(req.Formats)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "歌单文件格式错误: " + err.Error()})
+			return
+		}
+		if len(formats) == 0 {
+			c.JSON(http.StatusOK, PlaylistFilesResult{Files: []string{}, Missing: []string{}})
+			return
+		}
+		result, err := writePlaylistFiles(strings.TrimSpace(req.Name), req.Songs, formats, "")
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "missing": result.Missing})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	colAPI.POST("/:id/playlist_files", func(c *gin.Context) {
+		collection, err := loadCollection(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "歌单不存在"})
+			return
+		}
+		formats, err := playlistFileFormats(c.Query("formats"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "歌单文件格式错误: " + err.Error()})
+			return
+		}
+		if len(formats) == 0 {
+			formats = []core.PlaylistFormat{core.PlaylistFormatM3U8}
+		}
+		songs, err := collectionPlaylistSongs(collection)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := writePlaylistFiles(collection.Name, songs, formats, "")
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "missing": result.Missing})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+}
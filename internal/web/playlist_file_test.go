@@ -0,0 +1,143 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+)
+
+func newPlaylistFileTestRouter(t *testing.T, formats string) *gin.Engine {
+	t.Helper()
+	original := playlistFileSettings
+	playlistFileSettings = func() core.WebSettings {
+		return core.WebSettings{PlaylistFileFormats: formats}
+	}
+	t.Cleanup(func() { playlistFileSettings = original })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterPlaylistFileRoutes(router.Group(""))
+	return router
+}
+
+func writePlaylistTestAudio(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte("audio"), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestPlaylistFilesEndpointWritesBatchInOrder(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	router := newPlaylistFileTestRouter(t, "m3u8,pls")
+
+	downloaded := filepath.Join(downloadDir, "通勤", "周杰伦 - 晴天.flac")
+	writePlaylistTestAudio(t, downloaded)
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "通勤", "Local Song.mp3"))
+	outside := filepath.Join(t.TempDir(), "Outside.mp3")
+	writePlaylistTestAudio(t, outside)
+
+	body, _ := json.Marshal(playlistFilesRequest{
+		Name: "通勤",
+		Songs: []playlistFileSong{
+			{ID: encodeLocalMusicID("通勤/Local Song.mp3"), Source: localMusicSource, Name: "Local Song"},
+			{Path: downloaded, Name: "晴天", Artist: "周杰伦", Duration: 269},
+			{Path: outside, Name: "Outside", Artist: "Nobody"},
+		},
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/playlist_files", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var result PlaylistFilesResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	wantFiles := []string{filepath.Join(downloadDir, "通勤", "通勤.m3u8"), filepath.Join(downloadDir, "通勤", "通勤.pls")}
+	if fmt.Sprint(result.Files) != fmt.Sprint(wantFiles) || result.Entries != 2 {
+		t.Fatalf("result = %+v, want files %v and 2 entries", result, wantFiles)
+	}
+	// Paths outside the scanned roots are never trusted.
+	if len(result.Missing) != 1 || result.Missing[0] != "Outside - Nobody" {
+		t.Fatalf("missing = %v, want [Outside - Nobody]", result.Missing)
+	}
+
+	data, err := os.ReadFile(wantFiles[0])
+	if err != nil {
+		t.Fatalf("read m3u8: %v", err)
+	}
+	want := "#EXTM3U\n#PLAYLIST:通勤\n#EXTINF:-1,Local Song\nLocal Song.mp3\n#EXTINF:269,周杰伦 - 晴天\n周杰伦 - 晴天.flac\n"
+	if string(data) != want {
+		t.Fatalf("m3u8 = %q, want %q", data, want)
+	}
+}
+
+func TestCollectionPlaylistFilesEndpointMatchesLocalIndex(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	router := newPlaylistFileTestRouter(t, "none")
+
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "A", "First.mp3"))
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "B", "Second.mp3"))
+	if err := syncLocalMusicIndex(); err != nil {
+		t.Fatalf("sync index: %v", err)
+	}
+
+	collection := Collection{Name: "Mix", Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	// Collections list newest first, so Second is saved last.
+	for _, song := range []SavedSong{
+		{CollectionID: collection.ID, SongID: "1", Source: "qq", Name: "First", Artist: "未知歌手"},
+		{CollectionID: collection.ID, SongID: "2", Source: "qq", Name: "Second", Artist: "未知歌手"},
+		{CollectionID: collection.ID, SongID: "3", Source: "qq", Name: "Missing", Artist: "Nobody"},
+	} {
+		if err := db.Create(&song).Error; err != nil {
+			t.Fatalf("create saved song: %v", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/collections/%d/playlist_files?formats=xspf", collection.ID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var result PlaylistFilesResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0] != filepath.Join(downloadDir, "Mix.xspf") || len(result.Missing) != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	data, err := os.ReadFile(result.Files[0])
+	if err != nil {
+		t.Fatalf("read xspf: %v", err)
+	}
+	second, first := strings.Index(string(data), "B/Second.mp3"), strings.Index(string(data), "A/First.mp3")
+	if second < 0 || first < 0 || second > first {
+		t.Fatalf("xspf should list Second before First:\n%s", data)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/collections/999/playlist_files", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown collection status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,295 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// ==========================================
+// 导入 M3U / XSPF / PLS 歌单文件为本地歌单
+// ==========================================
+
+// playlistImportSearch finds an online song for an entry with no local file.
+var playlistImportSearch = func(name, artist string, duration int) (*model.Song, error) {
+	song, _, err := findBestSwitchSong(name, artist, "", "", duration)
+	return song, err
+}
+
+// PlaylistImportOptions controls ImportPlaylistFile.
+type PlaylistImportOptions struct {
+	Name    string // collection name, the playlist title when empty
+	BaseDir string // directory of the playlist file, resolves relative paths
+	Online  bool   // search online for entries without a local file
+}
+
+// PlaylistImportEntry is a playlist entry that matched nothing.
+type PlaylistImportEntry struct {
+	Index    int    `json:"index"`
+	Location string `json:"location"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+}
+
+// PlaylistImportResult reports how the entries of an imported file matched.
+type PlaylistImportResult struct {
+	CollectionID uint                  `json:"collection_id,omitempty"`
+	Name         string                `json:"name"`
+	Format       string                `json:"format"`
+	Total        int                   `json:"total"`
+	ByPath       int                   `json:"by_path"`
+	ByTag        int                   `json:"by_tag"`
+	Online       int                   `json:"online"`
+	Duplicate    int                   `json:"duplicate"`
+	Unmatched    []PlaylistImportEntry `json:"unmatched"`
+}
+
+// ImportPlaylistFile parses a playlist file and saves its entries as a new
+// manual collection. Entries are matched against the local music index by
+// path, then by title and artist, then optionally by online search. InitDB
+// must have been called.
+func ImportPlaylistFile(filename string, data []byte, opts PlaylistImportOptions) (*PlaylistImportResult, error) {
+	parsed, err := core.ParsePlaylistFile(filename, data)
+	if err != nil {
+		return nil, errors.New("歌单文件解析失败: " + err.Error())
+	}
+	_ = syncLocalMusicIndex()
+
+	name := strings.TrimSpace(opts.Name)
+	if name == "" {
+		name = parsed.Title
+	}
+	result := &PlaylistImportResult{
+		Name: name, Format: string(parsed.Format), Total: len(parsed.Entries), Unmatched: []PlaylistImportEntry{},
+	}
+
+	songs := make([]*SavedSong, len(parsed.Entries))
+	var pending []int
+	for i, entry := range parsed.Entries {
+		if track := matchPlaylistEntryByPath(entry.Path, opts.BaseDir); track != nil {
+			songs[i] = savedSongFromLocalTrack(track)
+			result.ByPath++
+			continue
+		}
+		title, artist := core.PlaylistEntryTitle(entry)
+		if title != "" {
+			if row, _, err := findLocalMusicMatch(title, artist); err == nil && row != nil {
+				if track, err := localMusicTrackByID(row.ID); err == nil {
+					songs[i] = savedSongFromLocalTrack(track)
+					result.ByTag++
+					continue
+				}
+			}
+		}
+		pending = append(pending, i)
+	}
+
+	if opts.Online && len(pending) > 0 {
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			slots = make(chan struct{}, collectionResolveWorkers)
+		)
+		for _, i := range pending {
+			title, artist := core.PlaylistEntryTitle(parsed.Entries[i])
+			if title == "" {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, title, artist string) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				song, err := playlistImportSearch(title, artist, parsed.Entries[i].Duration)
+				if err != nil || song == nil {
+					return
+				}
+				saved := savedSongFromModel(song)
+				mu.Lock()
+				songs[i] = saved
+				result.Online++
+				mu.Unlock()
+			}(i, title, artist)
+		}
+		wg.Wait()
+	}
+
+	for i, entry := range parsed.Entries {
+		if songs[i] != nil {
+			continue
+		}
+		title, artist := core.PlaylistEntryTitle(entry)
+		result.Unmatched = append(result.Unmatched, PlaylistImportEntry{
+			Index: i + 1, Location: entry.Path, Title: title, Artist: artist,
+		})
+	}
+	if len(result.Unmatched) == result.Total {
+		return result, errors.New("没有匹配到任何歌曲")
+	}
+
+	var existing int64
+	db.Model(&Collection{}).Where("name = ?", result.Name).Count(&existing)
+	if existing > 0 {
+		result.Name = uniqueCollectionName(result.Name)
+	}
+	collection := Collection{
+		Name: result.Name, Description: "导入自 " + filepath.Base(filename),
+		Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local",
+	}
+	if err := db.Create(&collection).Error; err != nil {
+		return result, err
+	}
+	result.CollectionID = collection.ID
+
+	// A song listed twice keeps its first position.
+	seen := map[string]bool{}
+	for i, song := range songs {
+		if song == nil {
+			continue
+		}
+		key := song.Source + "\x00" + song.SongID
+		if seen[key] {
+			songs[i] = nil
+			result.Duplicate++
+		}
+		seen[key] = true
+	}
+
+	now := time.Now()
+	rows := make([]SavedSong, 0, len(songs))
+	for _, song := range songs {
+		if song == nil {
+			continue
+		}
+		song.CollectionID = collection.ID
+		song.AddedAt = now
+		rows = append(rows, *song)
+	}
+	if _, err := insertSavedSongs(rows); err != nil {
+		db.Delete(&collection)
+		return result, err
+	}
+	return result, nil
+}
+
+// matchPlaylistEntryByPath finds the local track a playlist location points
+// at. Absolute paths (or paths relative to baseDir) must lie in a scanned
+// root; other paths match the end of an indexed track's path, which covers
+// playlists copied from another machine with a similar folder layout.
+func matchPlaylistEntryByPath(location, baseDir string) *localMusicTrack {
+	if location == "" || strings.Contains(location, "://") {
+		return nil
+	}
+	native := filepath.FromSlash(location)
+	abs := ""
+	switch {
+	case filepath.IsAbs(native):
+		abs = native
+	case baseDir != "":
+		abs = filepath.Join(baseDir, native)
+	}
+	if abs != "" {
+		for _, root := range localMusicRoots() {
+			if !isPathInside(root.Abs, abs) {
+				continue
+			}
+			rel, err := filepath.Rel(root.Abs, abs)
+			if err != nil {
+				continue
+			}
+			if track, err := localMusicTrackByID(encodeLocalMusicID(root.Prefix + filepath.ToSlash(rel))); err == nil {
+				return track
+			}
+		}
+	}
+
+	// Try the longest tail first: "old/Music/A/x.mp3", then "Music/A/x.mp3"
+	// down to "A/x.mp3"; a file name alone is too ambiguous unless that is
+	// all the entry has.
+	segments := strings.Split(path.Clean(strings.TrimPrefix(location, "/")), "/")
+	for start := 0; start <= len(segments)-min(2, len(segments)); start++ {
+		if segments[start] == ".." || segments[start] == "." {
+			continue
+		}
+		suffix := strings.Join(segments[start:], "/")
+		tail := "/" + suffix
+		var rows []LocalMusicIndex
+		if err := db.Where("rel_path = ? OR substr(rel_path, ?) = ?", suffix, -utf8.RuneCountInString(tail), tail).
+			Order("mod_time DESC").Limit(5).Find(&rows).Error; err != nil {
+			return nil
+		}
+		for _, row := range rows {
+			if track, err := localMusicTrackByID(row.ID); err == nil {
+				return track
+			}
+		}
+	}
+	return nil
+}
+
+func savedSongFromLocalTrack(track *localMusicTrack) *SavedSong {
+	extra, _ := json.Marshal(track.Extra)
+	return &SavedSong{
+		SongID: track.ID, Source: localMusicSource, Extra: string(extra),
+		Name: track.Name, Artist: track.Artist, Cover: track.Cover, Duration: track.Duration,
+	}
+}
+
+func savedSongFromModel(song *model.Song) *SavedSong {
+	saved := &SavedSong{
+		SongID: song.ID, Source: song.Source, Name: song.Name, Artist: song.Artist,
+		Cover: song.Cover, Duration: song.Duration,
+	}
+	if len(song.Extra) > 0 {
+		extra, _ := json.Marshal(song.Extra)
+		saved.Extra = string(extra)
+	}
+	return saved
+}
+
+// RegisterPlaylistImportRoutes exposes
+// POST /collections/import_playlist, a multipart upload with the
+// playlist "file", an optional collection "name" and "online"=1 to search
+// online for entries without a local file.
+func RegisterPlaylistImportRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+	colAPI.POST("/import_playlist", func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少歌单文件"})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取歌单文件失败"})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxCollectionImportBytes))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取歌单文件失败"})
+			return
+		}
+
+		result, err := ImportPlaylistFile(header.Filename, data, PlaylistImportOptions{
+			Name:   c.PostForm("name"),
+			Online: c.PostForm("online") == "1",
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "result": result})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func TestImportPlaylistFileMatchesLocalThenOnline(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "A", "First.mp3"))
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "B", "Second.mp3"))
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "C", "Third.mp3"))
+
+	original := playlistImportSearch
+	playlistImportSearch = func(name, artist string, duration int) (*model.Song, error) {
+		if name != "Online" || artist != "Singer" {
+			return nil, errors.New("no match")
+		}
+		return &model.Song{ID: "9", Source: "qq", Name: name, Artist: artist, Extra: map[string]string{"mid": "x"}}, nil
+	}
+	t.Cleanup(func() { playlistImportSearch = original })
+
+	playlist := "#EXTM3U\n" +
+		"#PLAYLIST:Road Trip\n" +
+		// Relative to the playlist file.
+		"B/Second.mp3\n" +
+		// Copied from another machine: matched by the end of the path.
+		"#EXTINF:-1,Whoever - First\n" +
+		"/old/Music/A/First.mp3\n" +
+		// No file here: matched by title in the local index.
+		"#EXTINF:-1,Third\n" +
+		"http://example.com/3.mp3\n" +
+		"#EXTINF:180,Singer - Online\n" +
+		"/old/Music/X/Online.mp3\n" +
+		"/old/Music/E/Gone.mp3\n" +
+		"B/Second.mp3\n"
+
+	result, err := ImportPlaylistFile("trip.m3u8", []byte(playlist), PlaylistImportOptions{BaseDir: downloadDir, Online: true})
+	if err != nil {
+		t.Fatalf("ImportPlaylistFile() error = %v", err)
+	}
+	if result.Name != "Road Trip" || result.Total != 6 || result.ByPath != 3 || result.ByTag != 1 ||
+		result.Online != 1 || result.Duplicate != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	if len(result.Unmatched) != 1 || result.Unmatched[0].Index != 5 || result.Unmatched[0].Title != "Gone" {
+		t.Fatalf("unmatched = %+v", result.Unmatched)
+	}
+
+	var songs []SavedSong
+	db.Where("collection_id = ?", result.CollectionID).Order(savedSongOrder).Find(&songs)
+	names := ""
+	for _, song := range songs {
+		names += song.Source + ":" + song.Name + " "
+	}
+	if names != "local:Second local:First local:Third qq:Online " {
+		t.Fatalf("collection songs = %s", names)
+	}
+
+	// The same file again gets a new collection name.
+	again, err := ImportPlaylistFile("trip.m3u8", []byte(playlist), PlaylistImportOptions{BaseDir: downloadDir})
+	if err != nil || again.Name != "Road Trip (2)" || again.Online != 0 || len(again.Unmatched) != 2 {
+		t.Fatalf("second import = %+v, %v", again, err)
+	}
+}
+
+func TestPlaylistImportEndpoint(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "A", "First.mp3"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterPlaylistImportRoutes(router.Group(""))
+	upload := func(filename, content, name string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", filename)
+		part.Write([]byte(content))
+		form.WriteField("name", name)
+		form.Close()
+		req := httptest.NewRequest(http.MethodPost, "/collections/import_playlist", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := upload("list.pls", "[playlist]\nFile1=A/First.mp3\nFile2=Z/Missing.mp3\nNumberOfEntries=2\n", "我的导入")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var result PlaylistImportResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if result.Name != "我的导入" || result.Format != "pls" || result.ByPath != 1 || len(result.Unmatched) != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+
+	if rec = upload("none.m3u", "Z/Missing.mp3\n", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unmatched playlist status = %d", rec.Code)
+	}
+	var count int64
+	db.Model(&Collection{}).Where("name = ?", "none").Count(&count)
+	if count != 0 {
+		t.Fatal("a playlist that matched nothing should not create a collection")
+	}
+}
@@ -0,0 +1,620 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// ==========================================
+// 定时任务：cron 表达式保存在 settings.db，由服务端按分钟检查
+// ==========================================
+
+const (
+	schedulerTickInterval    = 30 * time.Second
+	scheduledJobTimeout      = 2 * time.Hour
+	sourceHealthProbeTimeout = 15 * time.Second
+	sourceHealthKeyword      = "周杰伦"
+	maxUnplayableReported    = 200
+)
+
+// scheduledJobRunner performs one run of a job type. The message is a short
+// summary and detail, when not nil, is stored as JSON on the run.
+type scheduledJobRunner func(ctx context.Context) (message string, detail any, err error)
+
+var scheduledJobRunners = map[string]scheduledJobRunner{
+	core.JobRefreshCollections:  runRefreshCollectionsJob,
+	core.JobCheckSubscriptions:  runCheckSubscriptionsJob,
+	core.JobValidatePlayability: runValidatePlayabilityJob,
+	core.JobRescanLocalMusic:    runRescanLocalMusicJob,
+	core.JobCheckUpdate:         runCheckUpdateJob,
+	core.JobSourceHealth:        runSourceHealthJob,
+	core.JobPurgeTrash:          runPurgeTrashJob,
+}
+
+var scheduledJobLabels = map[string]string{
+	core.JobRefreshCollections:  "刷新导入歌单",
+	core.JobCheckSubscriptions:  "检查订阅歌单",
+	core.JobValidatePlayability: "检查歌单可播放性",
+	core.JobRescanLocalMusic:    "重新扫描本地音乐",
+	core.JobCheckUpdate:         "检查更新",
+	core.JobSourceHealth:        "音源健康检查",
+	core.JobPurgeTrash:          "清理回收站",
+}
+
+var (
+	schedulerSettings          = core.GetWebSettings
+	schedulerValidatePlayable  = core.ValidatePlayable
+	schedulerSearchFunc        = core.GetSearchFunc
+	schedulerSourceNames       = core.GetDefaultSourceNames
+	schedulerCheckLatestUpdate = checkLatestRelease
+
+	scheduledJobList       = core.ListScheduledJobs
+	scheduledJobGet        = core.GetScheduledJob
+	scheduledJobSave       = core.SaveScheduledJob
+	scheduledJobDelete     = core.DeleteScheduledJob
+	scheduledJobStartRun   = core.StartScheduledJobRun
+	scheduledJobFinishRun  = core.FinishScheduledJobRun
+	scheduledJobListRuns   = core.ListScheduledJobRuns
+	scheduledJobInterrupts = core.MarkInterruptedJobRuns
+)
+
+type jobScheduler struct {
+	mu      sync.Mutex
+	running map[uint]bool
+	desktop bool
+	wg      sync.WaitGroup
+}
+
+var scheduler = &jobScheduler{running: map[uint]bool{}}
+
+// active reports whether due jobs run automatically. The desktop app only
+// runs them when the user turned the scheduler on; manual runs always work.
+func (s *jobScheduler) active() bool {
+	return !s.desktop || schedulerSettings().SchedulerInDesktop
+}
+
+func (s *jobScheduler) isRunning(jobID uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running[jobID]
+}
+
+var errJobRunning = errors.New("任务正在运行")
+
+// run starts a job in the background and returns its run record.
+func (s *jobScheduler) run(job core.ScheduledJob, trigger string) (*core.ScheduledJobRun, error) {
+	runner := scheduledJobRunners[job.Type]
+	if runner == nil {
+		return nil, fmt.Errorf("未知任务类型: %s", job.Type)
+	}
+	s.mu.Lock()
+	if s.running[job.ID] {
+		s.mu.Unlock()
+		return nil, errJobRunning
+	}
+	s.running[job.ID] = true
+	s.mu.Unlock()
+
+	run, err := scheduledJobStartRun(job.ID, trigger)
+	if err != nil {
+		s.finish(job.ID)
+		return nil, err
+	}
+	started := *run
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.finish(job.ID)
+		ctx, cancel := context.WithTimeout(context.Background(), scheduledJobTimeout)
+		defer cancel()
+		message, detail, runErr := runScheduledJobSafely(ctx, runner)
+		detailJSON := ""
+		if detail != nil {
+			if data, err := json.Marshal(detail); err == nil {
+				detailJSON = string(data)
+			}
+		}
+		if err := scheduledJobFinishRun(run, message, detailJSON, runErr); err != nil {
+			fmt.Printf("[scheduler] save run of job %d failed: %v\n", job.ID, err)
+		}
+	}()
+	return &started, nil
+}
+
+func runScheduledJobSafely(ctx context.Context, runner scheduledJobRunner) (message string, detail any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务异常: %v", r)
+		}
+	}()
+	return runner(ctx)
+}
+
+func (s *jobScheduler) finish(jobID uint) {
+	s.mu.Lock()
+	delete(s.running, jobID)
+	s.mu.Unlock()
+}
+
+// tick starts every enabled job that is due at now.
+func (s *jobScheduler) tick(now time.Time) {
+	if !s.active() {
+		return
+	}
+	jobs, err := scheduledJobList()
+	if err != nil {
+		return
+	}
+	for _, job := range jobs {
+		next := job.NextRun()
+		if next.IsZero() || next.After(now) || s.isRunning(job.ID) {
+			continue
+		}
+		_, _ = s.run(job, core.JobTriggerSchedule)
+	}
+}
+
+// startScheduler fails runs a previous process left unfinished and then
+// checks for due jobs for the lifetime of the server.
+func startScheduler(desktop bool) {
+	scheduler.desktop = desktop
+	if err := scheduledJobInterrupts(); err != nil {
+		fmt.Printf("[scheduler] init failed: %v\n", err)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(schedulerTickInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			scheduler.tick(now)
+		}
+	}()
+}
+
+// ==========================================
+// 任务实现
+// ==========================================
+
+type refreshCollectionsReport struct {
+	Refreshed int      `json:"refreshed"`
+	Changed   int      `json:"changed"`
+	Failed    []string `json:"failed"`
+}
+
+// runRefreshCollectionsJob re-fetches every imported collection and updates its
+// track count. Subscribed ones are left to the subscription check job, which
+// follows each subscription's own interval.
+func runRefreshCollectionsJob(ctx context.Context) (string, any, error) {
+	if db == nil {
+		return "", nil, errors.New("歌单数据库未初始化")
+	}
+	var collections []Collection
+	if err := db.Where("kind = ?", collectionKindImported).Order("id").Find(&collections).Error; err != nil {
+		return "", nil, err
+	}
+	report := refreshCollectionsReport{Failed: []string{}}
+	for i := range collections {
+		if err := ctx.Err(); err != nil {
+			return "", report, err
+		}
+		collection := &collections[i]
+		if sub, err := loadCollectionSubscription(collection.ID); err == nil && sub.Enabled {
+			continue
+		}
+		songs, err := subscriptionFetchSongs(collection)
+		if err != nil {
+			report.Failed = append(report.Failed, collection.Name)
+			continue
+		}
+		if len(songs) != collection.TrackCount {
+			report.Changed++
+			_ = db.Model(&Collection{}).Where("id = ?", collection.ID).Update("track_count", len(songs)).Error
+		}
+		report.Refreshed++
+	}
+	message := fmt.Sprintf("刷新 %d 个歌单，%d 个有变化，%d 个失败", report.Refreshed, report.Changed, len(report.Failed))
+	if len(report.Failed) > 0 && report.Refreshed == 0 {
+		return message, report, errors.New("所有导入歌单都刷新失败")
+	}
+	return message, report, nil
+}
+
+// runCheckSubscriptionsJob records a snapshot of every subscription whose
+// interval has passed since its last check.
+func runCheckSubscriptionsJob(ctx context.Context) (string, any, error) {
+	if db == nil {
+		return "", nil, errors.New("歌单数据库未初始化")
+	}
+	report, err := checkDueSubscriptions(ctx)
+	if err != nil {
+		return "", report, err
+	}
+	message := fmt.Sprintf("检查 %d 个订阅，%d 个有变化，%d 个失败", report.Refreshed, report.Changed, len(report.Failed))
+	if len(report.Failed) > 0 && report.Refreshed == 0 {
+		return message, report, errors.New("所有到期订阅都检查失败")
+	}
+	return message, report, nil
+}
+
+type unplayableSong struct {
+	Collection string `json:"collection"`
+	ID         string `json:"id"`
+	Source     string `json:"source"`
+	Name       string `json:"name"`
+	Artist     string `json:"artist"`
+}
+
+type playabilityReport struct {
+	Checked    int              `json:"checked"`
+	Unplayable []unplayableSong `json:"unplayable"`
+}
+
+// runValidatePlayabilityJob checks that every online song saved in a manual
+// collection still resolves to a playable URL.
+func runValidatePlayabilityJob(ctx context.Context) (string, any, error) {
+	if db == nil {
+		return "", nil, errors.New("歌单数据库未初始化")
+	}
+	var collections []Collection
+	if err := db.Where("kind IS NULL OR kind <> ?", collectionKindImported).Order("id").Find(&collections).Error; err != nil {
+		return "", nil, err
+	}
+	report := playabilityReport{Unplayable: []unplayableSong{}}
+	unplayableCount := 0
+	checked := map[string]bool{}
+	for _, collection := range collections {
+		var saved []SavedSong
+		if err := db.Where("collection_id = ?", collection.ID).Order(savedSongOrder).Find(&saved).Error; err != nil {
+			return "", report, err
+		}
+		for _, song := range saved {
+			if err := ctx.Err(); err != nil {
+				return "", report, err
+			}
+			if isLocalMusicSource(song.Source) {
+				continue
+			}
+			key := song.Source + "\x00" + song.SongID
+			if checked[key] {
+				continue
+			}
+			checked[key] = true
+			report.Checked++
+			// The result also refreshes the health of every saved copy of the song.
+			entries := db.Where("song_id = ? AND source = ?", song.SongID, song.Source)
+			if schedulerValidatePlayable(&model.Song{ID: song.SongID, Source: song.Source}) {
+				_ = recordSavedSongHealth(entries, songHealthOK)
+				continue
+			}
+			if songHealthProbeable(song.Source) {
+				_ = recordSavedSongHealth(entries, songHealthDead)
+			}
+			unplayableCount++
+			if len(report.Unplayable) < maxUnplayableReported {
+				report.Unplayable = append(report.Unplayable, unplayableSong{
+					Collection: collection.Name, ID: song.SongID, Source: song.Source, Name: song.Name, Artist: song.Artist,
+				})
+			}
+		}
+	}
+	return fmt.Sprintf("检查 %d 首，%d 首不可播放", report.Checked, unplayableCount), report, nil
+}
+
+func runRescanLocalMusicJob(ctx context.Context) (string, any, error) {
+	if db == nil {
+		return "", nil, errors.New("歌单数据库未初始化")
+	}
+	invalidateLocalMusicScanCache()
+	if err := syncLocalMusicIndex(); err != nil {
+		return "", nil, err
+	}
+	var count int64
+	db.Model(&LocalMusicIndex{}).Count(&count)
+	return fmt.Sprintf("本地音乐共 %d 首", count), nil, nil
+}
+
+// runPurgeTrashJob purges recycle bin items older than the retention setting.
+func runPurgeTrashJob(ctx context.Context) (string, any, error) {
+	if db == nil {
+		return "", nil, errors.New("歌单数据库未初始化")
+	}
+	purged, err := purgeExpiredTrash(trashNow())
+	return fmt.Sprintf("彻底删除 %d 个过期项目", purged), nil, err
+}
+
+func runCheckUpdateJob(ctx context.Context) (string, any, error) {
+	settings := schedulerSettings()
+	ctx, cancel := context.WithTimeout(ctx, 4*githubRequestTimeout)
+	defer cancel()
+	result, err := schedulerCheckLatestUpdate(ctx, settings.UpdateRepoURL, settings.GithubProxyEnabled, settings.GithubProxyURL)
+	if err != nil {
+		return "", nil, err
+	}
+	message := fmt.Sprintf("当前 %s，最新 %s，已是最新版本", result.CurrentVersion, result.LatestVersion)
+	if result.UpdateAvailable {
+		message = fmt.Sprintf("当前 %s，发现新版本 %s", result.CurrentVersion, result.LatestVersion)
+	}
+	result.Body = ""
+	result.Assets = nil
+	return message, result, nil
+}
+
+type sourceHealth struct {
+	Source    string `json:"source"`
+	OK        bool   `json:"ok"`
+	Results   int    `json:"results"`
+	Playable  *bool  `json:"playable,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runSourceHealthJob searches every default source for a common keyword and
+// tries to play the first hit, all sources in parallel.
+func runSourceHealthJob(ctx context.Context) (string, any, error) {
+	sources := schedulerSourceNames()
+	results := make([]sourceHealth, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source string) {
+			defer wg.Done()
+			results[i] = probeSourceHealth(ctx, source)
+		}(i, source)
+	}
+	wg.Wait()
+
+	healthy := 0
+	failed := make([]string, 0)
+	for _, result := range results {
+		if result.OK {
+			healthy++
+		} else {
+			failed = append(failed, result.Source)
+		}
+	}
+	message := fmt.Sprintf("%d/%d 个音源正常", healthy, len(results))
+	if len(failed) > 0 {
+		message += "，异常: " + strings.Join(failed, ", ")
+	}
+	return message, results, nil
+}
+
+func probeSourceHealth(ctx context.Context, source string) sourceHealth {
+	health := sourceHealth{Source: source}
+	search := schedulerSearchFunc(source)
+	if search == nil {
+		health.Error = "不支持搜索"
+		return health
+	}
+	started := time.Now()
+	type searchResult struct {
+		songs []model.Song
+		err   error
+	}
+	done := make(chan searchResult, 1)
+	go func() {
+		songs, err := search(sourceHealthKeyword)
+		done <- searchResult{songs: songs, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		health.Error = ctx.Err().Error()
+		return health
+	case <-time.After(sourceHealthProbeTimeout):
+		health.Error = "搜索超时"
+		health.LatencyMs = time.Since(started).Milliseconds()
+		return health
+	case result := <-done:
+		health.LatencyMs = time.Since(started).Milliseconds()
+		if result.err != nil {
+			health.Error = result.err.Error()
+			return health
+		}
+		health.Results = len(result.songs)
+		if len(result.songs) == 0 {
+			health.Error = "没有搜索结果"
+			return health
+		}
+		health.OK = true
+		first := result.songs[0]
+		if first.Source == "" {
+			first.Source = source
+		}
+		playable := schedulerValidatePlayable(&first)
+		health.Playable = &playable
+		return health
+	}
+}
+
+// ==========================================
+// 管理接口
+// ==========================================
+
+type scheduledJobJSON struct {
+	core.ScheduledJob
+	Label     string     `json:"label"`
+	NextRunAt *time.Time `json:"next_run_at"`
+	Running   bool       `json:"running"`
+}
+
+type scheduledRunJSON struct {
+	core.ScheduledJobRun
+	Detail json.RawMessage `json:"detail,omitempty"`
+}
+
+func newScheduledJobJSON(job core.ScheduledJob) scheduledJobJSON {
+	out := scheduledJobJSON{ScheduledJob: job, Label: scheduledJobLabels[job.Type], Running: scheduler.isRunning(job.ID)}
+	if next := job.NextRun(); !next.IsZero() {
+		out.NextRunAt = &next
+	}
+	return out
+}
+
+type scheduledJobRequest struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Cron    string `json:"cron"`
+	Enabled *bool  `json:"enabled"`
+}
+
+func loadScheduledJobParam(c *gin.Context) (*core.ScheduledJob, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return nil, false
+	}
+	job, err := scheduledJobGet(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return nil, false
+	}
+	return job, true
+}
+
+// RegisterSchedulerRoutes exposes the scheduler admin API: listing and editing
+// jobs, their run history and "run now" triggers.
+func RegisterSchedulerRoutes(configAPI *gin.RouterGroup) {
+	configAPI.GET("/api/scheduler", func(c *gin.Context) {
+		jobs, err := scheduledJobList()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out := make([]scheduledJobJSON, 0, len(jobs))
+		for _, job := range jobs {
+			out = append(out, newScheduledJobJSON(job))
+		}
+		types := make([]gin.H, 0, len(scheduledJobLabels))
+		for _, jobType := range core.ScheduledJobTypes() {
+			types = append(types, gin.H{"type": jobType, "label": scheduledJobLabels[jobType]})
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"active":  scheduler.active(),
+			"desktop": scheduler.desktop,
+			"jobs":    out,
+			"types":   types,
+		})
+	})
+
+	configAPI.POST("/api/scheduler/jobs", func(c *gin.Context) {
+		var req scheduledJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+			return
+		}
+		job := &core.ScheduledJob{Name: req.Name, Type: req.Type, Cron: req.Cron, Enabled: req.Enabled == nil || *req.Enabled}
+		if err := scheduledJobSave(job); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "保存任务失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, newScheduledJobJSON(*job))
+	})
+
+	configAPI.PUT("/api/scheduler/jobs/:id", func(c *gin.Context) {
+		job, ok := loadScheduledJobParam(c)
+		if !ok {
+			return
+		}
+		var req scheduledJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+			return
+		}
+		if strings.TrimSpace(req.Name) != "" {
+			job.Name = req.Name
+		}
+		if strings.TrimSpace(req.Type) != "" {
+			job.Type = req.Type
+		}
+		if strings.TrimSpace(req.Cron) != "" {
+			job.Cron = req.Cron
+		}
+		if req.Enabled != nil {
+			job.Enabled = *req.Enabled
+		}
+		if err := scheduledJobSave(job); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "保存任务失败: " + err.Error()})
+			return
+		}
+		saved, err := scheduledJobGet(job.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if saved == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+			return
+		}
+		c.JSON(http.StatusOK, newScheduledJobJSON(*saved))
+	})
+
+	configAPI.DELETE("/api/scheduler/jobs/:id", func(c *gin.Context) {
+		job, ok := loadScheduledJobParam(c)
+		if !ok {
+			return
+		}
+		if scheduler.isRunning(job.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": errJobRunning.Error()})
+			return
+		}
+		if err := scheduledJobDelete(job.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	configAPI.POST("/api/scheduler/jobs/:id/run", func(c *gin.Context) {
+		job, ok := loadScheduledJobParam(c)
+		if !ok {
+			return
+		}
+		run, err := scheduler.run(*job, core.JobTriggerManual)
+		if errors.Is(err, errJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, scheduledRunJSON{ScheduledJobRun: *run})
+	})
+
+	configAPI.GET("/api/scheduler/jobs/:id/runs", func(c *gin.Context) {
+		job, ok := loadScheduledJobParam(c)
+		if !ok {
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		runs, err := scheduledJobListRuns(job.ID, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out := make([]scheduledRunJSON, 0, len(runs))
+		for _, run := range runs {
+			item := scheduledRunJSON{ScheduledJobRun: run}
+			if run.Detail != "" && json.Valid([]byte(run.Detail)) {
+				item.Detail = json.RawMessage(run.Detail)
+			}
+			out = append(out, item)
+		}
+		c.JSON(http.StatusOK, gin.H{"job": newScheduledJobJSON(*job), "runs": out})
+	})
+}
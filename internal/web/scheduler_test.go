@@ -0,0 +1,346 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// stubScheduledJobStore keeps jobs and runs in memory instead of settings.db.
+func stubScheduledJobStore(t *testing.T, jobs ...core.ScheduledJob) func() []core.ScheduledJobRun {
+	t.Helper()
+	var mu sync.Mutex
+	stored := map[uint]core.ScheduledJob{}
+	var runs []core.ScheduledJobRun
+	for _, job := range jobs {
+		stored[job.ID] = job
+	}
+	oldList, oldGet, oldSave, oldDelete := scheduledJobList, scheduledJobGet, scheduledJobSave, scheduledJobDelete
+	oldStart, oldFinish, oldRuns, oldInterrupts := scheduledJobStartRun, scheduledJobFinishRun, scheduledJobListRuns, scheduledJobInterrupts
+	scheduledJobList = func() ([]core.ScheduledJob, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		list := make([]core.ScheduledJob, 0, len(stored))
+		for id := uint(1); len(list) < len(stored); id++ {
+			if job, ok := stored[id]; ok {
+				list = append(list, job)
+			}
+		}
+		return list, nil
+	}
+	scheduledJobGet = func(id uint) (*core.ScheduledJob, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if job, ok := stored[id]; ok {
+			return &job, nil
+		}
+		return nil, nil
+	}
+	scheduledJobSave = func(job *core.ScheduledJob) error {
+		if _, err := core.ParseCronSchedule(job.Cron); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if job.ID == 0 {
+			job.ID = uint(len(stored) + 1)
+		}
+		stored[job.ID] = *job
+		return nil
+	}
+	scheduledJobDelete = func(id uint) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(stored, id)
+		return nil
+	}
+	scheduledJobStartRun = func(jobID uint, trigger string) (*core.ScheduledJobRun, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		job := stored[jobID]
+		job.LastRunAt = time.Now()
+		stored[jobID] = job
+		return &core.ScheduledJobRun{ID: uint(len(runs) + 1), JobID: jobID, Trigger: trigger, Status: core.JobStatusRunning}, nil
+	}
+	scheduledJobFinishRun = func(run *core.ScheduledJobRun, message, detail string, runErr error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		run.Message, run.Detail, run.Status = message, detail, core.JobStatusSuccess
+		if runErr != nil {
+			run.Status, run.Error = core.JobStatusFailed, runErr.Error()
+		}
+		runs = append([]core.ScheduledJobRun{*run}, runs...)
+		return nil
+	}
+	scheduledJobListRuns = func(jobID uint, _ int) ([]core.ScheduledJobRun, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		out := []core.ScheduledJobRun{}
+		for _, run := range runs {
+			if run.JobID == jobID {
+				out = append(out, run)
+			}
+		}
+		return out, nil
+	}
+	scheduledJobInterrupts = func() error { return nil }
+	t.Cleanup(func() {
+		scheduledJobList, scheduledJobGet, scheduledJobSave, scheduledJobDelete = oldList, oldGet, oldSave, oldDelete
+		scheduledJobStartRun, scheduledJobFinishRun, scheduledJobListRuns, scheduledJobInterrupts = oldStart, oldFinish, oldRuns, oldInterrupts
+	})
+	return func() []core.ScheduledJobRun {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]core.ScheduledJobRun(nil), runs...)
+	}
+}
+
+func TestSchedulerRunsDueJobsOnlyWhenActive(t *testing.T) {
+	created := time.Now().Add(-2 * time.Hour)
+	allRuns := stubScheduledJobStore(t,
+		core.ScheduledJob{ID: 1, Name: "scan", Type: core.JobRescanLocalMusic, Cron: "* * * * *", Enabled: true, CreatedAt: created},
+		core.ScheduledJob{ID: 2, Name: "update", Type: core.JobCheckUpdate, Cron: "* * * * *", Enabled: false, CreatedAt: created},
+	)
+	ran := make(chan string, 4)
+	oldRunner := scheduledJobRunners[core.JobRescanLocalMusic]
+	scheduledJobRunners[core.JobRescanLocalMusic] = func(context.Context) (string, any, error) {
+		ran <- "scan"
+		return "本地音乐共 3 首", gin.H{"count": 3}, nil
+	}
+	desktopSetting := false
+	oldSettings, oldDesktop := schedulerSettings, scheduler.desktop
+	schedulerSettings = func() core.WebSettings { return core.WebSettings{SchedulerInDesktop: desktopSetting} }
+	t.Cleanup(func() {
+		scheduledJobRunners[core.JobRescanLocalMusic] = oldRunner
+		schedulerSettings, scheduler.desktop = oldSettings, oldDesktop
+	})
+
+	scheduler.desktop = true
+	scheduler.tick(time.Now())
+	scheduler.wg.Wait()
+	if len(allRuns()) != 0 {
+		t.Fatalf("desktop scheduler ran jobs while turned off")
+	}
+
+	desktopSetting = true
+	scheduler.tick(time.Now())
+	scheduler.wg.Wait()
+	runs := allRuns()
+	if len(runs) != 1 || runs[0].JobID != 1 || runs[0].Trigger != core.JobTriggerSchedule || runs[0].Status != core.JobStatusSuccess {
+		t.Fatalf("runs = %+v, want one scheduled run of job 1", runs)
+	}
+	if runs[0].Detail != `{"count":3}` {
+		t.Fatalf("detail = %q", runs[0].Detail)
+	}
+
+	// The job just ran, so the next tick in the same minute skips it.
+	scheduler.tick(time.Now())
+	scheduler.wg.Wait()
+	if len(allRuns()) != 1 {
+		t.Fatalf("job ran again before its next time")
+	}
+}
+
+func TestSchedulerRoutesManageJobsAndRunNow(t *testing.T) {
+	stubScheduledJobStore(t)
+	release := make(chan struct{})
+	oldRunner := scheduledJobRunners[core.JobCheckUpdate]
+	scheduledJobRunners[core.JobCheckUpdate] = func(context.Context) (string, any, error) {
+		<-release
+		return "", nil, errors.New("github unreachable")
+	}
+	t.Cleanup(func() { scheduledJobRunners[core.JobCheckUpdate] = oldRunner })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterSchedulerRoutes(router.Group(""))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/scheduler/jobs", `{"type":"check_update","cron":"bad"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad cron status = %d", rec.Code)
+	}
+	rec := do(http.MethodPost, "/api/scheduler/jobs", `{"name":"更新","type":"check_update","cron":"0 9 * * *"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var job scheduledJobJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	if !job.Enabled || job.Label != "检查更新" {
+		t.Fatalf("job = %+v", job)
+	}
+
+	runPath := fmt.Sprintf("/api/scheduler/jobs/%d/run", job.ID)
+	if rec := do(http.MethodPost, runPath, ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("run status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, runPath, ""); rec.Code != http.StatusConflict {
+		t.Fatalf("second run status = %d, want 409 while running", rec.Code)
+	}
+	close(release)
+	scheduler.wg.Wait()
+
+	rec = do(http.MethodGet, fmt.Sprintf("/api/scheduler/jobs/%d/runs", job.ID), "")
+	var history struct {
+		Runs []scheduledRunJSON `json:"runs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode runs: %v (%s)", err, rec.Body.String())
+	}
+	if len(history.Runs) != 1 || history.Runs[0].Status != core.JobStatusFailed || history.Runs[0].Trigger != core.JobTriggerManual {
+		t.Fatalf("runs = %+v", history.Runs)
+	}
+
+	if rec := do(http.MethodPut, fmt.Sprintf("/api/scheduler/jobs/%d", job.ID), `{"enabled":false}`); rec.Code != http.StatusOK {
+		t.Fatalf("disable status = %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "/api/scheduler", "")
+	if !strings.Contains(rec.Body.String(), `"enabled":false`) || !strings.Contains(rec.Body.String(), `"next_run_at":null`) {
+		t.Fatalf("list = %s", rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, fmt.Sprintf("/api/scheduler/jobs/%d", job.ID), ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, runPath, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("run deleted job status = %d, want 404", rec.Code)
+	}
+}
+
+func TestSchedulerUpdateOfConcurrentlyDeletedJob(t *testing.T) {
+	stubScheduledJobStore(t, core.ScheduledJob{ID: 1, Name: "更新", Type: core.JobCheckUpdate, Cron: "0 9 * * *", Enabled: true})
+	save := scheduledJobSave
+	scheduledJobSave = func(job *core.ScheduledJob) error {
+		if err := save(job); err != nil {
+			return err
+		}
+		return scheduledJobDelete(job.ID)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterSchedulerRoutes(router.Group(""))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/scheduler/jobs/1", strings.NewReader(`{"enabled":false}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("update deleted job status = %d, want 404", rec.Code)
+	}
+}
+
+func TestScheduledJobRunners(t *testing.T) {
+	initCollectionDBForTest(t)
+
+	imported := Collection{Name: "热歌榜", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "1", TrackCount: 1}
+	broken := Collection{Name: "失效歌单", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "2"}
+	manual := Collection{Name: "收藏", Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	for _, collection := range []*Collection{&imported, &broken, &manual} {
+		if err := db.Create(collection).Error; err != nil {
+			t.Fatalf("create collection: %v", err)
+		}
+	}
+	for _, song := range []SavedSong{
+		{CollectionID: manual.ID, SongID: "ok", Source: "qq", Name: "Good"},
+		{CollectionID: manual.ID, SongID: "gone", Source: "qq", Name: "Gone", Artist: "Nobody"},
+		{CollectionID: manual.ID, SongID: "file", Source: localMusicSource, Name: "Local"},
+	} {
+		if err := db.Create(&song).Error; err != nil {
+			t.Fatalf("create saved song: %v", err)
+		}
+	}
+
+	oldFetch, oldPlayable, oldSearch, oldSources := subscriptionFetchSongs, schedulerValidatePlayable, schedulerSearchFunc, schedulerSourceNames
+	subscriptionFetchSongs = func(collection *Collection) ([]model.Song, error) {
+		if collection.ExternalID == "2" {
+			return nil, errors.New("playlist removed")
+		}
+		return []model.Song{{ID: "1"}, {ID: "2"}}, nil
+	}
+	schedulerValidatePlayable = func(song *model.Song) bool { return song.ID != "gone" }
+	schedulerSourceNames = func() []string { return []string{"qq", "kugou", "apple"} }
+	schedulerSearchFunc = func(source string) core.SearchFunc {
+		switch source {
+		case "qq":
+			return func(string) ([]model.Song, error) { return []model.Song{{ID: "ok"}}, nil }
+		case "kugou":
+			return func(string) ([]model.Song, error) { return nil, errors.New("blocked") }
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		subscriptionFetchSongs, schedulerValidatePlayable, schedulerSearchFunc, schedulerSourceNames = oldFetch, oldPlayable, oldSearch, oldSources
+	})
+
+	message, detail, err := runRefreshCollectionsJob(context.Background())
+	if err != nil || message != "刷新 1 个歌单，1 个有变化，1 个失败" {
+		t.Fatalf("refresh = %q, %v", message, err)
+	}
+	if report := detail.(refreshCollectionsReport); len(report.Failed) != 1 || report.Failed[0] != "失效歌单" {
+		t.Fatalf("refresh report = %+v", report)
+	}
+	var reloaded Collection
+	if db.First(&reloaded, imported.ID); reloaded.TrackCount != 2 {
+		t.Fatalf("track count = %d, want 2", reloaded.TrackCount)
+	}
+
+	message, detail, err = runValidatePlayabilityJob(context.Background())
+	if err != nil || message != "检查 2 首，1 首不可播放" {
+		t.Fatalf("playability = %q, %v", message, err)
+	}
+	if report := detail.(playabilityReport); len(report.Unplayable) != 1 || report.Unplayable[0].Name != "Gone" || report.Unplayable[0].Collection != "收藏" {
+		t.Fatalf("playability report = %+v", report)
+	}
+
+	message, detail, err = runSourceHealthJob(context.Background())
+	if err != nil || message != "1/3 个音源正常，异常: kugou, apple" {
+		t.Fatalf("source health = %q, %v", message, err)
+	}
+	results := detail.([]sourceHealth)
+	if !results[0].OK || results[0].Playable == nil || !*results[0].Playable || results[1].Error != "blocked" {
+		t.Fatalf("source health = %+v", results)
+	}
+}
+
+func TestSubscriptionsAreCheckedOnlyBySubscriptionJob(t *testing.T) {
+	initCollectionDBForTest(t)
+
+	collection := Collection{Name: "订阅歌单", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "1"}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	if err := db.Create(&CollectionSubscription{CollectionID: collection.ID, Enabled: true, IntervalHours: 1}).Error; err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+
+	var fetches int
+	oldFetch := subscriptionFetchSongs
+	subscriptionFetchSongs = func(*Collection) ([]model.Song, error) {
+		fetches++
+		return []model.Song{{ID: "1", Source: "qq", Name: "Song"}}, nil
+	}
+	t.Cleanup(func() { subscriptionFetchSongs = oldFetch })
+
+	if message, _, err := runRefreshCollectionsJob(context.Background()); err != nil || fetches != 0 {
+		t.Fatalf("refresh = %q, %v with %d fetches, want subscribed collection skipped", message, err, fetches)
+	}
+	if message, _, err := runCheckSubscriptionsJob(context.Background()); err != nil || message != "检查 1 个订阅，0 个有变化，0 个失败" || fetches != 1 {
+		t.Fatalf("subscription check = %q, %v with %d fetches", message, err, fetches)
+	}
+	if message, _, err := runCheckSubscriptionsJob(context.Background()); err != nil || message != "检查 0 个订阅，0 个有变化，0 个失败" || fetches != 1 {
+		t.Fatalf("second subscription check = %q, %v with %d fetches, want nothing due", message, err, fetches)
+	}
+}
@@ -80,7 +80,7 @@ func corsMiddleware() gin.HandlerFunc {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, UPDATE")
 		c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type, X-Lyric-Format, X-Lyric-Source, X-Lyric-Song-Id, X-Lyric-Override")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		if method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -335,6 +335,9 @@ type StartOptions struct {
 	ShouldOpenBrowser bool
 	DisableAuth       bool
 	ListenHost        string
+	// Desktop keeps scheduled jobs from running unless the schedulerInDesktop
+	// setting is on.
+	Desktop bool
 }
 
 func Start(port string, shouldOpenBrowser bool) {
@@ -345,6 +348,7 @@ func StartDesktop(port string) {
 	StartWithOptions(port, StartOptions{
 		DisableAuth: true,
 		ListenHost:  "127.0.0.1",
+		Desktop:     true,
 	})
 }
 
@@ -361,6 +365,8 @@ func StartWithOptions(port string, opts StartOptions) {
 	InitDB()
 	defer CloseDB()
 	syncLocalMusicIndexAsync()
+	resumeCSVImports()
+	startScheduler(opts.Desktop)
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
@@ -444,12 +450,28 @@ func StartWithOptions(port string, opts StartOptions) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		// 下载目录或路由变化会改变本地音乐的扫描范围。
+		invalidateLocalMusicScanCache()
 		c.JSON(200, core.GetWebSettings())
 	})
 
 	RegisterMusicRoutes(api, configAPI)
 	RegisterQRLoginRoutes(configAPI)
 	RegisterCollectionRoutes(api)
+	RegisterCollectionTransferRoutes(api)
+	RegisterCollectionOrderRoutes(api)
+	RegisterSongAnnotationRoutes(api)
+	RegisterSmartCollectionRoutes(api)
+	RegisterCollectionHealthRoutes(api)
+	RegisterTrashRoutes(api, configAPI)
+	RegisterPlaylistImportRoutes(api)
+	RegisterCSVImportRoutes(api)
+	RegisterSongOverrideRoutes(api)
+	RegisterFilenamePreviewRoutes(api)
+	RegisterLyricAuthorRoutes(api)
+	RegisterPlaylistFileRoutes(api)
+	RegisterSubscriptionRoutes(api)
+	RegisterSchedulerRoutes(configAPI)
 	RegisterLocalMusicRoutes(api)
 	RegisterVideogenRoutes(api, videoDir)
 	RegisterUpdateRoutes(api)
@@ -0,0 +1,589 @@
+package web
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/music-lib/model"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// 智能歌单：保存的是规则，读取时对本地音乐和已收藏歌曲求值
+// ==========================================
+
+const (
+	smartMatchAll = "all"
+	smartMatchAny = "any"
+
+	// Scope picks the songs a smart collection looks at: the local library
+	// index, songs saved in manual collections, or both.
+	smartScopeAll   = "all"
+	smartScopeLocal = "local"
+	smartScopeSaved = "saved"
+
+	maxSmartRules           = 20
+	maxSmartCollectionLimit = 5000
+	smartPreviewSongs       = 50
+)
+
+var errSmartCollectionSongs = errors.New("智能歌单的歌曲由规则决定，不能手动增删，请修改规则")
+
+type smartCollectionRules struct {
+	Match string      `json:"match"`
+	Scope string      `json:"scope"`
+	Rules []smartRule `json:"rules"`
+	Sort  string      `json:"sort"`
+	Order string      `json:"order"`
+	// Limit keeps the first songs after sorting; 0 keeps all of them.
+	Limit int `json:"limit"`
+}
+
+type smartRule struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+type smartFieldKind int
+
+const (
+	smartFieldText smartFieldKind = iota
+	smartFieldNumber
+	smartFieldDate
+	smartFieldPresence
+)
+
+var smartRuleFields = map[string]smartFieldKind{
+	"name":     smartFieldText,
+	"artist":   smartFieldText,
+	"album":    smartFieldText,
+	"source":   smartFieldText,
+	"format":   smartFieldText,
+	"tag":      smartFieldText,
+	"note":     smartFieldText,
+	"rating":   smartFieldNumber,
+	"duration": smartFieldNumber,
+	"added_at": smartFieldDate,
+	"lyrics":   smartFieldPresence,
+	"cover":    smartFieldPresence,
+}
+
+var smartRuleOps = map[smartFieldKind][]string{
+	smartFieldText:     {"contains", "not_contains", "is", "is_not"},
+	smartFieldNumber:   {"eq", "ne", "gt", "gte", "lt", "lte"},
+	smartFieldDate:     {"within_days", "older_than_days"},
+	smartFieldPresence: {"exists", "missing"},
+}
+
+// smartCandidate is one song a smart collection can pick, with the facts its
+// rules look at.
+type smartCandidate struct {
+	song    model.Song
+	format  string
+	addedAt time.Time
+	rating  int
+	tags    string
+	note    string
+	lyrics  bool
+	cover   bool
+	// lyricsKnown is false for saved online songs, which carry no lyric
+	// information; lyrics rules match neither way for them.
+	lyricsKnown bool
+}
+
+var smartSortKeys = map[string]func(a, b *smartCandidate) int{
+	"name": func(a, b *smartCandidate) int {
+		return strings.Compare(strings.ToLower(a.song.Name), strings.ToLower(b.song.Name))
+	},
+	"artist": func(a, b *smartCandidate) int {
+		return strings.Compare(strings.ToLower(a.song.Artist), strings.ToLower(b.song.Artist))
+	},
+	"album": func(a, b *smartCandidate) int {
+		return strings.Compare(strings.ToLower(a.song.Album), strings.ToLower(b.song.Album))
+	},
+	"duration": func(a, b *smartCandidate) int {
+		return cmp.Compare(a.song.Duration, b.song.Duration)
+	},
+	"added_at": func(a, b *smartCandidate) int {
+		return a.addedAt.Compare(b.addedAt)
+	},
+	"rating": func(a, b *smartCandidate) int {
+		return cmp.Compare(a.rating, b.rating)
+	},
+}
+
+func normalizeSmartFormat(format string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+}
+
+// normalize validates the rules and fills in the defaults: match all rules,
+// look at every song and show the most recently added first.
+func (r *smartCollectionRules) normalize() error {
+	r.Match = strings.ToLower(strings.TrimSpace(r.Match))
+	if r.Match == "" {
+		r.Match = smartMatchAll
+	}
+	if r.Match != smartMatchAll && r.Match != smartMatchAny {
+		return errors.New("match 只支持 all、any")
+	}
+	r.Scope = strings.ToLower(strings.TrimSpace(r.Scope))
+	if r.Scope == "" {
+		r.Scope = smartScopeAll
+	}
+	if r.Scope != smartScopeAll && r.Scope != smartScopeLocal && r.Scope != smartScopeSaved {
+		return errors.New("scope 只支持 all、local、saved")
+	}
+	if len(r.Rules) > maxSmartRules {
+		return fmt.Errorf("规则不能超过 %d 条", maxSmartRules)
+	}
+	for i := range r.Rules {
+		if err := r.Rules[i].normalize(); err != nil {
+			return err
+		}
+	}
+
+	r.Sort = strings.ToLower(strings.TrimSpace(r.Sort))
+	r.Order = strings.ToLower(strings.TrimSpace(r.Order))
+	if r.Sort == "" {
+		r.Sort = "added_at"
+		if r.Order == "" {
+			r.Order = "desc"
+		}
+	}
+	if _, ok := smartSortKeys[r.Sort]; !ok {
+		return errors.New("sort 只支持 name、artist、album、duration、added_at、rating")
+	}
+	if r.Order == "" {
+		r.Order = "asc"
+	}
+	if r.Order != "asc" && r.Order != "desc" {
+		return errors.New("order 只支持 asc、desc")
+	}
+	if r.Limit < 0 || r.Limit > maxSmartCollectionLimit {
+		return fmt.Errorf("limit 需要在 0-%d 之间", maxSmartCollectionLimit)
+	}
+	return nil
+}
+
+func (r *smartRule) normalize() error {
+	r.Field = strings.ToLower(strings.TrimSpace(r.Field))
+	r.Op = strings.ToLower(strings.TrimSpace(r.Op))
+	r.Value = strings.TrimSpace(r.Value)
+	kind, ok := smartRuleFields[r.Field]
+	if !ok {
+		return fmt.Errorf("不支持的规则字段: %s", r.Field)
+	}
+	supported := false
+	for _, op := range smartRuleOps[kind] {
+		supported = supported || op == r.Op
+	}
+	if !supported {
+		return fmt.Errorf("字段 %s 不支持条件 %s，可用: %s", r.Field, r.Op, strings.Join(smartRuleOps[kind], "、"))
+	}
+	switch kind {
+	case smartFieldNumber, smartFieldDate:
+		n, err := strconv.Atoi(r.Value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("规则 %s %s 需要一个非负整数", r.Field, r.Op)
+		}
+		r.Value = strconv.Itoa(n)
+	case smartFieldPresence:
+		r.Value = ""
+	default:
+		if r.Field == "format" {
+			r.Value = normalizeSmartFormat(r.Value)
+		}
+		if r.Value == "" {
+			return fmt.Errorf("规则 %s %s 缺少比较值", r.Field, r.Op)
+		}
+	}
+	return nil
+}
+
+func (r smartRule) matches(c *smartCandidate, now time.Time) bool {
+	switch smartRuleFields[r.Field] {
+	case smartFieldNumber:
+		want, _ := strconv.Atoi(r.Value)
+		got := c.rating
+		if r.Field == "duration" {
+			got = c.song.Duration
+		}
+		switch r.Op {
+		case "eq":
+			return got == want
+		case "ne":
+			return got != want
+		case "gt":
+			return got > want
+		case "gte":
+			return got >= want
+		case "lt":
+			return got < want
+		default:
+			return got <= want
+		}
+	case smartFieldDate:
+		if c.addedAt.IsZero() {
+			return false
+		}
+		days, _ := strconv.Atoi(r.Value)
+		cutoff := now.AddDate(0, 0, -days)
+		if r.Op == "within_days" {
+			return !c.addedAt.Before(cutoff)
+		}
+		return c.addedAt.Before(cutoff)
+	case smartFieldPresence:
+		has, known := c.lyrics, c.lyricsKnown
+		if r.Field == "cover" {
+			has, known = c.cover, true
+		}
+		return known && has == (r.Op == "exists")
+	}
+
+	negate := r.Op == "not_contains" || r.Op == "is_not"
+	exact := r.Op == "is" || r.Op == "is_not"
+	var values []string
+	switch r.Field {
+	case "tag":
+		values = songTagList(c.tags)
+	case "source":
+		if isLocalMusicSource(r.Value) && isLocalMusicSource(c.song.Source) {
+			return !negate
+		}
+		values = []string{c.song.Source}
+	case "format":
+		values = []string{c.format}
+	case "note":
+		values = []string{c.note}
+	case "artist":
+		values = []string{c.song.Artist}
+	case "album":
+		values = []string{c.song.Album}
+	default:
+		values = []string{c.song.Name}
+	}
+	want := strings.ToLower(r.Value)
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if (exact && value == want) || (!exact && strings.Contains(value, want)) {
+			return !negate
+		}
+	}
+	return negate
+}
+
+func (r smartCollectionRules) matches(c *smartCandidate, now time.Time) bool {
+	if len(r.Rules) == 0 {
+		return true
+	}
+	for _, rule := range r.Rules {
+		ok := rule.matches(c, now)
+		if ok && r.Match == smartMatchAny {
+			return true
+		}
+		if !ok && r.Match == smartMatchAll {
+			return false
+		}
+	}
+	return r.Match == smartMatchAll
+}
+
+func parseSmartCollectionRules(raw string) (smartCollectionRules, error) {
+	var rules smartCollectionRules
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+			return rules, fmt.Errorf("智能歌单规则无法解析: %w", err)
+		}
+	}
+	return rules, rules.normalize()
+}
+
+func encodeSmartCollectionRules(rules smartCollectionRules) string {
+	data, _ := json.Marshal(rules)
+	return string(data)
+}
+
+// smartCollectionCandidates lists the songs in scope. Local files come first
+// and a song saved in several collections is only listed once.
+func smartCollectionCandidates(scope string) ([]smartCandidate, error) {
+	var out []smartCandidate
+	seen := map[string]bool{}
+	if scope != smartScopeSaved {
+		var rows []LocalMusicIndex
+		if err := db.Order("mod_time DESC").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			row := &rows[i]
+			seen[localMusicSource+"\x00"+row.ID] = true
+			out = append(out, smartCandidate{
+				song: localMusicIndexSong(row), format: normalizeSmartFormat(row.Ext), addedAt: row.ModTime,
+				rating: row.Rating, tags: row.Tags, note: row.Note,
+				lyrics: row.HasLyric, lyricsKnown: true, cover: row.HasCover || row.Cover != "",
+			})
+		}
+	}
+	if scope != smartScopeLocal {
+		manual := db.Model(&Collection{}).Select("id").
+			Where("kind = ? OR kind = '' OR kind IS NULL", collectionKindManual)
+		var saved []SavedSong
+		if err := db.Where("collection_id IN (?)", manual).
+			Order("collection_id, " + savedSongOrder).Find(&saved).Error; err != nil {
+			return nil, err
+		}
+		for _, ss := range saved {
+			key := savedSongKey(ss)
+			if isLocalMusicSource(ss.Source) {
+				key = localMusicSource + "\x00" + ss.SongID
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			song := savedSongModel(ss)
+			hasLyric := extraMapValue(song.Extra, "lyric") == "true"
+			out = append(out, smartCandidate{
+				song: song, format: normalizeSmartFormat(extraMapValue(song.Extra, "ext")), addedAt: ss.AddedAt,
+				rating: ss.Rating, tags: ss.Tags, note: ss.Note,
+				lyrics: hasLyric, lyricsKnown: hasLyric, cover: strings.TrimSpace(ss.Cover) != "",
+			})
+		}
+	}
+	return out, nil
+}
+
+// evaluateSmartCollection returns the songs matching the rules, sorted and
+// limited as the rules ask.
+func evaluateSmartCollection(rules smartCollectionRules, now time.Time) ([]model.Song, error) {
+	candidates, err := smartCollectionCandidates(rules.Scope)
+	if err != nil {
+		return nil, err
+	}
+	matched := candidates[:0]
+	for i := range candidates {
+		if rules.matches(&candidates[i], now) {
+			matched = append(matched, candidates[i])
+		}
+	}
+	compare := smartSortKeys[rules.Sort]
+	sort.SliceStable(matched, func(i, j int) bool {
+		if rules.Order == "desc" {
+			return compare(&matched[i], &matched[j]) > 0
+		}
+		return compare(&matched[i], &matched[j]) < 0
+	})
+	if rules.Limit > 0 && len(matched) > rules.Limit {
+		matched = matched[:rules.Limit]
+	}
+	songs := make([]model.Song, 0, len(matched))
+	for _, candidate := range matched {
+		songs = append(songs, candidate.song)
+	}
+	return songs, nil
+}
+
+func loadSmartCollectionSongs(collection *Collection) ([]model.Song, error) {
+	rules, err := parseSmartCollectionRules(collection.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateSmartCollection(rules, time.Now())
+}
+
+// smartCountTTL bounds how long a cached count lives, since date rules
+// change their result without any write.
+const smartCountTTL = 5 * time.Minute
+
+type smartCount struct {
+	rules      string
+	generation uint64
+	count      int
+	at         time.Time
+}
+
+// smartCounts caches smart collection sizes for the collection list. Writes
+// to saved songs or the local music index bump the generation, which drops
+// every count; a rule change misses the cache through the rules text.
+var smartCounts = struct {
+	sync.Mutex
+	generation uint64
+	byID       map[uint]smartCount
+}{byID: map[uint]smartCount{}}
+
+func invalidateSmartCollectionCounts() {
+	smartCounts.Lock()
+	smartCounts.generation++
+	smartCounts.byID = map[uint]smartCount{}
+	smartCounts.Unlock()
+}
+
+// registerSmartCountInvalidation drops the cached counts after every write
+// to a table smart rules read. Raw statements name no table, so they always
+// invalidate.
+func registerSmartCountInvalidation(db *gorm.DB) error {
+	invalidateSmartCollectionCounts()
+	tables := map[string]bool{}
+	for _, value := range []any{&SavedSong{}, &LocalMusicIndex{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(value); err != nil {
+			return err
+		}
+		tables[stmt.Table] = true
+	}
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error == nil && tx.RowsAffected > 0 && (tx.Statement.Table == "" || tables[tx.Statement.Table]) {
+			invalidateSmartCollectionCounts()
+		}
+	}
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("gorm:create").Register("web:smart_counts", invalidate),
+		callbacks.Update().After("gorm:update").Register("web:smart_counts", invalidate),
+		callbacks.Delete().After("gorm:delete").Register("web:smart_counts", invalidate),
+		callbacks.Raw().After("gorm:raw").Register("web:smart_counts", invalidate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countSmartCollectionSongs(collection *Collection) int {
+	smartCounts.Lock()
+	cached, ok := smartCounts.byID[collection.ID]
+	generation := smartCounts.generation
+	smartCounts.Unlock()
+	if ok && cached.rules == collection.Rules && cached.generation == generation && time.Since(cached.at) < smartCountTTL {
+		return cached.count
+	}
+
+	count := 0
+	if songs, err := loadSmartCollectionSongs(collection); err == nil {
+		count = len(songs)
+	}
+	smartCounts.Lock()
+	if smartCounts.generation == generation {
+		smartCounts.byID[collection.ID] = smartCount{rules: collection.Rules, generation: generation, count: count, at: time.Now()}
+	}
+	smartCounts.Unlock()
+	return count
+}
+
+// loadSmartCollection loads a smart collection, answering the request itself
+// when the collection is missing or of another kind.
+func loadSmartCollection(c *gin.Context) (*Collection, bool) {
+	collection, err := loadCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "歌单不存在"})
+		return nil, false
+	}
+	if !collection.isSmart() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有智能歌单有规则"})
+		return nil, false
+	}
+	return collection, true
+}
+
+func RegisterSmartCollectionRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+
+	colAPI.POST("/smart", func(c *gin.Context) {
+		var req struct {
+			Name        string               `json:"name"`
+			Description string               `json:"description"`
+			Cover       string               `json:"cover"`
+			Rules       smartCollectionRules `json:"rules"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误，必须提供歌单名"})
+			return
+		}
+		if err := req.Rules.normalize(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		collection := Collection{
+			Name: strings.TrimSpace(req.Name), Description: strings.TrimSpace(req.Description), Cover: strings.TrimSpace(req.Cover),
+			Kind: collectionKindSmart, ContentType: collectionContentPlaylist, Source: "local",
+			Rules: encodeSmartCollectionRules(req.Rules),
+		}
+		if err := db.Create(&collection).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": collection.ID, "name": collection.Name})
+	})
+
+	colAPI.POST("/smart/preview", func(c *gin.Context) {
+		var rules smartCollectionRules
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+		if err := rules.normalize(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		songs, err := evaluateSmartCollection(rules, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "预览失败: " + err.Error()})
+			return
+		}
+		total := len(songs)
+		songs = songs[:min(total, smartPreviewSongs)]
+		preview := make([]gin.H, 0, len(songs))
+		for _, song := range songs {
+			preview = append(preview, gin.H{
+				"id": song.ID, "source": song.Source, "name": song.Name, "artist": song.Artist,
+				"album": song.Album, "duration": song.Duration,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"total": total, "songs": preview, "rules": rules})
+	})
+
+	colAPI.GET("/:id/rules", func(c *gin.Context) {
+		collection, ok := loadSmartCollection(c)
+		if !ok {
+			return
+		}
+		rules, err := parseSmartCollectionRules(collection.Rules)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rules)
+	})
+
+	colAPI.PUT("/:id/rules", func(c *gin.Context) {
+		collection, ok := loadSmartCollection(c)
+		if !ok {
+			return
+		}
+		var rules smartCollectionRules
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+		if err := rules.normalize(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		collection.Rules = encodeSmartCollectionRules(rules)
+		if err := db.Model(collection).Update("rules", collection.Rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "rules": rules, "track_count": countSmartCollectionSongs(collection)})
+	})
+}
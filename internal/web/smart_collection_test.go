@@ -0,0 +1,189 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedSmartCollectionLibrary(t *testing.T) {
+	t.Helper()
+	now := time.Now()
+	for _, row := range []LocalMusicIndex{
+		{ID: "l1", RelPath: "a.flac", Name: "晴天", Artist: "周杰伦", Ext: "flac", Duration: 269, HasLyric: true, ModTime: now.AddDate(0, 0, -3), Rating: 5, Tags: "夜跑"},
+		{ID: "l2", RelPath: "b.mp3", Name: "稻香", Artist: "周杰伦", Ext: ".MP3", Duration: 223, ModTime: now.AddDate(0, 0, -60)},
+		{ID: "l3", RelPath: "c.flac", Name: "Yellow", Artist: "Coldplay", Ext: "flac", Duration: 266, ModTime: now.AddDate(0, 0, -10), Rating: 3},
+	} {
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatalf("create index row: %v", err)
+		}
+	}
+	manual := seedTransferCollection(t, "收藏", "q1", "q2")
+	db.Model(&SavedSong{}).Where("song_id = ?", "q1").Updates(map[string]any{"name": "七里香", "artist": "周杰伦", "rating": 4, "added_at": now.AddDate(0, 0, -1)})
+	db.Model(&SavedSong{}).Where("song_id = ?", "q2").Updates(map[string]any{"name": "Fix You", "artist": "Coldplay", "source": "bilibili", "duration": 300})
+	// The same local file saved in a collection is listed once.
+	db.Create(&SavedSong{CollectionID: manual.ID, SongID: "l1", Source: localMusicSource, Name: "晴天", Artist: "周杰伦"})
+}
+
+func TestSmartCollectionRulesSelectSortAndLimit(t *testing.T) {
+	initCollectionDBForTest(t)
+	seedSmartCollectionLibrary(t)
+
+	tests := []struct {
+		name  string
+		rules smartCollectionRules
+		want  string
+	}{
+		{"default newest first", smartCollectionRules{}, "qq:q1,local:l1,local:l3,local:l2,bilibili:q2"},
+		{"artist and format", smartCollectionRules{Rules: []smartRule{{"artist", "contains", "周杰"}, {"format", "is", ".FLAC"}}}, "local:l1"},
+		{"added in last 30 days", smartCollectionRules{Rules: []smartRule{{"added_at", "within_days", "30"}}, Sort: "name"}, "local:l3,qq:q1,local:l1"},
+		{"missing lyrics from local files", smartCollectionRules{Scope: smartScopeLocal, Rules: []smartRule{{"lyrics", "missing", ""}}}, "local:l3,local:l2"},
+		{"missing lyrics skips online saved songs", smartCollectionRules{Rules: []smartRule{{"lyrics", "missing", ""}}}, "local:l3,local:l2"},
+		{"rating at least 4", smartCollectionRules{Rules: []smartRule{{"rating", "gte", "4"}}, Sort: "rating", Order: "desc"}, "local:l1,qq:q1"},
+		{"from source bilibili", smartCollectionRules{Rules: []smartRule{{"source", "is", "bilibili"}}}, "bilibili:q2"},
+		{"any rule with limit", smartCollectionRules{Match: smartMatchAny, Rules: []smartRule{{"tag", "is", "夜跑"}, {"artist", "is", "coldplay"}}, Sort: "duration", Limit: 2}, "local:l3,local:l1"},
+		{"saved songs only", smartCollectionRules{Scope: smartScopeSaved, Rules: []smartRule{{"source", "is_not", "local"}}, Sort: "name"}, "bilibili:q2,qq:q1"},
+	}
+	for _, tt := range tests {
+		rules := tt.rules
+		if err := rules.normalize(); err != nil {
+			t.Fatalf("%s: normalize() error = %v", tt.name, err)
+		}
+		songs, err := evaluateSmartCollection(rules, time.Now())
+		if err != nil {
+			t.Fatalf("%s: evaluateSmartCollection() error = %v", tt.name, err)
+		}
+		got := make([]string, 0, len(songs))
+		for _, song := range songs {
+			got = append(got, song.Source+":"+song.ID)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Fatalf("%s: songs = %s, want %s", tt.name, strings.Join(got, ","), tt.want)
+		}
+	}
+}
+
+func TestSmartCollectionCountIsCachedUntilSongsOrRulesChange(t *testing.T) {
+	initCollectionDBForTest(t)
+	seedSmartCollectionLibrary(t)
+	collection := Collection{Name: "高分", Kind: collectionKindSmart, ContentType: collectionContentPlaylist, Source: "local",
+		Rules: encodeSmartCollectionRules(smartCollectionRules{Rules: []smartRule{{"rating", "gte", "4"}}})}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create smart collection: %v", err)
+	}
+	if got := countSmartCollectionSongs(&collection); got != 2 {
+		t.Fatalf("count = %d, want 2", got)
+	}
+
+	// A write that bypasses gorm is not seen until something invalidates.
+	sqlDB, _ := db.DB()
+	if _, err := sqlDB.Exec("UPDATE local_music_index SET rating = 5 WHERE id = 'l3'"); err != nil {
+		t.Fatalf("raw update: %v", err)
+	}
+	if got := countSmartCollectionSongs(&collection); got != 2 {
+		t.Fatalf("cached count = %d, want 2", got)
+	}
+	db.Model(&SavedSong{}).Where("song_id = ?", "q2").Update("rating", 5)
+	if got := countSmartCollectionSongs(&collection); got != 4 {
+		t.Fatalf("count after saved song change = %d, want 4", got)
+	}
+	collection.Rules = encodeSmartCollectionRules(smartCollectionRules{Rules: []smartRule{{"source", "is", "bilibili"}}})
+	if got := countSmartCollectionSongs(&collection); got != 1 {
+		t.Fatalf("count after rule change = %d, want 1", got)
+	}
+}
+
+func TestSmartCollectionEndpoints(t *testing.T) {
+	initCollectionDBForTest(t)
+	seedSmartCollectionLibrary(t)
+	router := newCollectionTestRouter()
+	RegisterSmartCollectionRoutes(router.Group(RoutePrefix))
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, RoutePrefix+path, bytes.NewReader(data)))
+		return rec
+	}
+
+	for _, tt := range []struct {
+		name string
+		body map[string]any
+	}{
+		{"unknown field", map[string]any{"name": "x", "rules": map[string]any{"rules": []smartRule{{"mood", "is", "happy"}}}}},
+		{"op of another field", map[string]any{"name": "x", "rules": map[string]any{"rules": []smartRule{{"rating", "contains", "4"}}}}},
+		{"missing value", map[string]any{"name": "x", "rules": map[string]any{"rules": []smartRule{{"artist", "is", " "}}}}},
+		{"limit too large", map[string]any{"name": "x", "rules": map[string]any{"limit": maxSmartCollectionLimit + 1}}},
+		{"missing name", map[string]any{"rules": map[string]any{}}},
+	} {
+		if rec := do(http.MethodPost, "/collections/smart", tt.body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d body=%s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := do(http.MethodPost, "/collections/smart", map[string]any{
+		"name":  "周杰伦",
+		"rules": map[string]any{"rules": []smartRule{{"artist", "is", "周杰伦"}}, "sort": "name"},
+	})
+	var created struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.ID == 0 {
+		t.Fatalf("create smart collection = %d %s", rec.Code, rec.Body.String())
+	}
+	base := "/collections/" + collectionIDString(created.ID)
+	songIDs := func() string {
+		t.Helper()
+		rec := do(http.MethodGet, base+"/songs", nil)
+		var songs []struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &songs); err != nil {
+			t.Fatalf("decode songs: %v (%s)", err, rec.Body.String())
+		}
+		ids := make([]string, 0, len(songs))
+		for _, song := range songs {
+			ids = append(ids, song.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+	if got := songIDs(); got != "q1,l1,l2" {
+		t.Fatalf("smart collection songs = %s", got)
+	}
+
+	if rec := do(http.MethodPut, base+"/rules", map[string]any{"rules": []smartRule{{"rating", "gte", "4"}}, "limit": 1}); rec.Code != http.StatusOK {
+		t.Fatalf("update rules status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if got := songIDs(); got != "q1" {
+		t.Fatalf("songs after rule update = %s", got)
+	}
+	if rec := do(http.MethodPost, base+"/songs", map[string]string{"id": "x", "source": "qq"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("adding a song to a smart collection status = %d", rec.Code)
+	}
+	manual := seedTransferCollection(t, "手动", "m1")
+	if rec := do(http.MethodGet, "/collections/"+collectionIDString(manual.ID)+"/rules", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("rules of a manual collection status = %d", rec.Code)
+	}
+
+	export, err := exportCollections([]uint{created.ID})
+	if err != nil || export.Collections[0].Rules == nil || len(export.Collections[0].Songs) != 1 {
+		t.Fatalf("exportCollections() = %+v, %v", export, err)
+	}
+	data, _ := json.Marshal(export)
+	parsed, err := parseCollectionImport(data)
+	if err != nil {
+		t.Fatalf("parseCollectionImport() error = %v", err)
+	}
+	results, err := importCollections(parsed, collectionImportOptions{Conflict: collectionConflictRename})
+	if err != nil || len(results) != 1 || results[0].Action != "renamed" {
+		t.Fatalf("importCollections() = %+v, %v", results, err)
+	}
+	imported, _ := loadCollection(collectionIDString(results[0].ID))
+	if !imported.isSmart() || imported.Rules != encodeSmartCollectionRules(*export.Collections[0].Rules) {
+		t.Fatalf("imported collection = %+v", imported)
+	}
+}
@@ -0,0 +1,404 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+const (
+	maxSongTags      = 20
+	maxSongTagLength = 32
+	maxSongNoteRunes = 2000
+)
+
+// Keys the rating, tags and note travel under in model.Song.Extra, so song
+// cards, downloads and filters see them without extra lookups.
+const (
+	songExtraRating = "rating"
+	songExtraTags   = "tags"
+	songExtraNote   = "note"
+)
+
+// songAnnotationRequest updates the fields it carries; omitted ones are kept.
+type songAnnotationRequest struct {
+	Rating *int      `json:"rating"`
+	Tags   *[]string `json:"tags"`
+	Note   *string   `json:"note"`
+}
+
+// updates validates the request and returns the columns to write.
+func (r songAnnotationRequest) updates() (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	if r.Rating != nil {
+		if *r.Rating < 0 || *r.Rating > core.MaxSongRating {
+			return nil, fmt.Errorf("评分只能是 0-%d", core.MaxSongRating)
+		}
+		updates["rating"] = *r.Rating
+	}
+	if r.Tags != nil {
+		updates["tags"] = normalizeSongTags(*r.Tags)
+	}
+	if r.Note != nil {
+		note := strings.TrimSpace(*r.Note)
+		if utf8.RuneCountInString(note) > maxSongNoteRunes {
+			return nil, fmt.Errorf("备注不能超过 %d 个字", maxSongNoteRunes)
+		}
+		updates["note"] = note
+	}
+	if len(updates) == 0 {
+		return nil, errors.New("需要提供 rating、tags 或 note")
+	}
+	return updates, nil
+}
+
+// normalizeSongTags trims, splits "a, b" entries and drops duplicates
+// case-insensitively, keeping the first spelling. Tags are stored joined by
+// commas.
+func normalizeSongTags(tags []string) string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		for _, part := range strings.FieldsFunc(tag, isSongTagSeparator) {
+			part = strings.TrimSpace(part)
+			if part == "" || utf8.RuneCountInString(part) > maxSongTagLength {
+				continue
+			}
+			key := strings.ToLower(part)
+			if seen[key] || len(out) >= maxSongTags {
+				continue
+			}
+			seen[key] = true
+			out = append(out, part)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+func isSongTagSeparator(r rune) bool {
+	return r == ',' || r == '，' || r == ';' || r == '；'
+}
+
+func songTagList(tags string) []string {
+	if strings.TrimSpace(tags) == "" {
+		return []string{}
+	}
+	return strings.Split(tags, ",")
+}
+
+// withSongAnnotation returns a copy of extra carrying the annotation; empty
+// values remove their key.
+func withSongAnnotation(extra map[string]string, rating int, tags, note string) map[string]string {
+	next := make(map[string]string, len(extra)+3)
+	for key, value := range extra {
+		next[key] = value
+	}
+	set := func(key, value string) {
+		if value == "" {
+			delete(next, key)
+		} else {
+			next[key] = value
+		}
+	}
+	if rating > 0 {
+		set(songExtraRating, strconv.Itoa(rating))
+	} else {
+		set(songExtraRating, "")
+	}
+	set(songExtraTags, tags)
+	set(songExtraNote, note)
+	return next
+}
+
+func songAnnotationJSON(rating int, tags, note string) gin.H {
+	return gin.H{"rating": rating, "tags": songTagList(tags), "note": note}
+}
+
+// songAnnotationFilter narrows song lists to a tag and/or a minimum rating.
+type songAnnotationFilter struct {
+	Tag       string
+	MinRating int
+}
+
+func parseSongAnnotationFilter(c *gin.Context) songAnnotationFilter {
+	filter := songAnnotationFilter{Tag: strings.TrimSpace(c.Query("tag"))}
+	if n, err := strconv.Atoi(strings.TrimSpace(c.Query("min_rating"))); err == nil && n > 0 {
+		filter.MinRating = min(n, core.MaxSongRating)
+	}
+	return filter
+}
+
+func (f songAnnotationFilter) active() bool {
+	return f.Tag != "" || f.MinRating > 0
+}
+
+func (f songAnnotationFilter) matches(extra map[string]string) bool {
+	rating, _ := strconv.Atoi(extra[songExtraRating])
+	return f.matchesAnnotation(rating, extra[songExtraTags])
+}
+
+func (f songAnnotationFilter) matchesAnnotation(rating int, tags string) bool {
+	if rating < f.MinRating {
+		return false
+	}
+	if f.Tag == "" {
+		return true
+	}
+	for _, tag := range songTagList(tags) {
+		if strings.EqualFold(tag, f.Tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f songAnnotationFilter) songs(songs []model.Song) []model.Song {
+	if !f.active() {
+		return songs
+	}
+	out := make([]model.Song, 0, len(songs))
+	for _, song := range songs {
+		if f.matches(song.Extra) {
+			out = append(out, song)
+		}
+	}
+	return out
+}
+
+func (f songAnnotationFilter) tracks(tracks []*localMusicTrack) []*localMusicTrack {
+	if !f.active() {
+		return tracks
+	}
+	out := make([]*localMusicTrack, 0, len(tracks))
+	for _, track := range tracks {
+		if track != nil && f.matches(track.Extra) {
+			out = append(out, track)
+		}
+	}
+	return out
+}
+
+// annotateLocalMusicTracks returns the tracks with the annotations kept in
+// the index merged into their Extra. Annotated tracks are copied, so cached
+// scan results are left alone.
+func annotateLocalMusicTracks(tracks []*localMusicTrack) []*localMusicTrack {
+	if db == nil || len(tracks) == 0 {
+		return tracks
+	}
+	var rows []LocalMusicIndex
+	if err := db.Select("id", "rating", "tags", "note").
+		Where("rating > 0 OR tags <> '' OR note <> ''").Find(&rows).Error; err != nil || len(rows) == 0 {
+		return tracks
+	}
+	byID := make(map[string]*LocalMusicIndex, len(rows))
+	for i := range rows {
+		byID[rows[i].ID] = &rows[i]
+	}
+	out := make([]*localMusicTrack, len(tracks))
+	for i, track := range tracks {
+		out[i] = track
+		if track == nil {
+			continue
+		}
+		if row := byID[track.ID]; row != nil {
+			out[i] = cloneLocalMusicTrack(track)
+			out[i].Extra = withSongAnnotation(out[i].Extra, row.Rating, row.Tags, row.Note)
+		}
+	}
+	return out
+}
+
+// annotateSearchSongs merges the annotations of saved songs into online
+// results by source and id. A song saved in several collections gets its
+// highest rating, all of its tags and the first note. Local results already
+// carry the index annotations.
+func annotateSearchSongs(songs []model.Song) []model.Song {
+	if db == nil || len(songs) == 0 {
+		return songs
+	}
+	ids := make([]string, 0, len(songs))
+	for _, song := range songs {
+		if !isLocalMusicSource(song.Source) {
+			ids = append(ids, song.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return songs
+	}
+	var rows []SavedSong
+	if err := db.Select("song_id", "source", "rating", "tags", "note").
+		Where("song_id IN ? AND (rating > 0 OR tags <> '' OR note <> '')", ids).
+		Order(savedSongOrder).Find(&rows).Error; err != nil || len(rows) == 0 {
+		return songs
+	}
+	type annotation struct {
+		rating int
+		tags   []string
+		note   string
+	}
+	byKey := map[string]*annotation{}
+	for _, row := range rows {
+		key := savedSongKey(row)
+		a := byKey[key]
+		if a == nil {
+			a = &annotation{}
+			byKey[key] = a
+		}
+		a.rating = max(a.rating, row.Rating)
+		a.tags = append(a.tags, row.Tags)
+		if a.note == "" {
+			a.note = row.Note
+		}
+	}
+	out := make([]model.Song, len(songs))
+	for i, song := range songs {
+		out[i] = song
+		if isLocalMusicSource(song.Source) {
+			continue
+		}
+		if a := byKey[song.Source+"\x00"+song.ID]; a != nil {
+			out[i].Extra = withSongAnnotation(song.Extra, a.rating, normalizeSongTags(a.tags), a.note)
+		}
+	}
+	return out
+}
+
+// writeLocalMusicRating stores the rating in the file itself, replacing it
+// through a temporary file in the same directory. The file keeps its mode
+// and modification time.
+func writeLocalMusicRating(track *localMusicTrack, stars int) error {
+	info, err := os.Stat(track.absPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(track.absPath)
+	if err != nil {
+		return err
+	}
+	rated, err := core.WriteAudioRating(data, stars, core.GetWebSettings().ID3Version)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(track.absPath), ".rating-*"+filepath.Ext(track.absPath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(rated); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), time.Now(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), track.absPath)
+}
+
+func RegisterSongAnnotationRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+	colAPI.PUT("/:id/songs/annotation", func(c *gin.Context) {
+		collection, err := loadCollection(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "歌单不存在"})
+			return
+		}
+		if collection.isImported() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "外部导入歌单/专辑不保存歌曲明细，不能标注歌曲"})
+			return
+		}
+		if collection.isSmart() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "智能歌单请到歌曲所在的自建歌单或本地音乐中标注"})
+			return
+		}
+		var req struct {
+			savedSongRef
+			songAnnotationRequest
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.SongID) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误，需要歌曲 id 和 source"})
+			return
+		}
+		updates, err := req.updates()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var song SavedSong
+		if err := db.Where("collection_id = ? AND song_id = ? AND source = ?",
+			collection.ID, strings.TrimSpace(req.SongID), strings.TrimSpace(req.Source)).First(&song).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": errSavedSongNotFound.Error()})
+			return
+		}
+		if err := db.Model(&song).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存标注失败: " + err.Error()})
+			return
+		}
+		if err := db.First(&song, song.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存标注失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "annotation": songAnnotationJSON(song.Rating, song.Tags, song.Note)})
+	})
+
+	api.PUT("/local_music/annotation", func(c *gin.Context) {
+		var req struct {
+			ID string `json:"id"`
+			songAnnotationRequest
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.ID) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少本地音乐 ID"})
+			return
+		}
+		updates, err := req.updates()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		track, err := localMusicTrackByID(req.ID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "本地音乐不存在或已不在下载目录内"})
+			return
+		}
+
+		warning := ""
+		if req.Rating != nil && core.GetWebSettings().WriteRatingTags {
+			if err := writeLocalMusicRating(track, *req.Rating); err != nil {
+				warning = "评分未写入文件: " + err.Error()
+			} else if updated, err := localMusicTrackByID(track.ID); err == nil {
+				track = updated
+			}
+		}
+		upsertLocalMusicIndexRow(track)
+		if err := db.Model(&LocalMusicIndex{}).Where("id = ?", track.ID).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存标注失败: " + err.Error()})
+			return
+		}
+		var row LocalMusicIndex
+		if err := db.First(&row, "id = ?", track.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存标注失败: " + err.Error()})
+			return
+		}
+		resp := gin.H{"status": "ok", "annotation": songAnnotationJSON(row.Rating, row.Tags, row.Note)}
+		if warning != "" {
+			resp["warning"] = warning
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,236 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func TestNormalizeSongTags(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{" 通勤 ", "Rock"}, "通勤,Rock"},
+		{[]string{"rock, Jazz；通勤", "ROCK", ""}, "rock,Jazz,通勤"},
+		{[]string{strings.Repeat("x", maxSongTagLength+1), "ok"}, "ok"},
+	}
+	for _, tt := range tests {
+		if got := normalizeSongTags(tt.in); got != tt.want {
+			t.Fatalf("normalizeSongTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCollectionSongAnnotationEndpointAndFilter(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := seedTransferCollection(t, "通勤", "a", "b", "c")
+	imported := Collection{Name: "外部", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "1"}
+	db.Create(&imported)
+
+	router := newCollectionTestRouter()
+	RegisterSongAnnotationRoutes(router.Group(RoutePrefix))
+	put := func(colID uint, body any) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		rec := httptest.NewRecorder()
+		path := RoutePrefix + "/collections/" + collectionIDString(colID) + "/songs/annotation"
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, path, bytes.NewReader(data)))
+		return rec.Code
+	}
+
+	tests := []struct {
+		name  string
+		colID uint
+		body  map[string]any
+		code  int
+	}{
+		{"rate and tag", collection.ID, map[string]any{"id": "a", "source": "qq", "rating": 5, "tags": []string{"通勤, rock"}, "note": " 前奏好听 "}, 200},
+		{"tag only", collection.ID, map[string]any{"id": "b", "source": "qq", "tags": []string{"Rock"}}, 200},
+		{"rating only", collection.ID, map[string]any{"id": "c", "source": "qq", "rating": 3}, 200},
+		{"rating out of range", collection.ID, map[string]any{"id": "c", "source": "qq", "rating": 6}, 400},
+		{"nothing to update", collection.ID, map[string]any{"id": "c", "source": "qq"}, 400},
+		{"unknown song", collection.ID, map[string]any{"id": "z", "source": "qq", "rating": 1}, 404},
+		{"imported collection", imported.ID, map[string]any{"id": "a", "source": "qq", "rating": 1}, 400},
+	}
+	for _, tt := range tests {
+		if code := put(tt.colID, tt.body); code != tt.code {
+			t.Fatalf("%s: status = %d, want %d", tt.name, code, tt.code)
+		}
+	}
+
+	var song SavedSong
+	db.Where("collection_id = ? AND song_id = ?", collection.ID, "a").First(&song)
+	if song.Rating != 5 || song.Tags != "通勤,rock" || song.Note != "前奏好听" {
+		t.Fatalf("saved annotation = %d %q %q", song.Rating, song.Tags, song.Note)
+	}
+
+	filtered := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"a", "b", "c"}},
+		{"?tag=ROCK", []string{"a", "b"}},
+		{"?min_rating=3", []string{"a", "c"}},
+		{"?tag=rock&min_rating=4", []string{"a"}},
+	}
+	for _, tt := range filtered {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RoutePrefix+"/collections/"+collectionIDString(collection.ID)+"/songs"+tt.query, nil))
+		var songs []struct {
+			ID     string   `json:"id"`
+			Rating int      `json:"rating"`
+			Tags   []string `json:"tags"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &songs); err != nil {
+			t.Fatalf("decode %q: %v (%s)", tt.query, err, rec.Body.String())
+		}
+		got := make([]string, 0, len(songs))
+		for _, s := range songs {
+			got = append(got, s.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Fatalf("songs%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestAnnotateSearchSongsUsesSavedSongs(t *testing.T) {
+	initCollectionDBForTest(t)
+	first := seedTransferCollection(t, "通勤", "a", "b")
+	second := seedTransferCollection(t, "夜跑", "a")
+	db.Model(&SavedSong{}).Where("collection_id = ? AND song_id = ?", first.ID, "a").Updates(map[string]any{"rating": 5, "tags": "rock"})
+	db.Model(&SavedSong{}).Where("collection_id = ? AND song_id = ?", second.ID, "a").Updates(map[string]any{"rating": 2, "tags": "夜跑,Rock"})
+	db.Model(&SavedSong{}).Where("collection_id = ? AND song_id = ?", first.ID, "b").Update("rating", 3)
+
+	results := []model.Song{
+		{ID: "a", Source: "qq", Name: "Song a"},
+		{ID: "a", Source: "kugou", Name: "Song a"},
+		{ID: "b", Source: "qq", Name: "Song b", Extra: map[string]string{"album": "Album b"}},
+		{ID: "z", Source: "qq", Name: "Song z"},
+	}
+	annotated := annotateSearchSongs(results)
+	if annotated[0].Extra[songExtraRating] != "5" || annotated[0].Extra[songExtraTags] != "rock,夜跑" {
+		t.Fatalf("annotated a = %v", annotated[0].Extra)
+	}
+	if annotated[1].Extra != nil || annotated[2].Extra["album"] != "Album b" || annotated[2].Extra[songExtraRating] != "3" {
+		t.Fatalf("annotated results = %+v", annotated)
+	}
+	if results[2].Extra[songExtraRating] != "" {
+		t.Fatalf("annotateSearchSongs() changed its input: %v", results[2].Extra)
+	}
+
+	tests := []struct {
+		filter songAnnotationFilter
+		want   string
+	}{
+		{songAnnotationFilter{Tag: "夜跑"}, "qq:a"},
+		{songAnnotationFilter{MinRating: 3}, "qq:a,qq:b"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, song := range tt.filter.songs(annotated) {
+			got = append(got, song.Source+":"+song.ID)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Fatalf("filter %+v = %v, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestLocalMusicAnnotationSurvivesRescanAndFilters(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "Rated Song.mp3"))
+	writePlaylistTestAudio(t, filepath.Join(downloadDir, "Other Song.mp3"))
+	if err := syncLocalMusicIndex(); err != nil {
+		t.Fatalf("sync local music index: %v", err)
+	}
+	defer waitForLocalMusicScanRefresh(t)
+
+	router := newLocalMusicTestRouter()
+	RegisterSongAnnotationRoutes(router.Group(RoutePrefix))
+	tracks, _, _, err := scanLocalMusicTracks()
+	if err != nil {
+		t.Fatalf("scan local music: %v", err)
+	}
+	var ratedID string
+	for _, track := range tracks {
+		if track.Filename == "Rated Song.mp3" {
+			ratedID = track.ID
+		}
+	}
+
+	body, _ := json.Marshal(map[string]any{"id": ratedID, "rating": 4, "tags": []string{"夜跑"}})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, RoutePrefix+"/local_music/annotation", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("annotate status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if err := os.Chtimes(filepath.Join(downloadDir, "Rated Song.mp3"), time.Now().Add(time.Minute), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("touch file: %v", err)
+	}
+	if err := syncLocalMusicIndex(); err != nil {
+		t.Fatalf("resync local music index: %v", err)
+	}
+
+	for _, query := range []string{"?tag=夜跑", "?min_rating=4"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RoutePrefix+"/local_music"+query, nil))
+		var response struct {
+			Tracks []localMusicTrack `json:"tracks"`
+			Total  int               `json:"total"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode %s: %v", query, err)
+		}
+		if response.Total != 1 || len(response.Tracks) != 1 || response.Tracks[0].ID != ratedID ||
+			response.Tracks[0].Extra["rating"] != "4" || response.Tracks[0].Extra["tags"] != "夜跑" {
+			t.Fatalf("GET /local_music%s = %+v", query, response)
+		}
+	}
+}
+
+func TestWriteLocalMusicRatingKeepsModeAndModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Song.mp3")
+	if err := os.WriteFile(path, []byte{0xff, 0xfb, 0x90, 0x64, 0x00, 0x00, 0x00, 0x00}, 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	if err := writeLocalMusicRating(&localMusicTrack{absPath: path}, 4); err != nil {
+		t.Fatalf("writeLocalMusicRating() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o644 || !info.ModTime().Equal(modTime) {
+		t.Fatalf("rated file mode = %v, mtime = %v", info.Mode().Perm(), info.ModTime())
+	}
+
+	// Clearing the rating removes the tag, so a rescan cannot bring it back.
+	if err := writeLocalMusicRating(&localMusicTrack{absPath: path}, 0); err != nil {
+		t.Fatalf("writeLocalMusicRating(0) error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audio: %v", err)
+	}
+	if bytes.Contains(data, []byte("POPM")) {
+		t.Fatal("clearing the rating should remove the POPM frame")
+	}
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+)
+
+// maxLyricOverrideOffsetMs bounds the lyric offset an override may apply.
+const maxLyricOverrideOffsetMs = 10 * 60 * 1000
+
+var (
+	songOverrideList   = core.ListSongOverrides
+	songOverrideGet    = core.GetSongOverride
+	songOverrideSave   = core.SaveSongOverride
+	songOverrideDelete = core.DeleteSongOverride
+	songOverrideApply  = core.ApplySongOverrides
+)
+
+// RegisterSongOverrideRoutes exposes the per-song metadata and lyric overrides
+// that downloads, lyric endpoints, collections and videogen apply.
+func RegisterSongOverrideRoutes(api *gin.RouterGroup) {
+	api.GET("/api/song_overrides", func(c *gin.Context) {
+		overrides, err := songOverrideList()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取覆盖信息失败"})
+			return
+		}
+		c.JSON(http.StatusOK, overrides)
+	})
+
+	api.GET("/api/song_override", func(c *gin.Context) {
+		source, id := strings.TrimSpace(c.Query("source")), strings.TrimSpace(c.Query("id"))
+		if source == "" || id == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少参数"})
+			return
+		}
+		override, err := songOverrideGet(source, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取覆盖信息失败"})
+			return
+		}
+		if override == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未设置覆盖信息"})
+			return
+		}
+		c.JSON(http.StatusOK, override)
+	})
+
+	api.PUT("/api/song_override", func(c *gin.Context) {
+		var req core.SongOverride
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+		if strings.TrimSpace(req.Source) == "" || strings.TrimSpace(req.SongID) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少歌曲来源或 ID"})
+			return
+		}
+		if req.LyricOffsetMs > maxLyricOverrideOffsetMs || req.LyricOffsetMs < -maxLyricOverrideOffsetMs {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "歌词偏移超出范围"})
+			return
+		}
+		if err := songOverrideSave(&req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败: " + err.Error()})
+			return
+		}
+		if req.IsEmpty() {
+			c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	})
+
+	api.DELETE("/api/song_override", func(c *gin.Context) {
+		source, id := strings.TrimSpace(c.Query("source")), strings.TrimSpace(c.Query("id"))
+		if source == "" || id == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少参数"})
+			return
+		}
+		if err := songOverrideDelete(source, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+}
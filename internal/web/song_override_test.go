@@ -0,0 +1,112 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+// stubSongOverrideStore keeps overrides in memory so the test does not depend
+// on which settings database the core package opened first.
+func stubSongOverrideStore(t *testing.T) {
+	t.Helper()
+	store := map[string]core.SongOverride{}
+	key := func(source, id string) string { return source + "\x00" + id }
+	oldList, oldGet, oldSave, oldDelete, oldApply := songOverrideList, songOverrideGet, songOverrideSave, songOverrideDelete, songOverrideApply
+	songOverrideList = func() ([]core.SongOverride, error) {
+		list := make([]core.SongOverride, 0, len(store))
+		for _, override := range store {
+			list = append(list, override)
+		}
+		return list, nil
+	}
+	songOverrideGet = func(source, id string) (*core.SongOverride, error) {
+		if override, ok := store[key(source, id)]; ok {
+			return &override, nil
+		}
+		return nil, nil
+	}
+	songOverrideSave = func(override *core.SongOverride) error {
+		store[key(override.Source, override.SongID)] = *override
+		return nil
+	}
+	songOverrideDelete = func(source, id string) error {
+		delete(store, key(source, id))
+		return nil
+	}
+	songOverrideApply = func(songs []model.Song) {
+		for i := range songs {
+			if override, ok := store[key(songs[i].Source, songs[i].ID)]; ok {
+				if override.Name != "" {
+					songs[i].Name = override.Name
+				}
+				if override.Artist != "" {
+					songs[i].Artist = override.Artist
+				}
+			}
+		}
+	}
+	t.Cleanup(func() {
+		songOverrideList, songOverrideGet, songOverrideSave, songOverrideDelete, songOverrideApply = oldList, oldGet, oldSave, oldDelete, oldApply
+	})
+}
+
+func TestSongOverrideRoutesApplyToCollectionSongs(t *testing.T) {
+	initCollectionDBForTest(t)
+	router := newCollectionTestRouter()
+	RegisterSongOverrideRoutes(router.Group(RoutePrefix))
+
+	collection := Collection{Name: "Manual", Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	if err := db.Create(&SavedSong{CollectionID: collection.ID, SongID: "override-1", Source: "qq", Name: "Qing Tian", Artist: "Jay Chou"}).Error; err != nil {
+		t.Fatalf("create saved song: %v", err)
+	}
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&payload).Encode(body)
+		}
+		req := httptest.NewRequest(method, RoutePrefix+path, &payload)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(http.MethodPut, "/api/song_override", map[string]any{"source": "qq", "song_id": "override-1", "lyric_offset_ms": 3600000}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("PUT out of range offset status = %d, want 400", rec.Code)
+	}
+	if rec := send(http.MethodPut, "/api/song_override", map[string]any{"source": "qq", "song_id": "override-1", "name": "晴天", "artist": "周杰伦"}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := send(http.MethodGet, "/api/song_override?source=qq&id=override-1", nil)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"artist":"周杰伦"`)) {
+		t.Fatalf("GET override = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = send(http.MethodGet, fmt.Sprintf("/collections/%d/songs", collection.ID), nil)
+	var songs []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &songs); err != nil || len(songs) != 1 {
+		t.Fatalf("collection songs = %s (%v)", rec.Body.String(), err)
+	}
+	if songs[0]["name"] != "晴天" || songs[0]["artist"] != "周杰伦" {
+		t.Fatalf("collection song = %+v, want overridden name and artist", songs[0])
+	}
+
+	if rec := send(http.MethodDelete, "/api/song_override?source=qq&id=override-1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE status = %d", rec.Code)
+	}
+	if rec := send(http.MethodGet, "/api/song_override?source=qq&id=override-1", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET after delete status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,572 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// 导入歌单订阅：定期快照曲目列表，记录增删与顺序变化
+// ==========================================
+
+const (
+	defaultSubscriptionIntervalHours = 24
+	maxSubscriptionIntervalHours     = 24 * 30
+	maxSubscriptionSnapshots         = 100
+)
+
+var (
+	// subscriptionFetchSongs fetches an imported collection's current tracks.
+	subscriptionFetchSongs = loadImportedCollectionSongs
+	// subscriptionDownloadSong saves an auto-queued new track.
+	subscriptionDownloadSong = core.DownloadWithDedupCheckToTarget
+	subscriptionSettings     = core.GetWebSettings
+	subscriptionNow          = time.Now
+)
+
+// CollectionSubscription makes an imported collection tracked: its upstream
+// track list is snapshotted every IntervalHours and changes are recorded.
+type CollectionSubscription struct {
+	CollectionID  uint      `gorm:"primaryKey" json:"collection_id"`
+	Enabled       bool      `json:"enabled"`
+	AutoDownload  bool      `json:"auto_download"`
+	IntervalHours int       `json:"interval_hours"`
+	LastCheckedAt time.Time `json:"last_checked_at"`
+	LastError     string    `json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CollectionSnapshot is one recorded state of a subscribed collection. Only
+// the first snapshot and those that differ from the previous one are kept.
+type CollectionSnapshot struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CollectionID uint      `gorm:"index;not null" json:"collection_id"`
+	TakenAt      time.Time `gorm:"index" json:"taken_at"`
+	TrackCount   int       `json:"track_count"`
+	Baseline     bool      `json:"baseline"`
+	Added        int       `json:"added"`
+	Removed      int       `json:"removed"`
+	Moved        int       `json:"moved"`
+	Queued       int       `json:"queued"`
+	Tracks       string    `gorm:"type:text" json:"-"`
+	Diff         string    `gorm:"type:text" json:"-"`
+}
+
+// subscriptionTrack is the part of a song a snapshot keeps; Extra is kept so
+// new tracks can still be downloaded from the snapshot.
+type subscriptionTrack struct {
+	ID       string            `json:"id"`
+	Source   string            `json:"source"`
+	Name     string            `json:"name"`
+	Artist   string            `json:"artist"`
+	Album    string            `json:"album,omitempty"`
+	Duration int               `json:"duration,omitempty"`
+	Cover    string            `json:"cover,omitempty"`
+	Extra    map[string]string `json:"extra,omitempty"`
+}
+
+// subscriptionChange is a track in a diff. Position is 1-based in the new
+// list, or in the old list for removed tracks; From is the old position of a
+// moved track.
+type subscriptionChange struct {
+	Track    subscriptionTrack `json:"track"`
+	Position int               `json:"position"`
+	From     int               `json:"from,omitempty"`
+}
+
+type subscriptionDiff struct {
+	Added   []subscriptionChange `json:"added"`
+	Removed []subscriptionChange `json:"removed"`
+	Moved   []subscriptionChange `json:"moved"`
+}
+
+func (d subscriptionDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Moved) == 0
+}
+
+func (t subscriptionTrack) key() string {
+	if id := strings.TrimSpace(t.ID); id != "" {
+		return strings.ToLower(strings.TrimSpace(t.Source)) + "\x00" + id
+	}
+	return "\x00" + strings.ToLower(strings.TrimSpace(t.Name)) + "\x00" + strings.ToLower(strings.TrimSpace(t.Artist))
+}
+
+func (t subscriptionTrack) song() model.Song {
+	extra := make(map[string]string, len(t.Extra))
+	for k, v := range t.Extra {
+		extra[k] = v
+	}
+	return model.Song{
+		ID: t.ID, Source: t.Source, Name: t.Name, Artist: t.Artist, Album: t.Album,
+		Duration: t.Duration, Cover: t.Cover, Extra: extra,
+	}
+}
+
+func subscriptionTracksFromSongs(songs []model.Song) []subscriptionTrack {
+	tracks := make([]subscriptionTrack, 0, len(songs))
+	for _, song := range songs {
+		tracks = append(tracks, subscriptionTrack{
+			ID: song.ID, Source: song.Source, Name: song.Name, Artist: song.Artist, Album: song.Album,
+			Duration: song.Duration, Cover: song.Cover, Extra: song.Extra,
+		})
+	}
+	return tracks
+}
+
+// diffSubscriptionTracks compares two track lists. Tracks kept in both count
+// as moved when they are not part of the longest run that kept its relative
+// order, so one track moving to the top is one move, not a shift of all others.
+func diffSubscriptionTracks(previous, current []subscriptionTrack) subscriptionDiff {
+	diff := subscriptionDiff{Added: []subscriptionChange{}, Removed: []subscriptionChange{}, Moved: []subscriptionChange{}}
+	oldPos := make(map[string]int, len(previous))
+	for i, track := range previous {
+		if _, ok := oldPos[track.key()]; !ok {
+			oldPos[track.key()] = i
+		}
+	}
+	newPos := make(map[string]int, len(current))
+	for i, track := range current {
+		if _, ok := newPos[track.key()]; !ok {
+			newPos[track.key()] = i
+		}
+	}
+
+	for i, track := range previous {
+		if _, ok := newPos[track.key()]; !ok {
+			diff.Removed = append(diff.Removed, subscriptionChange{Track: track, Position: i + 1})
+		}
+	}
+
+	// Kept tracks in new order, as indexes into previous.
+	var keptNew, keptOld []int
+	for i, track := range current {
+		old, ok := oldPos[track.key()]
+		if !ok {
+			diff.Added = append(diff.Added, subscriptionChange{Track: track, Position: i + 1})
+			continue
+		}
+		if newPos[track.key()] != i {
+			continue // duplicate entry
+		}
+		keptNew = append(keptNew, i)
+		keptOld = append(keptOld, old)
+	}
+	stay := longestIncreasingRun(keptOld)
+	for j, i := range keptNew {
+		if !stay[j] {
+			diff.Moved = append(diff.Moved, subscriptionChange{Track: current[i], Position: i + 1, From: keptOld[j] + 1})
+		}
+	}
+	return diff
+}
+
+// longestIncreasingRun marks one longest strictly increasing subsequence.
+func longestIncreasingRun(values []int) []bool {
+	tails := []int{} // index into values of the smallest tail per length
+	prev := make([]int, len(values))
+	for i, v := range values {
+		n := sort.Search(len(tails), func(k int) bool { return values[tails[k]] >= v })
+		if n > 0 {
+			prev[i] = tails[n-1]
+		} else {
+			prev[i] = -1
+		}
+		if n == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[n] = i
+		}
+	}
+	marked := make([]bool, len(values))
+	if len(tails) == 0 {
+		return marked
+	}
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		marked[i] = true
+	}
+	return marked
+}
+
+func loadCollectionSubscription(collectionID uint) (*CollectionSubscription, error) {
+	var sub CollectionSubscription
+	result := db.Where("collection_id = ?", collectionID).Limit(1).Find(&sub)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &sub, nil
+}
+
+func latestCollectionSnapshot(collectionID uint) (*CollectionSnapshot, error) {
+	var snapshot CollectionSnapshot
+	result := db.Where("collection_id = ?", collectionID).Order("id DESC").Limit(1).Find(&snapshot)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &snapshot, nil
+}
+
+func deleteCollectionSubscription(tx *gorm.DB, collectionID uint) error {
+	if err := tx.Where("collection_id = ?", collectionID).Delete(&CollectionSnapshot{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("collection_id = ?", collectionID).Delete(&CollectionSubscription{}).Error
+}
+
+var (
+	subscriptionChecksMu sync.Mutex
+	subscriptionChecks   = map[uint]bool{}
+)
+
+var errSubscriptionCheckRunning = errors.New("该歌单正在检查更新")
+
+// checkCollectionSubscription fetches the collection's tracks and records a
+// snapshot when they changed. New tracks are queued for download when the
+// subscription asks for it. The returned snapshot is nil when nothing changed.
+func checkCollectionSubscription(collection *Collection) (*CollectionSnapshot, error) {
+	if !collection.isImported() {
+		return nil, errors.New("只有导入的歌单可以订阅")
+	}
+	subscriptionChecksMu.Lock()
+	if subscriptionChecks[collection.ID] {
+		subscriptionChecksMu.Unlock()
+		return nil, errSubscriptionCheckRunning
+	}
+	subscriptionChecks[collection.ID] = true
+	subscriptionChecksMu.Unlock()
+	defer func() {
+		subscriptionChecksMu.Lock()
+		delete(subscriptionChecks, collection.ID)
+		subscriptionChecksMu.Unlock()
+	}()
+
+	sub, err := loadCollectionSubscription(collection.ID)
+	if err != nil {
+		return nil, errors.New("歌单未订阅")
+	}
+	now := subscriptionNow()
+	songs, fetchErr := subscriptionFetchSongs(collection)
+	sub.LastCheckedAt = now
+	sub.LastError = ""
+	if fetchErr != nil {
+		sub.LastError = fetchErr.Error()
+		_ = db.Save(sub).Error
+		return nil, fetchErr
+	}
+
+	current := subscriptionTracksFromSongs(songs)
+	previous, err := latestCollectionSnapshot(collection.ID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &CollectionSnapshot{CollectionID: collection.ID, TakenAt: now, TrackCount: len(current)}
+	diff := subscriptionDiff{Added: []subscriptionChange{}, Removed: []subscriptionChange{}, Moved: []subscriptionChange{}}
+	if previous == nil {
+		snapshot.Baseline = true
+	} else {
+		var previousTracks []subscriptionTrack
+		_ = json.Unmarshal([]byte(previous.Tracks), &previousTracks)
+		diff = diffSubscriptionTracks(previousTracks, current)
+		if diff.empty() {
+			return nil, db.Save(sub).Error
+		}
+	}
+
+	tracksJSON, _ := json.Marshal(current)
+	diffJSON, _ := json.Marshal(diff)
+	snapshot.Tracks = string(tracksJSON)
+	snapshot.Diff = string(diffJSON)
+	snapshot.Added, snapshot.Removed, snapshot.Moved = len(diff.Added), len(diff.Removed), len(diff.Moved)
+	queue := sub.AutoDownload && len(diff.Added) > 0
+	if queue {
+		snapshot.Queued = len(diff.Added)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(snapshot).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Collection{}).Where("id = ?", collection.ID).Update("track_count", len(current)).Error; err != nil {
+			return err
+		}
+		return pruneCollectionSnapshots(tx, collection.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Queue only once the snapshot is stored, so a failed write does not make
+	// the next check queue the same tracks again.
+	if queue {
+		queueSubscriptionDownloads(collection, diff.Added)
+	}
+	return snapshot, nil
+}
+
+// pruneCollectionSnapshots keeps the newest snapshots of a collection.
+func pruneCollectionSnapshots(tx *gorm.DB, collectionID uint) error {
+	var ids []uint
+	if err := tx.Model(&CollectionSnapshot{}).Where("collection_id = ?", collectionID).
+		Order("id DESC").Offset(maxSubscriptionSnapshots).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", ids).Delete(&CollectionSnapshot{}).Error
+}
+
+// queueSubscriptionDownloads saves new tracks in the background, skipping
+// songs already downloaded. The playlist context lets download routes and
+// filename templates see the collection.
+func queueSubscriptionDownloads(collection *Collection, added []subscriptionChange) {
+	songs := make([]model.Song, 0, len(added))
+	for _, change := range added {
+		song := change.Track.song()
+		song.Extra["playlist"] = collection.Name
+		song.Extra["playlist_index"] = strconv.Itoa(change.Position)
+		song.Extra["collection_id"] = strconv.FormatUint(uint64(collection.ID), 10)
+		songs = append(songs, song)
+	}
+	go func() {
+		settings := subscriptionSettings()
+		target := core.WebDownloadTarget(settings)
+		dedupSet, _ := core.LoadDownloadDedupSet()
+		for i := range songs {
+			result, err := subscriptionDownloadSong(&songs[i], target, true, true, dedupSet)
+			if err == nil && result != nil && !result.Skipped {
+				indexAutoCachedLocalMusic(result, settings.DownloadDir)
+			}
+		}
+	}()
+}
+
+// checkDueSubscriptions checks every enabled subscription whose interval has
+// passed since its last check. Subscriptions already being checked are skipped.
+func checkDueSubscriptions(ctx context.Context) (refreshCollectionsReport, error) {
+	report := refreshCollectionsReport{Failed: []string{}}
+	var subs []CollectionSubscription
+	if err := db.Where("enabled = ?", true).Order("collection_id").Find(&subs).Error; err != nil {
+		return report, err
+	}
+	now := subscriptionNow()
+	for _, sub := range subs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		interval := time.Duration(normalizeSubscriptionInterval(sub.IntervalHours)) * time.Hour
+		if !sub.LastCheckedAt.IsZero() && now.Sub(sub.LastCheckedAt) < interval {
+			continue
+		}
+		collection, err := loadCollection(strconv.FormatUint(uint64(sub.CollectionID), 10))
+		if err != nil {
+			_ = deleteCollectionSubscription(db, sub.CollectionID)
+			continue
+		}
+		snapshot, err := checkCollectionSubscription(collection)
+		switch {
+		case errors.Is(err, errSubscriptionCheckRunning):
+		case err != nil:
+			report.Failed = append(report.Failed, collection.Name)
+		default:
+			if snapshot != nil && !snapshot.Baseline {
+				report.Changed++
+			}
+			report.Refreshed++
+		}
+	}
+	return report, nil
+}
+
+func normalizeSubscriptionInterval(hours int) int {
+	if hours <= 0 {
+		return defaultSubscriptionIntervalHours
+	}
+	return min(hours, maxSubscriptionIntervalHours)
+}
+
+func subscriptionStatusJSON(collection *Collection) gin.H {
+	status := gin.H{
+		"collection_id":  collection.ID,
+		"subscribed":     false,
+		"enabled":        false,
+		"auto_download":  false,
+		"interval_hours": defaultSubscriptionIntervalHours,
+	}
+	if sub, err := loadCollectionSubscription(collection.ID); err == nil {
+		status["subscribed"] = true
+		status["enabled"] = sub.Enabled
+		status["auto_download"] = sub.AutoDownload
+		status["interval_hours"] = normalizeSubscriptionInterval(sub.IntervalHours)
+		status["last_checked_at"] = sub.LastCheckedAt
+		status["last_error"] = sub.LastError
+	}
+	return status
+}
+
+func subscriptionChangeJSON(snapshot *CollectionSnapshot) gin.H {
+	var diff subscriptionDiff
+	_ = json.Unmarshal([]byte(snapshot.Diff), &diff)
+	return gin.H{
+		"id":          snapshot.ID,
+		"taken_at":    snapshot.TakenAt,
+		"track_count": snapshot.TrackCount,
+		"baseline":    snapshot.Baseline,
+		"queued":      snapshot.Queued,
+		"added":       nonNilChanges(diff.Added),
+		"removed":     nonNilChanges(diff.Removed),
+		"moved":       nonNilChanges(diff.Moved),
+	}
+}
+
+func nonNilChanges(changes []subscriptionChange) []subscriptionChange {
+	if changes == nil {
+		return []subscriptionChange{}
+	}
+	return changes
+}
+
+type subscriptionRequest struct {
+	Enabled       *bool `json:"enabled"`
+	AutoDownload  *bool `json:"auto_download"`
+	IntervalHours int   `json:"interval_hours"`
+}
+
+// RegisterSubscriptionRoutes exposes imported collection subscriptions under
+// /collections/:id: GET/PUT/DELETE subscription, POST subscription/check
+// and the GET changes feed.
+func RegisterSubscriptionRoutes(api *gin.RouterGroup) {
+	colAPI := api.Group("/collections")
+	loadImported := func(c *gin.Context) (*Collection, bool) {
+		collection, err := loadCollection(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "歌单不存在"})
+			return nil, false
+		}
+		if !collection.isImported() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "只有导入的歌单可以订阅"})
+			return nil, false
+		}
+		return collection, true
+	}
+
+	colAPI.GET("/:id/subscription", func(c *gin.Context) {
+		collection, ok := loadImported(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, subscriptionStatusJSON(collection))
+	})
+
+	colAPI.PUT("/:id/subscription", func(c *gin.Context) {
+		collection, ok := loadImported(c)
+		if !ok {
+			return
+		}
+		var req subscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+			return
+		}
+		sub, err := loadCollectionSubscription(collection.ID)
+		created := err != nil
+		if created {
+			sub = &CollectionSubscription{CollectionID: collection.ID, Enabled: true}
+		}
+		if req.Enabled != nil {
+			sub.Enabled = *req.Enabled
+		}
+		if req.AutoDownload != nil {
+			sub.AutoDownload = *req.AutoDownload
+		}
+		if req.IntervalHours != 0 || created {
+			sub.IntervalHours = normalizeSubscriptionInterval(req.IntervalHours)
+		}
+		if err := db.Save(sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存订阅失败"})
+			return
+		}
+		if created {
+			// 订阅后立即记录基准快照，之后的检查才有对比对象；失败时记录在 last_error。
+			_, _ = checkCollectionSubscription(collection)
+		}
+		c.JSON(http.StatusOK, subscriptionStatusJSON(collection))
+	})
+
+	colAPI.DELETE("/:id/subscription", func(c *gin.Context) {
+		collection, ok := loadImported(c)
+		if !ok {
+			return
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return deleteCollectionSubscription(tx, collection.ID)
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "取消订阅失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	colAPI.POST("/:id/subscription/check", func(c *gin.Context) {
+		collection, ok := loadImported(c)
+		if !ok {
+			return
+		}
+		snapshot, err := checkCollectionSubscription(collection)
+		switch {
+		case errors.Is(err, errSubscriptionCheckRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusBadGateway, gin.H{"error": "检查更新失败: " + err.Error()})
+		case snapshot == nil:
+			c.JSON(http.StatusOK, gin.H{"changed": false})
+		default:
+			c.JSON(http.StatusOK, gin.H{"changed": true, "change": subscriptionChangeJSON(snapshot)})
+		}
+	})
+
+	colAPI.GET("/:id/changes", func(c *gin.Context) {
+		collection, ok := loadImported(c)
+		if !ok {
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		limit = min(max(limit, 1), maxSubscriptionSnapshots)
+		query := db.Where("collection_id = ?", collection.ID).Order("id DESC").Limit(limit + 1)
+		if before, err := strconv.ParseUint(c.Query("before"), 10, 64); err == nil && before > 0 {
+			query = query.Where("id < ?", before)
+		}
+		var snapshots []CollectionSnapshot
+		if err := query.Find(&snapshots).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取变更失败"})
+			return
+		}
+		resp := gin.H{"subscription": subscriptionStatusJSON(collection)}
+		if len(snapshots) > limit {
+			snapshots = snapshots[:limit]
+			resp["next_before"] = snapshots[limit-1].ID
+		}
+		changes := make([]gin.H, 0, len(snapshots))
+		for i := range snapshots {
+			changes = append(changes, subscriptionChangeJSON(&snapshots[i]))
+		}
+		resp["changes"] = changes
+		c.JSON(http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,230 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"github.com/guohuiyuan/music-lib/model"
+)
+
+func subscriptionTestTracks(ids ...string) []subscriptionTrack {
+	tracks := make([]subscriptionTrack, 0, len(ids))
+	for _, id := range ids {
+		tracks = append(tracks, subscriptionTrack{ID: id, Source: "qq", Name: "Song " + id})
+	}
+	return tracks
+}
+
+func subscriptionChangeIDs(changes []subscriptionChange) string {
+	out := ""
+	for _, change := range changes {
+		out += fmt.Sprintf("%s@%d ", change.Track.ID, change.Position)
+	}
+	return out
+}
+
+func TestDiffSubscriptionTracks(t *testing.T) {
+	tests := []struct {
+		name                  string
+		previous, current     []string
+		added, removed, moved string
+	}{
+		{name: "unchanged", previous: []string{"a", "b", "c"}, current: []string{"a", "b", "c"}},
+		{name: "added and removed", previous: []string{"a", "b", "c"}, current: []string{"a", "c", "d"}, added: "d@3 ", removed: "b@2 "},
+		{name: "one track moved to top", previous: []string{"a", "b", "c", "d"}, current: []string{"d", "a", "b", "c"}, moved: "d@1 "},
+		{name: "swap", previous: []string{"a", "b"}, current: []string{"b", "a"}, moved: "b@1 "},
+	}
+	for _, tt := range tests {
+		diff := diffSubscriptionTracks(subscriptionTestTracks(tt.previous...), subscriptionTestTracks(tt.current...))
+		if got := subscriptionChangeIDs(diff.Added); got != tt.added {
+			t.Fatalf("%s: added = %q, want %q", tt.name, got, tt.added)
+		}
+		if got := subscriptionChangeIDs(diff.Removed); got != tt.removed {
+			t.Fatalf("%s: removed = %q, want %q", tt.name, got, tt.removed)
+		}
+		if got := subscriptionChangeIDs(diff.Moved); got != tt.moved {
+			t.Fatalf("%s: moved = %q, want %q", tt.name, got, tt.moved)
+		}
+	}
+}
+
+func TestSubscriptionRecordsChangesAndQueuesNewSongs(t *testing.T) {
+	initCollectionDBForTest(t)
+	withLocalMusicDownloadDir(t, t.TempDir())
+
+	upstream := []model.Song{
+		{ID: "1", Source: "qq", Name: "One", Artist: "A"},
+		{ID: "2", Source: "qq", Name: "Two", Artist: "B"},
+	}
+	originalFetch, originalDownload, originalNow := subscriptionFetchSongs, subscriptionDownloadSong, subscriptionNow
+	subscriptionFetchSongs = func(*Collection) ([]model.Song, error) { return upstream, nil }
+	downloaded := make(chan model.Song, 4)
+	subscriptionDownloadSong = func(song *model.Song, _ core.DownloadTarget, _, _ bool, _ map[string]struct{}) (*core.DownloadedSong, error) {
+		downloaded <- *song
+		return &core.DownloadedSong{Skipped: true}, nil
+	}
+	now := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	subscriptionNow = func() time.Time { return now }
+	t.Cleanup(func() {
+		subscriptionFetchSongs, subscriptionDownloadSong, subscriptionNow = originalFetch, originalDownload, originalNow
+	})
+
+	collection := Collection{Name: "每日推荐", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "42"}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	manual := Collection{Name: "Mine", Kind: collectionKindManual, ContentType: collectionContentPlaylist, Source: "local"}
+	if err := db.Create(&manual).Error; err != nil {
+		t.Fatalf("create manual collection: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterSubscriptionRoutes(router.Group(""))
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var reader *bytes.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, reader))
+		return rec
+	}
+
+	if rec := do(http.MethodPut, fmt.Sprintf("/collections/%d/subscription", manual.ID), gin.H{}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("manual subscription status = %d, want 400", rec.Code)
+	}
+	base := fmt.Sprintf("/collections/%d", collection.ID)
+	if rec := do(http.MethodPut, base+"/subscription", gin.H{"auto_download": true}); rec.Code != http.StatusOK {
+		t.Fatalf("subscribe status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	// Nothing changed upstream: no new snapshot.
+	rec := do(http.MethodPost, base+"/subscription/check", nil)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"changed":false`)) {
+		t.Fatalf("unchanged check = %d %s", rec.Code, rec.Body.String())
+	}
+
+	upstream = []model.Song{
+		{ID: "3", Source: "qq", Name: "Three", Artist: "C"},
+		{ID: "1", Source: "qq", Name: "One", Artist: "A"},
+	}
+	rec = do(http.MethodPost, base+"/subscription/check", nil)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"changed":true`)) {
+		t.Fatalf("changed check = %d %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case song := <-downloaded:
+		if song.ID != "3" || song.Extra["playlist"] != "每日推荐" || song.Extra["playlist_index"] != "1" {
+			t.Fatalf("queued song = %+v", song)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("new song was not queued for download")
+	}
+
+	rec = do(http.MethodGet, base+"/changes?limit=1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("changes status = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var feed struct {
+		NextBefore uint `json:"next_before"`
+		Changes    []struct {
+			Baseline bool                 `json:"baseline"`
+			Queued   int                  `json:"queued"`
+			Added    []subscriptionChange `json:"added"`
+			Removed  []subscriptionChange `json:"removed"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("decode changes: %v", err)
+	}
+	if len(feed.Changes) != 1 || feed.NextBefore == 0 {
+		t.Fatalf("feed = %+v, want one change and a next page", feed)
+	}
+	change := feed.Changes[0]
+	if change.Baseline || change.Queued != 1 || subscriptionChangeIDs(change.Added) != "3@1 " || subscriptionChangeIDs(change.Removed) != "2@2 " {
+		t.Fatalf("change = %+v", change)
+	}
+
+	rec = do(http.MethodGet, fmt.Sprintf("%s/changes?before=%d", base, feed.NextBefore), nil)
+	if !bytes.Contains(rec.Body.Bytes(), []byte(`"baseline":true`)) {
+		t.Fatalf("older page should hold the baseline: %s", rec.Body.String())
+	}
+
+	var reloaded Collection
+	if err := db.First(&reloaded, collection.ID).Error; err != nil || reloaded.TrackCount != 2 {
+		t.Fatalf("track count = %d, err=%v", reloaded.TrackCount, err)
+	}
+
+	if rec := do(http.MethodDelete, base+"/subscription", nil); rec.Code != http.StatusOK {
+		t.Fatalf("unsubscribe status = %d", rec.Code)
+	}
+	var remaining int64
+	db.Model(&CollectionSnapshot{}).Where("collection_id = ?", collection.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("snapshots after unsubscribe = %d, want 0", remaining)
+	}
+}
+
+func TestSubscriptionQueuesDownloadsOnlyAfterSnapshotIsStored(t *testing.T) {
+	initCollectionDBForTest(t)
+	withLocalMusicDownloadDir(t, t.TempDir())
+
+	upstream := []model.Song{{ID: "1", Source: "qq", Name: "One", Artist: "A"}}
+	originalFetch, originalDownload := subscriptionFetchSongs, subscriptionDownloadSong
+	subscriptionFetchSongs = func(*Collection) ([]model.Song, error) { return upstream, nil }
+	downloaded := make(chan model.Song, 4)
+	subscriptionDownloadSong = func(song *model.Song, _ core.DownloadTarget, _, _ bool, _ map[string]struct{}) (*core.DownloadedSong, error) {
+		downloaded <- *song
+		return &core.DownloadedSong{Skipped: true}, nil
+	}
+	t.Cleanup(func() { subscriptionFetchSongs, subscriptionDownloadSong = originalFetch, originalDownload })
+
+	collection := Collection{Name: "每日推荐", Kind: collectionKindImported, ContentType: collectionContentPlaylist, Source: "qq", ExternalID: "42"}
+	if err := db.Create(&collection).Error; err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	if err := db.Create(&CollectionSubscription{CollectionID: collection.ID, Enabled: true, AutoDownload: true}).Error; err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	if _, err := checkCollectionSubscription(&collection); err != nil {
+		t.Fatalf("baseline check error = %v", err)
+	}
+
+	upstream = append(upstream, model.Song{ID: "2", Source: "qq", Name: "Two", Artist: "B"})
+	if err := db.Exec("CREATE TRIGGER fail_snapshot BEFORE INSERT ON collection_snapshots BEGIN SELECT RAISE(ABORT, 'disk full'); END").Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	if _, err := checkCollectionSubscription(&collection); err == nil {
+		t.Fatal("check with a failing snapshot write should fail")
+	}
+	select {
+	case song := <-downloaded:
+		t.Fatalf("queued %s although the snapshot was not stored", song.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	db.Exec("DROP TRIGGER fail_snapshot")
+	snapshot, err := checkCollectionSubscription(&collection)
+	if err != nil || snapshot == nil || snapshot.Queued != 1 {
+		t.Fatalf("retry check = %+v, %v", snapshot, err)
+	}
+	select {
+	case song := <-downloaded:
+		if song.ID != "2" {
+			t.Fatalf("queued song = %+v", song)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("new song was not queued after the snapshot was stored")
+	}
+}
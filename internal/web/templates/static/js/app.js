@@ -20,6 +20,15 @@ const DOWNLOAD_DIR_PRESET_VALUES = [
 const DOWNLOAD_DIR_PRESETS = new Set(DOWNLOAD_DIR_PRESET_VALUES);
 const DEFAULT_UPDATE_REPO_URL = "https://github.com/guohuiyuan/go-music-dl";
 const DEFAULT_GITHUB_PROXY_URL = "https://edgeone.gh-proxy.com";
+const LYRIC_DOWNLOAD_FORMATS = ["lrc", "elrc", "srt", "vtt", "ass"];
+const LYRIC_MODES = ["original", "translation", "stacked", "side_by_side"];
+const PLAYLIST_FILE_FORMATS = [
+  "m3u8",
+  "m3u8,xspf",
+  "m3u8,pls",
+  "m3u8,xspf,pls",
+  "none",
+];
 const OPEN_CONFIG_QUERY = "open_config";
 const GITHUB_PROXY_PRESETS = [
   "https://edgeone.gh-proxy.com",
@@ -51,6 +60,19 @@ let webSettings = {
   vgChangeAudio: false,
   vgChangeLyric: false,
   vgExportVideo: false,
+  verifyDownloadDuration: false,
+  id3Version: 3,
+  coverMaxSize: 1200,
+  coverJpegQuality: 90,
+  coverSidecar: "",
+  lyricDownloadFormat: "lrc",
+  lyricMode: "stacked",
+  lyricRomanization: false,
+  downloadRoutes: [],
+  playlistFileFormats: "m3u8",
+  schedulerInDesktop: false,
+  writeRatingTags: false,
+  trashRetentionDays: 30,
 };
 
 function normalizeWebSettings(raw) {
@@ -72,6 +94,19 @@ function normalizeWebSettings(raw) {
     vgChangeAudio: false,
     vgChangeLyric: false,
     vgExportVideo: false,
+    verifyDownloadDuration: false,
+    id3Version: 3,
+    coverMaxSize: 1200,
+    coverJpegQuality: 90,
+    coverSidecar: "",
+    lyricDownloadFormat: "lrc",
+    lyricMode: "stacked",
+    lyricRomanization: false,
+    downloadRoutes: [],
+    playlistFileFormats: "m3u8",
+    schedulerInDesktop: false,
+    writeRatingTags: false,
+    trashRetentionDays: 30,
   };
 
   if (!raw || typeof raw !== "object") {
@@ -135,6 +170,47 @@ function normalizeWebSettings(raw) {
   if (typeof raw.vgExportVideo === "boolean") {
     next.vgExportVideo = raw.vgExportVideo;
   }
+  if (typeof raw.verifyDownloadDuration === "boolean") {
+    next.verifyDownloadDuration = raw.verifyDownloadDuration;
+  }
+  if (raw.id3Version === 4 || raw.id3Version === "4") {
+    next.id3Version = 4;
+  }
+  if (Number.isInteger(raw.coverMaxSize) && raw.coverMaxSize > 0) {
+    next.coverMaxSize = Math.min(Math.max(raw.coverMaxSize, 100), 4000);
+  }
+  if (Number.isInteger(raw.coverJpegQuality) && raw.coverJpegQuality > 0) {
+    next.coverJpegQuality = Math.min(Math.max(raw.coverJpegQuality, 30), 100);
+  }
+  if (raw.coverSidecar === "folder.jpg" || raw.coverSidecar === "cover.jpg") {
+    next.coverSidecar = raw.coverSidecar;
+  }
+  if (LYRIC_DOWNLOAD_FORMATS.includes(raw.lyricDownloadFormat)) {
+    next.lyricDownloadFormat = raw.lyricDownloadFormat;
+  }
+  if (LYRIC_MODES.includes(raw.lyricMode)) {
+    next.lyricMode = raw.lyricMode;
+  }
+  if (typeof raw.lyricRomanization === "boolean") {
+    next.lyricRomanization = raw.lyricRomanization;
+  }
+  if (PLAYLIST_FILE_FORMATS.includes(raw.playlistFileFormats)) {
+    next.playlistFileFormats = raw.playlistFileFormats;
+  }
+  if (typeof raw.schedulerInDesktop === "boolean") {
+    next.schedulerInDesktop = raw.schedulerInDesktop;
+  }
+  if (typeof raw.writeRatingTags === "boolean") {
+    next.writeRatingTags = raw.writeRatingTags;
+  }
+  if (Number.isInteger(raw.trashRetentionDays) && raw.trashRetentionDays > 0) {
+    next.trashRetentionDays = Math.min(raw.trashRetentionDays, 3650);
+  }
+  if (Array.isArray(raw.downloadRoutes)) {
+    next.downloadRoutes = raw.downloadRoutes.filter(
+      (route) => route && typeof route === "object" && !Array.isArray(route),
+    );
+  }
   return next;
 }
 
@@ -238,6 +314,44 @@ function bindDownloadDirPresetEvents() {
   dirInput.addEventListener("input", syncDownloadDirPresetFromInput);
 }
 
+let filenamePreviewTimer = null;
+
+async function refreshFilenameTemplatePreview() {
+  const input = document.getElementById("setting-download-filename-template");
+  const preview = document.getElementById("setting-filename-preview");
+  if (!input || !preview) return;
+
+  const template = String(input.value || "").trim();
+  try {
+    const response = await fetch(
+      `${API_ROOT}/api/filename_preview?template=${encodeURIComponent(template)}`,
+    );
+    const data = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      preview.textContent = data.error || "模板预览失败";
+      preview.classList.add("is-error");
+      return;
+    }
+    preview.classList.remove("is-error");
+    preview.textContent = (data.previews || [])
+      .map((item) => `${item.label}：${item.filename}`)
+      .join("\n");
+  } catch (_) {
+    preview.textContent = "";
+  }
+}
+
+function bindFilenameTemplatePreview() {
+  const input = document.getElementById("setting-download-filename-template");
+  if (!input || input.dataset.previewBound === "1") return;
+
+  input.dataset.previewBound = "1";
+  input.addEventListener("input", () => {
+    clearTimeout(filenamePreviewTimer);
+    filenamePreviewTimer = setTimeout(refreshFilenameTemplatePreview, 300);
+  });
+}
+
 function applyWebSettings(settings) {
   const wasAutoSwitchInvalidSourcesEnabled =
     isAutoSwitchInvalidSourcesEnabled();
@@ -262,6 +376,8 @@ function applyWebSettings(settings) {
   if (filenameTemplateInput) {
     filenameTemplateInput.value = webSettings.downloadFilenameTemplate;
   }
+  bindFilenameTemplatePreview();
+  refreshFilenameTemplatePreview();
 
   const floatingLyricsToggle = document.getElementById(
     "setting-floating-lyrics",
@@ -284,6 +400,74 @@ function applyWebSettings(settings) {
     );
   }
 
+  const id3VersionInput = document.getElementById("setting-id3-version");
+  if (id3VersionInput) {
+    id3VersionInput.value = String(webSettings.id3Version === 4 ? 4 : 3);
+  }
+  const coverMaxSizeInput = document.getElementById("setting-cover-max-size");
+  if (coverMaxSizeInput) {
+    coverMaxSizeInput.value = String(webSettings.coverMaxSize || 1200);
+  }
+  const coverQualityInput = document.getElementById(
+    "setting-cover-jpeg-quality",
+  );
+  if (coverQualityInput) {
+    coverQualityInput.value = String(webSettings.coverJpegQuality || 90);
+  }
+  const coverSidecarInput = document.getElementById("setting-cover-sidecar");
+  if (coverSidecarInput) {
+    coverSidecarInput.value = webSettings.coverSidecar || "";
+  }
+  const lyricFormatInput = document.getElementById(
+    "setting-lyric-download-format",
+  );
+  if (lyricFormatInput) {
+    lyricFormatInput.value = webSettings.lyricDownloadFormat || "lrc";
+  }
+  const playlistFormatsInput = document.getElementById(
+    "setting-playlist-file-formats",
+  );
+  if (playlistFormatsInput) {
+    playlistFormatsInput.value = webSettings.playlistFileFormats || "m3u8";
+  }
+  const lyricModeInput = document.getElementById("setting-lyric-mode");
+  if (lyricModeInput) {
+    lyricModeInput.value = webSettings.lyricMode || "stacked";
+  }
+  const lyricRomanizationToggle = document.getElementById(
+    "setting-lyric-romanization",
+  );
+  if (lyricRomanizationToggle) {
+    lyricRomanizationToggle.checked = webSettings.lyricRomanization;
+  }
+  const schedulerInDesktopToggle = document.getElementById(
+    "setting-scheduler-in-desktop",
+  );
+  if (schedulerInDesktopToggle) {
+    schedulerInDesktopToggle.checked = webSettings.schedulerInDesktop;
+  }
+  const writeRatingTagsToggle = document.getElementById(
+    "setting-write-rating-tags",
+  );
+  if (writeRatingTagsToggle) {
+    writeRatingTagsToggle.checked = webSettings.writeRatingTags;
+  }
+  const trashRetentionInput = document.getElementById(
+    "setting-trash-retention-days",
+  );
+  if (trashRetentionInput) {
+    trashRetentionInput.value = String(webSettings.trashRetentionDays || 30);
+  }
+
+  const downloadRoutesInput = document.getElementById(
+    "setting-download-routes",
+  );
+  if (downloadRoutesInput) {
+    downloadRoutesInput.value = webSettings.downloadRoutes.length
+      ? JSON.stringify(webSettings.downloadRoutes, null, 2)
+      : "";
+  }
+
   const autoSwitchInvalidSourcesToggle = document.getElementById(
     "setting-auto-switch-invalid-sources",
   );
@@ -299,6 +483,13 @@ function applyWebSettings(settings) {
     autoCacheOnPlayToggle.checked = webSettings.autoCacheOnPlay;
   }
 
+  const verifyDownloadDurationToggle = document.getElementById(
+    "setting-verify-download-duration",
+  );
+  if (verifyDownloadDurationToggle) {
+    verifyDownloadDurationToggle.checked = webSettings.verifyDownloadDuration;
+  }
+
   const vgChangeCoverToggle = document.getElementById(
     "setting-vg-change-cover",
   );
@@ -504,6 +695,10 @@ function buildBrowserDownloadURL(
 }
 
 function buildLyricRequestURL(song, endpoint = "lyric", format = "auto") {
+  // 开启罗马音后，自动格式的歌词请求改为生成拼音 / 罗马字层（保留逐字时间）。
+  if (webSettings.lyricRomanization && (format || "auto") === "auto") {
+    format = "roma";
+  }
   const params = new URLSearchParams({
     id: String(song?.id || ""),
     source: String(song?.source || ""),
@@ -513,6 +708,9 @@ function buildLyricRequestURL(song, endpoint = "lyric", format = "auto") {
     duration: String(song?.duration || 0),
     format: String(format || "auto"),
   });
+  if (webSettings.lyricMode && webSettings.lyricMode !== "stacked") {
+    params.set("mode", webSettings.lyricMode);
+  }
 
   const extraValue =
     typeof song?.extra === "string"
@@ -526,10 +724,15 @@ function buildLyricRequestURL(song, endpoint = "lyric", format = "auto") {
 }
 
 function lyricURLsForSong(song) {
+  let download = buildLyricRequestURL(song, "download_lrc", "auto");
+  const target = webSettings.lyricDownloadFormat || "lrc";
+  if (target !== "lrc") {
+    download += `&target=${encodeURIComponent(target)}`;
+  }
   return {
     line: buildLyricRequestURL(song, "lyric", "line"),
     auto: buildLyricRequestURL(song, "lyric", "auto"),
-    download: buildLyricRequestURL(song, "download_lrc", "auto"),
+    download,
   };
 }
 
@@ -1948,6 +2151,75 @@ function localMusicSongFromTrack(track) {
   };
 }
 
+function songAnnotationTagsHTML(extra) {
+  const parts = [];
+  if (extra?.rating) {
+    parts.push(`<span class="tag tag-rating" title="评分">${escapeHTML(extra.rating)}★</span>`);
+  }
+  if (extra?.tags) {
+    parts.push(`<span class="tag tag-label" title="标签"><i class="fa-solid fa-tag"></i> ${escapeHTML(extra.tags)}</span>`);
+  }
+  if (extra?.note) {
+    parts.push(`<span class="tag tag-label" title="${escapeHTML(extra.note)}"><i class="fa-regular fa-note-sticky"></i></span>`);
+  }
+  return parts.join("");
+}
+
+function annotateSong(btn) {
+  const card = btn.closest(".song-card");
+  if (!card) return;
+  const extra = normalizeSongExtra(card.dataset.extra);
+  const rating = prompt(`评分（0-5，0 表示清除）`, extra.rating || "0");
+  if (rating === null) return;
+  const stars = parseInt(rating, 10);
+  if (!(stars >= 0 && stars <= 5)) return alert("评分只能是 0-5");
+  const tags = prompt("标签（用逗号分隔）", extra.tags || "");
+  if (tags === null) return;
+  const note = prompt("备注", extra.note || "");
+  if (note === null) return;
+
+  const body = { rating: stars, tags: tags.split(/[,，]/), note };
+  const colId = card.closest(".result-list")?.dataset.collectionId || "";
+  let url = `${API_ROOT}/local_music/annotation`;
+  if (colId && !isLocalMusicPageActive()) {
+    url = `${API_ROOT}/collections/${colId}/songs/annotation`;
+    body.source = card.dataset.source;
+  }
+  body.id = card.dataset.id;
+  fetch(url, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  })
+    .then((r) => r.json())
+    .then((res) => {
+      if (res.error) return alert(res.error);
+      if (res.warning) alert(res.warning);
+      refreshCurrentPageContent();
+    })
+    .catch(() => alert("保存标注失败"));
+}
+
+function filterSongsByAnnotation() {
+  const url = new URL(window.location.href);
+  const tag = prompt("只显示带有此标签的歌曲（留空不限）", url.searchParams.get("tag") || "");
+  if (tag === null) return;
+  const minRating = prompt("最低评分（0-5，0 不限）", url.searchParams.get("min_rating") || "0");
+  if (minRating === null) return;
+  const stars = parseInt(minRating, 10) || 0;
+  if (tag.trim()) url.searchParams.set("tag", tag.trim());
+  else url.searchParams.delete("tag");
+  if (stars > 0) url.searchParams.set("min_rating", String(Math.min(stars, 5)));
+  else url.searchParams.delete("min_rating");
+  url.searchParams.delete("page");
+  if (isLocalMusicPageActive()) {
+    history.replaceState(history.state, "", url.toString());
+    loadLocalMusicPage(1, { updateHistory: false });
+    return;
+  }
+  navigateTo(url.toString());
+}
+
 function renderLocalMusicPageCard(track) {
   const song = localMusicSongFromTrack(track);
   const extraJSON = serializeSongExtra(song.extra);
@@ -1988,6 +2260,7 @@ function renderLocalMusicPageCard(track) {
                 <div class="tags">
                     <span class="tag tag-local">本地</span>
                     <span class="tag tag-duration">${formatDuration(song.duration)}</span>
+                    ${songAnnotationTagsHTML(song.extra)}
                     <span class="tag tag-loading" id="size-${escapeHTML(song.id)}"><i class="fa fa-spinner fa-spin"></i></span>
                     <span class="tag tag-loading" id="bitrate-${escapeHTML(song.id)}"><i class="fa fa-circle-notch fa-spin"></i></span>
                 </div>
@@ -2001,6 +2274,9 @@ function renderLocalMusicPageCard(track) {
                 </button>
                 ${lyricButton}
                 ${coverButton}
+                <button type="button" class="btn-circle btn-annotate" title="评分/标签/备注" onclick="annotateSong(this)">
+                    <i class="fa-regular fa-star"></i>
+                </button>
                 <button type="button" class="btn-circle btn-delete-local" title="删除本地音乐" onclick="deleteLocalMusicFromButton(this)">
                     <i class="fa-solid fa-trash"></i>
                 </button>
@@ -2076,6 +2352,10 @@ async function loadLocalMusicPage(page = 1, options = {}) {
   if (options.force) {
     params.set("refresh", "1");
   }
+  const pageQuery = new URLSearchParams(window.location.search);
+  ["tag", "min_rating"].forEach((key) => {
+    if (pageQuery.get(key)) params.set(key, pageQuery.get(key));
+  });
 
   list.dataset.loading = "1";
   setLocalMusicPageHint("正在加载本地音乐...");
@@ -3295,7 +3575,8 @@ async function loadDownloadRecordsPage(page = 1) {
       const success = records.filter(r => r.Status === "success").length;
       const skipped = records.filter(r => r.Status === "skipped").length;
       const failed = records.filter(r => r.Status === "failed").length;
-      countEl.textContent = `共 ${total} 条  ·  本页成功 ${success}  ·  跳过 ${skipped}  ·  失败 ${failed}`;
+      const corrupt = records.filter(r => r.Status === "corrupt").length;
+      countEl.textContent = `共 ${total} 条  ·  本页成功 ${success}  ·  跳过 ${skipped}  ·  失败 ${failed}  ·  损坏 ${corrupt}`;
     }
 
     if (records.length === 0) {
@@ -3317,7 +3598,9 @@ async function loadDownloadRecordsPage(page = 1) {
         ? { className: "is-success", icon: "fa-check", label: "成功" }
         : r.Status === "skipped"
           ? { className: "is-skipped", icon: "fa-forward", label: "跳过" }
-          : { className: "is-failed", icon: "fa-xmark", label: "失败" };
+          : r.Status === "corrupt"
+            ? { className: "is-corrupt", icon: "fa-triangle-exclamation", label: "损坏" }
+            : { className: "is-failed", icon: "fa-xmark", label: "失败" };
       const errHint = r.Error ? ` title="${escapeHtml(r.Error)}"` : "";
       const time = r.CreatedAt ? new Date(r.CreatedAt).toLocaleString() : "";
       html += `<tr${errHint}>
@@ -3344,6 +3627,128 @@ async function loadDownloadRecordsPage(page = 1) {
   }
 }
 
+async function openScheduledJobsModal() {
+  const modal = document.getElementById("scheduledJobsModal");
+  if (!modal) return;
+  modal.style.display = "flex";
+  await loadScheduledJobs();
+}
+
+function closeScheduledJobsModal() {
+  const modal = document.getElementById("scheduledJobsModal");
+  if (modal) modal.style.display = "none";
+}
+
+async function scheduledJobsRequest(path, options = {}) {
+  const resp = await fetch(`${API_ROOT}/api/scheduler${path}`, {
+    ...options,
+    headers: { Accept: "application/json", "Content-Type": "application/json" },
+  });
+  const data = await resp.json().catch(() => null);
+  if (!resp.ok || !data || data.error) {
+    throw new Error((data && data.error) || `HTTP ${resp.status}`);
+  }
+  return data;
+}
+
+async function loadScheduledJobs() {
+  const statusEl = document.getElementById("scheduled-jobs-status");
+  const listEl = document.getElementById("scheduled-jobs-list");
+  if (statusEl) statusEl.textContent = "加载中...";
+  try {
+    const data = await scheduledJobsRequest("");
+    if (statusEl) {
+      statusEl.textContent = data.active
+        ? "定时任务运行中"
+        : "桌面版未开启定时任务，仅可手动运行";
+    }
+    const jobs = data.jobs || [];
+    if (jobs.length === 0) {
+      if (listEl) listEl.innerHTML = '<div class="download-records-empty"><div><i class="fa-regular fa-calendar"></i><br>暂无定时任务</div></div>';
+      return;
+    }
+    let html = `<table class="download-records-table">
+      <thead><tr><th>任务</th><th>时间</th><th>上次运行</th><th>操作</th></tr></thead><tbody>`;
+    for (const job of jobs) {
+      const status = job.running || job.last_status === "running"
+        ? { className: "is-skipped", icon: "fa-spinner", label: "运行中" }
+        : job.last_status === "success"
+          ? { className: "is-success", icon: "fa-check", label: "成功" }
+          : job.last_status === "failed"
+            ? { className: "is-failed", icon: "fa-xmark", label: "失败" }
+            : null;
+      const lastRun = job.last_run_at && !job.last_run_at.startsWith("0001")
+        ? new Date(job.last_run_at).toLocaleString()
+        : "从未运行";
+      const nextRun = job.next_run_at ? `下次 ${new Date(job.next_run_at).toLocaleString()}` : "未启用";
+      const hint = escapeHtml(job.last_error || job.last_message || "");
+      html += `<tr>
+        <td><label class="setting-toggle"><input type="checkbox" ${job.enabled ? "checked" : ""} onchange="updateScheduledJob(${job.id}, { enabled: this.checked })"><span class="setting-switch" aria-hidden="true"></span><span class="download-record-name">${escapeHtml(job.name)}</span></label></td>
+        <td><code>${escapeHtml(job.cron)}</code><div class="download-record-time">${escapeHtml(nextRun)}</div></td>
+        <td title="${hint}">${status ? `<span class="download-record-status ${status.className}"><i class="fa-solid ${status.icon}"></i>${status.label}</span>` : ""}<div class="download-record-time">${escapeHtml(lastRun)}</div></td>
+        <td><div class="utility-modal-actions">
+          <button type="button" class="btn-pill" onclick="editScheduledJobCron(${job.id}, '${escapeHtml(job.cron)}')">修改时间</button>
+          <button type="button" class="btn-pill" onclick="showScheduledJobRuns(${job.id})">历史</button>
+          <button type="button" class="btn-pill btn-pill-primary" ${job.running ? "disabled" : ""} onclick="runScheduledJobNow(${job.id})">立即运行</button>
+        </div></td>
+      </tr>`;
+    }
+    html += "</tbody></table>";
+    if (listEl) listEl.innerHTML = html;
+  } catch (err) {
+    if (statusEl) statusEl.textContent = "加载失败";
+    if (listEl) listEl.innerHTML = `<div class="download-records-error">加载失败: ${escapeHtml(err.message)}</div>`;
+  }
+}
+
+async function updateScheduledJob(jobId, changes) {
+  try {
+    await scheduledJobsRequest(`/jobs/${jobId}`, {
+      method: "PUT",
+      body: JSON.stringify(changes),
+    });
+  } catch (err) {
+    showToast("保存任务失败", err.message, "error");
+  }
+  await loadScheduledJobs();
+}
+
+async function editScheduledJobCron(jobId, cron) {
+  const next = prompt("cron 表达式（分 时 日 月 周）", cron);
+  if (next === null || next.trim() === "" || next.trim() === cron) return;
+  await updateScheduledJob(jobId, { cron: next.trim() });
+}
+
+async function runScheduledJobNow(jobId) {
+  try {
+    await scheduledJobsRequest(`/jobs/${jobId}/run`, { method: "POST" });
+    showToast("任务已开始", "完成后可在“历史”中查看结果", "success");
+  } catch (err) {
+    showToast("运行任务失败", err.message, "error");
+  }
+  await loadScheduledJobs();
+}
+
+async function showScheduledJobRuns(jobId) {
+  try {
+    const data = await scheduledJobsRequest(`/jobs/${jobId}/runs?limit=10`);
+    const runs = data.runs || [];
+    const lines = runs.map((run) => {
+      const when = new Date(run.started_at).toLocaleString();
+      const trigger = run.trigger === "manual" ? "手动" : "定时";
+      const result = run.status === "failed"
+        ? `失败: ${run.error}`
+        : run.status === "running"
+          ? "运行中"
+          : run.message || "成功";
+      return `${when} [${trigger}] ${result}`;
+    });
+    showToast(`${data.job.name} · 运行历史`, lines.join("\n") || "暂无运行记录", "info", 0);
+  } catch (err) {
+    showToast("读取运行历史失败", err.message, "error");
+  }
+}
+
 function closeDownloadRecordsModal() {
   const modal = document.getElementById("downloadRecordsModal");
   if (modal) modal.style.display = "none";
@@ -3705,9 +4110,28 @@ function openCookieModal() {
   openSystemConfig();
 }
 
+// parseDownloadRoutesInput 读取下载路由 JSON，格式错误时返回 null。
+function parseDownloadRoutesInput() {
+  const raw = String(
+    document.getElementById("setting-download-routes")?.value || "",
+  ).trim();
+  if (!raw) return [];
+  try {
+    const routes = JSON.parse(raw);
+    return Array.isArray(routes) ? routes : null;
+  } catch (_) {
+    return null;
+  }
+}
+
 async function saveCookies() {
   const webPageSizeInput = document.getElementById("setting-web-page-size");
   const cliPageSizeInput = document.getElementById("setting-cli-page-size");
+  const downloadRoutes = parseDownloadRoutesInput();
+  if (!downloadRoutes) {
+    showToast("下载路由格式错误", "请填写 JSON 数组，例如 [{\"format\": \"flac\", \"dir\": \"无损\"}]", "error");
+    return;
+  }
 
   const nextSettings = normalizeWebSettings({
     embedDownload: !!document.getElementById("setting-embed-download")?.checked,
@@ -3742,6 +4166,41 @@ async function saveCookies() {
       ?.checked,
     vgExportVideo: !!document.getElementById("setting-vg-export-video")
       ?.checked,
+    verifyDownloadDuration: !!document.getElementById(
+      "setting-verify-download-duration",
+    )?.checked,
+    id3Version: parsePositiveInt(
+      document.getElementById("setting-id3-version")?.value,
+      3,
+    ),
+    coverMaxSize: parsePositiveInt(
+      document.getElementById("setting-cover-max-size")?.value,
+      1200,
+    ),
+    coverJpegQuality: parsePositiveInt(
+      document.getElementById("setting-cover-jpeg-quality")?.value,
+      90,
+    ),
+    coverSidecar: document.getElementById("setting-cover-sidecar")?.value || "",
+    lyricDownloadFormat:
+      document.getElementById("setting-lyric-download-format")?.value || "lrc",
+    lyricMode:
+      document.getElementById("setting-lyric-mode")?.value || "stacked",
+    lyricRomanization: !!document.getElementById("setting-lyric-romanization")
+      ?.checked,
+    downloadRoutes,
+    playlistFileFormats:
+      document.getElementById("setting-playlist-file-formats")?.value ||
+      "m3u8",
+    schedulerInDesktop: !!document.getElementById(
+      "setting-scheduler-in-desktop",
+    )?.checked,
+    writeRatingTags: !!document.getElementById("setting-write-rating-tags")
+      ?.checked,
+    trashRetentionDays: parsePositiveInt(
+      document.getElementById("setting-trash-retention-days")?.value,
+      30,
+    ),
   });
 
   const data = {};
@@ -4602,7 +5061,7 @@ const KaraokeLyrics = (() => {
   function looksLikeRomajiLine(line) {
     const text = String(line?.text || "").trim();
     if (!text) return false;
-    const latinCount = (text.match(/[A-Za-z]/g) || []).length;
+    const latinCount = (text.match(/[A-Za-z\u00c0-\u024f]/g) || []).length;
     const cjkOrKanaCount = (text.match(/[\u3040-\u30ff\u3400-\u9fff]/g) || [])
       .length;
     return latinCount > 0 && latinCount >= cjkOrKanaCount;
@@ -5801,14 +6260,38 @@ function selectInvalidSongs() {
   selectInvalidSongCards();
 }
 
+// withPlaylistContext 为歌单 / 收藏夹中的歌曲补充 playlist 与 playlist_index，
+// 供文件名模板的 {playlist}、{index} 使用；收藏夹歌曲另带 collection_id 供下载路由匹配。
+function withPlaylistContext(song, card) {
+  const list = card.closest(".result-list");
+  const playlistName = String(list?.dataset.playlistName || "").trim();
+  if (!playlistName) return song;
+
+  let extra = {};
+  try {
+    extra = song.extra ? JSON.parse(song.extra) || {} : {};
+  } catch (_) {
+    extra = {};
+  }
+  const cards = Array.from(list.querySelectorAll(".song-card"));
+  const pageStart = Math.max(parsePositiveInt(list.dataset.pageStart, 1), 1);
+  extra.playlist = playlistName;
+  extra.playlist_index = String(pageStart + cards.indexOf(card));
+  if (list.dataset.collectionId) {
+    extra.collection_id = list.dataset.collectionId;
+  }
+  return { ...song, extra: JSON.stringify(extra) };
+}
+
 function getSelectedSongs() {
   const checkedBoxes = document.querySelectorAll(".song-checkbox:checked");
   const songs = [];
   checkedBoxes.forEach((cb) => {
     const card = cb.closest(".song-card");
     if (card) {
-      const song = songFromCard(card);
-      if (!song) return;
+      const cardSong = songFromCard(card);
+      if (!cardSong) return;
+      const song = withPlaylistContext(cardSong, card);
       const lyricURLs = lyricURLsForSong(song);
 
       songs.push({
@@ -5816,6 +6299,7 @@ function getSelectedSongs() {
         source: song.source,
         name: song.name,
         artist: song.artist,
+        album: song.album || "",
         duration: song.duration,
         extra: song.extra,
         url: buildDownloadURL(
@@ -5921,6 +6405,465 @@ function closeDownloadPanel() {
   if (panel) panel.style.display = "none";
 }
 
+// writeBatchPlaylistFiles 在歌单 / 收藏夹中批量下载后，按列表顺序写出歌单文件，
+// 返回追加到完成提示里的说明。
+async function writeBatchPlaylistFiles(songs) {
+  const list = document.querySelector(".result-list");
+  const playlistName = String(list?.dataset.playlistName || "").trim();
+  if (!playlistName || webSettings.playlistFileFormats === "none") return "";
+
+  try {
+    const response = await fetch(`${API_ROOT}/api/playlist_files`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        name: playlistName,
+        songs: songs.map((song) => ({
+          id: song.id,
+          source: song.source,
+          path: song.savedPath || "",
+          name: song.name,
+          artist: song.artist,
+          album: song.album || "",
+          duration: Number(song.duration) || 0,
+        })),
+      }),
+    });
+    const data = await response.json().catch(() => null);
+    if (!response.ok || !data) {
+      return `\n\n歌单文件未生成：${(data && data.error) || "请求失败"}`;
+    }
+    if (!data.files || data.files.length === 0) return "";
+    const names = data.files.map((file) => file.split(/[\\/]/).pop());
+    return `\n\n已生成歌单文件：${names.join("、")}`;
+  } catch (_) {
+    return "";
+  }
+}
+
+// generateCollectionPlaylistFiles 为自建歌单中已在本地的歌曲生成歌单文件。
+async function generateCollectionPlaylistFiles(collectionId) {
+  try {
+    const response = await fetch(
+      `${API_ROOT}/collections/${encodeURIComponent(collectionId)}/playlist_files`,
+      { method: "POST", headers: { Accept: "application/json" } },
+    );
+    const data = await response.json().catch(() => null);
+    if (!response.ok || !data || data.error) {
+      throw new Error((data && data.error) || "生成失败");
+    }
+    let message = `已写入：\n${data.files.join("\n")}\n共 ${data.entries} 首`;
+    if (data.missing && data.missing.length > 0) {
+      message += `，${data.missing.length} 首未在本地找到`;
+    }
+    showToast("歌单文件已生成", message, "success", 0);
+  } catch (error) {
+    showToast("歌单文件生成失败", error.message || "请稍后重试", "error");
+  }
+}
+
+async function collectionSubscriptionRequest(collectionId, path, options = {}) {
+  const response = await fetch(
+    `${API_ROOT}/collections/${encodeURIComponent(collectionId)}/${path}`,
+    {
+      ...options,
+      headers: { Accept: "application/json", "Content-Type": "application/json" },
+    },
+  );
+  const data = await response.json().catch(() => null);
+  if (!response.ok || !data || data.error) {
+    throw new Error((data && data.error) || "请求失败");
+  }
+  return data;
+}
+
+function describeCollectionChange(change) {
+  const when = new Date(change.taken_at).toLocaleString();
+  if (change.baseline) {
+    return `${when} 开始跟踪，共 ${change.track_count} 首`;
+  }
+  const parts = [];
+  if (change.added.length > 0) parts.push(`新增 ${change.added.length}`);
+  if (change.removed.length > 0) parts.push(`移除 ${change.removed.length}`);
+  if (change.moved.length > 0) parts.push(`调整顺序 ${change.moved.length}`);
+  if (change.queued > 0) parts.push(`已加入下载 ${change.queued}`);
+  const added = change.added
+    .slice(0, 5)
+    .map((item) => `  + ${item.track.name} - ${item.track.artist}`);
+  return [`${when} ${parts.join("，")}`, ...added].join("\n");
+}
+
+// 导入歌单的订阅：未订阅时询问是否订阅，已订阅时立即检查并展示最近的变化。
+async function openCollectionSubscription(collectionId) {
+  try {
+    const status = await collectionSubscriptionRequest(collectionId, "subscription");
+    if (!status.subscribed) {
+      if (!confirm("订阅后会定期检查该歌单的曲目变化，是否订阅？")) return;
+      const autoDownload = confirm("是否自动下载新增的歌曲？（已下载过的会跳过）");
+      const created = await collectionSubscriptionRequest(collectionId, "subscription", {
+        method: "PUT",
+        body: JSON.stringify({ enabled: true, auto_download: autoDownload }),
+      });
+      if (created.last_error) {
+        throw new Error(created.last_error);
+      }
+      showToast("已订阅歌单", `每 ${created.interval_hours} 小时检查一次更新`, "success");
+      return;
+    }
+
+    await collectionSubscriptionRequest(collectionId, "subscription/check", { method: "POST" });
+    const feed = await collectionSubscriptionRequest(collectionId, "changes?limit=5");
+    const lines = feed.changes.map(describeCollectionChange);
+    const autoText = status.auto_download ? "自动下载新歌：开启" : "自动下载新歌：关闭";
+    showToast("歌单变化", [autoText, ...lines].join("\n"), "info", 0);
+    if (confirm(`${autoText}\n\n是否取消订阅该歌单？`)) {
+      await collectionSubscriptionRequest(collectionId, "subscription", { method: "DELETE" });
+      showToast("已取消订阅", "", "success");
+    }
+  } catch (error) {
+    showToast("歌单订阅失败", error.message || "请稍后重试", "error");
+  }
+}
+
+// exportCollections 下载歌单导出文件，collectionId 为空时导出全部歌单。
+function exportCollections(collectionId = "") {
+  const csv = confirm("导出为 CSV？（取消则导出为 JSON，JSON 可完整还原歌单）");
+  const format = csv ? "csv" : "json";
+  const path = collectionId
+    ? `/collections/${encodeURIComponent(collectionId)}/export`
+    : "/collections/export";
+  window.location.href = `${API_ROOT}${path}?format=${format}`;
+}
+
+// importPlaylistFile 把其他播放器的 M3U / XSPF / PLS 歌单文件导入为自建歌单。
+async function importPlaylistFile(file) {
+  const online = confirm("本地找不到的歌曲是否在线搜索匹配？");
+  const form = new FormData();
+  form.append("file", file);
+  form.append("online", online ? "1" : "0");
+  try {
+    const response = await fetch(`${API_ROOT}/collections/import_playlist`, {
+      method: "POST",
+      headers: { Accept: "application/json" },
+      body: form,
+    });
+    const data = await response.json().catch(() => null);
+    if (!response.ok || !data || data.error) {
+      throw new Error((data && data.error) || "导入失败");
+    }
+    const lines = [
+      `已导入歌单「${data.name}」，共 ${data.total} 首`,
+      `路径匹配 ${data.by_path}，歌名匹配 ${data.by_tag}，在线匹配 ${data.online}`,
+    ];
+    if (data.unmatched.length > 0) {
+      lines.push(`未匹配 ${data.unmatched.length} 首：`);
+      data.unmatched.slice(0, 10).forEach((entry) => {
+        lines.push(`  #${entry.index} ${entry.artist ? `${entry.artist} - ` : ""}${entry.title || entry.location}`);
+      });
+    }
+    showToast("歌单导入完成", lines.join("\n"), "success", 0);
+    openCollectionManager();
+  } catch (error) {
+    showToast("歌单导入失败", error.message || "请稍后重试", "error");
+  }
+}
+
+let csvImportReviewId = null;
+let csvImportReviewTimer = null;
+let csvImportReviewRows = {};
+
+// importThirdPartyCSV 上传其他平台导出的 CSV（歌名 / 歌手 / 专辑 / 时长），
+// 服务端在线匹配，低匹配度的歌曲进入确认队列。
+async function importThirdPartyCSV(file) {
+  const sources = prompt("在线匹配使用的音乐源（逗号分隔，如 qq,netease；留空使用默认搜索源）", "");
+  if (sources === null) return;
+  const form = new FormData();
+  form.append("file", file);
+  form.append("sources", sources.trim());
+  try {
+    const response = await fetch(`${API_ROOT}/collections/import_csv`, {
+      method: "POST",
+      headers: { Accept: "application/json" },
+      body: form,
+    });
+    const data = await response.json().catch(() => null);
+    if (!response.ok || !data || data.error) {
+      throw new Error((data && data.error) || "导入失败");
+    }
+    showToast("开始匹配", `歌单「${data.name}」共 ${data.total} 首，匹配度高的歌曲会直接加入`, "info");
+    openCSVImportReview(data.id);
+  } catch (error) {
+    showToast("CSV 导入失败", error.message || "请稍后重试", "error");
+  }
+}
+
+// openPendingCSVImportReview 打开最近一个仍有待确认歌曲的 CSV 导入。
+async function openPendingCSVImportReview() {
+  try {
+    const resp = await fetch(`${API_ROOT}/collections/csv_imports`, { headers: { Accept: "application/json" } });
+    const data = await resp.json().catch(() => null);
+    if (!resp.ok || !data || data.error) {
+      throw new Error((data && data.error) || `HTTP ${resp.status}`);
+    }
+    const pending = (data.imports || []).find((imp) => imp.status !== "done");
+    if (!pending) {
+      showToast("没有待确认的导入", "CSV 导入的歌曲都已处理", "info");
+      return;
+    }
+    openCSVImportReview(pending.id);
+  } catch (error) {
+    showToast("加载失败", error.message || "请稍后重试", "error");
+  }
+}
+
+function openCSVImportReview(importId) {
+  const modal = document.getElementById("csvImportModal");
+  if (!modal) return;
+  csvImportReviewId = importId;
+  modal.style.display = "flex";
+  loadCSVImportReview();
+}
+
+function openTrashModal() {
+  const modal = document.getElementById("trashModal");
+  if (!modal) return;
+  modal.style.display = "flex";
+  loadTrashItems();
+}
+
+function closeTrashModal() {
+  const modal = document.getElementById("trashModal");
+  if (modal) modal.style.display = "none";
+}
+
+async function trashRequest(path, options = {}) {
+  const resp = await fetch(`${API_ROOT}/api/trash${path}`, {
+    ...options,
+    headers: { Accept: "application/json" },
+  });
+  const data = await resp.json().catch(() => null);
+  if (handleConfigAuthResponse(resp, data)) {
+    throw new Error("需要管理员登录");
+  }
+  if (!resp.ok || !data || data.error) {
+    throw new Error((data && data.error) || `HTTP ${resp.status}`);
+  }
+  return data;
+}
+
+async function loadTrashItems() {
+  const statusEl = document.getElementById("trash-status");
+  const listEl = document.getElementById("trash-list");
+  try {
+    const data = await trashRequest("");
+    if (statusEl) {
+      statusEl.textContent = `共 ${data.items.length} 项，保留 ${data.retention_days} 天`;
+    }
+    if (!listEl) return;
+    if (data.items.length === 0) {
+      listEl.innerHTML = '<div class="download-records-empty"><div><i class="fa-solid fa-check"></i><br>回收站是空的</div></div>';
+      return;
+    }
+    let html = `<table class="download-records-table">
+      <thead><tr><th>类型</th><th>名称</th><th>删除时间</th><th>操作</th></tr></thead><tbody>`;
+    for (const item of data.items) {
+      const kind = item.kind === "collection" ? "歌单" : "本地音乐";
+      html += `<tr>
+        <td>${kind}</td>
+        <td><span class="download-record-name">${escapeHtml(item.name)}</span>${item.detail ? `<div class="download-record-time">${escapeHtml(item.detail)}</div>` : ""}</td>
+        <td><span class="download-record-time">${new Date(item.trashed_at).toLocaleString()}<br>${new Date(item.purge_at).toLocaleDateString()} 自动清除</span></td>
+        <td><div class="utility-modal-actions">
+          <button type="button" class="btn-pill btn-pill-primary" onclick="restoreTrashItem(${item.id})">还原</button>
+          <button type="button" class="btn-pill btn-pill-danger" onclick="purgeTrashItem(${item.id})">彻底删除</button>
+        </div></td>
+      </tr>`;
+    }
+    listEl.innerHTML = `${html}</tbody></table>`;
+  } catch (error) {
+    if (statusEl) statusEl.textContent = `加载失败：${error.message}`;
+  }
+}
+
+async function restoreTrashItem(itemId) {
+  try {
+    await trashRequest(`/${itemId}/restore`, { method: "POST" });
+    showToast("已还原", "", "success", 3000);
+    await loadTrashItems();
+    refreshCurrentPageContent();
+  } catch (error) {
+    showToast("还原失败", error.message || "请稍后重试", "error");
+  }
+}
+
+async function purgeTrashItem(itemId) {
+  if (!confirm("彻底删除后无法恢复，确定吗？")) return;
+  try {
+    await trashRequest(`/${itemId}`, { method: "DELETE" });
+    await loadTrashItems();
+  } catch (error) {
+    showToast("彻底删除失败", error.message || "请稍后重试", "error");
+  }
+}
+
+async function emptyTrash() {
+  if (!confirm("清空回收站后其中的歌单和本地音乐文件都无法恢复，确定吗？")) return;
+  try {
+    const data = await trashRequest("", { method: "DELETE" });
+    showToast("回收站已清空", `彻底删除 ${data.purged} 项`, "success", 3000);
+    await loadTrashItems();
+  } catch (error) {
+    showToast("清空回收站失败", error.message || "请稍后重试", "error");
+  }
+}
+
+function closeCSVImportModal() {
+  const modal = document.getElementById("csvImportModal");
+  if (modal) modal.style.display = "none";
+  window.clearTimeout(csvImportReviewTimer);
+  csvImportReviewId = null;
+}
+
+async function csvImportRequest(path, options = {}) {
+  const resp = await fetch(`${API_ROOT}/collections/csv_imports/${csvImportReviewId}${path}`, {
+    ...options,
+    headers: { Accept: "application/json", "Content-Type": "application/json" },
+  });
+  const data = await resp.json().catch(() => null);
+  if (!resp.ok || !data || data.error) {
+    throw new Error((data && data.error) || `HTTP ${resp.status}`);
+  }
+  return data;
+}
+
+function csvImportSongLabel(song, score) {
+  const label = `${song.name}${song.artist ? ` - ${song.artist}` : ""} (${song.source})`;
+  return score === undefined ? label : `${label} ${Math.round(score * 100)}%`;
+}
+
+async function loadCSVImportReview() {
+  window.clearTimeout(csvImportReviewTimer);
+  if (!csvImportReviewId) return;
+  const statusEl = document.getElementById("csv-import-status");
+  const listEl = document.getElementById("csv-import-list");
+  try {
+    const data = await csvImportRequest("?status=review");
+    const imp = data.import;
+    const counts = imp.counts || {};
+    const saved = (counts.matched || 0) + (counts.confirmed || 0);
+    if (imp.status === "matching") {
+      if (statusEl) statusEl.textContent = `「${imp.name}」匹配中... 已处理 ${imp.total - (counts.pending || 0)} / ${imp.total}`;
+      csvImportReviewTimer = window.setTimeout(loadCSVImportReview, 2000);
+    } else if (imp.status === "failed") {
+      if (statusEl) statusEl.textContent = `「${imp.name}」导入出错：${imp.error || "未知错误"}，已加入 ${saved} 首，重启服务后会继续`;
+    } else if (statusEl) {
+      statusEl.textContent = `「${imp.name}」已加入 ${saved} 首，待确认 ${data.rows.length} 首，跳过 ${counts.skipped || 0} 首`;
+    }
+    csvImportReviewRows = Object.fromEntries(data.rows.map((row) => [row.id, row]));
+    if (!listEl) return;
+    if (data.rows.length === 0) {
+      listEl.innerHTML = `<div class="download-records-empty"><div><i class="fa-solid fa-check"></i><br>${imp.status === "matching" ? "匹配中，请稍候" : "没有待确认的歌曲"}</div></div>`;
+      return;
+    }
+    let html = `<table class="download-records-table">
+      <thead><tr><th>#</th><th>CSV 中的歌曲</th><th>候选</th><th>操作</th></tr></thead><tbody>`;
+    for (const row of data.rows) {
+      const original = `${row.track}${row.artist ? ` - ${row.artist}` : ""}`;
+      const options = row.candidates
+        .map((candidate, i) => `<option value="${i}">${escapeHtml(csvImportSongLabel(candidate.song, candidate.score))}</option>`)
+        .join("");
+      html += `<tr>
+        <td>${row.position}</td>
+        <td><span class="download-record-name">${escapeHtml(original)}</span>${row.album ? `<div class="download-record-time">${escapeHtml(row.album)}</div>` : ""}</td>
+        <td>${options ? `<select id="csv-import-choice-${row.id}">${options}</select>` : '<span class="download-record-time">未找到</span>'}</td>
+        <td><div class="utility-modal-actions">
+          ${options ? `<button type="button" class="btn-pill btn-pill-primary" onclick="confirmCSVImportRow(${row.id})">确认</button>` : ""}
+          <button type="button" class="btn-pill" onclick="searchCSVImportRow(${row.id})">重新搜索</button>
+          <button type="button" class="btn-pill" onclick="csvImportRowAction(${row.id}, 'skip')">跳过</button>
+        </div></td>
+      </tr>`;
+    }
+    listEl.innerHTML = `${html}</tbody></table>`;
+  } catch (error) {
+    if (statusEl) statusEl.textContent = `加载失败：${error.message}`;
+  }
+}
+
+async function csvImportRowAction(rowId, action, body = {}) {
+  try {
+    await csvImportRequest(`/rows/${rowId}/${action}`, { method: "POST", body: JSON.stringify(body) });
+    await loadCSVImportReview();
+  } catch (error) {
+    showToast("操作失败", error.message || "请稍后重试", "error");
+  }
+}
+
+function confirmCSVImportRow(rowId) {
+  const select = document.getElementById(`csv-import-choice-${rowId}`);
+  const candidate = select ? Number(select.value) : 0;
+  csvImportRowAction(rowId, "confirm", { candidate });
+}
+
+function searchCSVImportRow(rowId) {
+  const row = csvImportReviewRows[rowId] || {};
+  const keyword = prompt("搜索关键词", [row.track, row.artist].filter(Boolean).join(" "));
+  if (keyword === null) return;
+  csvImportRowAction(rowId, "search", { keyword: keyword.trim() });
+}
+
+// importCollectionsFile 导入 JSON / CSV 歌单文件，同名歌单按选择的方式处理；
+// M3U / XSPF / PLS 文件交给 importPlaylistFile。
+function importCollectionsFile() {
+  const input = document.createElement("input");
+  input.type = "file";
+  input.accept = ".json,.csv,.m3u,.m3u8,.xspf,.pls,application/json,text/csv";
+  input.addEventListener("change", async () => {
+    const file = input.files && input.files[0];
+    if (!file) return;
+    if (/\.(m3u8?|xspf|pls)$/i.test(file.name)) {
+      importPlaylistFile(file);
+      return;
+    }
+    // 本程序导出的 CSV 带 song_id 列，其余 CSV 按第三方歌单在线匹配。
+    if (/\.csv$/i.test(file.name)) {
+      const head = await file.slice(0, 4096).text();
+      if (!/(^|,)"?song_id"?(,|\r?\n)/.test(head)) {
+        importThirdPartyCSV(file);
+        return;
+      }
+    }
+    const choice = prompt(
+      "遇到同名歌单时：merge 合并（默认）、rename 另存为新歌单、skip 跳过、replace 覆盖",
+      "merge",
+    );
+    if (choice === null) return;
+    const form = new FormData();
+    form.append("file", file);
+    try {
+      const response = await fetch(
+        `${API_ROOT}/collections/import_exported?conflict=${encodeURIComponent(choice.trim())}`,
+        { method: "POST", headers: { Accept: "application/json" }, body: form },
+      );
+      const data = await response.json().catch(() => null);
+      if (!response.ok || !data || data.error) {
+        throw new Error((data && data.error) || "导入失败");
+      }
+      const actions = { created: "新建", merged: "合并", renamed: "另存", replaced: "覆盖", skipped: "跳过", existing: "已存在" };
+      const lines = data.collections.map((item) => {
+        let line = `${item.name}：${actions[item.action] || item.action}，新增 ${item.added} 首`;
+        if (item.duplicate > 0) line += `，重复 ${item.duplicate}`;
+        if (item.resolved > 0) line += `，换源 ${item.resolved}`;
+        if (item.unresolved.length > 0) line += `，${item.unresolved.length} 首暂不可用`;
+        return line;
+      });
+      showToast("歌单导入完成", lines.join("\n") || "文件中没有歌单", "success", 0);
+      openCollectionManager();
+    } catch (error) {
+      showToast("歌单导入失败", error.message || "请稍后重试", "error");
+    }
+  });
+  input.click();
+}
+
 async function batchDownload() {
   // 关闭旧面板，准备新任务
   closeDownloadPanel();
@@ -5989,6 +6932,7 @@ async function batchDownload() {
       updateDownloadPanelItem(i, "loading");
       try {
         const result = await requestLocalDownload(song.url);
+        song.savedPath = (result && result.path) || "";
         // 判断是否跳过
         if (result && result.skipped) {
           updateDownloadPanelItem(i, "skipped");
@@ -6020,6 +6964,7 @@ async function batchDownload() {
       message += `\n\n共 ${warningCount} 首触发了降级提示，请查看终端日志`;
     }
     message += buildBatchFailureMessage(failures, "失败");
+    message += await writeBatchPlaylistFiles(selectedSongs);
 
     showToast(
       failures.length > 0 ? "下载部分完成" : "下载完成",
@@ -6072,12 +7017,12 @@ function confirmLocalMusicDeletion(songs) {
       : `${items.length} 首本地音乐`;
   if (
     !confirm(
-      `准备删除 ${scope}。\n删除后文件会从本地下载目录移除，且不可恢复。\n\n${names}${more}`,
+      `准备删除 ${scope}。\n文件会移到音乐目录下的 .trash 文件夹，保留期内可在回收站还原。\n\n${names}${more}`,
     )
   ) {
     return false;
   }
-  return confirm(`再次确认：确定永久删除 ${scope} 吗？`);
+  return true;
 }
 
 function stopDeletedLocalMusicPlayback(deletedIds) {
@@ -6671,11 +7616,21 @@ function openLocalMusicPage() {
   navigateTo(API_ROOT + "/local_music_page");
 }
 
-function showEditCollectionModal(id = "", name = "", desc = "", cover = "") {
-  document.getElementById("editColTitle").textContent = id
-    ? "编辑歌单"
-    : "新建歌单";
+function showEditCollectionModal(
+  id = "",
+  name = "",
+  desc = "",
+  cover = "",
+  smartRules = null,
+) {
+  const smart = !!smartRules;
+  document.getElementById("editColTitle").textContent =
+    (id ? "编辑" : "新建") + (smart ? "智能歌单" : "歌单");
   document.getElementById("editColId").value = id;
+  const smartSection = document.getElementById("editColSmartSection");
+  smartSection.style.display = smart ? "block" : "none";
+  smartSection.dataset.active = smart ? "1" : "";
+  if (smart) fillSmartCollectionRules(smartRules);
   document.getElementById("editColName").value = name;
   document.getElementById("editColDesc").value = desc;
 
@@ -6690,14 +7645,61 @@ function showEditCollectionModal(id = "", name = "", desc = "", cover = "") {
 
 function showEditCollectionModalFromButton(btn) {
   if (!btn) return;
+  let smartRules = null;
+  if (btn.dataset.kind === "smart") {
+    try {
+      smartRules = JSON.parse(btn.dataset.rules || "{}") || {};
+    } catch (_) {
+      smartRules = {};
+    }
+  }
   showEditCollectionModal(
     btn.dataset.id || "",
     btn.dataset.name || "",
     btn.dataset.description || "",
     btn.dataset.cover || "",
+    smartRules,
   );
 }
 
+function showSmartCollectionModal() {
+  showEditCollectionModal("", "", "", "", {});
+}
+
+function fillSmartCollectionRules(rules) {
+  document.getElementById("editColSmartRules").value = (rules.rules || [])
+    .map((rule) => [rule.field, rule.op, rule.value].filter(Boolean).join(" "))
+    .join("\n");
+  document.getElementById("editColSmartMatch").value = rules.match || "all";
+  document.getElementById("editColSmartScope").value = rules.scope || "all";
+  document.getElementById("editColSmartSort").value = rules.sort || "added_at";
+  document.getElementById("editColSmartOrder").value =
+    rules.order || (rules.sort ? "asc" : "desc");
+  document.getElementById("editColSmartLimit").value = rules.limit || 0;
+}
+
+// readSmartCollectionRules turns "field op value" lines into the rule set
+// the server expects; the server validates fields and conditions.
+function readSmartCollectionRules() {
+  const rules = document
+    .getElementById("editColSmartRules")
+    .value.split("\n")
+    .map((line) => line.trim())
+    .filter(Boolean)
+    .map((line) => {
+      const [field, op, ...value] = line.split(/\s+/);
+      return { field, op: op || "", value: value.join(" ") };
+    });
+  return {
+    match: document.getElementById("editColSmartMatch").value,
+    scope: document.getElementById("editColSmartScope").value,
+    rules,
+    sort: document.getElementById("editColSmartSort").value,
+    order: document.getElementById("editColSmartOrder").value,
+    limit: parsePositiveInt(document.getElementById("editColSmartLimit").value, 0),
+  };
+}
+
 function saveCollection() {
   const id = document.getElementById("editColId").value;
   const name = document.getElementById("editColName").value.trim();
@@ -6709,6 +7711,10 @@ function saveCollection() {
   const payload = { name, description: desc, cover };
   const isAddingSongModalOpen =
     document.getElementById("addToCollectionModal").style.display === "flex";
+  if (document.getElementById("editColSmartSection").dataset.active) {
+    saveSmartCollection(id, payload);
+    return;
+  }
 
   const url = id ? `${API_ROOT}/collections/${id}` : `${API_ROOT}/collections`;
   const method = id ? "PUT" : "POST";
@@ -6732,6 +7738,32 @@ function saveCollection() {
     });
 }
 
+async function saveSmartCollection(id, payload) {
+  const rules = readSmartCollectionRules();
+  const send = async (url, method, body) => {
+    const res = await fetch(url, {
+      method,
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+    }).then((r) => r.json());
+    if (res.error) throw new Error(res.error);
+    return res;
+  };
+  try {
+    if (id) {
+      await send(`${API_ROOT}/collections/${id}/rules`, "PUT", rules);
+      await send(`${API_ROOT}/collections/${id}`, "PUT", payload);
+    } else {
+      await send(`${API_ROOT}/collections/smart`, "POST", { ...payload, rules });
+    }
+  } catch (error) {
+    alert(error.message || "保存智能歌单失败");
+    return;
+  }
+  document.getElementById("editCollectionModal").style.display = "none";
+  refreshCurrentPageContent();
+}
+
 function setImportCollectionButtonState(btn, imported) {
   if (!btn) return;
 
@@ -6797,7 +7829,7 @@ function importCollectionFromButton(btn) {
 }
 
 function deleteCollection(id) {
-  if (!confirm("确定删除此歌单吗？内部歌曲记录也将被清空。")) return;
+  if (!confirm("确定删除此歌单吗？歌单和歌曲会移入回收站，保留期内可还原。")) return;
   fetch(`${API_ROOT}/collections/${id}`, { method: "DELETE" })
     .then((r) => r.json())
     .then((res) => {
@@ -6807,7 +7839,7 @@ function deleteCollection(id) {
 }
 
 function deleteCollectionFromModal(id) {
-  if (!confirm("确定删除此歌单吗？内部歌曲记录也将被清空。")) return;
+  if (!confirm("确定删除此歌单吗？歌单和歌曲会移入回收站，保留期内可还原。")) return;
   fetch(`${API_ROOT}/collections/${id}`, { method: "DELETE" })
     .then((r) => r.json())
     .then((res) => {
@@ -6933,6 +7965,85 @@ function addSongToCollection(colId) {
     });
 }
 
+const COLLECTION_SORT_KEYS = {
+  1: { by: "name", label: "歌名" },
+  2: { by: "artist", label: "歌手" },
+  3: { by: "duration", label: "时长" },
+  4: { by: "added_at", label: "添加时间" },
+};
+
+function collectionOrderRequest(colId, path, method, body) {
+  return fetch(`${API_ROOT}/collections/${colId}/songs/${path}`, {
+    method,
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  })
+    .then((r) => r.json())
+    .then((res) => {
+      if (res.error) return alert(res.error);
+      refreshCurrentPageContent();
+    })
+    .catch(() => alert("调整顺序失败"));
+}
+
+function sortCollectionSongs(colId) {
+  const options = Object.entries(COLLECTION_SORT_KEYS)
+    .map(([key, item]) => `${key}. ${item.label}`)
+    .join("\n");
+  const choice = prompt(`按什么排序？（在数字后加 - 表示倒序，如 4-）\n${options}`, "1");
+  if (choice === null) return;
+  const value = choice.trim();
+  const key = COLLECTION_SORT_KEYS[value.replace(/-$/, "")];
+  if (!key) return alert("请输入列表中的数字");
+  collectionOrderRequest(colId, "sort", "POST", {
+    by: key.by,
+    order: value.endsWith("-") ? "desc" : "asc",
+  });
+}
+
+function moveCollectionSong(colId, songId, source) {
+  const input = prompt("移动到第几首？", "1");
+  if (input === null) return;
+  const position = parseInt(input, 10);
+  if (!(position >= 1)) return alert("请输入从 1 开始的位置");
+  collectionOrderRequest(colId, "move", "POST", { id: songId, source, position });
+}
+
+async function checkCollectionHealth(colId) {
+  try {
+    await collectionSubscriptionRequest(colId, "health/check", { method: "POST" });
+    showToast("正在检查可播放性", "检查在后台进行，完成后会提示结果", "info", 3000);
+    let status;
+    do {
+      await new Promise((resolve) => setTimeout(resolve, 1500));
+      status = await collectionSubscriptionRequest(colId, "health");
+    } while (status.running);
+    const counts = status.counts || {};
+    let message = `可播放 ${counts.ok || 0} 首，失效 ${counts.dead || 0} 首`;
+    if (counts.unknown > 0) message += `，无法检测 ${counts.unknown} 首`;
+    showToast("可播放性检查完成", message, counts.dead > 0 ? "error" : "success", 0);
+    refreshCurrentPageContent();
+  } catch (error) {
+    showToast("可播放性检查失败", error.message || "请稍后重试", "error");
+  }
+}
+
+async function repairCollectionHealth(colId) {
+  if (!confirm("将失效歌曲替换为其他平台的最佳匹配，原歌曲会保留在修复记录中。继续吗？")) return;
+  showToast("正在修复失效歌曲", "正在为失效歌曲查找可播放的替代版本", "info", 3000);
+  try {
+    const result = await collectionSubscriptionRequest(colId, "health/repair", { method: "POST" });
+    let message = `已修复 ${result.repaired} 首`;
+    if (result.unresolved.length > 0) {
+      message += `，${result.unresolved.length} 首未找到替代：\n${result.unresolved.join("\n")}`;
+    }
+    showToast("失效歌曲修复完成", message, result.unresolved.length > 0 ? "info" : "success", 0);
+    refreshCurrentPageContent();
+  } catch (error) {
+    showToast("修复失效歌曲失败", error.message || "请稍后重试", "error");
+  }
+}
+
 function removeSongFromCollection(btn, colId, originalSongId, originalSource) {
   if (!confirm("确定将此歌曲移出当前歌单吗？")) return;
   fetch(
@@ -123,7 +123,7 @@
         function looksLikeRomajiLineWorker(line) {
             const text = String(line?.text || '').trim();
             if (!text) return false;
-            const latinCount = (text.match(/[A-Za-z]/g) || []).length;
+            const latinCount = (text.match(/[A-Za-z\u00c0-\u024f]/g) || []).length;
             const cjkOrKanaCount = (text.match(/[\u3040-\u30ff\u3400-\u9fff]/g) || []).length;
             return latinCount > 0 && latinCount >= cjkOrKanaCount;
         }
@@ -1169,6 +1169,7 @@
         this.updateVisuals(songData.cover || "https://via.placeholder.com/600", false);
         document.getElementById("vg-title").textContent = songData.name;
         document.getElementById("vg-artist").textContent = songData.artist;
+        this.applySongOverride(songData);
 
         if (window.ap && window.ap.audio) {
             this.isPlaying = (window.currentPlayingId === songData.id) && !window.ap.audio.paused;
@@ -1240,6 +1241,22 @@
         });
       },
 
+      // 用户在服务端保存的歌曲覆盖信息（歌名 / 歌手 / 封面）优先于卡片数据
+      applySongOverride: function (songData) {
+        if (!songData?.source || !songData?.id || songData.source === 'local') return;
+        const params = new URLSearchParams({ source: String(songData.source), id: String(songData.id) });
+        fetch(`${window.API_ROOT}/api/song_override?${params.toString()}`)
+            .then(r => r.ok ? r.json() : null)
+            .then(override => {
+                if (!override || this.data !== songData) return;
+                if (override.name) { songData.name = override.name; document.getElementById("vg-title").textContent = override.name; }
+                if (override.artist) { songData.artist = override.artist; document.getElementById("vg-artist").textContent = override.artist; }
+                if (override.album) songData.album = override.album;
+                if (override.cover && !this.customVisual) { songData.cover = override.cover; this.updateVisuals(override.cover, false); }
+            })
+            .catch(() => {});
+      },
+
       close: function () {
         this.stopRealtimeVisualizer();
         this.stopLyricsLoop();
@@ -0,0 +1,554 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guohuiyuan/go-music-dl/core"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// 回收站：删除的歌单与本地音乐
+// ==========================================
+
+const (
+	trashKindCollection = "collection"
+	trashKindLocalMusic = "local_music"
+
+	// localMusicTrashDir sits inside each library root. The scan skips dot
+	// directories, so trashed files drop out of the library.
+	localMusicTrashDir = ".trash"
+)
+
+var (
+	trashNow = time.Now
+
+	errTrashRestoreConflict = errors.New("原位置已有同名文件")
+	errTrashItemGone        = errors.New("回收站中没有该项目")
+)
+
+// TrashItem is a deleted collection or local music file kept until it is
+// restored, purged, or older than the configured retention.
+type TrashItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Kind      string    `gorm:"index;not null" json:"kind"`
+	Name      string    `json:"name"`
+	Detail    string    `json:"detail"`
+	Payload   string    `gorm:"type:text" json:"-"`
+	TrashedAt time.Time `gorm:"index" json:"trashed_at"`
+}
+
+// trashedCollection is the payload of a collection item. Rules and songs are
+// listed separately because Collection hides them from JSON. The
+// subscription, CSV imports and repair history come back on restore too.
+type trashedCollection struct {
+	Collection    Collection              `json:"collection"`
+	Rules         string                  `json:"rules"`
+	Songs         []SavedSong             `json:"songs"`
+	Subscription  *CollectionSubscription `json:"subscription,omitempty"`
+	Snapshots     []trashedSnapshot       `json:"snapshots,omitempty"`
+	CSVImports    []CSVImport             `json:"csv_imports,omitempty"`
+	CSVImportRows []CSVImportRow          `json:"csv_import_rows,omitempty"`
+	History       []SavedSongHistory      `json:"history,omitempty"`
+}
+
+// trashedSnapshot carries the track lists CollectionSnapshot hides from JSON.
+type trashedSnapshot struct {
+	CollectionSnapshot
+	Tracks string `json:"tracks"`
+	Diff   string `json:"diff"`
+}
+
+// trashedLocalMusic is the payload of a local music item: the index row with
+// the user's annotations and every file moved into the trash directory.
+type trashedLocalMusic struct {
+	Index    LocalMusicIndex `json:"index"`
+	TrashDir string          `json:"trash_dir"`
+	Files    []trashedFile   `json:"files"`
+}
+
+type trashedFile struct {
+	Original string `json:"original"`
+	Trashed  string `json:"trashed"`
+}
+
+func createTrashItem(tx *gorm.DB, kind, name, detail string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&TrashItem{Kind: kind, Name: name, Detail: detail, Payload: string(data), TrashedAt: trashNow()}).Error
+}
+
+// claimTrashItem deletes an item inside its restore transaction. It fails when
+// the item is already gone, so a concurrent restore of the same item rolls back.
+func claimTrashItem(tx *gorm.DB, itemID uint) error {
+	result := tx.Delete(&TrashItem{}, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errTrashItemGone
+	}
+	return nil
+}
+
+// trashCollection moves a collection, its saved songs and the records kept
+// about it into the recycle bin.
+func trashCollection(collectionID uint) error {
+	collection, err := loadCollection(strconv.FormatUint(uint64(collectionID), 10))
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		payload, err := loadTrashedCollection(tx, collection)
+		if err != nil {
+			return err
+		}
+		detail := fmt.Sprintf("%d 首", len(payload.Songs))
+		switch {
+		case collection.isImported():
+			detail = "导入的歌单"
+		case collection.isSmart():
+			detail = "智能歌单"
+		}
+		if err := createTrashItem(tx, trashKindCollection, collection.Name, detail, payload); err != nil {
+			return err
+		}
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&SavedSong{}).Error; err != nil {
+			return err
+		}
+		if err := deleteCollectionSubscription(tx, collection.ID); err != nil {
+			return err
+		}
+		if err := deleteCollectionCSVImports(tx, collection.ID); err != nil {
+			return err
+		}
+		if err := deleteCollectionSongHistory(tx, collection.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&Collection{}, collection.ID).Error
+	})
+}
+
+func loadTrashedCollection(tx *gorm.DB, collection *Collection) (*trashedCollection, error) {
+	payload := &trashedCollection{Collection: *collection, Rules: collection.Rules}
+	if err := tx.Where("collection_id = ?", collection.ID).Order("id").Find(&payload.Songs).Error; err != nil {
+		return nil, err
+	}
+	var sub CollectionSubscription
+	result := tx.Where("collection_id = ?", collection.ID).Limit(1).Find(&sub)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		payload.Subscription = &sub
+	}
+	var snapshots []CollectionSnapshot
+	if err := tx.Where("collection_id = ?", collection.ID).Order("id").Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		payload.Snapshots = append(payload.Snapshots, trashedSnapshot{CollectionSnapshot: snapshot, Tracks: snapshot.Tracks, Diff: snapshot.Diff})
+	}
+	if err := tx.Where("collection_id = ?", collection.ID).Order("id").Find(&payload.CSVImports).Error; err != nil {
+		return nil, err
+	}
+	if len(payload.CSVImports) > 0 {
+		ids := make([]uint, 0, len(payload.CSVImports))
+		for _, imp := range payload.CSVImports {
+			ids = append(ids, imp.ID)
+		}
+		if err := tx.Where("import_id IN ?", ids).Order("id").Find(&payload.CSVImportRows).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Where("collection_id = ?", collection.ID).Order("id").Find(&payload.History).Error; err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// restoreTrashedCollection recreates the collection, under its old ID when
+// that is still free, with its songs in their saved order and the records
+// kept about it. The trash item is removed in the same transaction.
+func restoreTrashedCollection(itemID uint, payload trashedCollection) (uint, error) {
+	collection := payload.Collection
+	collection.Rules = payload.Rules
+	collection.SavedSongs = nil
+	var resume []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := claimTrashItem(tx, itemID); err != nil {
+			return err
+		}
+		var taken int64
+		if err := tx.Model(&Collection{}).Where("id = ?", collection.ID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			collection.ID = 0
+		}
+		if err := tx.Create(&collection).Error; err != nil {
+			return err
+		}
+		songs := payload.Songs
+		sort.SliceStable(songs, func(i, j int) bool { return songs[i].ID < songs[j].ID })
+		oldIDs := make([]uint, len(songs))
+		for i := range songs {
+			oldIDs[i] = songs[i].ID
+			songs[i].ID = 0
+			songs[i].CollectionID = collection.ID
+		}
+		if len(songs) > 0 {
+			// Positions are restored as saved, so the BeforeCreate default is skipped.
+			if err := tx.Session(&gorm.Session{SkipHooks: true}).CreateInBatches(&songs, 200).Error; err != nil {
+				return err
+			}
+		}
+		songIDs := make(map[uint]uint, len(songs))
+		for i := range songs {
+			songIDs[oldIDs[i]] = songs[i].ID
+		}
+		var err error
+		resume, err = restoreTrashedCollectionRecords(tx, payload, collection.ID, songIDs)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range resume {
+		go runCSVImport(id)
+	}
+	return collection.ID, nil
+}
+
+// restoreTrashedCollectionRecords recreates the subscription, snapshots, CSV
+// imports and repair history of a restored collection under new IDs, and
+// returns the CSV imports that were still matching.
+func restoreTrashedCollectionRecords(tx *gorm.DB, payload trashedCollection, collectionID uint, songIDs map[uint]uint) ([]uint, error) {
+	if sub := payload.Subscription; sub != nil {
+		sub.CollectionID = collectionID
+		if err := tx.Create(sub).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range payload.Snapshots {
+		snapshot := item.CollectionSnapshot
+		snapshot.ID, snapshot.CollectionID = 0, collectionID
+		snapshot.Tracks, snapshot.Diff = item.Tracks, item.Diff
+		if err := tx.Create(&snapshot).Error; err != nil {
+			return nil, err
+		}
+	}
+	importIDs := make(map[uint]uint, len(payload.CSVImports))
+	var resume []uint
+	for _, imp := range payload.CSVImports {
+		oldID := imp.ID
+		imp.ID, imp.CollectionID = 0, collectionID
+		if err := tx.Create(&imp).Error; err != nil {
+			return nil, err
+		}
+		importIDs[oldID] = imp.ID
+		if imp.Status == csvImportMatching {
+			resume = append(resume, imp.ID)
+		}
+	}
+	rows := payload.CSVImportRows
+	for i := range rows {
+		rows[i].ID, rows[i].ImportID = 0, importIDs[rows[i].ImportID]
+	}
+	if len(rows) > 0 {
+		if err := tx.CreateInBatches(&rows, 200).Error; err != nil {
+			return nil, err
+		}
+	}
+	history := payload.History
+	for i := range history {
+		history[i].ID, history[i].CollectionID = 0, collectionID
+		history[i].SavedSongID = songIDs[history[i].SavedSongID]
+	}
+	if len(history) > 0 {
+		if err := tx.CreateInBatches(&history, 200).Error; err != nil {
+			return nil, err
+		}
+	}
+	return resume, nil
+}
+
+// trashLocalMusicTrack moves a track and its same-named cover and lyric files
+// to .trash/<timestamp>/ inside its library root, keeping the relative path.
+func trashLocalMusicTrack(track *localMusicTrack) error {
+	rootAbs, inner := localMusicResolveRel(track.RelPath)
+	trashDir := filepath.Join(rootAbs, localMusicTrashDir, strconv.FormatInt(trashNow().UnixNano(), 10))
+	target := filepath.Join(trashDir, filepath.FromSlash(inner))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	sources := []string{track.absPath}
+	for _, exts := range [][]string{localMusicCoverExts, localMusicLyricExts} {
+		for _, ext := range exts {
+			candidate := trimAudioExt(track.absPath) + ext
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				sources = append(sources, candidate)
+			}
+		}
+	}
+	files := make([]trashedFile, 0, len(sources))
+	for _, source := range sources {
+		trashed := trimAudioExt(target) + filepath.Ext(source)
+		if source == track.absPath {
+			trashed = target
+		}
+		if err := os.Rename(source, trashed); err != nil {
+			restoreTrashedFiles(files)
+			return err
+		}
+		files = append(files, trashedFile{Original: source, Trashed: trashed})
+	}
+
+	payload := trashedLocalMusic{TrashDir: trashDir, Files: files}
+	if db != nil {
+		if err := db.Where("id = ?", track.ID).Limit(1).Find(&payload.Index).Error; err != nil {
+			restoreTrashedFiles(files)
+			return err
+		}
+	}
+	if payload.Index.ID == "" {
+		payload.Index = localMusicTrackToIndexRow(track, trashNow())
+	}
+	if err := createTrashItem(db, trashKindLocalMusic, playlistSongLabel(track.Name, track.Artist), track.RelPath, payload); err != nil {
+		restoreTrashedFiles(files)
+		return err
+	}
+	return nil
+}
+
+func trimAudioExt(path string) string {
+	return path[:len(path)-len(filepath.Ext(path))]
+}
+
+func restoreTrashedFiles(files []trashedFile) {
+	for _, file := range files {
+		_ = os.Rename(file.Trashed, file.Original)
+	}
+}
+
+// restoreTrashedLocalMusic moves the files back and saves the index row with
+// its annotations, removing the trash item in the same transaction.
+func restoreTrashedLocalMusic(itemID uint, payload trashedLocalMusic) error {
+	for _, file := range payload.Files {
+		if _, err := os.Stat(file.Original); err == nil {
+			return errTrashRestoreConflict
+		}
+	}
+	moved := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := claimTrashItem(tx, itemID); err != nil {
+			return err
+		}
+		if payload.Index.ID != "" {
+			if err := tx.Save(&payload.Index).Error; err != nil {
+				return err
+			}
+		}
+		for _, file := range payload.Files {
+			if err := os.MkdirAll(filepath.Dir(file.Original), 0o755); err != nil {
+				return err
+			}
+			if err := os.Rename(file.Trashed, file.Original); err != nil {
+				return err
+			}
+			moved++
+		}
+		return nil
+	})
+	if err != nil {
+		// Put back what was already restored so the item stays whole.
+		for _, done := range payload.Files[:moved] {
+			_ = os.Rename(done.Original, done.Trashed)
+		}
+		return err
+	}
+	removeEmptyTrashDirs(payload)
+	invalidateLocalMusicScanCache()
+	return nil
+}
+
+// removeEmptyTrashDirs removes the directories of an item's trashed files
+// once they are empty, up to and including its batch directory.
+func removeEmptyTrashDirs(payload trashedLocalMusic) {
+	for _, file := range payload.Files {
+		for dir := filepath.Dir(file.Trashed); isPathInside(payload.TrashDir, dir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil || dir == payload.TrashDir {
+				break
+			}
+		}
+	}
+}
+
+// restoreTrashItem puts an item back and removes it from the recycle bin.
+func restoreTrashItem(item TrashItem) (gin.H, error) {
+	resp := gin.H{"status": "ok", "kind": item.Kind}
+	switch item.Kind {
+	case trashKindCollection:
+		var payload trashedCollection
+		if err := json.Unmarshal([]byte(item.Payload), &payload); err != nil {
+			return nil, err
+		}
+		id, err := restoreTrashedCollection(item.ID, payload)
+		if err != nil {
+			return nil, err
+		}
+		resp["collection_id"] = id
+	case trashKindLocalMusic:
+		var payload trashedLocalMusic
+		if err := json.Unmarshal([]byte(item.Payload), &payload); err != nil {
+			return nil, err
+		}
+		if err := restoreTrashedLocalMusic(item.ID, payload); err != nil {
+			return nil, err
+		}
+		resp["id"] = payload.Index.ID
+	default:
+		return nil, fmt.Errorf("unknown trash kind %q", item.Kind)
+	}
+	return resp, nil
+}
+
+// purgeTrashItem deletes an item for good, including its trashed files.
+func purgeTrashItem(item TrashItem) error {
+	if item.Kind == trashKindLocalMusic {
+		var payload trashedLocalMusic
+		if err := json.Unmarshal([]byte(item.Payload), &payload); err != nil {
+			return err
+		}
+		for _, file := range payload.Files {
+			if err := os.Remove(file.Trashed); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		removeEmptyTrashDirs(payload)
+	}
+	return db.Delete(&TrashItem{}, item.ID).Error
+}
+
+// purgeExpiredTrash purges items older than the retention setting and
+// returns how many were removed. Items that fail are kept and reported once.
+func purgeExpiredTrash(now time.Time) (int, error) {
+	retention := time.Duration(core.GetWebSettings().TrashRetentionDays) * 24 * time.Hour
+	var items []TrashItem
+	if err := db.Where("trashed_at < ?", now.Add(-retention)).Find(&items).Error; err != nil {
+		return 0, err
+	}
+	purged, failed := 0, 0
+	var firstErr error
+	for _, item := range items {
+		if err := purgeTrashItem(item); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged++
+	}
+	if firstErr != nil {
+		return purged, fmt.Errorf("%d 个项目彻底删除失败: %w", failed, firstErr)
+	}
+	return purged, nil
+}
+
+func loadTrashItem(c *gin.Context) (TrashItem, bool) {
+	var item TrashItem
+	if err := db.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该项目"})
+		return item, false
+	}
+	return item, true
+}
+
+// RegisterTrashRoutes exposes the recycle bin: GET /api/trash lists items
+// (newest first, optional kind), POST /api/trash/:id/restore puts one back,
+// DELETE /api/trash/:id purges one and DELETE /api/trash empties the bin.
+// Purging deletes files for good, so it needs the config login.
+func RegisterTrashRoutes(api, configAPI *gin.RouterGroup) {
+	api.GET("/api/trash", func(c *gin.Context) {
+		query := db.Order("trashed_at DESC, id DESC")
+		if kind := c.Query("kind"); kind != "" {
+			query = query.Where("kind = ?", kind)
+		}
+		var items []TrashItem
+		if err := query.Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		retention := core.GetWebSettings().TrashRetentionDays
+		resp := make([]gin.H, 0, len(items))
+		for _, item := range items {
+			resp = append(resp, gin.H{
+				"id": item.ID, "kind": item.Kind, "name": item.Name, "detail": item.Detail,
+				"trashed_at": item.TrashedAt, "purge_at": item.TrashedAt.AddDate(0, 0, retention),
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"items": resp, "retention_days": retention})
+	})
+
+	api.POST("/api/trash/:id/restore", func(c *gin.Context) {
+		item, ok := loadTrashItem(c)
+		if !ok {
+			return
+		}
+		resp, err := restoreTrashItem(item)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, errTrashRestoreConflict):
+				status = http.StatusConflict
+			case errors.Is(err, errTrashItemGone):
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": "还原失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	configAPI.DELETE("/api/trash/:id", func(c *gin.Context) {
+		item, ok := loadTrashItem(c)
+		if !ok {
+			return
+		}
+		if err := purgeTrashItem(item); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "彻底删除失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	configAPI.DELETE("/api/trash", func(c *gin.Context) {
+		var items []TrashItem
+		if err := db.Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		purged := 0
+		for _, item := range items {
+			if err := purgeTrashItem(item); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "清空回收站失败: " + err.Error(), "purged": purged})
+				return
+			}
+			purged++
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "purged": purged})
+	})
+}
@@ -0,0 +1,334 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTrashTestRouter() *gin.Engine {
+	router := newCollectionTestRouter()
+	group := router.Group(RoutePrefix)
+	RegisterTrashRoutes(group, group)
+	return router
+}
+
+func listTrashItems(t *testing.T, router *gin.Engine) []TrashItem {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RoutePrefix+"/api/trash", nil))
+	var resp struct {
+		Items []TrashItem `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode trash list: %v (%s)", err, rec.Body.String())
+	}
+	return resp.Items
+}
+
+func TestDeletedCollectionGoesToTrashAndRestores(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := seedTransferCollection(t, "通勤", "a", "b", "c")
+	db.Model(&SavedSong{}).Where("song_id = ?", "b").Updates(map[string]any{"position": 0, "rating": 4})
+	before := transferSongIDs(t, collection.ID)
+	var songB SavedSong
+	db.Where("collection_id = ? AND song_id = ?", collection.ID, "b").First(&songB)
+	imp := CSVImport{CollectionID: collection.ID, Name: "通勤", Status: csvImportReview}
+	for _, record := range []any{
+		&CollectionSubscription{CollectionID: collection.ID, Enabled: true, IntervalHours: 12},
+		&CollectionSnapshot{CollectionID: collection.ID, Baseline: true, Tracks: `[{"id":"a"}]`},
+		&imp,
+		&SavedSongHistory{CollectionID: collection.ID, SavedSongID: songB.ID, SongID: "old-b", Source: "kugou"},
+	} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create %T: %v", record, err)
+		}
+	}
+	db.Create(&CSVImportRow{ImportID: imp.ID, Position: 1, Track: "Song x", Status: csvRowReview})
+	countRecords := func(colID uint) (counts [4]int64) {
+		db.Model(&CollectionSubscription{}).Where("collection_id = ?", colID).Count(&counts[0])
+		db.Model(&CollectionSnapshot{}).Where("collection_id = ?", colID).Count(&counts[1])
+		db.Model(&CSVImport{}).Where("collection_id = ?", colID).Count(&counts[2])
+		db.Model(&SavedSongHistory{}).Where("collection_id = ?", colID).Count(&counts[3])
+		return counts
+	}
+	router := newTrashTestRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, RoutePrefix+"/collections/"+collectionIDString(collection.ID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete collection status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if _, err := loadCollection(collectionIDString(collection.ID)); err == nil {
+		t.Fatalf("deleted collection is still listed")
+	}
+	var remaining int64
+	db.Model(&SavedSong{}).Where("collection_id = ?", collection.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("deleted collection kept %d songs", remaining)
+	}
+	if counts := countRecords(collection.ID); counts != [4]int64{} {
+		t.Fatalf("deleted collection kept records %v", counts)
+	}
+
+	items := listTrashItems(t, router)
+	if len(items) != 1 || items[0].Kind != trashKindCollection || items[0].Name != "通勤" || items[0].Detail != "3 首" {
+		t.Fatalf("trash items = %+v", items)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, RoutePrefix+"/api/trash/"+collectionIDString(items[0].ID)+"/restore", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	restored, err := loadCollection(collectionIDString(collection.ID))
+	if err != nil || restored.Name != "通勤" {
+		t.Fatalf("restored collection = %+v, %v", restored, err)
+	}
+	if got := transferSongIDs(t, collection.ID); got != before {
+		t.Fatalf("restored songs = %s, want %s", got, before)
+	}
+	var song SavedSong
+	db.Where("collection_id = ? AND song_id = ?", collection.ID, "b").First(&song)
+	if song.Rating != 4 || song.Position != 0 {
+		t.Fatalf("restored song = %+v", song)
+	}
+	if counts := countRecords(collection.ID); counts != [4]int64{1, 1, 1, 1} {
+		t.Fatalf("restored records %v", counts)
+	}
+	var snapshot CollectionSnapshot
+	var history SavedSongHistory
+	var restoredImport CSVImport
+	var rows int64
+	db.Where("collection_id = ?", collection.ID).First(&snapshot)
+	db.Where("collection_id = ?", collection.ID).First(&history)
+	db.Where("collection_id = ?", collection.ID).First(&restoredImport)
+	db.Model(&CSVImportRow{}).Where("import_id = ?", restoredImport.ID).Count(&rows)
+	if snapshot.Tracks != `[{"id":"a"}]` || history.SavedSongID != song.ID || rows != 1 {
+		t.Fatalf("restored snapshot = %+v, history = %+v, csv rows = %d", snapshot, history, rows)
+	}
+	if items := listTrashItems(t, router); len(items) != 0 {
+		t.Fatalf("trash after restore = %+v", items)
+	}
+}
+
+func TestDeletedLocalMusicMovesToTrashAndRestores(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	songPath := filepath.Join(downloadDir, "Album", "Song.mp3")
+	if err := os.MkdirAll(filepath.Dir(songPath), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writePlaylistTestAudio(t, songPath)
+	if err := os.WriteFile(filepath.Join(downloadDir, "Album", "Song.lrc"), []byte("[00:01.00]hi"), 0o644); err != nil {
+		t.Fatalf("write lyric: %v", err)
+	}
+	if err := syncLocalMusicIndex(); err != nil {
+		t.Fatalf("sync local music index: %v", err)
+	}
+	defer waitForLocalMusicScanRefresh(t)
+	id := encodeLocalMusicID("Album/Song.mp3")
+	db.Model(&LocalMusicIndex{}).Where("id = ?", id).Update("rating", 5)
+
+	router := newLocalMusicTestRouter()
+	group := router.Group(RoutePrefix)
+	RegisterTrashRoutes(group, group)
+	deleteTrack := func() {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, RoutePrefix+"/local_music?id="+id, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("delete local music status = %d body=%s", rec.Code, rec.Body.String())
+		}
+	}
+	deleteTrack()
+
+	if _, err := os.Stat(songPath); !os.IsNotExist(err) {
+		t.Fatalf("deleted file still in place: %v", err)
+	}
+	trashed, _ := filepath.Glob(filepath.Join(downloadDir, localMusicTrashDir, "*", "Album", "Song.*"))
+	if len(trashed) != 2 {
+		t.Fatalf("trashed files = %v", trashed)
+	}
+	tracks, _, _, err := scanLocalMusicTracks()
+	if err != nil || len(tracks) != 0 {
+		t.Fatalf("scan after delete = %d tracks, %v", len(tracks), err)
+	}
+
+	items := listTrashItems(t, router)
+	if len(items) != 1 || items[0].Kind != trashKindLocalMusic || items[0].Detail != "Album/Song.mp3" {
+		t.Fatalf("trash items = %+v", items)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, RoutePrefix+"/api/trash/"+collectionIDString(items[0].ID)+"/restore", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{songPath, filepath.Join(downloadDir, "Album", "Song.lrc")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("restored file %s: %v", path, err)
+		}
+	}
+	var row LocalMusicIndex
+	if err := db.Where("id = ?", id).First(&row).Error; err != nil || row.Rating != 5 {
+		t.Fatalf("restored index row = %+v, %v", row, err)
+	}
+	if batches, _ := os.ReadDir(filepath.Join(downloadDir, localMusicTrashDir)); len(batches) != 0 {
+		t.Fatalf("trash directory kept %d batches after restore", len(batches))
+	}
+
+	deleteTrack()
+	items = listTrashItems(t, router)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, RoutePrefix+"/api/trash/"+collectionIDString(items[0].ID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("purge status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if batches, _ := os.ReadDir(filepath.Join(downloadDir, localMusicTrashDir)); len(batches) != 0 {
+		t.Fatalf("trash directory kept %d batches after purge", len(batches))
+	}
+	if items := listTrashItems(t, router); len(items) != 0 {
+		t.Fatalf("trash after purge = %+v", items)
+	}
+}
+
+func TestRestoreLocalMusicRefusesToOverwrite(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	songPath := filepath.Join(downloadDir, "Song.mp3")
+	writePlaylistTestAudio(t, songPath)
+	defer waitForLocalMusicScanRefresh(t)
+
+	if err := deleteLocalMusicTrack(encodeLocalMusicID("Song.mp3")); err != nil {
+		t.Fatalf("deleteLocalMusicTrack() error = %v", err)
+	}
+	writePlaylistTestAudio(t, songPath)
+	var item TrashItem
+	db.First(&item)
+	if _, err := restoreTrashItem(item); err != errTrashRestoreConflict {
+		t.Fatalf("restoreTrashItem() error = %v, want %v", err, errTrashRestoreConflict)
+	}
+	var count int64
+	db.Model(&TrashItem{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("trash items after refused restore = %d", count)
+	}
+}
+
+func TestRestoreLocalMusicKeepsItemWhenIndexSaveFails(t *testing.T) {
+	initCollectionDBForTest(t)
+	downloadDir := t.TempDir()
+	withLocalMusicDownloadDir(t, downloadDir)
+	songPath := filepath.Join(downloadDir, "Song.mp3")
+	writePlaylistTestAudio(t, songPath)
+	defer waitForLocalMusicScanRefresh(t)
+
+	if err := deleteLocalMusicTrack(encodeLocalMusicID("Song.mp3")); err != nil {
+		t.Fatalf("deleteLocalMusicTrack() error = %v", err)
+	}
+	for _, event := range []string{"INSERT", "UPDATE"} {
+		if err := db.Exec("CREATE TRIGGER fail_index_" + event + " BEFORE " + event + " ON local_music_index BEGIN SELECT RAISE(ABORT, 'disk full'); END").Error; err != nil {
+			t.Fatalf("create trigger: %v", err)
+		}
+	}
+	var item TrashItem
+	db.First(&item)
+	if _, err := restoreTrashItem(item); err == nil {
+		t.Fatalf("restoreTrashItem() succeeded without saving the index row")
+	}
+	if _, err := os.Stat(songPath); !os.IsNotExist(err) {
+		t.Fatalf("file restored despite the failed restore: %v", err)
+	}
+	var count int64
+	db.Model(&TrashItem{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("trash items after failed restore = %d", count)
+	}
+}
+
+func TestRestoreTrashItemOnlyOnce(t *testing.T) {
+	initCollectionDBForTest(t)
+	collection := seedTransferCollection(t, "通勤", "a", "b")
+	if err := trashCollection(collection.ID); err != nil {
+		t.Fatalf("trashCollection() error = %v", err)
+	}
+	var item TrashItem
+	db.First(&item)
+	if _, err := restoreTrashItem(item); err != nil {
+		t.Fatalf("restoreTrashItem() error = %v", err)
+	}
+	if _, err := restoreTrashItem(item); err != errTrashItemGone {
+		t.Fatalf("second restoreTrashItem() error = %v, want %v", err, errTrashItemGone)
+	}
+	var count int64
+	db.Model(&Collection{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("collections after two restores = %d", count)
+	}
+}
+
+func TestPurgeTrashItemKeepsUnreadablePayload(t *testing.T) {
+	initCollectionDBForTest(t)
+	item := TrashItem{Kind: trashKindLocalMusic, Name: "broken", Payload: "{", TrashedAt: time.Now()}
+	db.Create(&item)
+	if err := purgeTrashItem(item); err == nil {
+		t.Fatalf("purgeTrashItem() succeeded with an unreadable payload")
+	}
+	var count int64
+	db.Model(&TrashItem{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("trash items after failed purge = %d", count)
+	}
+}
+
+func TestTrashPurgeRoutesRequireConfigAuth(t *testing.T) {
+	initCollectionDBForTest(t)
+	item := TrashItem{Kind: trashKindCollection, Name: "old", Payload: "{}", TrashedAt: time.Now()}
+	db.Create(&item)
+	router := newCollectionTestRouter()
+	api := router.Group(RoutePrefix)
+	configAPI := api.Group("")
+	configAPI.Use(func(c *gin.Context) { c.AbortWithStatus(http.StatusUnauthorized) })
+	RegisterTrashRoutes(api, configAPI)
+
+	for _, path := range []string{"/api/trash/" + collectionIDString(item.ID), "/api/trash"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, RoutePrefix+path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("DELETE %s status = %d, want 401", path, rec.Code)
+		}
+	}
+	if items := listTrashItems(t, router); len(items) != 1 {
+		t.Fatalf("trash items = %+v", items)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	initCollectionDBForTest(t)
+	now := time.Now()
+	for _, item := range []TrashItem{
+		{Kind: trashKindCollection, Name: "old", Payload: "{}", TrashedAt: now.AddDate(0, 0, -31)},
+		{Kind: trashKindCollection, Name: "recent", Payload: "{}", TrashedAt: now.AddDate(0, 0, -29)},
+	} {
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("create trash item: %v", err)
+		}
+	}
+
+	if purged, err := purgeExpiredTrash(now); err != nil || purged != 1 {
+		t.Fatalf("purgeExpiredTrash() = %d, %v, want 1", purged, err)
+	}
+	var left []TrashItem
+	db.Find(&left)
+	if len(left) != 1 || left[0].Name != "recent" {
+		t.Fatalf("trash after purge = %+v", left)
+	}
+}